@@ -1414,7 +1414,7 @@ func (e *Editor) expandKotlinConst(c *vt.Canvas) bool {
 // LettersBeforeCursor returns the current word up until the cursor (for autocompletion)
 func (e *Editor) LettersBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Get(y)
 	if !ok {
 		// This should never happen
 		return ""
@@ -1446,7 +1446,7 @@ func (e *Editor) LettersBeforeCursor() string {
 // Will also include ".".
 func (e *Editor) LettersOrDotBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Get(y)
 	if !ok {
 		// This should never happen
 		return ""
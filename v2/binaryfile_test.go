@@ -19,7 +19,7 @@ func TestBinaryLoadSaveRoundTrip(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name+" (LoadBytes)", func(t *testing.T) {
 			e := &Editor{}
-			e.lines = make(map[int][]rune)
+			e.lines = NewLineBuffer()
 			e.LoadBytes(tc.data)
 			if !e.binaryFile {
 				t.Fatalf("expected binaryFile=true")
@@ -40,7 +40,7 @@ func TestBinaryLoadSaveRoundTrip(t *testing.T) {
 			}
 			tmp.Close()
 			e := &Editor{}
-			e.lines = make(map[int][]rune)
+			e.lines = NewLineBuffer()
 			if err := e.ReadFileAndProcessLines(tmp.Name()); err != nil {
 				t.Fatal(err)
 			}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/vt"
+)
+
+// Breakpoint is a line where the debugger should stop. If Condition is set, the debugger only
+// stops when the condition is true. The first IgnoreCount times the line is reached are skipped.
+type Breakpoint struct {
+	Condition   string
+	Line        LineNumber
+	IgnoreCount int
+}
+
+// String returns a short description of the breakpoint, like "line 12 if i > 3"
+func (bp Breakpoint) String() string {
+	s := "line " + bp.Line.String()
+	if bp.Condition != "" {
+		s += " if " + bp.Condition
+	}
+	if bp.IgnoreCount > 0 {
+		s += fmt.Sprintf(", ignoring the first %d hits", bp.IgnoreCount)
+	}
+	return s
+}
+
+// BreakpointStore has the breakpoints per absolute filename, sorted by line number
+type BreakpointStore map[string][]Breakpoint
+
+var (
+	breakpoints     BreakpointStore // the breakpoints of all files, kept between sessions
+	breakpointsOnce sync.Once
+)
+
+// LoadBreakpoints loads the breakpoints from the given file. The format is, per line,
+// the absolute filename, the line number, the ignore count and the condition, separated by tabs.
+func LoadBreakpoints(path string) (BreakpointStore, error) {
+	bs := make(BreakpointStore)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return bs, err
+	}
+	for line := range strings.SplitSeq(string(contents), "\n") {
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) != 4 || fields[0] == "" {
+			continue
+		}
+		lineNumber, err := strconv.Atoi(fields[1])
+		if err != nil || lineNumber < 1 {
+			continue
+		}
+		ignoreCount, err := strconv.Atoi(fields[2])
+		if err != nil {
+			ignoreCount = 0
+		}
+		bs.Set(fields[0], Breakpoint{Line: LineNumber(lineNumber), IgnoreCount: ignoreCount, Condition: fields[3]})
+	}
+	return bs, nil
+}
+
+// Save saves the breakpoints to the given file
+func (bs BreakpointStore) Save(path string) error {
+	if noWriteToCache {
+		return nil
+	}
+	_ = os.MkdirAll(filepath.Dir(path), 0o755) // best effort
+	filenames := make([]string, 0, len(bs))
+	for filename := range bs {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	var sb strings.Builder
+	for _, filename := range filenames {
+		for _, bp := range bs[filename] {
+			// Tabs and newlines would break the format, and are never needed in a condition
+			condition := strings.Join(strings.Fields(bp.Condition), " ")
+			sb.WriteString(fmt.Sprintf("%s\t%d\t%d\t%s\n", filename, bp.Line, bp.IgnoreCount, condition))
+		}
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0o644)
+}
+
+// Get returns the breakpoints for the given absolute filename
+func (bs BreakpointStore) Get(absFilename string) []Breakpoint {
+	return bs[absFilename]
+}
+
+// Find returns the breakpoint at the given line, if any
+func (bs BreakpointStore) Find(absFilename string, line LineNumber) (Breakpoint, bool) {
+	for _, bp := range bs[absFilename] {
+		if bp.Line == line {
+			return bp, true
+		}
+	}
+	return Breakpoint{}, false
+}
+
+// Set adds a breakpoint, or replaces the breakpoint at the same line
+func (bs BreakpointStore) Set(absFilename string, bp Breakpoint) {
+	list := slices.DeleteFunc(bs[absFilename], func(other Breakpoint) bool {
+		return other.Line == bp.Line
+	})
+	list = append(list, bp)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Line < list[j].Line
+	})
+	bs[absFilename] = list
+}
+
+// Remove removes the breakpoint at the given line. Returns false if there was none.
+func (bs BreakpointStore) Remove(absFilename string, line LineNumber) bool {
+	list := bs[absFilename]
+	n := len(list)
+	list = slices.DeleteFunc(list, func(bp Breakpoint) bool {
+		return bp.Line == line
+	})
+	if len(list) == 0 {
+		delete(bs, absFilename)
+	} else {
+		bs[absFilename] = list
+	}
+	return len(list) < n
+}
+
+// Shift moves the breakpoints at or after the given line by delta lines, when lines are inserted
+// (delta > 0) or deleted (delta < 0). Breakpoints on deleted lines are removed.
+// Returns true if any breakpoint was moved or removed.
+func (bs BreakpointStore) Shift(absFilename string, from LineNumber, delta int) bool {
+	if delta < 0 {
+		return bs.Replace(absFilename, from, -delta, 0)
+	}
+	return bs.Replace(absFilename, from, 0, delta)
+}
+
+// Replace updates the breakpoints when oldCount lines, starting at the given line, are replaced
+// by newCount lines. Breakpoints within the replaced lines stay where they are, if that line is
+// still within the new lines, and are removed otherwise. Breakpoints after the replaced lines are moved.
+// Returns true if any breakpoint was moved or removed.
+func (bs BreakpointStore) Replace(absFilename string, from LineNumber, oldCount, newCount int) bool {
+	list := bs[absFilename]
+	if len(list) == 0 || oldCount == newCount {
+		return false
+	}
+	var (
+		changed = false
+		oldEnd  = from + LineNumber(oldCount)
+		newEnd  = from + LineNumber(newCount)
+		kept    = list[:0]
+	)
+	for _, bp := range list {
+		switch {
+		case bp.Line >= oldEnd:
+			bp.Line += LineNumber(newCount - oldCount)
+			changed = true
+		case bp.Line >= newEnd:
+			changed = true
+			continue // the line of this breakpoint was removed
+		}
+		kept = append(kept, bp)
+	}
+	if len(kept) == 0 {
+		delete(bs, absFilename)
+	} else {
+		bs[absFilename] = kept
+	}
+	return changed
+}
+
+// allBreakpoints returns the breakpoints of all files, loading them the first time
+func allBreakpoints() BreakpointStore {
+	breakpointsOnce.Do(func() {
+		breakpoints, _ = LoadBreakpoints(breakpointsFilename) // an empty store is returned on error
+	})
+	return breakpoints
+}
+
+// breakpointKey returns the absolute filename that breakpoints for the current file are stored under
+func (e *Editor) breakpointKey() string {
+	if absFilename, err := e.AbsFilename(); err == nil {
+		return absFilename
+	}
+	return e.filename
+}
+
+// Breakpoints returns the breakpoints in the current file
+func (e *Editor) Breakpoints() []Breakpoint {
+	return allBreakpoints().Get(e.breakpointKey())
+}
+
+// shiftBreakpoints keeps the breakpoints in the current file on the same lines of code when
+// n lines are inserted (n > 0) or deleted (n < 0) at the given line index.
+// The breakpoints are saved together with the file.
+func (e *Editor) shiftBreakpoints(index LineIndex, n int) {
+	if len(e.Breakpoints()) == 0 {
+		return
+	}
+	allBreakpoints().Shift(e.breakpointKey(), index.LineNumber(), n)
+}
+
+// moveBreakpoints keeps the breakpoints in the current file on the same lines of code when the
+// given lines have been replaced by the current lines, for instance by undo, redo or formatting.
+// Only the lines between the common start and end of the two are considered to have changed.
+func (e *Editor) moveBreakpoints(before *LineBuffer) {
+	if before == nil || len(e.Breakpoints()) == 0 {
+		return
+	}
+	prefix := before.commonPrefix(e.lines)
+	suffix := before.commonSuffix(e.lines, min(before.Len(), e.lines.Len())-prefix)
+	allBreakpoints().Replace(e.breakpointKey(), LineIndex(prefix).LineNumber(), before.Len()-prefix-suffix, e.lines.Len()-prefix-suffix)
+}
+
+// breakpointLines returns the breakpoints in the current file per line index, for drawing them
+func (e *Editor) breakpointLines() map[LineIndex]Breakpoint {
+	list := e.Breakpoints()
+	if len(list) == 0 {
+		return nil
+	}
+	m := make(map[LineIndex]Breakpoint, len(list))
+	for _, bp := range list {
+		m[bp.Line.LineIndex()] = bp
+	}
+	return m
+}
+
+// SetBreakpoint adds or replaces the breakpoint at the given line in the current file, saves all
+// breakpoints and also activates the breakpoint if the program is being debugged
+func (e *Editor) SetBreakpoint(bp Breakpoint) error {
+	key := e.breakpointKey()
+	bs := allBreakpoints()
+	_, replace := bs.Find(key, bp.Line)
+	bs.Set(key, bp)
+	if err := bs.Save(breakpointsFilename); err != nil {
+		return err
+	}
+	if e.debugger == nil || !e.debugger.ProgramRunning() {
+		return nil // the breakpoint is activated when the debug session is started
+	}
+	sourceBaseFilename := filepath.Base(e.filename)
+	if replace {
+		if err := e.debugger.DeleteBreakpoint(sourceBaseFilename, int(bp.Line)); err != nil {
+			return err
+		}
+	}
+	return e.debugger.ActivateBreakpoint(sourceBaseFilename, int(bp.Line), bp.Condition, bp.IgnoreCount)
+}
+
+// RemoveBreakpoint removes the breakpoint at the given line in the current file, saves all breakpoints
+// and also deletes the breakpoint if the program is being debugged. Returns false if there was no breakpoint.
+func (e *Editor) RemoveBreakpoint(line LineNumber) (bool, error) {
+	bs := allBreakpoints()
+	if !bs.Remove(e.breakpointKey(), line) {
+		return false, nil
+	}
+	if err := bs.Save(breakpointsFilename); err != nil {
+		return true, err
+	}
+	if e.debugger == nil || !e.debugger.ProgramRunning() {
+		return true, nil
+	}
+	return true, e.debugger.DeleteBreakpoint(filepath.Base(e.filename), int(line))
+}
+
+// parseBreakpointCondition interprets what was entered when asked for a breakpoint condition.
+// A number is the number of hits to ignore, anything else is a condition.
+func parseBreakpointCondition(s string) (condition string, ignoreCount int) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return "", n
+	}
+	return s, 0
+}
+
+// drawBreakpointMarker draws a marker after a line that has a breakpoint, followed by the condition, if any
+func (e *Editor) drawBreakpointMarker(c *vt.Canvas, xp, yp, cw uint, bg vt.AttributeColor, bp Breakpoint) {
+	if xp+2 >= cw {
+		return
+	}
+	marker := '●'
+	if useASCII {
+		marker = '*'
+	}
+	c.WriteRuneBNoLock(xp+1, yp, e.UnmatchedParenColor, bg, marker)
+	var text string
+	if bp.Condition != "" {
+		text = "if " + bp.Condition
+	}
+	if bp.IgnoreCount > 0 {
+		if text != "" {
+			text += ", "
+		}
+		text += fmt.Sprintf("skip %d", bp.IgnoreCount)
+	}
+	if available := int(cw) - int(xp+3); text != "" && available > 0 {
+		c.Write(xp+3, yp, e.CommentColor, bg, chopRunes(asciiFallback(text), available))
+	}
+}
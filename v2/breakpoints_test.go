@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBreakpointStore(t *testing.T) {
+	bs := make(BreakpointStore)
+	bs.Set("/tmp/main.go", Breakpoint{Line: 12})
+	bs.Set("/tmp/main.go", Breakpoint{Line: 3, Condition: "i > 3"})
+	bs.Set("/tmp/main.go", Breakpoint{Line: 12, IgnoreCount: 2})
+	bs.Set("/tmp/util.go", Breakpoint{Line: 7})
+
+	list := bs.Get("/tmp/main.go")
+	if len(list) != 2 || list[0].Line != 3 || list[1].Line != 12 {
+		t.Fatalf("expected breakpoints at line 3 and 12, got %v", list)
+	}
+	if bp, ok := bs.Find("/tmp/main.go", 12); !ok || bp.IgnoreCount != 2 {
+		t.Errorf("expected the breakpoint at line 12 to be replaced, got %v", bp)
+	}
+	if bs.Remove("/tmp/main.go", 5) {
+		t.Error("expected no breakpoint to be removed at line 5")
+	}
+	if !bs.Remove("/tmp/util.go", 7) {
+		t.Error("expected the breakpoint at line 7 to be removed")
+	}
+	if _, ok := bs["/tmp/util.go"]; ok {
+		t.Error("expected util.go to have no breakpoints")
+	}
+
+	orgNoWriteToCache := noWriteToCache
+	noWriteToCache = false
+	defer func() { noWriteToCache = orgNoWriteToCache }()
+
+	path := filepath.Join(t.TempDir(), "breakpoints.txt")
+	if err := bs.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBreakpoints(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(loaded.Get("/tmp/main.go"), bs.Get("/tmp/main.go")) {
+		t.Errorf("expected %v after loading, got %v", bs.Get("/tmp/main.go"), loaded.Get("/tmp/main.go"))
+	}
+}
+
+func TestBreakpointStoreShift(t *testing.T) {
+	bs := make(BreakpointStore)
+	for _, line := range []LineNumber{2, 5, 6, 9} {
+		bs.Set("/tmp/main.go", Breakpoint{Line: line})
+	}
+	lines := func() []LineNumber {
+		var list []LineNumber
+		for _, bp := range bs.Get("/tmp/main.go") {
+			list = append(list, bp.Line)
+		}
+		return list
+	}
+
+	// Two lines inserted above line 5
+	if !bs.Shift("/tmp/main.go", 5, 2) {
+		t.Error("expected breakpoints to be moved")
+	}
+	if got := lines(); !slices.Equal(got, []LineNumber{2, 7, 8, 11}) {
+		t.Errorf("expected breakpoints at line 2, 7, 8 and 11, got %v", got)
+	}
+
+	// Line 7 and 8 deleted
+	bs.Shift("/tmp/main.go", 7, -2)
+	if got := lines(); !slices.Equal(got, []LineNumber{2, 9}) {
+		t.Errorf("expected breakpoints at line 2 and 9, got %v", got)
+	}
+
+	if bs.Shift("/tmp/main.go", 10, 1) {
+		t.Error("expected no breakpoints after line 10 to be moved")
+	}
+	// Line 2 and 3 replaced by a single line
+	bs.Replace("/tmp/main.go", 2, 2, 1)
+	if got := lines(); !slices.Equal(got, []LineNumber{2, 8}) {
+		t.Errorf("expected breakpoints at line 2 and 8, got %v", got)
+	}
+
+	bs.Shift("/tmp/main.go", 1, -20)
+	if _, ok := bs["/tmp/main.go"]; ok {
+		t.Error("expected main.go to have no breakpoints")
+	}
+}
+
+func TestBreakpointsFollowUndo(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.filename = filepath.Join(t.TempDir(), "main.go")
+	e.LoadBytes([]byte("a\nb\nc\nd\n"))
+	key := e.breakpointKey()
+	bs := allBreakpoints()
+	defer delete(bs, key)
+	bs.Set(key, Breakpoint{Line: 3})
+
+	u := NewUndo(64, 0)
+	u.Snapshot(e)
+	e.InsertLineBelowAt(0)
+	if _, ok := bs.Find(key, 4); !ok {
+		t.Fatalf("expected the breakpoint to move to line 4 after inserting a line, got %v", bs.Get(key))
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bs.Find(key, 3); !ok {
+		t.Errorf("expected the breakpoint to be back on line 3 after undo, got %v", bs.Get(key))
+	}
+}
+
+func TestParseBreakpointCondition(t *testing.T) {
+	if condition, ignoreCount := parseBreakpointCondition(" 5 "); condition != "" || ignoreCount != 5 {
+		t.Errorf("expected an ignore count of 5, got %q and %d", condition, ignoreCount)
+	}
+	if condition, ignoreCount := parseBreakpointCondition("x == 5"); condition != "x == 5" || ignoreCount != 0 {
+		t.Errorf("expected the condition x == 5, got %q and %d", condition, ignoreCount)
+	}
+}
+
+func TestBreakpointCommands(t *testing.T) {
+	args := gdbBreakInsertArgs("main.c", 4, "i > 3", 2)
+	if !slices.Equal(args, []string{"-c", "i > 3", "-i", "2", "main.c:4"}) {
+		t.Errorf("unexpected gdb arguments: %v", args)
+	}
+	if command := lldbBreakpointCommand("main.c", 4, "i > 3", 0); command != `breakpoint set -f main.c -l 4 -c "i > 3"` {
+		t.Errorf("unexpected lldb command: %s", command)
+	}
+	if bp := newDlvBreakpoint("main.go", 4, "", 3); bp.HitCond != "> 3" || bp.Cond != "" {
+		t.Errorf("unexpected Delve breakpoint: %+v", bp)
+	}
+	if m := lldbBreakpointRegexp.FindStringSubmatch("Breakpoint 2: where = main`main + 20 at main.c:4:9"); m == nil || m[1] != "2" {
+		t.Errorf("expected the breakpoint ID 2, got %v", m)
+	}
+}
@@ -1609,8 +1609,8 @@ func (e *Editor) Build(c *vt.Canvas, status *StatusBar, tty *vt.TTY) {
 			return
 		}
 		status.ClearAll(c, false)
-		// If we have a breakpoint, continue to it
-		if e.breakpoint != nil { // exists
+		// If we have breakpoints, continue to the next one
+		if len(e.Breakpoints()) > 0 {
 			// continue forward to the end or to the next breakpoint
 			if err := e.debugger.Continue(); err != nil {
 				// logf("[continue] gdb output: %s\n", gdbOutput)
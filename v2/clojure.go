@@ -302,7 +302,7 @@ func (nc *NREPLClient) Eval(code string) (string, error) {
 func (e *Editor) clojureTopLevelFormStart() int {
 	y := int(e.DataY())
 	for y >= 0 {
-		if line, ok := e.lines[y]; ok && len(line) > 0 && line[0] == '(' {
+		if line, ok := e.lines.Get(y); ok && len(line) > 0 && line[0] == '(' {
 			return y
 		}
 		y--
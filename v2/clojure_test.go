@@ -211,10 +211,10 @@ func TestClojureTopLevelForm(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := NewSimpleEditor(80)
-			e.lines = make(map[int][]rune)
+			e.lines = NewLineBuffer()
 			lines := splitLines(tt.source)
 			for i, l := range lines {
-				e.lines[i] = []rune(l)
+				e.lines.Set(i, []rune(l))
 			}
 			// Place the cursor at the requested line.
 			e.pos.offsetY = 0
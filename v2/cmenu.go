@@ -346,15 +346,14 @@ func (e *Editor) CommandMenu(c *vt.Canvas, tty *vt.TTY, status *StatusBar, undo
 			}
 			// Get the current index and remove the rest of the lines
 			currentLineIndex := int(e.DataY())
-			for y := range e.lines {
-				if y >= currentLineIndex {
-					// Run the prepareFunction, but only once, if there was changes to be made
-					if prepareFunction != nil {
-						prepareFunction()
-						prepareFunction = nil
-					}
-					delete(e.lines, y)
+			if currentLineIndex < e.lines.Len() {
+				// Run the prepareFunction, but only if there are changes to be made
+				if prepareFunction != nil {
+					prepareFunction()
+					prepareFunction = nil
 				}
+				e.shiftBreakpoints(LineIndex(currentLineIndex), currentLineIndex-e.lines.Len())
+				e.lines.DeleteRange(currentLineIndex, e.lines.Len())
 			}
 			if e.changed.Load() {
 				e.redraw.Store(true)
@@ -379,8 +378,11 @@ func (e *Editor) CommandMenu(c *vt.Canvas, tty *vt.TTY, status *StatusBar, undo
 	// Find the path to either "rust-gdb" or "gdb", depending on the mode, then check if it's there
 	foundDebugger := findGDB(e.mode) != "" || (e.mode == mode.Go && findDlv() != "")
 
-	// Debug mode on/off, if gdb is found and the mode is tested
-	if foundDebugger && e.UsingGDBMightWork() {
+	// Or a debug adapter, for modes like Python
+	_, foundDAP := dapConfigFor(e.mode)
+
+	// Debug mode on/off, if gdb is found and the mode is tested, or if a debug adapter or pdb is found
+	if (foundDebugger && e.UsingGDBMightWork()) || foundDAP || pdbAvailable(e.mode) {
 		if e.debugMode {
 			actions.Add("Exit debug mode", func() {
 				status.Clear(c, false)
@@ -400,6 +402,33 @@ func (e *Editor) CommandMenu(c *vt.Canvas, tty *vt.TTY, status *StatusBar, undo
 				e.debugMode = true
 			})
 		}
+		// Debug only the Go or Rust test that the cursor is in
+		if testName, _, ok := e.CurrentTestName(); ok && foundDebugger {
+			actions.Add("Debug "+testName, func() {
+				if err := e.DebugTest(c, tty, status); err != nil {
+					status.Clear(c, false)
+					status.SetError(err)
+					status.Show(c, e)
+				}
+			})
+		}
+		// Attaching and post-mortem inspection needs gdb, lldb or dlv
+		if foundDebugger && e.UsingGDBMightWork() && (e.debugger == nil || !e.debugger.ProgramRunning()) {
+			actions.Add("Attach debugger to process", func() {
+				if err := e.DebugAttach(tty, c, status); err != nil {
+					status.Clear(c, false)
+					status.SetError(err)
+					status.Show(c, e)
+				}
+			})
+			actions.Add("Open core dump", func() {
+				if err := e.DebugOpenCore(tty, c, status); err != nil {
+					status.Clear(c, false)
+					status.SetError(err)
+					status.Show(c, e)
+				}
+			})
+		}
 	}
 
 	// Add the syntax highlighting toggle menu item
@@ -757,6 +786,60 @@ func (e *Editor) CommandMenu(c *vt.Canvas, tty *vt.TTY, status *StatusBar, undo
 		})
 	}
 
+	// Ask the language server for documentation, renaming or quick fixes, if one is configured for this mode
+	if _, ok := lspConfigs[e.mode]; ok && !e.InBookMode() && !e.Empty() {
+		actions.AddCommand(e, c, tty, status, undo, "Show documentation for the symbol under the cursor", "hover")
+		actions.AddCommand(e, c, tty, status, undo, "Rename the symbol under the cursor", "rename")
+		actions.AddCommand(e, c, tty, status, undo, "Code actions and quick fixes", "codeaction")
+	}
+
+	// Find references with the language server, or with a text search if there is no language server
+	if ProgrammingLanguage(e.mode) && !e.InBookMode() && !e.Empty() {
+		actions.AddCommand(e, c, tty, status, undo, "Find references to the symbol under the cursor", "references")
+	}
+
+	// List the functions, types and methods, or the headings, and jump to one of them
+	if (ProgrammingLanguage(e.mode) || hasMarkdownHeadings(e.mode)) && !e.InBookMode() && !e.Empty() {
+		actions.AddCommand(e, c, tty, status, undo, "Go to symbol", "outline")
+	}
+
+	// Save the current macro, play it back on several lines, or use or edit one of the saved macros
+	if !e.InBookMode() {
+		if e.macro != nil && !e.macro.Recording && e.macro.Len() > 0 {
+			actions.Add("Save the current macro", func() {
+				e.SaveCurrentMacro(tty, c, status)
+			})
+			if e.HasSelection() {
+				actions.Add("Play back the macro on each selected line", func() {
+					startY, _ := e.selection.start()
+					endY, endX := e.selection.end()
+					if endY > startY && endX == 0 {
+						endY-- // the selection ends before the last line
+					}
+					e.PlayMacroOnLines(c, status, undo, startY, int(endY-startY)+1)
+				})
+			} else {
+				actions.Add("Play back the macro on each line to the end", func() {
+					y := e.DataY()
+					e.PlayMacroOnLines(c, status, undo, y, e.Len()-int(y))
+				})
+			}
+		}
+		if files.Exists(macrosFilename) {
+			actions.Add("Use a saved macro", func() {
+				e.UseSavedMacro(tty, c, status)
+			})
+			actions.Add("Edit a saved macro", func() {
+				e.EditSavedMacro(tty, c, status)
+			})
+		}
+	}
+
+	// Browse every state of the document in this session, including undo branches
+	if !e.InBookMode() && undo.Tree().Len() > 0 {
+		actions.AddCommand(e, c, tty, status, undo, "Browse the undo tree", "undotree")
+	}
+
 	// Only show the menu option for killing the parent process if the parent process is a known search command
 	searchProcessNames := []string{"ag", "find", "rg"}
 	if firstWordContainsOneOf(parentCommand(), searchProcessNames) {
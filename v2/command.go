@@ -121,6 +121,12 @@ func (e *Editor) CommandToFunction(c *vt.Canvas, tty *vt.TTY, status *StatusBar,
 		copy200
 		gobacktofunc
 		help
+		hover
+		rename
+		references
+		codeaction
+		outline
+		undotree
 		insertdate
 		insertfile
 		inserttime
@@ -386,6 +392,24 @@ func (e *Editor) CommandToFunction(c *vt.Canvas, tty *vt.TTY, status *StatusBar,
 			undo.Snapshot(e)
 			e.SmartSplitLineOnBlanks(c, status)
 		},
+		hover: func() { // show the documentation for the symbol under the cursor
+			e.ShowLSPHover(tty, c, status)
+		},
+		rename: func() { // rename the symbol under the cursor, in all files
+			e.RenameSymbol(tty, c, status, undo)
+		},
+		references: func() { // list the references to the symbol under the cursor
+			e.FindReferences(tty, c, status)
+		},
+		codeaction: func() { // list and apply the quick fixes and refactorings for the cursor position or selection
+			e.CodeActions(tty, c, status, undo)
+		},
+		outline: func() { // list the functions, types and headings in this file, and jump to one
+			e.GoToSymbol(tty, c, status)
+		},
+		undotree: func() { // browse every state of the document in this session, and go to one of them
+			e.BrowseUndoTree(tty, c, status, undo)
+		},
 		quit: func() { // quit
 			e.quit = true
 		},
@@ -420,6 +444,18 @@ func (e *Editor) CommandToFunction(c *vt.Canvas, tty *vt.TTY, status *StatusBar,
 		functionID = gobacktofunc
 	case "h", "he", "hh", "hel", "help":
 		functionID = help
+	case "hover", "doc", "docs", "documentation":
+		functionID = hover
+	case "rename", "renamesymbol", "rn":
+		functionID = rename
+	case "references", "refs", "findreferences", "usages":
+		functionID = references
+	case "codeaction", "codeactions", "quickfix", "fix", "ca":
+		functionID = codeaction
+	case "outline", "symbols", "gotosymbol", "sym":
+		functionID = outline
+	case "undotree", "ut", "history":
+		functionID = undotree
 	case "if", "i", "insertfile", "insert", "insertf":
 		functionID = insertfile
 	case "insertdate", "insertd", "id", "date", "d":
@@ -5,7 +5,7 @@ import "testing"
 func editorWithLines(lines ...string) *Editor {
 	e := NewSimpleEditor(80)
 	for i, line := range lines {
-		e.lines[i] = []rune(line)
+		e.lines.Set(i, []rune(line))
 	}
 	return e
 }
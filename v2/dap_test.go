@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+// TestFakeDAPAdapter is not a test, but a small debug adapter that is started by TestDAPDebugger,
+// by running the test binary again with ORBITON_FAKE_DAP set. The program has three lines.
+func TestFakeDAPAdapter(_ *testing.T) {
+	if os.Getenv("ORBITON_FAKE_DAP") == "" {
+		return
+	}
+	reader := bufio.NewReader(os.Stdin)
+	seq := 0
+	send := func(msg map[string]any) {
+		seq++
+		msg["seq"] = seq
+		writeDAPMessage(os.Stdout, msg)
+	}
+	respond := func(request *dapMessage, body any) {
+		send(map[string]any{"type": "response", "request_seq": request.Seq, "command": request.Command, "success": true, "body": body})
+	}
+	event := func(name string, body any) {
+		send(map[string]any{"type": "event", "event": name, "body": body})
+	}
+	line := 1
+	for {
+		request, err := readDAPMessage(reader)
+		if err != nil {
+			os.Exit(0)
+		}
+		switch request.Command {
+		case "initialize":
+			respond(request, map[string]any{"supportsConfigurationDoneRequest": true})
+			event("initialized", nil)
+		case "configurationDone":
+			respond(request, nil)
+			event("stopped", map[string]any{"reason": "entry", "threadId": 1})
+		case "setBreakpoints":
+			var arguments struct {
+				Breakpoints []dapSourceBreakpoint `json:"breakpoints"`
+			}
+			data, _ := json.Marshal(request.Arguments)
+			json.Unmarshal(data, &arguments)
+			respond(request, map[string]any{"breakpoints": arguments.Breakpoints})
+		case "threads":
+			respond(request, map[string]any{"threads": []map[string]any{{"id": 1, "name": "MainThread"}, {"id": 2, "name": "worker"}}})
+		case "stackTrace":
+			var arguments struct {
+				ThreadID int `json:"threadId"`
+			}
+			data, _ := json.Marshal(request.Arguments)
+			json.Unmarshal(data, &arguments)
+			if arguments.ThreadID == 2 {
+				respond(request, map[string]any{"stackFrames": []map[string]any{
+					{"id": 2000, "name": "work", "line": 7, "source": map[string]any{"path": "/tmp/worker.py"}},
+				}})
+				break
+			}
+			respond(request, map[string]any{"stackFrames": []map[string]any{
+				{"id": 1000, "name": "add", "line": line, "source": map[string]any{"path": "/tmp/fake.py"}},
+				{"id": 1001, "name": "<module>", "line": 3, "source": map[string]any{"path": "/tmp/fake.py"}},
+			}})
+		case "scopes":
+			respond(request, map[string]any{"scopes": []map[string]any{
+				{"name": "Locals", "variablesReference": 7},
+				{"name": "Globals", "variablesReference": 8, "expensive": true},
+			}})
+		case "variables":
+			respond(request, map[string]any{"variables": []map[string]any{{"name": "x", "value": "42", "type": "int"}}})
+		case "evaluate":
+			respond(request, map[string]any{"result": "42", "memoryReference": "0x1000"})
+		case "readMemory":
+			respond(request, map[string]any{"address": "0x1000", "data": "aGk="})
+		case "next":
+			respond(request, nil)
+			event("output", map[string]any{"category": "stdout", "output": "hello\n"})
+			line++
+			event("stopped", map[string]any{"reason": "step", "threadId": 1})
+		case "gotoTargets":
+			respond(request, map[string]any{"targets": []map[string]any{{"id": 5, "label": "line 1", "line": 1}}})
+		case "goto":
+			respond(request, nil)
+			line = 1
+			event("stopped", map[string]any{"reason": "goto", "threadId": 1})
+		case "continue":
+			respond(request, nil)
+			event("exited", map[string]any{"exitCode": 0})
+			event("terminated", nil)
+		case "disconnect":
+			respond(request, nil)
+			os.Exit(0)
+		default:
+			respond(request, nil)
+		}
+	}
+}
+
+func TestDAPDebugger(t *testing.T) {
+	t.Setenv("ORBITON_FAKE_DAP", "1")
+	d := newDAPDebugger(DAPConfig{
+		Command:   os.Args[0],
+		Args:      []string{"-test.run=^TestFakeDAPAdapter$"},
+		AdapterID: "fake",
+		Launch:    map[string]any{"program": "${file}"},
+	})
+	var lines []int
+	done := false
+	dir := t.TempDir()
+	if _, err := d.Start(dir, "fake.py", "", func(line int) { lines = append(lines, line) }, func() { done = true }); err != nil {
+		t.Fatal(err)
+	}
+	defer d.End()
+
+	if err := d.ActivateBreakpoint("fake.py", 3, "x > 1", 0); err != nil {
+		t.Error(err)
+	}
+	if err := d.DeleteBreakpoint("fake.py", 3); err != nil {
+		t.Error(err)
+	}
+	if err := d.DeleteBreakpoint("fake.py", 3); err == nil {
+		t.Error("expected an error when deleting a breakpoint that is not there")
+	}
+	if err := d.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0] != 1 || lines[1] != 2 {
+		t.Errorf("expected to stop at line 1 and then line 2, got %v", lines)
+	}
+	if frames, err := d.Stack(); err != nil || len(frames) != 2 || frames[0].Function != "add" || filepath.Base(frames[0].File) != "fake.py" {
+		t.Errorf("unexpected stack: %v, %v", frames, err)
+	}
+	if locals, err := d.Locals(); err != nil || len(locals) != 1 || locals[0].String() != "x: 42" {
+		t.Errorf("unexpected locals: %v, %v", locals, err)
+	}
+	if value, err := d.AddWatch("x"); err != nil || value != "42" {
+		t.Errorf("expected x to be 42, got %q, %v", value, err)
+	}
+	if addr, data, err := d.ReadMemory("&x", 2); err != nil || addr != 0x1000 || string(data) != "hi" {
+		t.Errorf("unexpected memory at &x: %x, %q, %v", addr, data, err)
+	}
+	if threads, err := d.Threads(); err != nil || len(threads) != 2 || !threads[0].Current || threads[1].String() != "2 worker: work worker.py:7" {
+		t.Errorf("unexpected threads: %v, %v", threads, err)
+	}
+	if err := d.SelectThread(2); err != nil {
+		t.Error(err)
+	}
+	if frames, err := d.Stack(); err != nil || len(frames) != 1 || frames[0].Function != "work" {
+		t.Errorf("expected the stack of the worker thread, got %v, %v", frames, err)
+	}
+	if err := d.SelectThread(1); err != nil {
+		t.Error(err)
+	}
+	if err := d.JumpToLine("fake.py", 1); err != nil || lines[len(lines)-1] != 1 {
+		t.Errorf("expected to jump to line 1, got %v, %v", lines, err)
+	}
+	if output := d.Output(); output != "hello\n" {
+		t.Errorf("expected the program output to be collected, got %q", output)
+	}
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if !done || d.ProgramRunning() {
+		t.Error("expected the program to be done")
+	}
+}
+
+func TestParseDAPConfigs(t *testing.T) {
+	configs := map[mode.Mode]DAPConfig{
+		mode.Python: {Command: "python3", Args: []string{"-m", "debugpy.adapter"}},
+	}
+	data := []byte(`
+[python]
+command = "/opt/python/bin/python3"
+
+[javascript]
+command = "node"
+args = ["/opt/js-debug/src/dapDebugServer.js"]
+launch = { type = "pwa-node", program = "${file}" }
+`)
+	if err := parseDAPConfigs(data, configs); err != nil {
+		t.Fatal(err)
+	}
+	if config := configs[mode.Python]; config.Command != "/opt/python/bin/python3" || len(config.Args) != 2 {
+		t.Errorf("expected only the command to be replaced, got %+v", config)
+	}
+	config, ok := configs[mode.JavaScript]
+	if !ok || config.AdapterID != "javascript" || config.Launch["program"] != "${file}" || config.needsExecutable() {
+		t.Errorf("unexpected JavaScript configuration: %+v", config)
+	}
+	if err := parseDAPConfigs([]byte("[lua]\ncommand = \"lua-debug\"\n"), configs); err == nil {
+		t.Error("expected an error for a new language without launch arguments")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/xyproto/mode"
+)
+
+// dapConfigFilename is where extra or overriding debug adapter configurations can be placed
+var dapConfigFilename = filepath.Join(userConfigDir, "o", "dap.toml")
+
+// dapConfigEntry is one table in dap.toml, like [python] or [javascript]
+type dapConfigEntry struct {
+	Launch        map[string]any `toml:"launch"`
+	Command       string         `toml:"command"`
+	AdapterID     string         `toml:"adapter_id"`
+	EntryFunction string         `toml:"entry_function"`
+	Args          []string       `toml:"args"`
+	Extensions    []string       `toml:"extensions"`
+}
+
+// mergeDAPConfig returns the given configuration with the fields that are set in the entry replaced
+func mergeDAPConfig(config DAPConfig, entry dapConfigEntry) DAPConfig {
+	if entry.Command != "" {
+		config.Command = entry.Command
+	}
+	if entry.Args != nil {
+		config.Args = entry.Args
+	}
+	if entry.AdapterID != "" {
+		config.AdapterID = entry.AdapterID
+	}
+	if entry.EntryFunction != "" {
+		config.EntryFunction = entry.EntryFunction
+	}
+	if entry.Launch != nil {
+		config.Launch = entry.Launch
+	}
+	return config
+}
+
+// parseDAPConfigs parses the contents of dap.toml and merges the entries with the given configurations,
+// which are modified in place. Languages without a built-in configuration must have a command and launch arguments.
+func parseDAPConfigs(data []byte, configs map[mode.Mode]DAPConfig) error {
+	var entries map[string]dapConfigEntry
+	if _, err := toml.Decode(string(data), &entries); err != nil {
+		return err
+	}
+	// Go through the entries in a predictable order, so that errors are reported consistently
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := entries[name]
+		m, found := modeFromLSPConfigName(name, entry.Extensions, lspConfigs)
+		if !found {
+			return fmt.Errorf("[%s]: unknown language, try adding extensions = [\".ext\"]", name)
+		}
+		config, builtIn := configs[m]
+		if !builtIn {
+			if entry.Command == "" {
+				return fmt.Errorf("[%s]: command is missing", name)
+			}
+			if entry.Launch == nil {
+				return fmt.Errorf("[%s]: launch is missing", name)
+			}
+			config = DAPConfig{AdapterID: name}
+		}
+		configs[m] = mergeDAPConfig(config, entry)
+	}
+	return nil
+}
+
+// dapConfigError is set if dap.toml could not be used, so that it can be shown in the status bar
+var dapConfigError error
+
+// LoadDAPConfigs merges the debug adapter configurations in dap.toml in the config directory,
+// if it exists, with the built-in ones. If dap.toml has an error, the built-in ones are left as they are.
+func LoadDAPConfigs() error {
+	data, err := os.ReadFile(dapConfigFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	configs := maps.Clone(dapConfigs)
+	if err := parseDAPConfigs(data, configs); err != nil {
+		return fmt.Errorf("%s: %w", dapConfigFilename, err)
+	}
+	dapConfigs = configs
+	return nil
+}
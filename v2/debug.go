@@ -3,7 +3,9 @@ package main
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"maps"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
@@ -54,6 +56,9 @@ func demangleLines(lines []string) []string {
 const (
 	smallRegisterWindow = iota
 	largeRegisterWindow
+	stackAndLocalsWindow
+	threadsWindow
+	memoryWindow
 	noRegisterWindow
 )
 
@@ -62,24 +67,45 @@ var (
 	showInstructionPane      bool
 	errProgramStopped        = errors.New("program stopped") // must contain "program stopped"
 	errRecordingStopped      = errors.New("recording stopped, please repeat the last step")
+	errCoreFile              = errors.New("a core dump can not be stepped through")
 	prevFlags                []string
 	longInstructionPaneWidth int // should the instruction pane be extra wide, if so, how wide?
 	lastDebugOutputLen       int
 	watchesBoxBottom         int // bottom Y of the watches/Running box, for positioning the registers box below it
 )
 
-// DebugActivateBreakpoint sends break-insert to gdb together with the breakpoint in e.breakpoint, if available
-func (e *Editor) DebugActivateBreakpoint(sourceBaseFilename string) (string, error) {
+// absExecutablePath returns the path to the executable, relative to the source directory if it is not absolute
+func absExecutablePath(sourceDir, executable string) string {
+	if filepath.IsAbs(executable) {
+		return executable
+	}
+	return filepath.Join(sourceDir, executable)
+}
+
+// DebugActivateBreakpoints passes the breakpoints of the current file to the debugger. The breakpoints
+// of other files in the same directory are also passed along, but errors for those are ignored,
+// since the files may not be part of the program. Returns the number of breakpoints in the current file.
+func (e *Editor) DebugActivateBreakpoints(absFilename string) (int, error) {
 	if e.debugger == nil {
-		return "", errors.New("debugger is not running")
+		return 0, errors.New("debugger is not running")
 	}
-	if e.breakpoint != nil {
-		if err := e.debugger.ActivateBreakpoint(sourceBaseFilename, int(e.breakpoint.LineNumber())); err != nil {
-			return "", err
+	bs := allBreakpoints()
+	list := bs.Get(absFilename)
+	for _, bp := range list {
+		if err := e.debugger.ActivateBreakpoint(filepath.Base(absFilename), int(bp.Line), bp.Condition, bp.IgnoreCount); err != nil {
+			return 0, err
 		}
-		return "", nil
 	}
-	return "", errors.New("e.breakpoint is not set")
+	dir := filepath.Dir(absFilename)
+	for filename, others := range bs {
+		if filename == absFilename || filepath.Dir(filename) != dir {
+			continue
+		}
+		for _, bp := range others {
+			_ = e.debugger.ActivateBreakpoint(filepath.Base(filename), int(bp.Line), bp.Condition, bp.IgnoreCount) // best effort
+		}
+	}
+	return len(list), nil
 }
 
 // DebugEnd will end the current debug session, but not set debugMode to false
@@ -98,6 +124,10 @@ func (e *Editor) DebugEnd() {
 	e.debugLine.Store(-1)
 	e.debugConsoleOutput = ""
 	lastDebugOutputLen = 0
+	if e.debugTestDir != "" {
+		os.RemoveAll(e.debugTestDir)
+		e.debugTestDir = ""
+	}
 }
 
 // DrawWatches will draw a box with the current watch expressions and values in the upper right
@@ -212,13 +242,19 @@ func (e *Editor) DrawDebugKeybindings(c *vt.Canvas, repositionCursor bool) {
 		"ctrl-o     : step over",
 		"ctrl-i     : step into",
 		"ctrl-f     : step out",
+		"F4         : run to cursor",
+		"F7         : jump to cursor",
 		"ctrl-n     : next instruction",
 		"ctrl-r     : reverse step",
+		"ctrl-b     : toggle breakpoint",
+		"ctrl-t     : breakpoint condition",
 		"ctrl-w     : add a watch",
 		"ctrl-c     : clear watches",
 		"ctrl-s     : toggle stdout",
 		"ctrl-g     : toggle GDB console",
-		"ctrl-p     : reg. pane layout",
+		"ctrl-p     : reg./stack/thr./mem.",
+		"ctrl-u/d   : frame/thread up/down",
+		"ctrl-e     : examine memory",
 		"ctrl-k     : toggle this box",
 		"ctrl-q     : exit debug mode",
 	}
@@ -228,13 +264,19 @@ func (e *Editor) DrawDebugKeybindings(c *vt.Canvas, repositionCursor bool) {
 			"ctrl-o: step over",
 			"ctrl-i: step into",
 			"ctrl-f: step out",
+			"F4: run to cursor",
+			"F7: jump to cursor",
 			"ctrl-n: next inst.",
 			"ctrl-r: reverse step",
+			"ctrl-b: breakpoint",
+			"ctrl-t: bp. condition",
 			"ctrl-w: add watch",
 			"ctrl-c: clear watches",
 			"ctrl-s: toggle stdout",
 			"ctrl-g: toggle console",
-			"ctrl-p: reg. pane",
+			"ctrl-p: reg./stack/thr./mem.",
+			"ctrl-u/d: frame/thread",
+			"ctrl-e: memory",
 			"ctrl-k: toggle keys",
 			"ctrl-q: exit debug",
 		}
@@ -245,12 +287,17 @@ func (e *Editor) DrawDebugKeybindings(c *vt.Canvas, repositionCursor bool) {
 	if !programRunning {
 		filtered := helpSlice[:0]
 		for _, line := range helpSlice {
-			if strings.Contains(line, "reverse") || strings.Contains(line, "stdout") || strings.Contains(line, "console") || strings.Contains(line, "pane") || strings.Contains(line, "reg.") {
+			if strings.Contains(line, "reverse") || strings.Contains(line, "stdout") || strings.Contains(line, "console") || strings.Contains(line, "pane") || strings.Contains(line, "reg.") || strings.Contains(line, "frame") || strings.Contains(line, "memory") || strings.Contains(line, "cursor") {
 				continue
 			}
 			filtered = append(filtered, line)
 		}
 		helpSlice = filtered
+	} else if e.debugShowRegisters != memoryWindow {
+		// ctrl-e is only for examining memory when the memory pane is shown
+		helpSlice = slices.DeleteFunc(helpSlice, func(line string) bool {
+			return strings.HasPrefix(line, "ctrl-e")
+		})
 	}
 
 	bt := e.NewBoxTheme()
@@ -391,7 +438,7 @@ func (e *Editor) DrawRegisters(c *vt.Canvas, repositionCursor bool) error {
 		}
 	}()
 
-	if e.debugShowRegisters == noRegisterWindow || e.debugger == nil {
+	if e.debugShowRegisters == noRegisterWindow || e.debugShowRegisters == stackAndLocalsWindow || e.debugShowRegisters == threadsWindow || e.debugShowRegisters == memoryWindow || e.debugger == nil {
 		// Don't draw anything
 		return nil
 	}
@@ -769,8 +816,40 @@ func (e *Editor) DrawDebugConsole(c *vt.Canvas, repositionCursor bool) {
 	}
 }
 
-// DebugStartSession builds and then connects to the debugger
-func (e *Editor) DebugStartSession(c *vt.Canvas, tty *vt.TTY, status *StatusBar, optionalOutputExecutable string) error {
+// newNativeDebugger returns Delve for Go, LLDB on macOS and GDB for the rest
+func (e *Editor) newNativeDebugger() Debugger {
+	if e.mode == mode.Go {
+		return newDelveDebugger()
+	} else if isDarwin && findLLDB() != "" {
+		// On macOS, prefer LLDB over GDB (GDB cannot debug arm64 natively)
+		return newLLDBDebugger()
+	}
+	return newGDBDebugger(e.mode)
+}
+
+// debugCallbacks returns the functions that the debugger calls when a new line is reached
+// and when the program is done
+func (e *Editor) debugCallbacks(status *StatusBar) (func(int), func()) {
+	lineFunc := func(lineNumber int) {
+		debugSelectedFrame = 0 // stepping selects the innermost frame
+		debugMemoryStale = true
+		debugInlineStale = true
+		e.debugLine.Store(int64(lineNumber - 1))
+		e.GoToLineNumber(LineNumber(lineNumber), nil, nil, true)
+		e.redraw.Store(true)
+	}
+	doneFunc := func() {
+		e.debugComplete.Store(true)
+		status.SetMessageAfterRedraw("Execution complete")
+		e.redraw.Store(true)
+		e.redrawCursor.Store(true)
+	}
+	return lineFunc, doneFunc
+}
+
+// DebugStartSession builds and then connects to the debugger.
+// The program is given the command line arguments in programArgs, if any.
+func (e *Editor) DebugStartSession(c *vt.Canvas, tty *vt.TTY, status *StatusBar, optionalOutputExecutable string, programArgs ...string) error {
 	e.debugComplete.Store(false)
 
 	absFilename, err := e.AbsFilename()
@@ -778,15 +857,24 @@ func (e *Editor) DebugStartSession(c *vt.Canvas, tty *vt.TTY, status *StatusBar,
 		return err
 	}
 
+	// Use a debug adapter, if one is configured for this mode and found
+	dapConfig, useDAP := dapConfigFor(e.mode)
+
+	// Or pdb, for Python when debugpy is not installed
+	usePdb := !useDAP && pdbAvailable(e.mode)
+
+	// Interpreted languages, like Python, are debugged directly from the source file
+	needsExecutable := !usePdb && (!useDAP || dapConfig.needsExecutable())
+
 	var outputExecutable string
-	if optionalOutputExecutable == "" {
+	if needsExecutable && optionalOutputExecutable == "" {
 		outputExecutable, err = e.BuildOrExport(tty, c, status)
 		if err != nil {
 			e.debugMode = false
 			e.redrawCursor.Store(true)
 			return err
 		}
-	} else {
+	} else if needsExecutable {
 		outputExecutable = optionalOutputExecutable
 	}
 
@@ -794,41 +882,32 @@ func (e *Editor) DebugStartSession(c *vt.Canvas, tty *vt.TTY, status *StatusBar,
 		outputExecutable = e.exeName(absFilename, true)
 	}
 
-	outputExecutableClean := filepath.Clean(filepath.Join(filepath.Dir(absFilename), outputExecutable))
-	if !files.Exists(outputExecutableClean) {
-		e.debugMode = false
-		e.redrawCursor.Store(true)
-		return errors.New("could not find " + outputExecutableClean)
+	if needsExecutable {
+		outputExecutableClean := filepath.Clean(absExecutablePath(filepath.Dir(absFilename), outputExecutable))
+		if !files.Exists(outputExecutableClean) {
+			e.debugMode = false
+			e.redrawCursor.Store(true)
+			return errors.New("could not find " + outputExecutableClean)
+		}
 	}
 
 	// Reuse existing debugger to preserve watches, or create a new one
 	if e.debugger == nil {
-		if e.mode == mode.Go {
-			e.debugger = newDelveDebugger()
-		} else if isDarwin && findLLDB() != "" {
-			// On macOS, prefer LLDB over GDB (GDB cannot debug arm64 natively)
-			e.debugger = newLLDBDebugger()
+		if useDAP {
+			e.debugger = newDAPDebugger(dapConfig)
+		} else if usePdb {
+			e.debugger = newPdbDebugger()
 		} else {
-			e.debugger = newGDBDebugger(e.mode)
+			e.debugger = e.newNativeDebugger()
 		}
 		// Restore watches from previous sessions
 		if len(e.debugWatches) > 0 {
 			maps.Copy(e.debugger.WatchMap(), e.debugWatches)
 		}
 	}
+	e.debugger.SetProgramArguments(programArgs)
 
-	lineFunc := func(lineNumber int) {
-		e.debugLine.Store(int64(lineNumber - 1))
-		e.GoToLineNumber(LineNumber(lineNumber), nil, nil, true)
-		e.redraw.Store(true)
-	}
-
-	doneFunc := func() {
-		e.debugComplete.Store(true)
-		status.SetMessageAfterRedraw("Execution complete")
-		e.redraw.Store(true)
-		e.redrawCursor.Store(true)
-	}
+	lineFunc, doneFunc := e.debugCallbacks(status)
 
 	// Start GDB execution from the top
 	msg, err := e.debugger.Start(filepath.Dir(absFilename), filepath.Base(absFilename), outputExecutable, lineFunc, doneFunc)
@@ -842,13 +921,12 @@ func (e *Editor) DebugStartSession(c *vt.Canvas, tty *vt.TTY, status *StatusBar,
 		return errors.New("could not start debugging: " + msg)
 	}
 
-	// Pass the breakpoint, if set
-	if e.breakpoint != nil {
-		if err := e.debugger.ActivateBreakpoint(filepath.Base(absFilename), int(e.breakpoint.LineNumber())); err != nil {
-			e.debugger.End()
-			e.debugger = nil
-			return err
-		}
+	// Pass the breakpoints, if any
+	breakpointCount, err := e.DebugActivateBreakpoints(absFilename)
+	if err != nil {
+		e.debugger.End()
+		e.debugger = nil
+		return err
 	}
 
 	// Setup assembly mode, disassembly style, and run
@@ -863,10 +941,13 @@ func (e *Editor) DebugStartSession(c *vt.Canvas, tty *vt.TTY, status *StatusBar,
 	e.GoToTop(c, nil)
 
 	status.ClearAll(c, false)
-	if e.breakpoint == nil {
+	switch breakpointCount {
+	case 0:
 		status.SetMessage("Started executing")
-	} else {
-		status.SetMessage("Started executing. Breakpoint at line " + e.breakpoint.LineNumber().String() + ".")
+	case 1:
+		status.SetMessage("Started executing. Breakpoint at line " + e.Breakpoints()[0].Line.String() + ".")
+	default:
+		status.SetMessage(fmt.Sprintf("Started executing. %d breakpoints.", breakpointCount))
 	}
 	status.Show(c, e)
 	return nil
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/vt"
+)
+
+// processInfo is a process that the debugger can be attached to
+type processInfo struct {
+	Command string
+	PID     int
+}
+
+// parsePSOutput parses the output of "ps -o pid= -o args=", leaving out the given PID
+func parsePSOutput(output string, skipPID int) []processInfo {
+	var processes []processInfo
+	for line := range strings.SplitSeq(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil || pid == skipPID {
+			continue
+		}
+		processes = append(processes, processInfo{PID: pid, Command: strings.Join(fields[1:], " ")})
+	}
+	return processes
+}
+
+// userProcesses returns the processes of the current user, except for this one
+func userProcesses() ([]processInfo, error) {
+	output, err := exec.Command("ps", "-U", strconv.Itoa(os.Getuid()), "-o", "pid=", "-o", "args=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list processes: %w", err)
+	}
+	return parsePSOutput(string(output), os.Getpid()), nil
+}
+
+// findCoreFile returns the most recently modified core dump in the given directory, like "core" or "core.1234"
+func findCoreFile(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var (
+		newest    string
+		newestMod int64
+	)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || (name != "core" && !strings.HasPrefix(name, "core.")) {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimPrefix(name, "core.")); name != "core" && err != nil {
+			continue // like "core.go"
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if modTime := info.ModTime().UnixNano(); newest == "" || modTime > newestMod {
+			newest, newestMod = name, modTime
+		}
+	}
+	return newest
+}
+
+// startPostMortemDebugger ends the current debug session, if any, and returns a new
+// debugger for this mode, with the watches from earlier sessions
+func (e *Editor) startPostMortemDebugger() Debugger {
+	e.DebugEnd()
+	e.debugComplete.Store(false)
+	debugger := e.newNativeDebugger()
+	if len(e.debugWatches) > 0 {
+		maps.Copy(debugger.WatchMap(), e.debugWatches)
+	}
+	return debugger
+}
+
+// debugSelectSourceFrame selects the innermost frame that is in the current file, since a process
+// that has crashed or that is waiting is usually stopped in a library function. Returns the frame.
+func (e *Editor) debugSelectSourceFrame(c *vt.Canvas, status *StatusBar) (StackFrame, bool) {
+	frames, err := e.debugger.Stack()
+	if err != nil {
+		return StackFrame{}, false
+	}
+	for _, frame := range frames {
+		if frame.Line > 0 && filepath.Base(frame.File) == filepath.Base(e.filename) {
+			if frame.Level > 0 {
+				if err := e.DebugSelectFrame(frame.Level, c, status); err != nil {
+					return StackFrame{}, false
+				}
+			}
+			e.debugLine.Store(int64(frame.Line - 1))
+			return frame, true
+		}
+	}
+	return StackFrame{}, false
+}
+
+// DebugAttach lets the user pick a running process, then attaches the debugger to it.
+// The process is stopped where it is, and keeps running when the debug session ends.
+func (e *Editor) DebugAttach(tty *vt.TTY, c *vt.Canvas, status *StatusBar) error {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	processes, err := userProcesses()
+	if err != nil {
+		return err
+	}
+	if len(processes) == 0 {
+		return errors.New("found no processes to attach to")
+	}
+	items := make([]string, len(processes))
+	for i, p := range processes {
+		items[i] = fmt.Sprintf("%d %s", p.PID, p.Command)
+	}
+	index := e.FuzzyPickFromList(tty, c, status, "Attach to process", items, items, "Type to filter, press return to attach, or Esc to cancel.")
+	if index < 0 {
+		return nil
+	}
+	process := processes[index]
+
+	status.SetMessage(fmt.Sprintf("Attaching to %d", process.PID))
+	status.ShowNoTimeout(c, e)
+
+	e.debugger = e.startPostMortemDebugger()
+	lineFunc, doneFunc := e.debugCallbacks(status)
+	msg, err := e.debugger.Attach(filepath.Dir(absFilename), process.PID, lineFunc, doneFunc)
+	if err != nil {
+		e.debugger = nil
+		if msg != "" {
+			return fmt.Errorf("could not attach to %d: %s, %w", process.PID, msg, err)
+		}
+		return fmt.Errorf("could not attach to %d: %w", process.PID, err)
+	}
+	e.debugMode = true
+	status.ClearAll(c, false)
+	if frame, ok := e.debugSelectSourceFrame(c, status); ok {
+		status.SetMessageAfterRedraw(fmt.Sprintf("Attached to %d, stopped in %s", process.PID, frame))
+	} else {
+		status.SetMessageAfterRedraw(fmt.Sprintf("Attached to %d", process.PID))
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return nil
+}
+
+// DebugOpenCore asks for a core dump and the executable that produced it, then opens them
+// for inspecting the stack, the registers and the variables at the time of the crash
+func (e *Editor) DebugOpenCore(tty *vt.TTY, c *vt.Canvas, status *StatusBar) error {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	sourceDir := filepath.Dir(absFilename)
+
+	corePath, ok := e.UserInput(c, tty, status, "Core dump", findCoreFile(sourceDir), []string{}, false, "")
+	if !ok || strings.TrimSpace(corePath) == "" {
+		return nil
+	}
+	corePath = absExecutablePath(sourceDir, strings.TrimSpace(corePath))
+	if !files.Exists(corePath) {
+		return errors.New("could not find " + corePath)
+	}
+
+	executable, ok := e.UserInput(c, tty, status, "Executable that crashed", e.exeName(absFilename, true), []string{}, false, "")
+	if !ok || strings.TrimSpace(executable) == "" {
+		return nil
+	}
+	executable = absExecutablePath(sourceDir, strings.TrimSpace(executable))
+	if !files.Exists(executable) {
+		return errors.New("could not find " + executable)
+	}
+
+	status.SetMessage("Opening " + filepath.Base(corePath))
+	status.ShowNoTimeout(c, e)
+
+	e.debugger = e.startPostMortemDebugger()
+	lineFunc, doneFunc := e.debugCallbacks(status)
+	msg, err := e.debugger.OpenCore(sourceDir, executable, corePath, lineFunc, doneFunc)
+	if err != nil {
+		e.debugger = nil
+		if msg != "" {
+			return fmt.Errorf("could not open %s: %s, %w", filepath.Base(corePath), msg, err)
+		}
+		return fmt.Errorf("could not open %s: %w", filepath.Base(corePath), err)
+	}
+	e.debugMode = true
+	e.debugShowRegisters = stackAndLocalsWindow
+	status.ClearAll(c, false)
+	if frame, ok := e.debugSelectSourceFrame(c, status); ok {
+		status.SetMessageAfterRedraw("Crashed in " + frame.String())
+	} else {
+		status.SetMessageAfterRedraw("Opened " + filepath.Base(corePath) + ", the crash is not in " + filepath.Base(e.filename))
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePSOutput(t *testing.T) {
+	output := "    1 /sbin/init splash\n  412 o main.c\n  500 ./server --port 8080\n\n  abc broken\n  600\n"
+	processes := parsePSOutput(output, 412)
+	if len(processes) != 2 {
+		t.Fatalf("expected 2 processes, got %d: %+v", len(processes), processes)
+	}
+	if processes[0].PID != 1 || processes[0].Command != "/sbin/init splash" {
+		t.Errorf("unexpected first process: %+v", processes[0])
+	}
+	if processes[1].PID != 500 || processes[1].Command != "./server --port 8080" {
+		t.Errorf("unexpected second process: %+v", processes[1])
+	}
+}
+
+func TestFindCoreFile(t *testing.T) {
+	dir := t.TempDir()
+	if name := findCoreFile(dir); name != "" {
+		t.Errorf("expected no core file, got %s", name)
+	}
+	for _, name := range []string{"core.go", "core.1234", "core"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte{}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, "core"), old, old)
+	if name := findCoreFile(dir); name != "core.1234" {
+		t.Errorf("expected the newest core file to be core.1234, got %q", name)
+	}
+}
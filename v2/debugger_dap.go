@@ -0,0 +1,921 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+)
+
+// compile-time check that dapDebugger implements Debugger
+var _ Debugger = (*dapDebugger)(nil)
+
+// dapRequestTimeout is how long to wait for a response from the debug adapter, for requests
+// that should be answered right away. Continuing and stepping may take as long as the program needs.
+const dapRequestTimeout = 10 * time.Second
+
+// DAPConfig is a debug adapter that speaks the Debug Adapter Protocol over stdin and stdout
+type DAPConfig struct {
+	Launch        map[string]any // arguments for the launch request, where ${file}, ${dir} and ${executable} are replaced
+	Command       string
+	AdapterID     string
+	EntryFunction string // if set, a function breakpoint is placed here before the program is started
+	Args          []string
+}
+
+// Debug adapter configurations, for modes that are not debugged with GDB, LLDB or Delve
+var dapConfigs = map[mode.Mode]DAPConfig{
+	mode.Python: {
+		Command:   "python3",
+		Args:      []string{"-m", "debugpy.adapter"},
+		AdapterID: "debugpy",
+		Launch: map[string]any{
+			"program":     "${file}",
+			"cwd":         "${dir}",
+			"console":     "internalConsole",
+			"stopOnEntry": true,
+			"justMyCode":  true,
+		},
+	},
+	mode.Zig: {
+		Command:       "lldb-dap",
+		AdapterID:     "lldb-dap",
+		EntryFunction: "main",
+		Launch: map[string]any{
+			"program": "${executable}",
+			"cwd":     "${dir}",
+		},
+	},
+}
+
+var (
+	dapAdapterFound      = make(map[string]bool) // if the adapter commands were found, by command and arguments
+	dapAdapterFoundMutex sync.Mutex
+)
+
+// dapConfigFor returns the debug adapter configuration for the given mode,
+// if there is one and the adapter command is in the PATH
+func dapConfigFor(m mode.Mode) (DAPConfig, bool) {
+	config, ok := dapConfigs[m]
+	if !ok || config.Command == "" {
+		return config, false
+	}
+	key := config.Command + " " + strings.Join(config.Args, " ")
+	dapAdapterFoundMutex.Lock()
+	defer dapAdapterFoundMutex.Unlock()
+	if found, checked := dapAdapterFound[key]; checked {
+		return config, found
+	}
+	found := files.WhichCached(config.Command) != ""
+	if found && len(config.Args) >= 2 && config.Args[0] == "-m" {
+		// The adapter is a Python module, like debugpy, so check that it can be imported
+		found = exec.Command(config.Command, "-c", "import "+config.Args[1]).Run() == nil
+	}
+	dapAdapterFound[key] = found
+	return config, found
+}
+
+// needsExecutable returns true if the program must be built before it can be debugged
+func (config DAPConfig) needsExecutable() bool {
+	data, err := json.Marshal(config.Launch)
+	return err == nil && bytes.Contains(data, []byte("${executable}"))
+}
+
+// expandDAPLaunchArguments returns a copy of the launch arguments with ${file}, ${dir} and ${executable} replaced
+func expandDAPLaunchArguments(launch map[string]any, replacer *strings.Replacer) map[string]any {
+	expanded := make(map[string]any, len(launch))
+	for k, v := range launch {
+		switch value := v.(type) {
+		case string:
+			expanded[k] = replacer.Replace(value)
+		case []any:
+			list := make([]any, len(value))
+			for i, item := range value {
+				if s, ok := item.(string); ok {
+					list[i] = replacer.Replace(s)
+				} else {
+					list[i] = item
+				}
+			}
+			expanded[k] = list
+		case map[string]any:
+			expanded[k] = expandDAPLaunchArguments(value, replacer)
+		default:
+			expanded[k] = v
+		}
+	}
+	return expanded
+}
+
+// dapMessage is a request, response or event in the Debug Adapter Protocol
+type dapMessage struct {
+	Arguments  any             `json:"arguments,omitempty"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Seq        int             `json:"seq"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    bool            `json:"success,omitempty"`
+}
+
+// writeDAPMessage writes a message with a Content-Length header, as for LSP
+func writeDAPMessage(w io.Writer, msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// readDAPMessage reads a message with a Content-Length header
+func readDAPMessage(reader *bufio.Reader) (*dapMessage, error) {
+	contentLength := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if contentLength > 0 {
+				break
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			contentLength, _ = strconv.Atoi(strings.TrimSpace(value))
+		}
+	}
+	body := make([]byte, contentLength)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	var msg dapMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// DAP types that are used in responses and events
+type (
+	dapSource struct {
+		Path string `json:"path,omitempty"`
+		Name string `json:"name,omitempty"`
+	}
+	dapStackFrame struct {
+		Source                      *dapSource `json:"source,omitempty"`
+		Name                        string     `json:"name"`
+		InstructionPointerReference string     `json:"instructionPointerReference,omitempty"`
+		ID                          int        `json:"id"`
+		Line                        int        `json:"line"`
+	}
+	dapThread struct {
+		Name string `json:"name"`
+		ID   int    `json:"id"`
+	}
+	dapScope struct {
+		Name               string `json:"name"`
+		VariablesReference int    `json:"variablesReference"`
+		Expensive          bool   `json:"expensive"`
+	}
+	dapVariable struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+		Type  string `json:"type"`
+	}
+	dapSourceBreakpoint struct {
+		Condition    string `json:"condition,omitempty"`
+		HitCondition string `json:"hitCondition,omitempty"`
+		Line         int    `json:"line"`
+	}
+)
+
+// dapDebugger implements the Debugger interface for any debug adapter that speaks the
+// Debug Adapter Protocol over stdin and stdout, like debugpy or lldb-dap
+type dapDebugger struct {
+	config      DAPConfig
+	cmd         *exec.Cmd
+	stdin       io.WriteCloser
+	pending     map[int]chan *dapMessage // responses that are waited for, by request sequence number
+	events      chan *dapMessage         // stopped, terminated and exited events
+	initialized chan struct{}            // closed when the initialized event arrives
+	watchMap    map[string]string
+	breakpoints map[string][]dapSourceBreakpoint // per source path, since setBreakpoints replaces all breakpoints in a file
+	lineFunc    func(int)
+	doneFunc    func()
+	sourceDir   string
+	programArgs []string // command line arguments for the program, passed as "args" when launching
+	lastWatch   string
+	console     strings.Builder
+	output      bytes.Buffer // program stdout
+	frameIDs    []int        // the IDs of the frames from the last stack trace
+	seq         int
+	threadID    int
+	frame       int // the selected frame, for Locals and EvalExpression
+	mu          sync.Mutex
+	writeMu     sync.Mutex
+	running     bool
+	stepInto    bool
+}
+
+func newDAPDebugger(config DAPConfig) *dapDebugger {
+	return &dapDebugger{
+		config:      config,
+		watchMap:    make(map[string]string),
+		breakpoints: make(map[string][]dapSourceBreakpoint),
+	}
+}
+
+// readLoop reads messages from the debug adapter until it exits. Responses are passed on to
+// the request that waits for them, output is collected and events that stop or end the
+// program are passed on to the events channel.
+func (d *dapDebugger) readLoop(reader *bufio.Reader, pending map[int]chan *dapMessage, events chan *dapMessage, initialized chan struct{}) {
+	defer close(events)
+	initializedOnce := sync.Once{}
+	for {
+		msg, err := readDAPMessage(reader)
+		if err != nil {
+			d.mu.Lock()
+			for seq, ch := range pending {
+				close(ch)
+				delete(pending, seq)
+			}
+			d.mu.Unlock()
+			return
+		}
+		switch msg.Type {
+		case "response":
+			d.mu.Lock()
+			ch, ok := pending[msg.RequestSeq]
+			delete(pending, msg.RequestSeq)
+			d.mu.Unlock()
+			if ok {
+				ch <- msg
+			}
+		case "request": // reverse requests, like runInTerminal, are not supported
+			d.writeMu.Lock()
+			if d.stdin != nil {
+				writeDAPMessage(d.stdin, map[string]any{"type": "response", "seq": 0, "request_seq": msg.Seq, "command": msg.Command, "success": false, "message": "not supported"})
+			}
+			d.writeMu.Unlock()
+		case "event":
+			switch msg.Event {
+			case "initialized":
+				initializedOnce.Do(func() { close(initialized) })
+			case "output":
+				var body struct {
+					Category string `json:"category"`
+					Output   string `json:"output"`
+				}
+				if json.Unmarshal(msg.Body, &body) == nil {
+					d.mu.Lock()
+					if body.Category == "stdout" || body.Category == "stderr" {
+						d.output.WriteString(body.Output)
+					} else if body.Category != "telemetry" {
+						d.console.WriteString(body.Output)
+					}
+					d.mu.Unlock()
+				}
+			case "stopped", "terminated", "exited":
+				events <- msg
+			}
+		}
+	}
+}
+
+// request sends a request to the debug adapter and returns a channel for the response.
+// The channel is closed without a response if the adapter exits.
+func (d *dapDebugger) request(command string, arguments any) (chan *dapMessage, error) {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	if d.stdin == nil {
+		return nil, errors.New("the debug adapter is not running")
+	}
+	ch := make(chan *dapMessage, 1)
+	d.mu.Lock()
+	d.seq++
+	seq := d.seq
+	d.pending[seq] = ch
+	d.mu.Unlock()
+	if err := writeDAPMessage(d.stdin, dapMessage{Seq: seq, Type: "request", Command: command, Arguments: arguments}); err != nil {
+		d.mu.Lock()
+		delete(d.pending, seq)
+		d.mu.Unlock()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// waitForResponse waits for a response and unmarshals the body into out, if out is not nil
+func waitForResponse(ch chan *dapMessage, command string, timeout time.Duration, out any) error {
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return errors.New("the debug adapter exited")
+		}
+		if !msg.Success {
+			if msg.Message != "" {
+				return fmt.Errorf("%s: %s", command, msg.Message)
+			}
+			return errors.New(command + " failed")
+		}
+		if out != nil && len(msg.Body) > 0 {
+			return json.Unmarshal(msg.Body, out)
+		}
+		return nil
+	case <-time.After(timeout):
+		return errors.New("timeout waiting for a response to " + command)
+	}
+}
+
+// call sends a request and waits for the response
+func (d *dapDebugger) call(command string, arguments any, out any) error {
+	ch, err := d.request(command, arguments)
+	if err != nil {
+		return err
+	}
+	return waitForResponse(ch, command, dapRequestTimeout, out)
+}
+
+// waitForStop waits until the program stops or ends, then reports the new line or that
+// the program is done. Returns an error if the adapter exits unexpectedly.
+func (d *dapDebugger) waitForStop() error {
+	msg, ok := <-d.events
+	if !ok || msg.Event == "terminated" || msg.Event == "exited" {
+		d.programEnded()
+		return nil
+	}
+	var body struct {
+		ThreadID int `json:"threadId"`
+	}
+	if json.Unmarshal(msg.Body, &body) == nil && body.ThreadID != 0 {
+		d.threadID = body.ThreadID
+	}
+	d.frame = 0
+	if frames, err := d.Stack(); err == nil && len(frames) > 0 && frames[0].Line > 0 && d.lineFunc != nil {
+		d.lineFunc(frames[0].Line)
+	}
+	d.refreshWatches()
+	return nil
+}
+
+// programEnded marks the program as done and calls doneFunc, once
+func (d *dapDebugger) programEnded() {
+	if !d.running {
+		return
+	}
+	d.running = false
+	if d.doneFunc != nil {
+		d.doneFunc()
+	}
+}
+
+// refreshWatches evaluates the watched expressions again
+func (d *dapDebugger) refreshWatches() {
+	for expr := range d.watchMap {
+		if value, err := d.EvalExpression(expr); err == nil && d.watchMap[expr] != value {
+			d.watchMap[expr] = value
+			d.lastWatch = expr
+		}
+	}
+}
+
+// Start launches the debug adapter, launches the program and waits until it stops at the entry
+// function or at the first line, depending on the adapter configuration
+func (d *dapDebugger) Start(sourceDir, sourceBaseFilename, executableBaseFilename string, lineFunc func(int), doneFunc func()) (string, error) {
+	d.End()
+	d.lineFunc = lineFunc
+	d.doneFunc = doneFunc
+	d.sourceDir = sourceDir
+
+	var err error
+	originalDirectory, err = os.Getwd()
+	if err == nil {
+		if err = os.Chdir(sourceDir); err != nil {
+			return "", fmt.Errorf("could not change directory to %s", sourceDir)
+		}
+	}
+
+	d.cmd = exec.Command(d.config.Command, d.config.Args...)
+	d.cmd.Dir = sourceDir
+	if d.stdin, err = d.cmd.StdinPipe(); err != nil {
+		return "", err
+	}
+	stdout, err := d.cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := d.cmd.Start(); err != nil {
+		d.stdin = nil
+		d.cmd = nil
+		return "", fmt.Errorf("could not start %s: %w", d.config.Command, err)
+	}
+	d.pending = make(map[int]chan *dapMessage)
+	d.events = make(chan *dapMessage, 16)
+	d.initialized = make(chan struct{})
+	go d.readLoop(bufio.NewReader(stdout), d.pending, d.events, d.initialized)
+
+	if err := d.call("initialize", map[string]any{
+		"clientID":        "orbiton",
+		"clientName":      "Orbiton",
+		"adapterID":       d.config.AdapterID,
+		"pathFormat":      "path",
+		"linesStartAt1":   true,
+		"columnsStartAt1": true,
+	}, nil); err != nil {
+		d.End()
+		return "", err
+	}
+
+	executablePath := executableBaseFilename
+	if executablePath != "" && !filepath.IsAbs(executablePath) {
+		executablePath = filepath.Join(sourceDir, executableBaseFilename)
+	}
+	replacer := strings.NewReplacer(
+		"${file}", filepath.Join(sourceDir, sourceBaseFilename),
+		"${dir}", sourceDir,
+		"${executable}", executablePath,
+	)
+	// The launch response may only arrive after configurationDone, so it is not waited for yet
+	launchArguments := expandDAPLaunchArguments(d.config.Launch, replacer)
+	if len(d.programArgs) > 0 {
+		launchArguments["args"] = d.programArgs
+	}
+	launchResponse, err := d.request("launch", launchArguments)
+	if err != nil {
+		d.End()
+		return "", err
+	}
+	select {
+	case <-d.initialized:
+	case msg, ok := <-launchResponse:
+		if !ok || !msg.Success {
+			d.End()
+			if ok && msg.Message != "" {
+				return "", errors.New("launch: " + msg.Message)
+			}
+			return "", errors.New("could not launch the program with " + d.config.Command)
+		}
+		launchResponse = nil
+		<-d.initialized
+	case <-time.After(dapRequestTimeout):
+		d.End()
+		return "", errors.New("timeout waiting for " + d.config.Command)
+	}
+	d.running = true
+
+	if d.config.EntryFunction != "" {
+		_ = d.call("setFunctionBreakpoints", map[string]any{
+			"breakpoints": []map[string]any{{"name": d.config.EntryFunction}},
+		}, nil)
+	}
+	if err := d.call("configurationDone", nil, nil); err != nil {
+		d.End()
+		return "", err
+	}
+	if launchResponse != nil {
+		if err := waitForResponse(launchResponse, "launch", dapRequestTimeout, nil); err != nil {
+			d.End()
+			return "", err
+		}
+	}
+	if err := d.waitForStop(); err != nil {
+		return "", err
+	}
+	return "started " + d.config.Command, nil
+}
+
+// Attach is not supported, since each debug adapter has its own attach arguments
+func (d *dapDebugger) Attach(_ string, _ int, _ func(int), _ func()) (string, error) {
+	return "", errors.New("attaching to a process is not supported with " + d.config.Command)
+}
+
+// OpenCore is not supported, since each debug adapter has its own arguments for core dumps
+func (d *dapDebugger) OpenCore(_, _, _ string, _ func(int), _ func()) (string, error) {
+	return "", errors.New("opening a core dump is not supported with " + d.config.Command)
+}
+
+// End terminates the program and the debug adapter
+func (d *dapDebugger) End() {
+	if d.stdin != nil {
+		if ch, err := d.request("disconnect", map[string]any{"terminateDebuggee": true}); err == nil {
+			_ = waitForResponse(ch, "disconnect", time.Second, nil)
+		}
+		d.writeMu.Lock()
+		d.stdin.Close()
+		d.stdin = nil
+		d.writeMu.Unlock()
+	}
+	if d.cmd != nil && d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+		d.cmd.Wait()
+		d.cmd = nil
+	}
+	if originalDirectory != "" {
+		os.Chdir(originalDirectory)
+	}
+	d.mu.Lock()
+	d.output.Reset()
+	d.console.Reset()
+	d.mu.Unlock()
+	d.breakpoints = make(map[string][]dapSourceBreakpoint)
+	d.frameIDs = nil
+	d.threadID = 0
+	d.frame = 0
+	d.running = false
+}
+
+// doStep sends a request that resumes the program, then waits until it stops again
+func (d *dapDebugger) doStep(command string, arguments map[string]any) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	if d.threadID == 0 {
+		if threads, err := d.threads(); err == nil && len(threads) > 0 {
+			d.threadID = threads[0].ID
+		}
+	}
+	if arguments == nil {
+		arguments = make(map[string]any)
+	}
+	arguments["threadId"] = d.threadID
+	if err := d.call(command, arguments, nil); err != nil {
+		return err
+	}
+	return d.waitForStop()
+}
+
+func (d *dapDebugger) Continue() error { return d.doStep("continue", nil) }
+func (d *dapDebugger) Finish() error   { return d.doStep("stepOut", nil) }
+func (d *dapDebugger) Step() error     { return d.doStep("stepIn", nil) }
+
+func (d *dapDebugger) Next() error {
+	if d.stepInto {
+		return d.doStep("stepIn", nil)
+	}
+	return d.doStep("next", nil)
+}
+
+func (d *dapDebugger) NextInstruction() error {
+	arguments := map[string]any{"granularity": "instruction"}
+	if d.stepInto {
+		return d.doStep("stepIn", arguments)
+	}
+	return d.doStep("next", arguments)
+}
+
+func (d *dapDebugger) Run() error {
+	if !d.running {
+		return errProgramStopped
+	}
+	return d.call("restart", nil, nil)
+}
+
+// setBreakpoints sends all breakpoints for the given source file to the debug adapter
+func (d *dapDebugger) setBreakpoints(path string) error {
+	list := d.breakpoints[path]
+	if list == nil {
+		list = []dapSourceBreakpoint{}
+	}
+	return d.call("setBreakpoints", map[string]any{
+		"source":      dapSource{Path: path, Name: filepath.Base(path)},
+		"breakpoints": list,
+	}, nil)
+}
+
+func (d *dapDebugger) ActivateBreakpoint(file string, line int, condition string, ignoreCount int) error {
+	path := filepath.Join(d.sourceDir, file)
+	bp := dapSourceBreakpoint{Line: line, Condition: condition}
+	if ignoreCount > 0 {
+		bp.HitCondition = fmt.Sprintf("> %d", ignoreCount)
+	}
+	list := d.breakpoints[path]
+	for i, other := range list {
+		if other.Line == line {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	list = append(list, bp)
+	sort.Slice(list, func(i, j int) bool { return list[i].Line < list[j].Line })
+	d.breakpoints[path] = list
+	return d.setBreakpoints(path)
+}
+
+func (d *dapDebugger) DeleteBreakpoint(file string, line int) error {
+	path := filepath.Join(d.sourceDir, file)
+	list := d.breakpoints[path]
+	for i, other := range list {
+		if other.Line == line {
+			d.breakpoints[path] = append(list[:i], list[i+1:]...)
+			return d.setBreakpoints(path)
+		}
+	}
+	return fmt.Errorf("no breakpoint at %s:%d", file, line)
+}
+
+// RunToLine continues to the given file and line, with a breakpoint that is removed again when the program stops
+func (d *dapDebugger) RunToLine(file string, line int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	path := filepath.Join(d.sourceDir, file)
+	list := d.breakpoints[path]
+	for _, other := range list {
+		if other.Line == line {
+			return d.Continue() // there is already a breakpoint at that line
+		}
+	}
+	d.breakpoints[path] = append(slices.Clone(list), dapSourceBreakpoint{Line: line})
+	if err := d.setBreakpoints(path); err != nil {
+		d.breakpoints[path] = list
+		return err
+	}
+	err := d.Continue()
+	d.breakpoints[path] = list
+	if d.running {
+		d.setBreakpoints(path)
+	}
+	return err
+}
+
+// JumpToLine moves the execution to the given file and line, with the "gotoTargets" and "goto" requests
+func (d *dapDebugger) JumpToLine(file string, line int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	path := filepath.Join(d.sourceDir, file)
+	var out struct {
+		Targets []struct {
+			ID int `json:"id"`
+		} `json:"targets"`
+	}
+	if err := d.call("gotoTargets", map[string]any{"source": dapSource{Path: path, Name: file}, "line": line}, &out); err != nil {
+		return err
+	}
+	if len(out.Targets) == 0 {
+		return fmt.Errorf("can not jump to %s:%d", file, line)
+	}
+	return d.doStep("goto", map[string]any{"targetId": out.Targets[0].ID})
+}
+
+// dapStackDepth is the maximum number of frames that are requested from the debug adapter
+const dapStackDepth = 50
+
+func (d *dapDebugger) Stack() ([]StackFrame, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	var out struct {
+		StackFrames []dapStackFrame `json:"stackFrames"`
+	}
+	if err := d.call("stackTrace", map[string]any{"threadId": d.threadID, "levels": dapStackDepth}, &out); err != nil {
+		return nil, err
+	}
+	frames := make([]StackFrame, len(out.StackFrames))
+	d.frameIDs = make([]int, len(out.StackFrames))
+	for i, f := range out.StackFrames {
+		frames[i] = StackFrame{Level: i, Function: f.Name, Line: f.Line, Address: f.InstructionPointerReference}
+		if f.Source != nil {
+			frames[i].File = f.Source.Path
+		}
+		d.frameIDs[i] = f.ID
+	}
+	return frames, nil
+}
+
+// frameID returns the ID of the selected frame, fetching the stack trace if needed
+func (d *dapDebugger) frameID() (int, error) {
+	if d.frame >= len(d.frameIDs) {
+		if _, err := d.Stack(); err != nil {
+			return 0, err
+		}
+		if d.frame >= len(d.frameIDs) {
+			return 0, fmt.Errorf("there is no frame #%d", d.frame)
+		}
+	}
+	return d.frameIDs[d.frame], nil
+}
+
+func (d *dapDebugger) Locals() ([]Variable, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	id, err := d.frameID()
+	if err != nil {
+		return nil, err
+	}
+	var scopes struct {
+		Scopes []dapScope `json:"scopes"`
+	}
+	if err := d.call("scopes", map[string]any{"frameId": id}, &scopes); err != nil {
+		return nil, err
+	}
+	var variables []Variable
+	for _, scope := range scopes.Scopes {
+		if scope.Expensive || scope.VariablesReference == 0 {
+			continue // like globals or registers
+		}
+		var out struct {
+			Variables []dapVariable `json:"variables"`
+		}
+		if err := d.call("variables", map[string]any{"variablesReference": scope.VariablesReference}, &out); err != nil {
+			return nil, err
+		}
+		for _, v := range out.Variables {
+			variables = append(variables, Variable{Name: v.Name, Type: v.Type, Value: v.Value})
+		}
+	}
+	return variables, nil
+}
+
+func (d *dapDebugger) SelectFrame(n int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	d.frame = n
+	return nil
+}
+
+// threads returns the threads from a "threads" request
+func (d *dapDebugger) threads() ([]dapThread, error) {
+	var out struct {
+		Threads []dapThread `json:"threads"`
+	}
+	if err := d.call("threads", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Threads, nil
+}
+
+func (d *dapDebugger) Threads() ([]Thread, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	list, err := d.threads()
+	if err != nil {
+		return nil, err
+	}
+	threads := make([]Thread, len(list))
+	for i, t := range list {
+		threads[i] = Thread{ID: t.ID, Name: t.Name, Current: t.ID == d.threadID}
+		// The location of each thread is the innermost frame of its stack
+		var out struct {
+			StackFrames []dapStackFrame `json:"stackFrames"`
+		}
+		if err := d.call("stackTrace", map[string]any{"threadId": t.ID, "levels": 1}, &out); err == nil && len(out.StackFrames) > 0 {
+			f := out.StackFrames[0]
+			threads[i].Function, threads[i].Line = f.Name, f.Line
+			if f.Source != nil {
+				threads[i].File = f.Source.Path
+			}
+		}
+	}
+	return threads, nil
+}
+
+func (d *dapDebugger) SelectThread(id int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	d.threadID = id
+	d.frameIDs = nil
+	d.frame = 0
+	return nil
+}
+
+func (d *dapDebugger) AddWatch(expression string) (string, error) {
+	value, err := d.EvalExpression(expression)
+	if err != nil {
+		// Store with placeholder so it shows up in the watch list
+		d.watchMap[expression] = "?"
+		return "", err
+	}
+	d.watchMap[expression] = value
+	d.lastWatch = expression
+	return value, nil
+}
+
+func (d *dapDebugger) EvalExpression(expr string) (string, error) {
+	if !d.running {
+		return "", errProgramStopped
+	}
+	arguments := map[string]any{"expression": expr, "context": "watch"}
+	if id, err := d.frameID(); err == nil {
+		arguments["frameId"] = id
+	}
+	var out struct {
+		Result string `json:"result"`
+	}
+	if err := d.call("evaluate", arguments, &out); err != nil {
+		return "", err
+	}
+	return out.Result, nil
+}
+
+// ReadMemory reads n bytes from the given address or address expression. Expressions are evaluated
+// first, and the memory reference of the result is used, for adapters that support readMemory.
+func (d *dapDebugger) ReadMemory(address string, n int) (uint64, []byte, error) {
+	if !d.running {
+		return 0, nil, errProgramStopped
+	}
+	memoryReference := address
+	if _, err := strconv.ParseUint(address, 0, 64); err != nil {
+		arguments := map[string]any{"expression": address, "context": "watch"}
+		if id, err := d.frameID(); err == nil {
+			arguments["frameId"] = id
+		}
+		var out struct {
+			Result          string `json:"result"`
+			MemoryReference string `json:"memoryReference"`
+		}
+		if err := d.call("evaluate", arguments, &out); err != nil {
+			return 0, nil, err
+		}
+		memoryReference = out.MemoryReference
+		if memoryReference == "" {
+			memoryReference = out.Result
+		}
+	}
+	var out struct {
+		Address string `json:"address"`
+		Data    string `json:"data"`
+	}
+	if err := d.call("readMemory", map[string]any{"memoryReference": memoryReference, "count": n}, &out); err != nil {
+		return 0, nil, err
+	}
+	addr, err := strconv.ParseUint(out.Address, 0, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unexpected address from the debug adapter: %q", out.Address)
+	}
+	data, err := base64.StdEncoding.DecodeString(out.Data)
+	if err != nil {
+		return 0, nil, err
+	}
+	return addr, data, nil
+}
+
+// Registers and disassembly are not part of the Debug Adapter Protocol
+
+func (d *dapDebugger) RegisterNames() ([]string, error) { return nil, nil }
+func (d *dapDebugger) ChangedRegisters() ([]int, error) { return nil, nil }
+func (d *dapDebugger) ChangedRegisterMap() (map[string]string, error) {
+	return map[string]string{}, nil
+}
+func (d *dapDebugger) RegisterMap() (map[string]string, error) { return map[string]string{}, nil }
+func (d *dapDebugger) Disassemble(_ int) ([]string, error)     { return nil, nil }
+func (d *dapDebugger) WatchMap() map[string]string             { return d.watchMap }
+func (d *dapDebugger) LastSeenWatch() string                   { return d.lastWatch }
+func (d *dapDebugger) ProgramRunning() bool                    { return d.running }
+func (d *dapDebugger) SetStepInto(stepInto bool)               { d.stepInto = stepInto }
+func (d *dapDebugger) SetProgramArguments(args []string)       { d.programArgs = args }
+
+func (d *dapDebugger) Output() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.output.String()
+}
+
+func (d *dapDebugger) OutputLen() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.output.Len()
+}
+
+func (d *dapDebugger) ConsoleString() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.console.String()
+	d.console.Reset()
+	return s
+}
+
+func (d *dapDebugger) ReverseStep() error {
+	return errors.New("reverse stepping is not supported with " + d.config.Command)
+}
+
+func (d *dapDebugger) ReverseNextInstruction() error {
+	return errors.New("reverse stepping is not supported with " + d.config.Command)
+}
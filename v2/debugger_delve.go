@@ -11,6 +11,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -38,8 +40,13 @@ type delveDebugger struct {
 	dec           *json.Decoder
 	watchMap      map[string]string
 	prevRegisters map[string]string
+	breakpointIDs map[string]int // breakpoint IDs from Delve, per "file:line"
+	frame         int            // the selected frame, for Locals and EvalExpression
+	attached      bool           // true when attached to a process that should be detached from, not killed
+	coreFile      bool           // true when a core dump is being inspected
 	lineFunc      func(int)
 	doneFunc      func()
+	programArgs   []string // command line arguments for the program, given after "--"
 	lastWatch     string
 	output        bytes.Buffer
 	seq           int64
@@ -52,6 +59,7 @@ func newDelveDebugger() *delveDebugger {
 	return &delveDebugger{
 		watchMap:      make(map[string]string),
 		prevRegisters: make(map[string]string),
+		breakpointIDs: make(map[string]int),
 	}
 }
 
@@ -73,7 +81,8 @@ type dlvResponse struct {
 // Fields without json tags use their Go name (capital) as the JSON key.
 
 type dlvCommandIn struct {
-	Name string `json:"Name"`
+	Name        string `json:"Name"`
+	GoroutineID int64  `json:"goroutineID,omitempty"` // for switchGoroutine
 }
 
 type dlvStateIn struct {
@@ -83,6 +92,9 @@ type dlvStateIn struct {
 type dlvBreakpoint struct {
 	FunctionName string `json:"functionName,omitempty"`
 	File         string `json:"file,omitempty"`
+	Cond         string `json:"Cond,omitempty"`
+	HitCond      string `json:"hitCond,omitempty"` // like "> 3", for ignoring the first hits
+	ID           int    `json:"id,omitempty"`
 	Line         int    `json:"line,omitempty"`
 }
 
@@ -90,6 +102,10 @@ type dlvCreateBreakpointIn struct {
 	Breakpoint dlvBreakpoint `json:"Breakpoint"`
 }
 
+type dlvClearBreakpointIn struct {
+	ID int `json:"Id"`
+}
+
 type dlvEvalScope struct {
 	GoroutineID int64 `json:"goroutineID"`
 	Frame       int   `json:"frame"`
@@ -121,6 +137,17 @@ type dlvDisassembleIn struct {
 	Flavour int          `json:"Flavour"` // 0 = Intel
 }
 
+type dlvStacktraceIn struct {
+	ID    int64 `json:"Id"`
+	Depth int   `json:"Depth"`
+	Full  bool  `json:"Full"`
+}
+
+type dlvListLocalVarsIn struct {
+	Cfg   dlvLoadConfig `json:"Cfg"`
+	Scope dlvEvalScope  `json:"Scope"`
+}
+
 type dlvDetachIn struct {
 	Kill bool `json:"Kill"`
 }
@@ -129,6 +156,16 @@ type dlvRestartIn struct {
 	Position string `json:"Position"`
 }
 
+type dlvListGoroutinesIn struct {
+	Start int `json:"Start"`
+	Count int `json:"Count"`
+}
+
+type dlvExamineMemoryIn struct {
+	Address uint64 `json:"Address"`
+	Length  int    `json:"Length"`
+}
+
 // --- Delve API output types ---
 // These mirror Delve's api package, which uses lowercase json tags.
 
@@ -139,11 +176,18 @@ type dlvThread struct {
 	Line int    `json:"line"`
 }
 
+type dlvGoroutine struct {
+	UserCurrentLoc dlvStackframe `json:"userCurrentLoc"` // the innermost frame that is not in the runtime
+	ID             int64         `json:"id"`
+	ThreadID       int           `json:"threadID"`
+}
+
 type dlvState struct {
-	CurrentThread *dlvThread `json:"currentThread"`
-	Err           *string    `json:"err,omitempty"`
-	ExitStatus    int        `json:"exitStatus"`
-	Exited        bool       `json:"exited"`
+	CurrentThread     *dlvThread    `json:"currentThread"`
+	SelectedGoroutine *dlvGoroutine `json:"currentGoroutine"`
+	Err               *string       `json:"err,omitempty"`
+	ExitStatus        int           `json:"exitStatus"`
+	Exited            bool          `json:"exited"`
 }
 
 // Result wrappers: top-level field names match Go struct field names (capital).
@@ -151,6 +195,10 @@ type dlvCommandOut struct {
 	State dlvState `json:"State"`
 }
 
+type dlvCreateBreakpointOut struct {
+	Breakpoint dlvBreakpoint `json:"Breakpoint"`
+}
+
 type dlvStateOut struct {
 	State dlvState `json:"State"`
 }
@@ -160,20 +208,48 @@ type dlvRegister struct {
 	Value string `json:"Value"`
 }
 
+type dlvListGoroutinesOut struct {
+	Goroutines []dlvGoroutine `json:"Goroutines"`
+}
+
+type dlvExaminedMemoryOut struct {
+	Mem []byte `json:"Mem"`
+}
+
 type dlvListRegistersOut struct {
 	Regs []dlvRegister `json:"Regs"`
 }
 
 type dlvVariable struct {
-	Name  string `json:"name"`
-	Value string `json:"value"`
-	Type  string `json:"type"`
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Type     string        `json:"type"`
+	Children []dlvVariable `json:"children"` // the pointed-to value, for pointers
+	Addr     uint64        `json:"addr"`
+	Kind     reflect.Kind  `json:"kind"`
 }
 
 type dlvEvalOut struct {
 	Variable dlvVariable `json:"Variable"`
 }
 
+type dlvListVarsOut struct {
+	Variables []dlvVariable `json:"Variables"`
+}
+
+type dlvStackframe struct {
+	Function *struct {
+		Name string `json:"name"`
+	} `json:"function"`
+	File string `json:"file"`
+	PC   uint64 `json:"pc"`
+	Line int    `json:"line"`
+}
+
+type dlvStacktraceOut struct {
+	Locations []dlvStackframe `json:"Locations"`
+}
+
 type dlvAsmInstruction struct {
 	Text string `json:"text"`
 	Loc  struct {
@@ -225,6 +301,10 @@ func (d *delveDebugger) doStep(commandName string) error {
 	if !d.running {
 		return errProgramStopped
 	}
+	if d.coreFile {
+		return errCoreFile
+	}
+	d.frame = 0
 	state, err := d.command(commandName)
 	if err != nil {
 		msg := err.Error()
@@ -259,19 +339,22 @@ func (d *delveDebugger) doStep(commandName string) error {
 	return nil
 }
 
+// dlvDefaultLoadConfig is how much of a variable Delve should load, when evaluating expressions
+var dlvDefaultLoadConfig = dlvLoadConfig{
+	FollowPointers:     true,
+	MaxVariableRecurse: 1,
+	MaxStringLen:       64,
+	MaxArrayValues:     64,
+	MaxStructFields:    -1,
+}
+
 // evalExpr evaluates an expression without acquiring the watch lock.
 func (d *delveDebugger) evalExpr(expr string) (string, error) {
 	var out dlvEvalOut
 	err := d.call("Eval", dlvEvalIn{
-		Scope: dlvEvalScope{GoroutineID: -1, Frame: 0},
+		Scope: dlvEvalScope{GoroutineID: -1, Frame: d.frame},
 		Expr:  expr,
-		Cfg: dlvLoadConfig{
-			FollowPointers:     true,
-			MaxVariableRecurse: 1,
-			MaxStringLen:       64,
-			MaxArrayValues:     64,
-			MaxStructFields:    -1,
-		},
+		Cfg:   dlvDefaultLoadConfig,
 	}, &out)
 	if err != nil {
 		return "", err
@@ -280,7 +363,9 @@ func (d *delveDebugger) evalExpr(expr string) (string, error) {
 }
 
 // Start launches dlv in headless mode, connects to it, and runs to main.main.
-func (d *delveDebugger) Start(sourceDir, sourceBaseFilename, executableBaseFilename string, lineFunc func(int), doneFunc func()) (string, error) {
+// launch ends any existing session, changes to the source directory, starts a headless dlv
+// with the given arguments, like "exec" and the executable, and connects to it.
+func (d *delveDebugger) launch(sourceDir string, lineFunc func(int), doneFunc func(), args ...string) error {
 	d.End()
 	d.lineFunc = lineFunc
 	d.doneFunc = doneFunc
@@ -289,41 +374,41 @@ func (d *delveDebugger) Start(sourceDir, sourceBaseFilename, executableBaseFilen
 	originalDirectory, err = os.Getwd()
 	if err == nil {
 		if err = os.Chdir(sourceDir); err != nil {
-			return "", fmt.Errorf("could not change directory to %s", sourceDir)
+			return fmt.Errorf("could not change directory to %s", sourceDir)
 		}
 	}
 
 	dlv := findDlv()
 	if dlv == "" {
-		return "", errors.New("dlv not found, install with: go install github.com/go-delve/delve/cmd/dlv@latest")
+		return errors.New("dlv not found, install with: go install github.com/go-delve/delve/cmd/dlv@latest")
 	}
 
 	// Let the OS pick a free port, then release it for dlv to bind.
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		return "", fmt.Errorf("could not find a free port: %w", err)
+		return fmt.Errorf("could not find a free port: %w", err)
 	}
 	addr := l.Addr().String()
 	l.Close()
 
-	executablePath := executableBaseFilename
-	if !filepath.IsAbs(executablePath) {
-		executablePath = filepath.Join(sourceDir, executableBaseFilename)
-	}
-	d.cmd = exec.Command(dlv, "exec", executablePath,
+	args = append(args,
 		"--headless", "--api-version=2", "--accept-multiclient",
 		"--listen="+addr, "--log-dest=/dev/null",
 	)
+	if args[0] == "exec" && len(d.programArgs) > 0 {
+		args = append(append(args, "--"), d.programArgs...)
+	}
+	d.cmd = exec.Command(dlv, args...)
 	d.cmd.Dir = sourceDir
 
 	stdout, err := d.cmd.StdoutPipe()
 	if err != nil {
-		return "", err
+		return err
 	}
 	go io.Copy(&d.output, stdout)
 
 	if err = d.cmd.Start(); err != nil {
-		return "", fmt.Errorf("could not start dlv: %w", err)
+		return fmt.Errorf("could not start dlv: %w", err)
 	}
 
 	// Retry connecting until dlv is ready (up to 3 seconds).
@@ -336,12 +421,30 @@ func (d *delveDebugger) Start(sourceDir, sourceBaseFilename, executableBaseFilen
 	}
 	if err != nil {
 		d.cmd.Process.Kill()
-		return "", fmt.Errorf("could not connect to dlv at %s: %w", addr, err)
+		return fmt.Errorf("could not connect to dlv at %s: %w", addr, err)
 	}
 	d.conn = conn
 	d.enc = json.NewEncoder(conn)
 	d.dec = json.NewDecoder(bufio.NewReader(conn))
 	d.running = true
+	return nil
+}
+
+// reportCurrentLine passes the line of the current thread to lineFunc, if any
+func (d *delveDebugger) reportCurrentLine() {
+	var out dlvStateOut
+	if err := d.call("State", dlvStateIn{NonBlocking: true}, &out); err != nil {
+		return
+	}
+	if out.State.CurrentThread != nil && out.State.CurrentThread.Line > 0 && d.lineFunc != nil {
+		d.lineFunc(out.State.CurrentThread.Line)
+	}
+}
+
+func (d *delveDebugger) Start(sourceDir, sourceBaseFilename, executableBaseFilename string, lineFunc func(int), doneFunc func()) (string, error) {
+	if err := d.launch(sourceDir, lineFunc, doneFunc, "exec", absExecutablePath(sourceDir, executableBaseFilename)); err != nil {
+		return "", err
+	}
 
 	// Set breakpoints at main.main and at the start of the source file, then continue to one of them.
 	_ = d.call("CreateBreakpoint", dlvCreateBreakpointIn{
@@ -377,9 +480,31 @@ func (d *delveDebugger) Start(sourceDir, sourceBaseFilename, executableBaseFilen
 }
 
 // End terminates the dlv session and restores the working directory.
+// Attach begins a debug session for the running Go process with the given PID.
+// The process is detached from, not killed, when the session ends.
+func (d *delveDebugger) Attach(sourceDir string, pid int, lineFunc func(int), doneFunc func()) (string, error) {
+	if err := d.launch(sourceDir, lineFunc, doneFunc, "attach", strconv.Itoa(pid)); err != nil {
+		return "", err
+	}
+	d.attached = true
+	d.reportCurrentLine()
+	return fmt.Sprintf("attached dlv to %d", pid), nil
+}
+
+// OpenCore begins a post-mortem debug session for the given executable and core dump
+func (d *delveDebugger) OpenCore(sourceDir, executable, corePath string, lineFunc func(int), doneFunc func()) (string, error) {
+	if err := d.launch(sourceDir, lineFunc, doneFunc, "core", absExecutablePath(sourceDir, executable), corePath); err != nil {
+		return "", err
+	}
+	d.coreFile = true
+	d.reportCurrentLine()
+	return "opened " + filepath.Base(corePath), nil
+}
+
 func (d *delveDebugger) End() {
 	if d.conn != nil {
-		_ = d.call("Detach", dlvDetachIn{Kill: true}, nil)
+		// Let an attached process continue running, instead of killing it
+		_ = d.call("Detach", dlvDetachIn{Kill: !d.attached}, nil)
 		d.conn.Close()
 		d.conn = nil
 	}
@@ -391,7 +516,11 @@ func (d *delveDebugger) End() {
 	if originalDirectory != "" {
 		os.Chdir(originalDirectory)
 	}
+	d.breakpointIDs = make(map[string]int)
+	d.frame = 0
 	d.running = false
+	d.attached = false
+	d.coreFile = false
 }
 
 func (d *delveDebugger) Continue() error { return d.doStep("continue") }
@@ -420,10 +549,66 @@ func (d *delveDebugger) Run() error {
 	return d.call("Restart", dlvRestartIn{}, nil)
 }
 
-func (d *delveDebugger) ActivateBreakpoint(file string, line int) error {
-	return d.call("CreateBreakpoint", dlvCreateBreakpointIn{
-		Breakpoint: dlvBreakpoint{File: file, Line: line},
-	}, nil)
+// newDlvBreakpoint returns a Delve breakpoint for the given file and line
+func newDlvBreakpoint(file string, line int, condition string, ignoreCount int) dlvBreakpoint {
+	bp := dlvBreakpoint{File: file, Line: line, Cond: condition}
+	if ignoreCount > 0 {
+		bp.HitCond = fmt.Sprintf("> %d", ignoreCount)
+	}
+	return bp
+}
+
+func (d *delveDebugger) ActivateBreakpoint(file string, line int, condition string, ignoreCount int) error {
+	var out dlvCreateBreakpointOut
+	if err := d.call("CreateBreakpoint", dlvCreateBreakpointIn{
+		Breakpoint: newDlvBreakpoint(file, line, condition, ignoreCount),
+	}, &out); err != nil {
+		return err
+	}
+	d.breakpointIDs[fmt.Sprintf("%s:%d", file, line)] = out.Breakpoint.ID
+	return nil
+}
+
+func (d *delveDebugger) DeleteBreakpoint(file string, line int) error {
+	key := fmt.Sprintf("%s:%d", file, line)
+	id, ok := d.breakpointIDs[key]
+	if !ok {
+		return fmt.Errorf("no breakpoint at %s", key)
+	}
+	if err := d.call("ClearBreakpoint", dlvClearBreakpointIn{ID: id}, nil); err != nil {
+		return err
+	}
+	delete(d.breakpointIDs, key)
+	return nil
+}
+
+// RunToLine continues to the given file and line, with a breakpoint that is removed again when the program stops
+func (d *delveDebugger) RunToLine(file string, line int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	if d.coreFile {
+		return errCoreFile
+	}
+	if _, ok := d.breakpointIDs[fmt.Sprintf("%s:%d", file, line)]; ok {
+		return d.doStep("continue") // there is already a breakpoint at that line
+	}
+	var out dlvCreateBreakpointOut
+	if err := d.call("CreateBreakpoint", dlvCreateBreakpointIn{
+		Breakpoint: newDlvBreakpoint(file, line, "", 0),
+	}, &out); err != nil {
+		return err
+	}
+	err := d.doStep("continue")
+	if d.running {
+		d.call("ClearBreakpoint", dlvClearBreakpointIn{ID: out.Breakpoint.ID}, nil)
+	}
+	return err
+}
+
+// JumpToLine is not possible with Delve, which can only restart recordings at a checkpoint or an event
+func (d *delveDebugger) JumpToLine(file string, line int) error {
+	return errors.New("Delve can not move the execution to another line")
 }
 
 func (d *delveDebugger) AddWatch(expression string) (string, error) {
@@ -442,6 +627,142 @@ func (d *delveDebugger) EvalExpression(expr string) (string, error) {
 	return d.evalExpr(expr)
 }
 
+// dlvVariableAddress returns the address that a variable refers to, in the same way as GDB:
+// the value of pointers and integers, and the location of arrays, structs and other variables
+func dlvVariableAddress(v dlvVariable) (uint64, error) {
+	switch {
+	case v.Kind == reflect.Pointer && len(v.Children) > 0:
+		return v.Children[0].Addr, nil
+	case v.Kind == reflect.Pointer || v.Kind == reflect.UnsafePointer:
+		// Like "unsafe.Pointer(0xc000012345)" or "(*int)(0xc000012345)"
+		value := v.Value
+		if i := strings.LastIndex(value, "(0x"); i >= 0 {
+			value = strings.TrimSuffix(value[i+1:], ")")
+		}
+		return strconv.ParseUint(value, 0, 64)
+	case v.Kind >= reflect.Int && v.Kind <= reflect.Uintptr:
+		return strconv.ParseUint(v.Value, 0, 64)
+	}
+	if v.Addr == 0 {
+		return 0, fmt.Errorf("%s has no address", v.Name)
+	}
+	return v.Addr, nil
+}
+
+// ReadMemory reads n bytes from the given address or address expression, using ExamineMemory
+func (d *delveDebugger) ReadMemory(address string, n int) (uint64, []byte, error) {
+	if !d.running {
+		return 0, nil, errProgramStopped
+	}
+	addr, err := strconv.ParseUint(address, 0, 64)
+	if err != nil {
+		var out dlvEvalOut
+		if err := d.call("Eval", dlvEvalIn{
+			Scope: dlvEvalScope{GoroutineID: -1, Frame: d.frame},
+			Expr:  address,
+			Cfg:   dlvLoadConfig{FollowPointers: true, MaxVariableRecurse: 0, MaxStringLen: 64},
+		}, &out); err != nil {
+			return 0, nil, err
+		}
+		if addr, err = dlvVariableAddress(out.Variable); err != nil {
+			return 0, nil, err
+		}
+	}
+	var out dlvExaminedMemoryOut
+	if err := d.call("ExamineMemory", dlvExamineMemoryIn{Address: addr, Length: n}, &out); err != nil {
+		return 0, nil, err
+	}
+	return addr, out.Mem, nil
+}
+
+// dlvStackDepth is the maximum number of frames that are requested from Delve
+const dlvStackDepth = 50
+
+func (d *delveDebugger) Stack() ([]StackFrame, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	var out dlvStacktraceOut
+	if err := d.call("Stacktrace", dlvStacktraceIn{ID: -1, Depth: dlvStackDepth}, &out); err != nil {
+		return nil, err
+	}
+	frames := make([]StackFrame, len(out.Locations))
+	for i, location := range out.Locations {
+		frames[i] = StackFrame{Level: i, File: location.File, Line: location.Line, Address: fmt.Sprintf("0x%x", location.PC), Function: "??"}
+		if location.Function != nil {
+			frames[i].Function = location.Function.Name
+		}
+	}
+	return frames, nil
+}
+
+func (d *delveDebugger) Locals() ([]Variable, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	var variables []Variable
+	scope := dlvEvalScope{GoroutineID: -1, Frame: d.frame}
+	for _, method := range []string{"ListFunctionArgs", "ListLocalVars"} {
+		var out dlvListVarsOut
+		if err := d.call(method, dlvListLocalVarsIn{Scope: scope, Cfg: dlvDefaultLoadConfig}, &out); err != nil {
+			return nil, err
+		}
+		for _, v := range out.Variables {
+			variables = append(variables, Variable{Name: v.Name, Type: v.Type, Value: v.Value})
+		}
+	}
+	return variables, nil
+}
+
+func (d *delveDebugger) SelectFrame(n int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	d.frame = n
+	return nil
+}
+
+// dlvGoroutineCount is the maximum number of goroutines that are requested from Delve
+const dlvGoroutineCount = 100
+
+func (d *delveDebugger) Threads() ([]Thread, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	var stateOut dlvStateOut
+	if err := d.call("State", dlvStateIn{NonBlocking: true}, &stateOut); err != nil {
+		return nil, err
+	}
+	var out dlvListGoroutinesOut
+	if err := d.call("ListGoroutines", dlvListGoroutinesIn{Start: 0, Count: dlvGoroutineCount}, &out); err != nil {
+		return nil, err
+	}
+	threads := make([]Thread, len(out.Goroutines))
+	for i, g := range out.Goroutines {
+		location := g.UserCurrentLoc
+		threads[i] = Thread{ID: int(g.ID), File: location.File, Line: location.Line}
+		if location.Function != nil {
+			threads[i].Function = location.Function.Name
+		}
+		if stateOut.State.SelectedGoroutine != nil {
+			threads[i].Current = g.ID == stateOut.State.SelectedGoroutine.ID
+		}
+	}
+	return threads, nil
+}
+
+func (d *delveDebugger) SelectThread(id int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	var out dlvCommandOut
+	if err := d.call("Command", dlvCommandIn{Name: "switchGoroutine", GoroutineID: int64(id)}, &out); err != nil {
+		return err
+	}
+	d.frame = 0
+	return nil
+}
+
 func (d *delveDebugger) listRegisters() ([]dlvRegister, error) {
 	var out dlvListRegistersOut
 	if err := d.call("ListRegisters", dlvListRegistersIn{ThreadID: 0, IncludeFP: false}, &out); err != nil {
@@ -539,10 +860,11 @@ func (d *delveDebugger) Output() string        { return d.output.String() }
 func (d *delveDebugger) OutputLen() int        { return d.output.Len() }
 func (d *delveDebugger) ConsoleString() string { return "" }
 
-func (d *delveDebugger) WatchMap() map[string]string { return d.watchMap }
-func (d *delveDebugger) LastSeenWatch() string       { return d.lastWatch }
-func (d *delveDebugger) ProgramRunning() bool        { return d.running }
-func (d *delveDebugger) SetStepInto(stepInto bool)   { d.stepInto = stepInto }
+func (d *delveDebugger) WatchMap() map[string]string       { return d.watchMap }
+func (d *delveDebugger) LastSeenWatch() string             { return d.lastWatch }
+func (d *delveDebugger) ProgramRunning() bool              { return d.running }
+func (d *delveDebugger) SetStepInto(stepInto bool)         { d.stepInto = stepInto }
+func (d *delveDebugger) SetProgramArguments(args []string) { d.programArgs = args }
 func (d *delveDebugger) ReverseStep() error {
 	return errors.New("reverse stepping is not supported by Delve")
 }
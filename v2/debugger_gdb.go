@@ -30,12 +30,17 @@ var _ Debugger = (*gdbDebugger)(nil)
 type gdbDebugger struct {
 	conn            *gdb.Gdb
 	watchMap        map[string]string
-	stopped         chan struct{} // signaled when a *stopped exec notification arrives
+	breakpointIDs   map[string]string // breakpoint numbers from gdb, per "file:line"
+	stopped         chan struct{}     // signaled when a *stopped exec notification arrives
+	lineFunc        func(int)
+	programArgs     []string // command line arguments for the program, like "-test.run"
 	lastWatch       string
 	console         strings.Builder
 	output          bytes.Buffer
 	mode            mode.Mode
 	running         bool
+	attached        bool // true when attached to a process that should be detached from, not killed
+	coreFile        bool // true when a core dump is being inspected
 	recording       bool // true when "record full" is active
 	stepInto        bool
 	filterRegisters bool
@@ -43,9 +48,10 @@ type gdbDebugger struct {
 
 func newGDBDebugger(m mode.Mode) *gdbDebugger {
 	return &gdbDebugger{
-		watchMap: make(map[string]string),
-		mode:     m,
-		stopped:  make(chan struct{}, 1),
+		watchMap:      make(map[string]string),
+		breakpointIDs: make(map[string]string),
+		mode:          m,
+		stopped:       make(chan struct{}, 1),
 	}
 }
 
@@ -75,16 +81,95 @@ func (d *gdbDebugger) Start(sourceDir, sourceBaseFilename, executableBaseFilenam
 		flogf(debugLogFile, "[gdb] dir %s, src %s, exe %s\n", sourceDir, sourceBaseFilename, executableBaseFilename)
 	}
 
+	if err := d.startGDB(sourceDir, lineFunc, doneFunc); err != nil {
+		return "", err
+	}
+
+	// Load the executable file using an absolute path so that GDB finds it regardless of CWD
+	if retvalMap, err := d.conn.CheckedSend("file-exec-and-symbols", absExecutablePath(sourceDir, executableBaseFilename)); err != nil {
+		return fmt.Sprintf("%v", retvalMap), err
+	}
+
+	// GDB may pass the arguments on to a shell, so each one is quoted
+	if len(d.programArgs) > 0 {
+		quotedArgs := make([]string, len(d.programArgs))
+		for i, arg := range d.programArgs {
+			quotedArgs[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		if retvalMap, err := d.conn.CheckedSend("exec-arguments", quotedArgs...); err != nil {
+			return fmt.Sprintf("%v", retvalMap), err
+		}
+	}
+
+	// Pass the breakpoint is handled by the caller via ActivateBreakpoint
+
+	return "started gdb", nil
+}
+
+// Attach begins a debug session for the running process with the given PID, which is stopped
+// where it is. The process is detached from, not killed, when the session ends.
+func (d *gdbDebugger) Attach(sourceDir string, pid int, lineFunc func(int), doneFunc func()) (string, error) {
+	if err := d.startGDB(sourceDir, lineFunc, doneFunc); err != nil {
+		return "", err
+	}
+	if retvalMap, err := d.conn.CheckedSend("target-attach", strconv.Itoa(pid)); err != nil {
+		d.End()
+		return fmt.Sprintf("%v", retvalMap), err
+	}
+	d.attached = true
+	d.running = true
+	d.reportCurrentLine()
+	return fmt.Sprintf("attached gdb to %d", pid), nil
+}
+
+// OpenCore begins a post-mortem debug session for the given executable and core dump
+func (d *gdbDebugger) OpenCore(sourceDir, executable, corePath string, lineFunc func(int), doneFunc func()) (string, error) {
+	if err := d.startGDB(sourceDir, lineFunc, doneFunc); err != nil {
+		return "", err
+	}
+	if retvalMap, err := d.conn.CheckedSend("file-exec-and-symbols", absExecutablePath(sourceDir, executable)); err != nil {
+		d.End()
+		return fmt.Sprintf("%v", retvalMap), err
+	}
+	if retvalMap, err := d.conn.CheckedSend("target-select", "core", corePath); err != nil {
+		d.End()
+		return fmt.Sprintf("%v", retvalMap), err
+	}
+	d.coreFile = true
+	d.running = true
+	d.reportCurrentLine()
+	return "opened " + filepath.Base(corePath), nil
+}
+
+// reportCurrentLine passes the line of the selected frame to lineFunc, if it has a source line
+func (d *gdbDebugger) reportCurrentLine() {
+	notification, err := d.conn.CheckedSend("stack-info-frame")
+	if err != nil || d.lineFunc == nil {
+		return
+	}
+	if payloadMap, ok := notification["payload"].(map[string]any); ok {
+		if frameMap, ok := payloadMap["frame"].(map[string]any); ok {
+			if lineNumber, err := strconv.Atoi(gdbString(frameMap, "line")); err == nil {
+				d.lineFunc(lineNumber)
+			}
+		}
+	}
+}
+
+// startGDB ends any existing session, changes to the source directory and starts GDB
+func (d *gdbDebugger) startGDB(sourceDir string, lineFunc func(int), doneFunc func()) error {
 	// End any existing sessions
 	d.End()
 
+	d.lineFunc = lineFunc
+
 	// Change directory to the sourcefile, temporarily
 	var err error
 	originalDirectory, err = os.Getwd()
 	if err == nil {
 		err = os.Chdir(sourceDir)
 		if err != nil {
-			return "", errors.New("could not change directory to " + sourceDir)
+			return errors.New("could not change directory to " + sourceDir)
 		}
 	}
 
@@ -152,37 +237,64 @@ func (d *gdbDebugger) Start(sourceDir, sourceBaseFilename, executableBaseFilenam
 	})
 	if err != nil {
 		d.conn = nil
-		return "", err
+		return err
 	}
 	if d.conn == nil {
-		return "", errors.New("gdb.New returned no error, but conn is nil")
+		return errors.New("gdb.New returned no error, but conn is nil")
 	}
 
 	// Handle output to stdout from programs that are being debugged
 	go io.Copy(&d.output, d.conn)
 
-	// Load the executable file using an absolute path so that GDB finds it regardless of CWD
-	executablePath := executableBaseFilename
-	if !filepath.IsAbs(executablePath) {
-		executablePath = filepath.Join(sourceDir, executableBaseFilename)
+	return nil
+}
+
+// gdbBreakInsertArgs returns the arguments to break-insert for a breakpoint at the given file and line
+func gdbBreakInsertArgs(file string, line int, condition string, ignoreCount int) []string {
+	var args []string
+	if condition != "" {
+		args = append(args, "-c", condition)
 	}
-	if retvalMap, err := d.conn.CheckedSend("file-exec-and-symbols", executablePath); err != nil {
-		return fmt.Sprintf("%v", retvalMap), err
+	if ignoreCount > 0 {
+		args = append(args, "-i", strconv.Itoa(ignoreCount))
 	}
-
-	// Pass the breakpoint is handled by the caller via ActivateBreakpoint
-
-	return "started gdb", nil
+	return append(args, fmt.Sprintf("%s:%d", file, line))
 }
 
 // ActivateBreakpoint sets a breakpoint at the given file and line.
-func (d *gdbDebugger) ActivateBreakpoint(file string, line int) error {
+func (d *gdbDebugger) ActivateBreakpoint(file string, line int, condition string, ignoreCount int) error {
+	if d.conn == nil {
+		return errors.New("gdb is not running")
+	}
+	retvalMap, err := d.conn.CheckedSend("break-insert", gdbBreakInsertArgs(file, line, condition, ignoreCount)...)
+	if err != nil {
+		return fmt.Errorf("%v: %w", retvalMap, err)
+	}
+	// Remember the breakpoint number, for deleting the breakpoint later
+	if payload, ok := retvalMap["payload"].(map[string]any); ok {
+		if bkpt, ok := payload["bkpt"].(map[string]any); ok {
+			if number, ok := bkpt["number"].(string); ok {
+				d.breakpointIDs[fmt.Sprintf("%s:%d", file, line)] = number
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteBreakpoint removes the breakpoint at the given file and line.
+func (d *gdbDebugger) DeleteBreakpoint(file string, line int) error {
 	if d.conn == nil {
 		return errors.New("gdb is not running")
 	}
-	if retvalMap, err := d.conn.CheckedSend("break-insert", fmt.Sprintf("%s:%d", file, line)); err != nil {
+	key := fmt.Sprintf("%s:%d", file, line)
+	number, ok := d.breakpointIDs[key]
+	if !ok {
+		return fmt.Errorf("no breakpoint at %s", key)
+	}
+	if retvalMap, err := d.conn.CheckedSend("break-delete", number); err != nil {
 		return fmt.Errorf("%v: %w", retvalMap, err)
 	}
+	delete(d.breakpointIDs, key)
 	return nil
 }
 
@@ -322,6 +434,10 @@ func (d *gdbDebugger) End() {
 	if d.conn != nil {
 		conn := d.conn
 		d.conn = nil
+		if d.attached {
+			// Let the process continue running, instead of killing it
+			conn.Send("target-detach")
+		}
 		// Run Exit in a goroutine with a timeout so a hung GDB cannot freeze the editor
 		done := make(chan struct{})
 		go func() {
@@ -336,10 +452,13 @@ func (d *gdbDebugger) End() {
 	d.output.Reset()
 	d.console.Reset()
 	d.lastWatch = ""
+	d.breakpointIDs = make(map[string]string)
 	if originalDirectory != "" {
 		os.Chdir(originalDirectory)
 	}
 	d.running = false
+	d.attached = false
+	d.coreFile = false
 	d.recording = false
 	longInstructionPaneWidth = 0
 }
@@ -349,6 +468,9 @@ func (d *gdbDebugger) Continue() error {
 	if !d.running {
 		return errProgramStopped
 	}
+	if d.coreFile {
+		return errCoreFile
+	}
 	if _, err := d.conn.CheckedSend("exec-continue"); err != nil {
 		return err
 	}
@@ -369,6 +491,47 @@ func (d *gdbDebugger) Continue() error {
 	return nil
 }
 
+// RunToLine sets a temporary breakpoint at the given file and line, then continues to it.
+func (d *gdbDebugger) RunToLine(file string, line int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	if d.coreFile {
+		return errCoreFile
+	}
+	if retvalMap, err := d.conn.CheckedSend("break-insert", append([]string{"-t"}, gdbBreakInsertArgs(file, line, "", 0)...)...); err != nil {
+		return fmt.Errorf("%v: %w", retvalMap, err)
+	}
+	return d.Continue()
+}
+
+// JumpToLine moves the execution to the given file and line, using -exec-jump. A temporary breakpoint
+// is set there first, since GDB resumes the program after jumping.
+func (d *gdbDebugger) JumpToLine(file string, line int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	if d.coreFile {
+		return errCoreFile
+	}
+	location := gdbBreakInsertArgs(file, line, "", 0)
+	if retvalMap, err := d.conn.CheckedSend("break-insert", append([]string{"-t"}, location...)...); err != nil {
+		return fmt.Errorf("%v: %w", retvalMap, err)
+	}
+	if _, err := d.conn.CheckedSend("exec-jump", location...); err != nil {
+		return err
+	}
+	if d.waitForStop() {
+		return errRecordingStopped
+	}
+	d.parseWatchOutput()
+	d.refreshWatches()
+	if !d.running {
+		return errProgramStopped
+	}
+	return nil
+}
+
 // Run starts (or restarts) the program from the beginning.
 func (d *gdbDebugger) Run() error {
 	_, err := d.conn.CheckedSend("exec-run")
@@ -437,6 +600,9 @@ func (d *gdbDebugger) Next() error {
 	if !d.running {
 		return errProgramStopped
 	}
+	if d.coreFile {
+		return errCoreFile
+	}
 	if d.nextInstructionIsSyscall() {
 		return errProgramStopped
 	}
@@ -466,6 +632,9 @@ func (d *gdbDebugger) NextInstruction() error {
 	if !d.running {
 		return errProgramStopped
 	}
+	if d.coreFile {
+		return errCoreFile
+	}
 	if d.nextInstructionIsSyscall() {
 		return errProgramStopped
 	}
@@ -494,6 +663,9 @@ func (d *gdbDebugger) Step() error {
 	if !d.running {
 		return errProgramStopped
 	}
+	if d.coreFile {
+		return errCoreFile
+	}
 	if d.nextInstructionIsSyscall() {
 		return errProgramStopped
 	}
@@ -513,6 +685,9 @@ func (d *gdbDebugger) Step() error {
 
 // Finish runs until the current function returns (step out).
 func (d *gdbDebugger) Finish() error {
+	if d.coreFile {
+		return errCoreFile
+	}
 	if d.nextInstructionIsSyscall() {
 		return errProgramStopped
 	}
@@ -536,6 +711,9 @@ func (d *gdbDebugger) ReverseStep() error {
 	if !d.running {
 		return errProgramStopped
 	}
+	if d.coreFile {
+		return errCoreFile
+	}
 	_, err := d.conn.CheckedSend("interpreter-exec", "console", "reverse-step")
 	if err != nil {
 		return err
@@ -556,6 +734,9 @@ func (d *gdbDebugger) ReverseNextInstruction() error {
 	if !d.running {
 		return errProgramStopped
 	}
+	if d.coreFile {
+		return errCoreFile
+	}
 	_, err := d.conn.CheckedSend("interpreter-exec", "console", "reverse-stepi")
 	if err != nil {
 		return err
@@ -784,6 +965,84 @@ func (d *gdbDebugger) RegisterMap() (map[string]string, error) {
 	return nil, errors.New("could not find the register values in the payload returned from gdb")
 }
 
+// Stack returns the call stack, using -stack-list-frames.
+func (d *gdbDebugger) Stack() ([]StackFrame, error) {
+	if d.conn == nil {
+		return nil, errors.New("gdb is not running")
+	}
+	notification, err := d.conn.CheckedSend("stack-list-frames")
+	if err != nil {
+		return nil, err
+	}
+	if payloadMap, ok := notification["payload"].(map[string]any); ok && notification["class"] == "done" {
+		return parseGDBFrames(payloadMap), nil
+	}
+	return nil, errors.New("could not get the call stack from gdb")
+}
+
+// Locals returns the local variables and arguments of the selected frame, using -stack-list-variables.
+func (d *gdbDebugger) Locals() ([]Variable, error) {
+	if d.conn == nil {
+		return nil, errors.New("gdb is not running")
+	}
+	notification, err := d.conn.CheckedSend("stack-list-variables", "--simple-values")
+	if err != nil {
+		return nil, err
+	}
+	if payloadMap, ok := notification["payload"].(map[string]any); ok && notification["class"] == "done" {
+		return parseGDBVariables(payloadMap), nil
+	}
+	return nil, errors.New("could not get the local variables from gdb")
+}
+
+// SelectFrame selects frame n of the call stack, using -stack-select-frame.
+func (d *gdbDebugger) SelectFrame(n int) error {
+	if d.conn == nil {
+		return errors.New("gdb is not running")
+	}
+	_, err := d.conn.CheckedSend("stack-select-frame", strconv.Itoa(n))
+	return err
+}
+
+// Threads returns the threads of the program, using -thread-info.
+func (d *gdbDebugger) Threads() ([]Thread, error) {
+	if d.conn == nil {
+		return nil, errors.New("gdb is not running")
+	}
+	notification, err := d.conn.CheckedSend("thread-info")
+	if err != nil {
+		return nil, err
+	}
+	if payloadMap, ok := notification["payload"].(map[string]any); ok && notification["class"] == "done" {
+		return parseGDBThreads(payloadMap), nil
+	}
+	return nil, errors.New("could not get the threads from gdb")
+}
+
+// SelectThread makes the thread with the given ID the current one, using -thread-select.
+func (d *gdbDebugger) SelectThread(id int) error {
+	if d.conn == nil {
+		return errors.New("gdb is not running")
+	}
+	_, err := d.conn.CheckedSend("thread-select", strconv.Itoa(id))
+	return err
+}
+
+// ReadMemory reads n bytes from the given address or address expression, using -data-read-memory-bytes.
+func (d *gdbDebugger) ReadMemory(address string, n int) (uint64, []byte, error) {
+	if d.conn == nil {
+		return 0, nil, errors.New("gdb is not running")
+	}
+	notification, err := d.conn.CheckedSend("data-read-memory-bytes", address, strconv.Itoa(n))
+	if err != nil {
+		return 0, nil, err
+	}
+	if payloadMap, ok := notification["payload"].(map[string]any); ok && notification["class"] == "done" {
+		return parseGDBMemory(payloadMap)
+	}
+	return 0, nil, errors.New("could not read memory with gdb")
+}
+
 // EvalExpression evaluates an expression and returns the result.
 func (d *gdbDebugger) EvalExpression(expr string) (string, error) {
 	if d.conn == nil {
@@ -852,3 +1111,6 @@ func (d *gdbDebugger) ProgramRunning() bool { return d.running }
 
 // SetStepInto controls whether stepping goes into function calls.
 func (d *gdbDebugger) SetStepInto(stepInto bool) { d.stepInto = stepInto }
+
+// SetProgramArguments sets the command line arguments that the program is given by the next Start.
+func (d *gdbDebugger) SetProgramArguments(args []string) { d.programArgs = args }
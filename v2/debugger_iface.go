@@ -7,6 +7,17 @@ type Debugger interface {
 	// doneFunc is called when the program finishes execution.
 	Start(sourceDir, sourceBaseFilename, executableBaseFilename string, lineFunc func(int), doneFunc func()) (string, error)
 
+	// Attach begins a debug session for the running process with the given PID. The process
+	// is stopped where it is, and it is detached from instead of killed when the session ends.
+	Attach(sourceDir string, pid int, lineFunc func(int), doneFunc func()) (string, error)
+
+	// OpenCore begins a post-mortem debug session for the given executable and core dump.
+	// The stack, registers and variables can be inspected, but the program can not be stepped through.
+	OpenCore(sourceDir, executable, corePath string, lineFunc func(int), doneFunc func()) (string, error)
+
+	// SetProgramArguments sets the command line arguments that the program is given by the next Start.
+	SetProgramArguments(args []string)
+
 	// End terminates the current debug session.
 	End()
 
@@ -28,8 +39,35 @@ type Debugger interface {
 	// Finish runs until the current function returns (step out).
 	Finish() error
 
-	// ActivateBreakpoint sets a breakpoint at the given file and line.
-	ActivateBreakpoint(file string, line int) error
+	// RunToLine continues until the given file and line is reached, or until the next breakpoint.
+	RunToLine(file string, line int) error
+
+	// JumpToLine moves the execution to the given file and line, without running the lines in between.
+	JumpToLine(file string, line int) error
+
+	// ActivateBreakpoint sets a breakpoint at the given file and line. If condition is not empty,
+	// the program only stops there when the condition is true. The first ignoreCount hits are skipped.
+	ActivateBreakpoint(file string, line int, condition string, ignoreCount int) error
+
+	// DeleteBreakpoint removes the breakpoint at the given file and line.
+	DeleteBreakpoint(file string, line int) error
+
+	// Stack returns the call stack, starting with the innermost frame.
+	Stack() ([]StackFrame, error)
+
+	// Locals returns the local variables and arguments of the selected frame.
+	Locals() ([]Variable, error)
+
+	// SelectFrame selects frame n of the call stack, for Locals and EvalExpression.
+	// Stepping selects the innermost frame again.
+	SelectFrame(n int) error
+
+	// Threads returns the threads of the program, or the goroutines for Delve.
+	Threads() ([]Thread, error)
+
+	// SelectThread makes the thread with the given ID the current one, for stepping, Stack and Locals.
+	// The innermost frame of that thread is selected.
+	SelectThread(id int) error
 
 	// AddWatch adds a watchpoint for the given expression.
 	AddWatch(expression string) (string, error)
@@ -49,6 +87,10 @@ type Debugger interface {
 	// Disassemble returns the next n assembly instructions.
 	Disassemble(n int) ([]string, error)
 
+	// ReadMemory reads n bytes of memory from the given address, or from the address that the given
+	// expression evaluates to, like "&x", "buf" or "$sp". Returns the start address and the bytes.
+	ReadMemory(address string, n int) (uint64, []byte, error)
+
 	// EvalExpression evaluates an expression and returns the result string.
 	EvalExpression(expr string) (string, error)
 
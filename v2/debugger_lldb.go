@@ -28,21 +28,27 @@ type lldbDebugger struct {
 	watchMap map[string]string
 	prevRegs map[string]string // previous register values for change detection
 
-	lineFunc func(int)
-	doneFunc func()
+	breakpointIDs map[string]int // breakpoint IDs from LLDB, per "file:line"
+
+	lineFunc    func(int)
+	doneFunc    func()
+	programArgs []string // command line arguments for the program
 
 	lastWatch string
 	console   strings.Builder
 	output    bytes.Buffer // program stdout
 	mu        sync.Mutex   // guards PTY writes and response reads
 	running   bool
+	attached  bool // true when attached to a process that should be detached from, not killed
+	coreFile  bool // true when a core dump is being inspected
 	stepInto  bool
 }
 
 func newLLDBDebugger() *lldbDebugger {
 	return &lldbDebugger{
-		watchMap: make(map[string]string),
-		prevRegs: make(map[string]string),
+		watchMap:      make(map[string]string),
+		prevRegs:      make(map[string]string),
+		breakpointIDs: make(map[string]int),
 	}
 }
 
@@ -125,8 +131,8 @@ func checkExited(output string) bool {
 	return strings.Contains(output, "Process") && strings.Contains(output, "exited")
 }
 
-// Start begins a new debug session using LLDB.
-func (d *lldbDebugger) Start(sourceDir, _, executableBaseFilename string, lineFunc func(int), doneFunc func()) (string, error) {
+// startLLDB ends any existing session, changes to the source directory and starts LLDB with the given arguments
+func (d *lldbDebugger) startLLDB(sourceDir string, lineFunc func(int), doneFunc func(), args ...string) error {
 	d.End()
 
 	d.lineFunc = lineFunc
@@ -136,33 +142,88 @@ func (d *lldbDebugger) Start(sourceDir, _, executableBaseFilename string, lineFu
 	originalDirectory, err = os.Getwd()
 	if err == nil {
 		if err = os.Chdir(sourceDir); err != nil {
-			return "", errors.New("could not change directory to " + sourceDir)
+			return errors.New("could not change directory to " + sourceDir)
 		}
 	}
 
 	lldbPath := findLLDB()
 	if lldbPath == "" {
-		return "", errors.New("could not find lldb")
-	}
-
-	// Build absolute path to executable
-	executablePath := executableBaseFilename
-	if !filepath.IsAbs(executablePath) {
-		executablePath = filepath.Join(sourceDir, executableBaseFilename)
+		return errors.New("could not find lldb")
 	}
 
-	d.cmd = exec.Command(lldbPath, "--no-use-colors", executablePath)
+	d.cmd = exec.Command(lldbPath, append([]string{"--no-use-colors"}, args...)...)
 	d.cmd.Dir = sourceDir
 
 	// Start LLDB with a PTY so it behaves interactively
 	d.ptyFile, err = pty.Start(d.cmd)
 	if err != nil {
-		return "", fmt.Errorf("could not start lldb with pty: %w", err)
+		return fmt.Errorf("could not start lldb with pty: %w", err)
 	}
 
 	// Read the initial prompt
 	if _, err := d.readUntilPrompt(); err != nil {
-		return "", fmt.Errorf("lldb startup: %w", err)
+		return fmt.Errorf("lldb startup: %w", err)
+	}
+	return nil
+}
+
+// reportCurrentLine passes the line of the selected frame to lineFunc, if it has a source line
+func (d *lldbDebugger) reportCurrentLine() {
+	resp, err := d.send("frame info")
+	if err != nil {
+		return
+	}
+	if lineNum, ok := extractLineNumber(resp); ok && d.lineFunc != nil {
+		d.lineFunc(lineNum)
+	}
+}
+
+// Attach begins a debug session for the running process with the given PID.
+// The process is detached from, not killed, when the session ends.
+func (d *lldbDebugger) Attach(sourceDir string, pid int, lineFunc func(int), doneFunc func()) (string, error) {
+	if err := d.startLLDB(sourceDir, lineFunc, doneFunc); err != nil {
+		return "", err
+	}
+	resp, err := d.send(fmt.Sprintf("process attach --pid %d", pid))
+	if err != nil {
+		d.End()
+		return "", err
+	}
+	if strings.Contains(resp, "error:") {
+		d.End()
+		return resp, fmt.Errorf("could not attach to %d", pid)
+	}
+	d.attached = true
+	d.running = true
+	d.reportCurrentLine()
+	return fmt.Sprintf("attached lldb to %d", pid), nil
+}
+
+// OpenCore begins a post-mortem debug session for the given executable and core dump
+func (d *lldbDebugger) OpenCore(sourceDir, executable, corePath string, lineFunc func(int), doneFunc func()) (string, error) {
+	if err := d.startLLDB(sourceDir, lineFunc, doneFunc, absExecutablePath(sourceDir, executable), "--core", corePath); err != nil {
+		return "", err
+	}
+	d.coreFile = true
+	d.running = true
+	d.reportCurrentLine()
+	return "opened " + filepath.Base(corePath), nil
+}
+
+// Start begins a new debug session using LLDB.
+func (d *lldbDebugger) Start(sourceDir, _, executableBaseFilename string, lineFunc func(int), doneFunc func()) (string, error) {
+	if err := d.startLLDB(sourceDir, lineFunc, doneFunc, absExecutablePath(sourceDir, executableBaseFilename)); err != nil {
+		return "", err
+	}
+
+	if len(d.programArgs) > 0 {
+		quotedArgs := make([]string, len(d.programArgs))
+		for i, arg := range d.programArgs {
+			quotedArgs[i] = strconv.Quote(arg)
+		}
+		if _, err := d.send("settings set -- target.run-args " + strings.Join(quotedArgs, " ")); err != nil {
+			return "", err
+		}
 	}
 
 	// Set a breakpoint at main and run to it
@@ -198,6 +259,10 @@ func (d *lldbDebugger) Start(sourceDir, _, executableBaseFilename string, lineFu
 // End terminates the current LLDB session.
 func (d *lldbDebugger) End() {
 	if d.ptyFile != nil {
+		if d.attached {
+			// Let the process continue running, instead of killing it
+			d.send("process detach")
+		}
 		fmt.Fprintf(d.ptyFile, "quit\n")
 		d.ptyFile.Close()
 		d.ptyFile = nil
@@ -211,7 +276,10 @@ func (d *lldbDebugger) End() {
 	d.console.Reset()
 	d.lastWatch = ""
 	d.running = false
+	d.attached = false
+	d.coreFile = false
 	d.prevRegs = make(map[string]string)
+	d.breakpointIDs = make(map[string]int)
 	if originalDirectory != "" {
 		os.Chdir(originalDirectory)
 	}
@@ -223,6 +291,9 @@ func (d *lldbDebugger) doStep(command string) error {
 	if !d.running {
 		return errProgramStopped
 	}
+	if d.coreFile {
+		return errCoreFile
+	}
 
 	resp, err := d.send(command)
 	if err != nil {
@@ -300,10 +371,88 @@ func (d *lldbDebugger) Finish() error {
 	return d.doStep("finish")
 }
 
-// ActivateBreakpoint sets a breakpoint at the given file and line.
-func (d *lldbDebugger) ActivateBreakpoint(file string, line int) error {
-	_, err := d.send(fmt.Sprintf("breakpoint set -f %s -l %d", file, line))
-	return err
+// RunToLine sets a one-shot breakpoint at the given file and line, then continues to it.
+func (d *lldbDebugger) RunToLine(file string, line int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	if d.coreFile {
+		return errCoreFile
+	}
+	resp, err := d.send(lldbBreakpointCommand(file, line, "", 0) + " --one-shot true")
+	if err != nil {
+		return err
+	}
+	if strings.Contains(resp, "error:") {
+		return errors.New(strings.TrimSpace(resp[strings.Index(resp, "error:")+len("error:"):]))
+	}
+	return d.doStep("continue")
+}
+
+// JumpToLine moves the execution to the given file and line, using "thread jump", without resuming.
+func (d *lldbDebugger) JumpToLine(file string, line int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	if d.coreFile {
+		return errCoreFile
+	}
+	resp, err := d.send(fmt.Sprintf("thread jump --file %s --line %d", file, line))
+	if err != nil {
+		return err
+	}
+	if strings.Contains(resp, "error:") {
+		return errors.New(strings.TrimSpace(resp[strings.Index(resp, "error:")+len("error:"):]))
+	}
+	if d.lineFunc != nil {
+		d.lineFunc(line)
+	}
+	d.refreshWatches()
+	return nil
+}
+
+// lldbBreakpointRegexp matches the ID in LLDB's response to "breakpoint set".
+// Example: "Breakpoint 2: where = main`main + 20 at main.c:4:9, address = 0x..."
+var lldbBreakpointRegexp = regexp.MustCompile(`Breakpoint (\d+):`)
+
+// lldbBreakpointCommand returns the LLDB command for setting a breakpoint
+func lldbBreakpointCommand(file string, line int, condition string, ignoreCount int) string {
+	command := fmt.Sprintf("breakpoint set -f %s -l %d", file, line)
+	if condition != "" {
+		command += " -c " + strconv.Quote(condition)
+	}
+	if ignoreCount > 0 {
+		command += fmt.Sprintf(" -i %d", ignoreCount)
+	}
+	return command
+}
+
+// ActivateBreakpoint sets a breakpoint at the given file and line, with an optional condition and ignore count.
+func (d *lldbDebugger) ActivateBreakpoint(file string, line int, condition string, ignoreCount int) error {
+	resp, err := d.send(lldbBreakpointCommand(file, line, condition, ignoreCount))
+	if err != nil {
+		return err
+	}
+	if m := lldbBreakpointRegexp.FindStringSubmatch(resp); m != nil {
+		if id, err := strconv.Atoi(m[1]); err == nil {
+			d.breakpointIDs[fmt.Sprintf("%s:%d", file, line)] = id
+		}
+	}
+	return nil
+}
+
+// DeleteBreakpoint removes the breakpoint at the given file and line.
+func (d *lldbDebugger) DeleteBreakpoint(file string, line int) error {
+	key := fmt.Sprintf("%s:%d", file, line)
+	id, ok := d.breakpointIDs[key]
+	if !ok {
+		return fmt.Errorf("no breakpoint at %s", key)
+	}
+	if _, err := d.send(fmt.Sprintf("breakpoint delete %d", id)); err != nil {
+		return err
+	}
+	delete(d.breakpointIDs, key)
+	return nil
 }
 
 // AddWatch adds a watch for the given expression.
@@ -318,6 +467,18 @@ func (d *lldbDebugger) AddWatch(expression string) (string, error) {
 	return "", nil
 }
 
+// ReadMemory reads n bytes from the given address or address expression, using "memory read".
+func (d *lldbDebugger) ReadMemory(address string, n int) (uint64, []byte, error) {
+	resp, err := d.send(fmt.Sprintf("memory read --force --size 1 --format x --count %d -- %s", n, address))
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, after, found := strings.Cut(resp, "error:"); found {
+		return 0, nil, errors.New(strings.TrimSpace(after))
+	}
+	return parseLLDBMemory(resp)
+}
+
 // EvalExpression evaluates an expression and returns the result.
 func (d *lldbDebugger) EvalExpression(expr string) (string, error) {
 	resp, err := d.send(fmt.Sprintf("expression -- %s", expr))
@@ -348,6 +509,60 @@ func (d *lldbDebugger) EvalExpression(expr string) (string, error) {
 	return "", errors.New("could not evaluate expression")
 }
 
+// Stack returns the call stack, using "bt".
+func (d *lldbDebugger) Stack() ([]StackFrame, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	resp, err := d.send("bt")
+	if err != nil {
+		return nil, err
+	}
+	return parseLLDBFrames(resp), nil
+}
+
+// Locals returns the local variables and arguments of the selected frame, using "frame variable".
+func (d *lldbDebugger) Locals() ([]Variable, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	resp, err := d.send("frame variable")
+	if err != nil {
+		return nil, err
+	}
+	return parseLLDBVariables(resp), nil
+}
+
+// SelectFrame selects frame n of the call stack, using "frame select".
+func (d *lldbDebugger) SelectFrame(n int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	_, err := d.send(fmt.Sprintf("frame select %d", n))
+	return err
+}
+
+// Threads returns the threads of the program, using "thread list".
+func (d *lldbDebugger) Threads() ([]Thread, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	resp, err := d.send("thread list")
+	if err != nil {
+		return nil, err
+	}
+	return parseLLDBThreads(resp), nil
+}
+
+// SelectThread makes the thread with the given index the current one, using "thread select".
+func (d *lldbDebugger) SelectThread(id int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	_, err := d.send(fmt.Sprintf("thread select %d", id))
+	return err
+}
+
 // RegisterNames returns all register names.
 func (d *lldbDebugger) RegisterNames() ([]string, error) {
 	resp, err := d.send("register read")
@@ -489,6 +704,9 @@ func (d *lldbDebugger) ProgramRunning() bool { return d.running }
 // SetStepInto controls whether stepping goes into function calls.
 func (d *lldbDebugger) SetStepInto(stepInto bool) { d.stepInto = stepInto }
 
+// SetProgramArguments sets the command line arguments that the program is given by the next Start.
+func (d *lldbDebugger) SetProgramArguments(args []string) { d.programArgs = args }
+
 // ReverseStep is not supported by LLDB.
 func (d *lldbDebugger) ReverseStep() error {
 	return errors.New("reverse stepping is not supported by LLDB")
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+)
+
+// compile-time check that pdbDebugger implements Debugger
+var _ Debugger = (*pdbDebugger)(nil)
+
+// pdbPrompt is printed by pdb when it is ready for the next command
+const pdbPrompt = "(Pdb) "
+
+// pdbRequestTimeout is how long to wait for pdb to answer commands that do not run the program
+const pdbRequestTimeout = 10 * time.Second
+
+// pdbLocalsCommand prints the name, type and value of each local variable in the selected frame,
+// one per line and separated by tabs. The first iterable of a generator expression is evaluated
+// in the enclosing scope, so locals() is the locals of the frame and not of the generator.
+const pdbLocalsCommand = `!print("\n".join(f"{k}\t{type(v).__name__}\t{v!r:.200}" for k, v in sorted(locals().items()) if not k.startswith("__") and type(v).__name__ not in ("module", "function", "type")))`
+
+var (
+	// pdbLocationRegexp matches a location from pdb, like "> /tmp/main.py(4)add()" or "> /tmp/main.py(9)<module>()->None".
+	// Program output that did not end with a newline may come first.
+	pdbLocationRegexp = regexp.MustCompile(`^(.*?)> (.+)\((\d+)\)([^()]*)\(\)(?:->.*)?$`)
+
+	// pdbFrameRegexp matches a frame in the output of "where", like "  /tmp/main.py(7)<module>()"
+	pdbFrameRegexp = regexp.MustCompile(`^[> ] (.+)\((\d+)\)([^()]*)\(\)(?:->.*)?$`)
+
+	// pdbBreakpointRegexp matches the response to "break", like "Breakpoint 1 at /tmp/main.py:4"
+	pdbBreakpointRegexp = regexp.MustCompile(`Breakpoint (\d+) at `)
+
+	pythonPathOnce sync.Once
+	pythonPath     string
+)
+
+// findPython returns the path to python3 or python, or "" if not found. Cached.
+func findPython() string {
+	pythonPathOnce.Do(func() {
+		pythonPath = files.WhichCached("python3")
+		if pythonPath == "" {
+			pythonPath = files.WhichCached("python")
+		}
+	})
+	return pythonPath
+}
+
+// pdbAvailable returns true if the given mode can be debugged with pdb, which is used for
+// Python when there is no debug adapter
+func pdbAvailable(m mode.Mode) bool {
+	return m == mode.Python && findPython() != ""
+}
+
+// pdbDebugger implements the Debugger interface by running "python -m pdb" over pipes
+type pdbDebugger struct {
+	cmd           *exec.Cmd
+	stdin         io.WriteCloser
+	chunks        chan string // output from pdb and the program, closed when pdb exits
+	watchMap      map[string]string
+	breakpointIDs map[string]int // breakpoint numbers from pdb, per "file:line"
+	lineFunc      func(int)
+	doneFunc      func()
+	sourceFile    string // the base filename of the program, since lines in other files are not reported
+	programArgs   []string
+	lastWatch     string
+	console       strings.Builder
+	output        bytes.Buffer // program stdout and stderr
+	frame         int          // the selected frame, where 0 is the innermost one
+	mu            sync.Mutex
+	running       bool
+	stepInto      bool
+}
+
+func newPdbDebugger() *pdbDebugger {
+	return &pdbDebugger{
+		watchMap:      make(map[string]string),
+		breakpointIDs: make(map[string]int),
+	}
+}
+
+// pdbStop is what pdb reported after running the program for a while
+type pdbStop struct {
+	File     string
+	Function string
+	Output   string // what the program printed
+	Line     int
+	Finished bool
+}
+
+// parsePdbStop parses the response to a command that runs the program, like "next" or "continue",
+// and separates the output of the program from the output of pdb
+func parsePdbStop(response string) pdbStop {
+	var (
+		stop   pdbStop
+		output strings.Builder
+	)
+	lines := strings.Split(strings.ReplaceAll(response, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := pdbLocationRegexp.FindStringSubmatch(line); m != nil {
+			output.WriteString(m[1])
+			if !stop.Finished { // after finishing, pdb shows where it would restart
+				stop.File = m[2]
+				stop.Line, _ = strconv.Atoi(m[3])
+				stop.Function = m[4]
+			}
+			if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "-> ") {
+				i++ // skip the source line that follows the location
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "The program finished and will be restarted"):
+			stop.Finished = true
+		case strings.HasPrefix(line, "The program exited via sys.exit()"):
+			stop.Finished = true
+		case strings.HasPrefix(line, "***"),
+			strings.HasPrefix(line, "Uncaught exception. Entering post mortem debugging"),
+			strings.HasPrefix(line, "Running 'cont' or 'step' will restart the program"),
+			strings.HasPrefix(line, "Post mortem debugger finished"),
+			strings.HasPrefix(line, "Deleted breakpoint "): // when a temporary breakpoint is reached
+			// Messages from pdb
+		case strings.HasSuffix(line, "--Return--") || strings.HasSuffix(line, "--Call--"):
+			// Program output that did not end with a newline may come first
+			output.WriteString(strings.TrimSuffix(strings.TrimSuffix(line, "--Return--"), "--Call--"))
+		default:
+			output.WriteString(line)
+			if i < len(lines)-1 {
+				output.WriteString("\n")
+			}
+		}
+	}
+	stop.Output = output.String()
+	return stop
+}
+
+// parsePdbFrames parses the output of "where", where the outermost frame comes first.
+// The frames of pdb itself are left out.
+func parsePdbFrames(output string) []StackFrame {
+	var frames []StackFrame
+	for line := range strings.SplitSeq(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		m := pdbFrameRegexp.FindStringSubmatch(line)
+		if m == nil || m[1] == "<string>" || filepath.Base(m[1]) == "bdb.py" || filepath.Base(m[1]) == "pdb.py" {
+			continue
+		}
+		lineNumber, _ := strconv.Atoi(m[2])
+		frames = append([]StackFrame{{Function: m[3], File: m[1], Line: lineNumber}}, frames...)
+	}
+	for i := range frames {
+		frames[i].Level = i
+	}
+	return frames
+}
+
+// parsePdbVariables parses the output of pdbLocalsCommand
+func parsePdbVariables(output string) []Variable {
+	var variables []Variable
+	for line := range strings.SplitSeq(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		variables = append(variables, Variable{Name: fields[0], Type: fields[1], Value: fields[2]})
+	}
+	return variables
+}
+
+// readUntilPrompt collects output from pdb until the prompt is seen. A timeout of 0 waits for as
+// long as the program runs. Returns io.EOF if pdb has exited.
+func (d *pdbDebugger) readUntilPrompt(timeout time.Duration) (string, error) {
+	var (
+		sb       strings.Builder
+		deadline <-chan time.Time
+	)
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+	for {
+		select {
+		case chunk, ok := <-d.chunks:
+			if !ok {
+				return sb.String(), io.EOF
+			}
+			sb.WriteString(chunk)
+			if s := sb.String(); strings.HasSuffix(s, pdbPrompt) {
+				return strings.TrimSuffix(s, pdbPrompt), nil
+			}
+		case <-deadline:
+			return sb.String(), errors.New("timeout waiting for pdb")
+		}
+	}
+}
+
+// send writes a command to pdb and reads the response until the next prompt
+func (d *pdbDebugger) send(command string, timeout time.Duration) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stdin == nil {
+		return "", errors.New("pdb is not running")
+	}
+	if _, err := fmt.Fprintf(d.stdin, "%s\n", command); err != nil {
+		return "", err
+	}
+	return d.readUntilPrompt(timeout)
+}
+
+// Start runs the Python program with pdb, which stops at the first line
+func (d *pdbDebugger) Start(sourceDir, sourceBaseFilename, _ string, lineFunc func(int), doneFunc func()) (string, error) {
+	d.End()
+	d.lineFunc = lineFunc
+	d.doneFunc = doneFunc
+	d.sourceFile = sourceBaseFilename
+
+	var err error
+	originalDirectory, err = os.Getwd()
+	if err == nil {
+		if err = os.Chdir(sourceDir); err != nil {
+			return "", fmt.Errorf("could not change directory to %s", sourceDir)
+		}
+	}
+
+	python := findPython()
+	if python == "" {
+		return "", errors.New("could not find python3 or python")
+	}
+
+	// Both pdb and the program write to stdout and stderr, which are read from the same pipe
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	d.cmd = exec.Command(python, append([]string{"-u", "-m", "pdb", sourceBaseFilename}, d.programArgs...)...)
+	d.cmd.Dir = sourceDir
+	d.cmd.Stdout = w
+	d.cmd.Stderr = w
+	if d.stdin, err = d.cmd.StdinPipe(); err != nil {
+		r.Close()
+		w.Close()
+		return "", err
+	}
+	if err := d.cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		d.stdin = nil
+		d.cmd = nil
+		return "", fmt.Errorf("could not start pdb: %w", err)
+	}
+	w.Close() // only the child process writes to the pipe, so reading ends when it exits
+
+	d.chunks = make(chan string, 16)
+	go func(r *os.File, chunks chan<- string) {
+		defer r.Close()
+		defer close(chunks)
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				chunks <- string(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}(r, d.chunks)
+
+	d.mu.Lock()
+	resp, err := d.readUntilPrompt(pdbRequestTimeout)
+	d.mu.Unlock()
+	if err != nil {
+		d.End()
+		return resp, fmt.Errorf("pdb startup: %w", err)
+	}
+	d.running = true
+	d.handleStop(resp)
+	return "started pdb", nil
+}
+
+// handleStop collects the program output from the response to a command that ran the program,
+// then reports the new line, or that the program is done
+func (d *pdbDebugger) handleStop(resp string) {
+	d.console.WriteString(resp)
+	stop := parsePdbStop(resp)
+	d.output.WriteString(stop.Output)
+	d.frame = 0
+	if stop.Finished {
+		d.running = false
+		if d.doneFunc != nil {
+			d.doneFunc()
+		}
+		return
+	}
+	if stop.Line > 0 && filepath.Base(stop.File) == d.sourceFile && d.lineFunc != nil {
+		d.lineFunc(stop.Line)
+	}
+	d.refreshWatches()
+}
+
+// doStep sends a command that runs the program, like "next", and waits until it stops again
+func (d *pdbDebugger) doStep(command string) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	resp, err := d.send(command, 0)
+	if errors.Is(err, io.EOF) {
+		// pdb has exited, for instance because the program called os._exit
+		d.output.WriteString(parsePdbStop(resp).Output)
+		d.running = false
+		if d.doneFunc != nil {
+			d.doneFunc()
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	d.handleStop(resp)
+	return nil
+}
+
+// refreshWatches re-evaluates all watch expressions
+func (d *pdbDebugger) refreshWatches() {
+	for expr := range d.watchMap {
+		if value, err := d.EvalExpression(expr); err == nil {
+			if value != d.watchMap[expr] {
+				d.lastWatch = expr
+			}
+			d.watchMap[expr] = value
+		}
+	}
+}
+
+// Attach is not supported, since pdb can only debug programs that it starts
+func (d *pdbDebugger) Attach(_ string, _ int, _ func(int), _ func()) (string, error) {
+	return "", errors.New("attaching to a process is not supported with pdb")
+}
+
+// OpenCore is not supported, since Python programs do not leave core dumps that pdb can read
+func (d *pdbDebugger) OpenCore(_, _, _ string, _ func(int), _ func()) (string, error) {
+	return "", errors.New("opening a core dump is not supported with pdb")
+}
+
+// End quits pdb, which also ends the program
+func (d *pdbDebugger) End() {
+	if d.stdin != nil {
+		d.mu.Lock()
+		fmt.Fprintf(d.stdin, "quit\n")
+		d.stdin.Close()
+		d.stdin = nil
+		d.mu.Unlock()
+	}
+	if d.cmd != nil && d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+		d.cmd.Wait()
+		d.cmd = nil
+	}
+	if originalDirectory != "" {
+		os.Chdir(originalDirectory)
+	}
+	d.output.Reset()
+	d.console.Reset()
+	d.lastWatch = ""
+	d.breakpointIDs = make(map[string]int)
+	d.frame = 0
+	d.running = false
+}
+
+func (d *pdbDebugger) Continue() error { return d.doStep("continue") }
+func (d *pdbDebugger) Step() error     { return d.doStep("step") }
+func (d *pdbDebugger) Finish() error   { return d.doStep("return") }
+
+func (d *pdbDebugger) Next() error {
+	if d.stepInto {
+		return d.doStep("step")
+	}
+	return d.doStep("next")
+}
+
+// NextInstruction is the same as Next, since pdb steps through lines and not bytecode instructions
+func (d *pdbDebugger) NextInstruction() error { return d.Next() }
+
+// Run restarts the program from the beginning
+func (d *pdbDebugger) Run() error { return d.doStep("restart") }
+
+// RunToLine sets a temporary breakpoint with "tbreak", then continues to it
+func (d *pdbDebugger) RunToLine(file string, line int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	resp, err := d.send(fmt.Sprintf("tbreak %s:%d", file, line), pdbRequestTimeout)
+	if err != nil {
+		return err
+	}
+	if !pdbBreakpointRegexp.MatchString(resp) {
+		return fmt.Errorf("could not set a breakpoint at %s:%d: %s", file, line, strings.TrimPrefix(strings.TrimSpace(resp), "*** "))
+	}
+	return d.doStep("continue")
+}
+
+// JumpToLine sets the next line to be executed with "jump", which only works within the innermost frame
+func (d *pdbDebugger) JumpToLine(file string, line int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	if file != d.sourceFile {
+		return errors.New("pdb can only jump within the current file")
+	}
+	resp, err := d.send(fmt.Sprintf("jump %d", line), pdbRequestTimeout)
+	if err != nil {
+		return err
+	}
+	if trimmed := strings.TrimSpace(resp); strings.HasPrefix(trimmed, "***") {
+		return errors.New(strings.TrimSpace(strings.TrimPrefix(trimmed, "***")))
+	}
+	d.handleStop(resp)
+	return nil
+}
+
+// ActivateBreakpoint sets a breakpoint with "break file:line, condition", and skips the first hits with "ignore"
+func (d *pdbDebugger) ActivateBreakpoint(file string, line int, condition string, ignoreCount int) error {
+	command := fmt.Sprintf("break %s:%d", file, line)
+	if condition != "" {
+		command += ", " + condition
+	}
+	resp, err := d.send(command, pdbRequestTimeout)
+	if err != nil {
+		return err
+	}
+	m := pdbBreakpointRegexp.FindStringSubmatch(resp)
+	if m == nil {
+		return fmt.Errorf("could not set a breakpoint at %s:%d: %s", file, line, strings.TrimPrefix(strings.TrimSpace(resp), "*** "))
+	}
+	id, _ := strconv.Atoi(m[1])
+	d.breakpointIDs[fmt.Sprintf("%s:%d", file, line)] = id
+	if ignoreCount > 0 {
+		if _, err := d.send(fmt.Sprintf("ignore %d %d", id, ignoreCount), pdbRequestTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBreakpoint removes the breakpoint at the given file and line, with "clear"
+func (d *pdbDebugger) DeleteBreakpoint(file string, line int) error {
+	key := fmt.Sprintf("%s:%d", file, line)
+	id, ok := d.breakpointIDs[key]
+	if !ok {
+		return fmt.Errorf("no breakpoint at %s", key)
+	}
+	if _, err := d.send(fmt.Sprintf("clear %d", id), pdbRequestTimeout); err != nil {
+		return err
+	}
+	delete(d.breakpointIDs, key)
+	return nil
+}
+
+// Stack returns the call stack, using "where"
+func (d *pdbDebugger) Stack() ([]StackFrame, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	resp, err := d.send("where", pdbRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return parsePdbFrames(resp), nil
+}
+
+// Locals returns the local variables of the selected frame
+func (d *pdbDebugger) Locals() ([]Variable, error) {
+	if !d.running {
+		return nil, errProgramStopped
+	}
+	resp, err := d.send(pdbLocalsCommand, pdbRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return parsePdbVariables(resp), nil
+}
+
+// SelectFrame selects frame n of the call stack, with "up" or "down", since pdb moves relative to the selected frame
+func (d *pdbDebugger) SelectFrame(n int) error {
+	if !d.running {
+		return errProgramStopped
+	}
+	var command string
+	switch {
+	case n > d.frame:
+		command = fmt.Sprintf("up %d", n-d.frame)
+	case n < d.frame:
+		command = fmt.Sprintf("down %d", d.frame-n)
+	default:
+		return nil
+	}
+	resp, err := d.send(command, pdbRequestTimeout)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(strings.TrimSpace(resp), "***") {
+		return errors.New(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(resp), "***")))
+	}
+	d.frame = n
+	return nil
+}
+
+// Threads returns the main thread, since pdb only debugs the thread that it was started in
+func (d *pdbDebugger) Threads() ([]Thread, error) {
+	frames, err := d.Stack()
+	if err != nil {
+		return nil, err
+	}
+	thread := Thread{ID: 1, Name: "MainThread", Current: true}
+	if len(frames) > 0 {
+		thread.Function, thread.File, thread.Line = frames[0].Function, frames[0].File, frames[0].Line
+	}
+	return []Thread{thread}, nil
+}
+
+// SelectThread selects the main thread, which is the only one
+func (d *pdbDebugger) SelectThread(id int) error {
+	if id != 1 {
+		return errors.New("pdb can only debug the main thread")
+	}
+	return d.SelectFrame(0)
+}
+
+// EvalExpression evaluates a Python expression in the selected frame, with "p"
+func (d *pdbDebugger) EvalExpression(expr string) (string, error) {
+	if !d.running {
+		return "", errProgramStopped
+	}
+	resp, err := d.send("p "+expr, pdbRequestTimeout)
+	if err != nil {
+		return "", err
+	}
+	resp = strings.TrimSpace(resp)
+	if after, found := strings.CutPrefix(resp, "***"); found {
+		return "", errors.New(strings.TrimSpace(after))
+	}
+	return resp, nil
+}
+
+// AddWatch adds an expression that is evaluated each time the program stops
+func (d *pdbDebugger) AddWatch(expression string) (string, error) {
+	if value, err := d.EvalExpression(expression); err == nil {
+		d.watchMap[expression] = value
+		d.lastWatch = expression
+	} else {
+		d.watchMap[expression] = "?"
+	}
+	return "", nil
+}
+
+// ReadMemory is not supported, since Python objects are not inspected as raw memory
+func (d *pdbDebugger) ReadMemory(_ string, _ int) (uint64, []byte, error) {
+	return 0, nil, errors.New("reading memory is not supported with pdb")
+}
+
+// Registers and disassembly are not available when debugging Python with pdb
+
+func (d *pdbDebugger) RegisterNames() ([]string, error) { return nil, nil }
+func (d *pdbDebugger) ChangedRegisters() ([]int, error) { return nil, nil }
+func (d *pdbDebugger) ChangedRegisterMap() (map[string]string, error) {
+	return map[string]string{}, nil
+}
+func (d *pdbDebugger) RegisterMap() (map[string]string, error) { return map[string]string{}, nil }
+func (d *pdbDebugger) Disassemble(_ int) ([]string, error)     { return nil, nil }
+func (d *pdbDebugger) Output() string                          { return d.output.String() }
+func (d *pdbDebugger) OutputLen() int                          { return d.output.Len() }
+func (d *pdbDebugger) WatchMap() map[string]string             { return d.watchMap }
+func (d *pdbDebugger) LastSeenWatch() string                   { return d.lastWatch }
+func (d *pdbDebugger) ProgramRunning() bool                    { return d.running }
+func (d *pdbDebugger) SetStepInto(stepInto bool)               { d.stepInto = stepInto }
+func (d *pdbDebugger) SetProgramArguments(args []string)       { d.programArgs = args }
+
+// ConsoleString returns and clears the pdb console output
+func (d *pdbDebugger) ConsoleString() string {
+	s := d.console.String()
+	d.console.Reset()
+	return s
+}
+
+func (d *pdbDebugger) ReverseStep() error {
+	return errors.New("reverse stepping is not supported with pdb")
+}
+
+func (d *pdbDebugger) ReverseNextInstruction() error {
+	return errors.New("reverse stepping is not supported with pdb")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePdbStop(t *testing.T) {
+	stop := parsePdbStop("x is 3\ndone--Return--\n> /tmp/main.py(9)<module>()->None\n-> print(\"done\", end=\"\")\n")
+	if stop.File != "/tmp/main.py" || stop.Line != 9 || stop.Function != "<module>" || stop.Finished {
+		t.Errorf("unexpected stop: %+v", stop)
+	}
+	if stop.Output != "x is 3\ndone" {
+		t.Errorf("unexpected output: %q", stop.Output)
+	}
+	stop = parsePdbStop("bye\nThe program finished and will be restarted\n> /tmp/main.py(1)<module>()\n-> import os\n")
+	if !stop.Finished || stop.Output != "bye\n" || stop.Line != 0 {
+		t.Errorf("expected the program to be finished, got %+v", stop)
+	}
+	stop = parsePdbStop("Traceback (most recent call last):\nZeroDivisionError: division by zero\nUncaught exception. Entering post mortem debugging\nRunning 'cont' or 'step' will restart the program\n> /tmp/main.py(4)add()\n-> c = a / b\n")
+	if stop.Line != 4 || stop.Output != "Traceback (most recent call last):\nZeroDivisionError: division by zero\n" {
+		t.Errorf("unexpected stop after an exception: %+v", stop)
+	}
+}
+
+func TestParsePdbFrames(t *testing.T) {
+	output := "  /usr/lib/python3.11/bdb.py(600)run()\n-> exec(cmd, globals, locals)\n  <string>(1)<module>()\n" +
+		"  /tmp/main.py(7)<module>()\n-> x = add(1, 2)\n> /tmp/main.py(4)add()\n-> c = a + b\n"
+	frames := parsePdbFrames(output)
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d: %+v", len(frames), frames)
+	}
+	if frames[0].Function != "add" || frames[0].Line != 4 || frames[0].Level != 0 {
+		t.Errorf("unexpected innermost frame: %+v", frames[0])
+	}
+	if frames[1].Function != "<module>" || frames[1].Line != 7 || frames[1].Level != 1 {
+		t.Errorf("unexpected outermost frame: %+v", frames[1])
+	}
+	variables := parsePdbVariables("a\tint\t1\nname\tstr\t'hi\\tthere'\n")
+	if len(variables) != 2 || variables[1].String() != "name: 'hi\\tthere'" {
+		t.Errorf("unexpected variables: %+v", variables)
+	}
+}
+
+func TestPdbDebugger(t *testing.T) {
+	if findPython() == "" {
+		t.Skip("python is not installed")
+	}
+	dir := t.TempDir()
+	program := "def add(a, b):\n    c = a + b\n    return c\n\nx = add(1, 2)\nprint('x is', x)\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := newPdbDebugger()
+	var lines []int
+	done := false
+	if _, err := d.Start(dir, "main.py", "", func(line int) { lines = append(lines, line) }, func() { done = true }); err != nil {
+		t.Fatal(err)
+	}
+	defer d.End()
+
+	if err := d.ActivateBreakpoint("main.py", 2, "a > 0", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.AddWatch("x"); err != nil {
+		t.Error(err)
+	}
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0] != 1 || lines[1] != 2 {
+		t.Errorf("expected to stop at line 1 and then at the breakpoint on line 2, got %v", lines)
+	}
+	if frames, err := d.Stack(); err != nil || len(frames) != 2 || frames[0].Function != "add" || frames[1].Line != 5 {
+		t.Errorf("unexpected stack: %+v, %v", frames, err)
+	}
+	if locals, err := d.Locals(); err != nil || len(locals) != 2 || locals[0].String() != "a: 1" || locals[1].Type != "int" {
+		t.Errorf("unexpected locals: %+v, %v", locals, err)
+	}
+	if err := d.SelectFrame(1); err != nil {
+		t.Error(err)
+	}
+	if value, err := d.EvalExpression("add(2, 3)"); err != nil || value != "5" {
+		t.Errorf("expected 5, got %q, %v", value, err)
+	}
+	if _, err := d.EvalExpression("undefined_name"); err == nil {
+		t.Error("expected an error for an undefined name")
+	}
+	if err := d.DeleteBreakpoint("main.py", 2); err != nil {
+		t.Error(err)
+	}
+	if err := d.RunToLine("main.py", 6); err != nil || lines[len(lines)-1] != 6 {
+		t.Errorf("expected to run to line 6, got %v, %v", lines, err)
+	}
+	if err := d.JumpToLine("main.py", 5); err != nil || lines[len(lines)-1] != 5 {
+		t.Errorf("expected to jump back to line 5, got %v, %v", lines, err)
+	}
+	if err := d.Next(); err != nil || lines[len(lines)-1] != 6 {
+		t.Errorf("expected to step over line 5 again, got %v, %v", lines, err)
+	}
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if !done || d.ProgramRunning() {
+		t.Error("expected the program to be done")
+	}
+	if output := d.Output(); output != "x is 3\n" {
+		t.Errorf("unexpected program output: %q", output)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/vt"
+)
+
+// debugInlineValueLength is the maximum length of each value that is shown after a source line
+const debugInlineValueLength = 24
+
+var (
+	debugInlineLocals map[string]string // the values of the local variables of the innermost frame, by name
+	debugInlineStale  bool              // set when the program stops at a new place, so that the locals are fetched again
+)
+
+// identifiersInLine returns the identifiers that are used on the given line, in order and without duplicates.
+// Strings, comments and fields or methods after a "." are skipped.
+func identifiersInLine(line, commentMarker string) []string {
+	if commentMarker != "" {
+		line, _, _ = strings.Cut(line, commentMarker)
+	}
+	var (
+		identifiers []string
+		seen        = make(map[string]bool)
+		quote       rune
+		prev        rune
+		word        strings.Builder
+		afterDot    bool
+	)
+	addWord := func() {
+		if word.Len() > 0 {
+			s := word.String()
+			if !afterDot && !seen[s] && !unicode.IsDigit([]rune(s)[0]) {
+				seen[s] = true
+				identifiers = append(identifiers, s)
+			}
+			word.Reset()
+		}
+	}
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote && prev != '\\' {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			addWord()
+			quote = r
+		case isIdentifierRune(r):
+			if word.Len() == 0 {
+				afterDot = prev == '.'
+			}
+			word.WriteRune(r)
+		default:
+			addWord()
+		}
+		prev = r
+	}
+	addWord()
+	return identifiers
+}
+
+// inlineValuesText returns the values of the given local variables that are used on the given line,
+// like "x = 42, name = "Bob"", or an empty string if none of them are used
+func inlineValuesText(line, commentMarker string, locals map[string]string) string {
+	var parts []string
+	for _, identifier := range identifiersInLine(line, commentMarker) {
+		value, ok := locals[identifier]
+		if !ok || value == "" {
+			continue
+		}
+		value, _, _ = strings.Cut(strings.TrimSpace(value), "\n")
+		parts = append(parts, identifier+" = "+chopRunes(value, debugInlineValueLength))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// debugInlineRange returns the range of lines that the values of the local variables should be shown
+// after, which is from the start of the current function to the current debug line. Returns false if
+// no values should be shown, for instance when another frame than the innermost one is selected.
+// Fetches the local variables again if the program has stopped at a new place.
+func (e *Editor) debugInlineRange() (LineIndex, LineIndex, bool) {
+	if !e.debugMode || e.debugger == nil || !e.debugger.ProgramRunning() || debugSelectedFrame != 0 {
+		return 0, 0, false
+	}
+	debugLine := e.debugLine.Load()
+	if debugLine < 0 || debugLine >= int64(e.Len()) {
+		return 0, 0, false
+	}
+	if debugInlineStale || debugInlineLocals == nil {
+		debugInlineLocals = make(map[string]string)
+		if locals, err := e.debugger.Locals(); err == nil {
+			for _, v := range locals {
+				debugInlineLocals[v.Name] = v.Value
+			}
+		}
+		debugInlineStale = false
+	}
+	if len(debugInlineLocals) == 0 {
+		return 0, 0, false
+	}
+	// The function starts at the closest line above that is not indented, like "func main() {" or "def main():"
+	to := LineIndex(debugLine)
+	from := to
+	for from > 0 {
+		line := e.Line(from)
+		if line != "" && !unicode.IsSpace([]rune(line)[0]) {
+			break
+		}
+		from--
+	}
+	return from, to, true
+}
+
+// drawInlineValues draws the values of the local variables that are used on a line, after the end of the line
+func (e *Editor) drawInlineValues(c *vt.Canvas, xp, yp, cw uint, bg vt.AttributeColor, text string) {
+	if available := int(cw) - int(xp+1); text != "" && available > 0 {
+		c.Write(xp+1, yp, e.CommentColor, bg, chopRunes(asciiFallback(text), available))
+	}
+}
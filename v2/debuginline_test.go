@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIdentifiersInLine(t *testing.T) {
+	tests := []struct {
+		line          string
+		commentMarker string
+		expected      []string
+	}{
+		{"\tsum := x + y*x // add x and z", "//", []string{"sum", "x", "y"}},
+		{"\tfmt.Printf(\"x is %d\\n\", x)", "//", []string{"fmt", "x"}},
+		{"    total = self.count + 2 # count", "#", []string{"total", "self"}},
+		{"for (int i = 0; i < n; i++) {", "//", []string{"for", "int", "i", "n"}},
+	}
+	for _, test := range tests {
+		if identifiers := identifiersInLine(test.line, test.commentMarker); !reflect.DeepEqual(identifiers, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.line, test.expected, identifiers)
+		}
+	}
+}
+
+func TestInlineValuesText(t *testing.T) {
+	locals := map[string]string{"x": "42", "name": "\"Bob\"", "data": "[]int len: 3, cap: 3, [1,2,3]\nmore", "empty": ""}
+	if s := inlineValuesText("\tfmt.Println(name, x, empty, y)", "//", locals); s != "name = \"Bob\", x = 42" {
+		t.Errorf("unexpected inline values: %q", s)
+	}
+	if s := inlineValuesText("\treturn data", "//", locals); s != "data = "+chopRunes("[]int len: 3, cap: 3, [1,2,3]", debugInlineValueLength) {
+		t.Errorf("expected a shortened value on a single line, got %q", s)
+	}
+	if s := inlineValuesText("}", "//", locals); s != "" {
+		t.Errorf("expected no inline values, got %q", s)
+	}
+}
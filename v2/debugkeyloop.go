@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/xyproto/vt"
@@ -21,7 +23,12 @@ func (e *Editor) handleDebugKey(key string, c *vt.Canvas, tty *vt.TTY, status *S
 	case "c:23": // ctrl-w, add watch
 		if expression, ok := e.UserInput(c, tty, status, "Variable name to watch", "", []string{}, false, ""); ok {
 			if e.debugger == nil {
-				e.debugger = newGDBDebugger(e.mode)
+				// Add the watch when the session starts, with the debugger that is right for this mode
+				if e.debugWatches == nil {
+					e.debugWatches = make(map[string]string)
+				}
+				e.debugWatches[expression] = "?"
+				return true
 			}
 			if _, err := e.debugger.AddWatch(expression); err != nil {
 				status.ClearAll(c, true)
@@ -159,13 +166,88 @@ func (e *Editor) handleDebugKey(key string, c *vt.Canvas, tty *vt.TTY, status *S
 		return true
 
 	case "c:16": // ctrl-p, cycle register pane layout
-		// e.showRegisters has three states, 0 (SmallRegisterWindow), 1 (LargeRegisterWindow) and 2 (NoRegisterWindow)
+		// e.showRegisters has six states: smallRegisterWindow, largeRegisterWindow, stackAndLocalsWindow, threadsWindow, memoryWindow and noRegisterWindow
 		e.debugShowRegisters++
 		if e.debugShowRegisters > noRegisterWindow {
 			e.debugShowRegisters = smallRegisterWindow
 		}
 		return true
 
+	case "c:21", "c:4": // ctrl-u or ctrl-d, select the frame above or below in the call stack, or the thread above or below
+		if (e.debugShowRegisters != stackAndLocalsWindow && e.debugShowRegisters != threadsWindow) || e.debugger == nil || !e.debugger.ProgramRunning() {
+			return false // undo or delete, as usual
+		}
+		if e.debugShowRegisters == threadsWindow {
+			delta := -1 // up, to the thread above
+			if key == "c:4" {
+				delta = 1 // down, to the thread below
+			}
+			status.ClearAll(c, false)
+			if err := e.DebugSelectNextThread(delta, c, status); err != nil {
+				status.SetError(err)
+			}
+			status.SetMessageAfterRedraw(status.Message())
+			e.redrawCursor.Store(true)
+			return true
+		}
+		n := debugSelectedFrame + 1 // up, to the caller
+		if key == "c:4" {
+			n = debugSelectedFrame - 1 // down, to the callee
+		}
+		status.ClearAll(c, false)
+		if err := e.DebugSelectFrame(n, c, status); err != nil {
+			status.SetError(err)
+		}
+		status.SetMessageAfterRedraw(status.Message())
+		e.redrawCursor.Store(true)
+		return true
+
+	case "F4", "F7": // F4, run to the line of the cursor, or F7, jump to the line of the cursor without running the lines in between
+		if e.debugger == nil || !e.debugger.ProgramRunning() {
+			return false // file browser or next typo, as usual
+		}
+		status.ClearAll(c, false)
+		lineNumber := e.LineNumber()
+		var err error
+		if key == "F7" {
+			err = e.debugger.JumpToLine(filepath.Base(e.filename), int(lineNumber))
+		} else {
+			e.debugLastStepWasInstruction = false
+			err = e.debugger.RunToLine(filepath.Base(e.filename), int(lineNumber))
+		}
+		if err != nil {
+			if err == errProgramStopped || !e.debugger.ProgramRunning() {
+				e.DebugEnd()
+				status.SetMessage("Execution complete")
+				e.GoToEnd(c, nil)
+			} else {
+				status.SetError(err)
+			}
+		} else if e.debugComplete.Load() {
+			e.DebugEnd()
+			status.SetMessage("Execution complete")
+		} else if LineNumber(e.debugLine.Load()+1) != lineNumber {
+			status.SetMessage(fmt.Sprintf("Stopped at line %d, before reaching line %d", e.debugLine.Load()+1, lineNumber))
+		} else if key == "F7" {
+			status.SetMessage(fmt.Sprintf("Jumped to line %d", lineNumber))
+		} else {
+			status.SetMessage(fmt.Sprintf("Ran to line %d", lineNumber))
+		}
+		e.redrawCursor.Store(true)
+		status.SetMessageAfterRedraw(status.Message())
+		return true
+
+	case "c:5": // ctrl-e, examine memory at an address or expression, when the memory pane is shown
+		if e.debugShowRegisters != memoryWindow || e.debugger == nil || !e.debugger.ProgramRunning() {
+			return false // end of line, as usual
+		}
+		if e.DebugExamineMemory(c, tty, status) {
+			status.ClearAll(c, false)
+			status.SetMessageAfterRedraw("Memory at " + debugMemoryExpression)
+		}
+		e.redrawCursor.Store(true)
+		return true
+
 	case "c:14": // ctrl-n, next instruction
 		if e.debugger != nil {
 			if e.debugComplete.Load() {
@@ -359,34 +441,44 @@ func (e *Editor) handleDebugKey(key string, c *vt.Canvas, tty *vt.TTY, status *S
 
 	case "c:2", "F9": // ctrl-b or F9, toggle breakpoint
 		status.ClearAll(c, false)
-		if e.breakpoint == nil {
-			e.breakpoint = e.pos.Copy()
-			_, err := e.DebugActivateBreakpoint(filepath.Base(e.filename))
-			if err != nil {
-				status.SetError(err)
-				status.Show(c, e)
-				e.redrawCursor.Store(true)
-				return true
-			}
-			s := "Placed breakpoint at line " + e.LineNumber().String()
-			status.SetMessage("  " + s + "  ")
-		} else if e.breakpoint.LineNumber() == e.LineNumber() {
-			// setting a breakpoint at the same line twice: remove the breakpoint
-			s := "Removed breakpoint at line " + e.breakpoint.LineNumber().String()
-			status.SetMessage(s)
-			e.breakpoint = nil
+		lineNumber := e.LineNumber()
+		removed, err := e.RemoveBreakpoint(lineNumber)
+		if !removed && err == nil {
+			err = e.SetBreakpoint(Breakpoint{Line: lineNumber})
+		}
+		if err != nil {
+			status.SetError(err)
+		} else if removed {
+			status.SetMessage("Removed breakpoint at line " + lineNumber.String())
+		} else {
+			status.SetMessage("  Placed breakpoint at line " + lineNumber.String() + "  ")
+		}
+		e.redraw.Store(true)
+		status.SetMessageAfterRedraw(status.Message())
+		e.redrawCursor.Store(true)
+		return true
+
+	case "c:20": // ctrl-t, set the condition of the breakpoint at this line
+		lineNumber := e.LineNumber()
+		bp, _ := allBreakpoints().Find(e.breakpointKey(), lineNumber)
+		defaultValue := bp.Condition
+		if bp.IgnoreCount > 0 {
+			defaultValue = strconv.Itoa(bp.IgnoreCount)
+		}
+		input, ok := e.UserInput(c, tty, status, "Breakpoint condition, or number of hits to ignore", defaultValue, []string{}, false, "")
+		if !ok {
+			status.ClearAll(c, true)
+			return true
+		}
+		bp.Line = lineNumber
+		bp.Condition, bp.IgnoreCount = parseBreakpointCondition(input)
+		if err := e.SetBreakpoint(bp); err != nil {
+			status.SetError(err)
 		} else {
-			undo.Snapshot(e)
-			// Go to the breakpoint position
-			e.GoToPosition(c, status, *e.breakpoint)
-			// Do the redraw manually before showing the status message
-			e.HideCursorDrawLines(c, true, false, true)
-			e.redraw.Store(false)
-			// Show the status message
-			s := "Jumped to breakpoint at line " + e.LineNumber().String()
-			status.SetMessage(s)
-		}
-		status.Show(c, e)
+			status.SetMessage("Placed breakpoint at " + bp.String())
+		}
+		e.redraw.Store(true)
+		status.SetMessageAfterRedraw(status.Message())
 		e.redrawCursor.Store(true)
 		return true
 
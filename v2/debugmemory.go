@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt"
+)
+
+var (
+	debugMemoryExpression string // the address or expression that the memory pane shows
+	debugMemoryAddress    uint64
+	debugMemoryData       []byte
+	debugMemoryPrevious   []byte // the memory before the last step, for highlighting the bytes that changed
+	debugMemoryStale      bool   // set when the program stops at a new place, so that the memory is read again
+)
+
+// lldbMemoryRegexp matches a line from "memory read --format x --size 1", like "0x16fdff0b8: 0x48 0x65"
+var lldbMemoryRegexp = regexp.MustCompile(`^(0x[0-9a-fA-F]+):((?:\s+0x[0-9a-fA-F]{2})+)`)
+
+// parseGDBMemory parses the payload of a GDB/MI -data-read-memory-bytes response, which is a
+// list of memory={begin,offset,end,contents} tuples. Only the first readable block is used.
+func parseGDBMemory(payload map[string]any) (uint64, []byte, error) {
+	list, _ := payload["memory"].([]any)
+	if len(list) == 0 {
+		return 0, nil, errors.New("gdb returned no memory")
+	}
+	block, ok := list[0].(map[string]any)
+	if !ok {
+		return 0, nil, errors.New("unexpected memory block from gdb")
+	}
+	begin, err := strconv.ParseUint(gdbString(block, "begin"), 0, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unexpected start address from gdb: %w", err)
+	}
+	offset, _ := strconv.ParseUint(gdbString(block, "offset"), 0, 64)
+	data, err := hex.DecodeString(gdbString(block, "contents"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return begin + offset, data, nil
+}
+
+// parseLLDBMemory parses the output of "memory read --format x --size 1"
+func parseLLDBMemory(output string) (uint64, []byte, error) {
+	var (
+		start uint64
+		data  []byte
+		found bool
+	)
+	for line := range strings.SplitSeq(output, "\n") {
+		m := lldbMemoryRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		if !found {
+			addr, err := strconv.ParseUint(m[1], 0, 64)
+			if err != nil {
+				return 0, nil, err
+			}
+			start, found = addr, true
+		}
+		for field := range strings.FieldsSeq(m[2]) {
+			b, err := strconv.ParseUint(field, 0, 8)
+			if err != nil {
+				return 0, nil, err
+			}
+			data = append(data, byte(b))
+		}
+	}
+	if !found {
+		return 0, nil, errors.New("lldb returned no memory")
+	}
+	return start, data, nil
+}
+
+// hexDumpBytesPerRow returns how many bytes fit on a row of the given width, as a power of two
+// from 1 to 16, when each row has an address, the bytes in hex and the bytes as ASCII
+func hexDumpBytesPerRow(width, addressWidth int) int {
+	n := 16
+	for n > 1 && addressWidth+3+4*n > width {
+		n /= 2
+	}
+	return n
+}
+
+// hexDumpASCII returns the byte as a printable ASCII character, or "."
+func hexDumpASCII(b byte) string {
+	if b < 32 || b > 126 {
+		return "."
+	}
+	return string(rune(b))
+}
+
+// DebugExamineMemory asks for an address or an expression, like "&x", "buf" or "$sp",
+// and shows the memory at that address in the lower right pane
+func (e *Editor) DebugExamineMemory(c *vt.Canvas, tty *vt.TTY, status *StatusBar) bool {
+	expression, ok := e.UserInput(c, tty, status, "Memory address or expression", debugMemoryExpression, []string{}, false, "")
+	if !ok || strings.TrimSpace(expression) == "" {
+		return false
+	}
+	debugMemoryExpression = strings.TrimSpace(expression)
+	debugMemoryAddress = 0
+	debugMemoryData = nil
+	debugMemoryPrevious = nil
+	e.debugShowRegisters = memoryWindow
+	e.redraw.Store(true)
+	return true
+}
+
+// DrawMemory will draw a hex and ASCII dump of the memory at the address that has been given with
+// ctrl-e, in the lower right, when that layout has been selected. Bytes that changed at the last step
+// are highlighted.
+func (e *Editor) DrawMemory(c *vt.Canvas, repositionCursor bool) error {
+	defer func() {
+		// Reposition the cursor
+		if repositionCursor {
+			e.EnableAndPlaceCursor(c)
+		}
+	}()
+
+	if e.debugShowRegisters != memoryWindow || e.debugger == nil || !e.debugger.ProgramRunning() {
+		return nil
+	}
+
+	canvasBox := NewCanvasBox(c)
+
+	// The same placement as the narrow register box, below the watches box
+	lowerRightBox := NewBox()
+	lowerRightBox.LowerRightPlacement(canvasBox, 48)
+	if watchesBoxBottom > 0 && watchesBoxBottom+1 < canvasBox.H {
+		desiredY := watchesBoxBottom + 1
+		if desiredY > lowerRightBox.Y {
+			lowerRightBox.H -= desiredY - lowerRightBox.Y
+		}
+		lowerRightBox.Y = desiredY
+	}
+	if showInstructionPane {
+		lowerRightBox.H = int(float64(lowerRightBox.H) * 0.9)
+	}
+	if lowerRightBox.H < 4 {
+		return nil
+	}
+
+	bt := e.NewBoxTheme()
+	bt.Background = &e.DebugRegistersBackground
+
+	e.DrawBox(bt, c, lowerRightBox)
+
+	listBox := NewBox()
+	listBox.FillWithMargins(lowerRightBox, 2, 1)
+	if listBox.W <= 0 || listBox.H <= 0 {
+		return nil
+	}
+
+	if debugMemoryExpression == "" {
+		e.DrawTitle(bt, c, lowerRightBox, "Memory", true)
+		e.DrawList(bt, c, listBox, []string{chopRunes("Press ctrl-e to enter an address", listBox.W)}, -1)
+		c.HideCursorAndDraw()
+		return nil
+	}
+	e.DrawTitle(bt, c, lowerRightBox, "Memory at "+chopRunes(debugMemoryExpression, lowerRightBox.W-16), true)
+
+	// Assume addresses with 12 hex digits, which is enough for user space on 64-bit systems
+	const addressWidth = 12
+	bytesPerRow := hexDumpBytesPerRow(listBox.W, addressWidth)
+	n := bytesPerRow * listBox.H
+
+	// Read the memory again if the program has stopped somewhere else, or if the pane has changed size
+	if debugMemoryStale || len(debugMemoryData) != n {
+		addr, data, err := e.debugger.ReadMemory(debugMemoryExpression, n)
+		if err != nil {
+			e.DrawList(bt, c, listBox, []string{chopRunes(err.Error(), listBox.W)}, -1)
+			c.HideCursorAndDraw()
+			return err
+		}
+		if debugMemoryStale {
+			debugMemoryPrevious = nil
+			if addr == debugMemoryAddress {
+				debugMemoryPrevious = debugMemoryData
+			}
+			debugMemoryStale = false
+		}
+		debugMemoryAddress, debugMemoryData = addr, data
+	}
+
+	changedFg, changedBg := e.StatusErrorForeground, e.StatusErrorBackground
+	for row := 0; row*bytesPerRow < len(debugMemoryData) && row < listBox.H; row++ {
+		x := uint(listBox.X)
+		y := uint(listBox.Y + row)
+		offset := row * bytesPerRow
+		address := fmt.Sprintf("%0*x  ", addressWidth, debugMemoryAddress+uint64(offset))
+		c.Write(x, y, *bt.Text, *bt.Background, address)
+		x += ulen(address)
+		var ascii strings.Builder
+		for i := offset; i < offset+bytesPerRow; i++ {
+			if i >= len(debugMemoryData) {
+				c.Write(x, y, *bt.Text, *bt.Background, "   ")
+				x += 3
+				continue
+			}
+			b := debugMemoryData[i]
+			if i < len(debugMemoryPrevious) && debugMemoryPrevious[i] != b {
+				c.Write(x, y, changedFg, changedBg, fmt.Sprintf("%02x", b))
+			} else {
+				c.Write(x, y, *bt.Text, *bt.Background, fmt.Sprintf("%02x", b))
+			}
+			c.Write(x+2, y, *bt.Text, *bt.Background, " ")
+			x += 3
+			ascii.WriteString(hexDumpASCII(b))
+		}
+		c.Write(x, y, *bt.Text, *bt.Background, " "+ascii.String())
+	}
+
+	// Blit
+	c.HideCursorAndDraw()
+
+	return nil
+}
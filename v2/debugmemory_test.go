@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGDBMemory(t *testing.T) {
+	payload := map[string]any{
+		"memory": []any{
+			map[string]any{"begin": "0x7fffffffe0a0", "offset": "0x0000000000000000", "end": "0x7fffffffe0a4", "contents": "68690a00"},
+		},
+	}
+	addr, data, err := parseGDBMemory(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != 0x7fffffffe0a0 || string(data) != "hi\n\x00" {
+		t.Errorf("unexpected memory: %x, %q", addr, data)
+	}
+	if _, _, err := parseGDBMemory(map[string]any{}); err == nil {
+		t.Error("expected an error when there is no memory in the payload")
+	}
+}
+
+func TestParseLLDBMemory(t *testing.T) {
+	output := "memory read --force --size 1 --format x --count 10 -- &x\r\n" +
+		"0x16fdff0b8: 0x48 0x65 0x6c 0x6c 0x6f 0x00 0x00 0x00\r\n" +
+		"0x16fdff0c0: 0x2a 0x00\r\n"
+	addr, data, err := parseLLDBMemory(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != 0x16fdff0b8 || len(data) != 10 || string(data[:5]) != "Hello" || data[8] != 42 {
+		t.Errorf("unexpected memory: %x, %v", addr, data)
+	}
+	if _, _, err := parseLLDBMemory("error: invalid start address expression."); err == nil {
+		t.Error("expected an error when there is no memory in the output")
+	}
+}
+
+func TestHexDumpBytesPerRow(t *testing.T) {
+	for _, tc := range []struct{ width, expected int }{{80, 16}, {64, 8}, {40, 4}, {10, 1}} {
+		if n := hexDumpBytesPerRow(tc.width, 12); n != tc.expected {
+			t.Errorf("expected %d bytes per row for width %d, got %d", tc.expected, tc.width, n)
+		}
+	}
+}
+
+func TestDlvVariableAddress(t *testing.T) {
+	for _, tc := range []struct {
+		v        dlvVariable
+		expected uint64
+	}{
+		{dlvVariable{Kind: reflect.Pointer, Children: []dlvVariable{{Addr: 0xc000012340}}}, 0xc000012340},
+		{dlvVariable{Kind: reflect.UnsafePointer, Value: "unsafe.Pointer(0xc000012340)"}, 0xc000012340},
+		{dlvVariable{Kind: reflect.Uintptr, Value: "4096"}, 4096},
+		{dlvVariable{Kind: reflect.Array, Addr: 0xc000012350}, 0xc000012350},
+	} {
+		if addr, err := dlvVariableAddress(tc.v); err != nil || addr != tc.expected {
+			t.Errorf("expected %x for %+v, got %x, %v", tc.expected, tc.v, addr, err)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt"
+)
+
+// StackFrame is a frame in the call stack of the debugged program, where frame 0 is the innermost frame
+type StackFrame struct {
+	Function string
+	File     string // the full path, if the debugger knows it
+	Address  string
+	Level    int
+	Line     int // 0 if there is no source line for this frame
+}
+
+// String returns a short description of the frame, like "#1 main main.c:12"
+func (f StackFrame) String() string {
+	s := fmt.Sprintf("#%d %s", f.Level, f.Function)
+	if f.File != "" && f.Line > 0 {
+		s += fmt.Sprintf(" %s:%d", filepath.Base(f.File), f.Line)
+	} else if f.Address != "" {
+		s += " " + f.Address
+	}
+	return s
+}
+
+// Variable is a local variable or argument in the selected frame
+type Variable struct {
+	Name  string
+	Type  string
+	Value string // may be empty for structs and arrays, if the debugger does not show those
+}
+
+// String returns the variable as "name: value", or "name: type" if there is no value
+func (v Variable) String() string {
+	if v.Value == "" {
+		return v.Name + ": " + v.Type
+	}
+	return v.Name + ": " + v.Value
+}
+
+// debugSelectedFrame is the frame that is selected in the call stack pane, 0 is the innermost frame
+var debugSelectedFrame int
+
+// gdbString returns the string with the given key in a GDB/MI tuple
+func gdbString(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// parseGDBFrames parses the payload of a GDB/MI -stack-list-frames response,
+// which is a list of frame={level,addr,func,file,fullname,line} tuples
+func parseGDBFrames(payload map[string]any) []StackFrame {
+	list, _ := payload["stack"].([]any)
+	frames := make([]StackFrame, 0, len(list))
+	for _, item := range list {
+		itemMap, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		frameMap, ok := itemMap["frame"].(map[string]any)
+		if !ok {
+			continue
+		}
+		frame := StackFrame{
+			Function: gdbString(frameMap, "func"),
+			File:     gdbString(frameMap, "fullname"),
+			Address:  gdbString(frameMap, "addr"),
+		}
+		if frame.File == "" {
+			frame.File = gdbString(frameMap, "file")
+		}
+		if frame.Function == "" {
+			frame.Function = "??"
+		}
+		frame.Level, _ = strconv.Atoi(gdbString(frameMap, "level"))
+		frame.Line, _ = strconv.Atoi(gdbString(frameMap, "line"))
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// parseGDBVariables parses the payload of a GDB/MI -stack-list-variables --simple-values response
+func parseGDBVariables(payload map[string]any) []Variable {
+	list, _ := payload["variables"].([]any)
+	variables := make([]Variable, 0, len(list))
+	for _, item := range list {
+		variableMap, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		variables = append(variables, Variable{
+			Name:  gdbString(variableMap, "name"),
+			Type:  gdbString(variableMap, "type"),
+			Value: gdbString(variableMap, "value"),
+		})
+	}
+	return variables
+}
+
+// lldbFrameRegexp matches a frame in the output of LLDB's "bt" command.
+// Example: "  * frame #0: 0x0000000100003f84 a.out`main at main.c:4:9"
+var lldbFrameRegexp = regexp.MustCompile("frame #(\\d+): (0x[0-9a-fA-F]+) [^`]*`(.*?)(?: at ([^\\s:]+):(\\d+)(?::\\d+)?)?$")
+
+// lldbVariableRegexp matches a variable in the output of LLDB's "frame variable" command.
+// Example: "(int) x = 5"
+var lldbVariableRegexp = regexp.MustCompile(`^\((.+?)\) ([^\s=]+) = (.*)$`)
+
+// parseLLDBFrames parses the output of LLDB's "bt" command
+func parseLLDBFrames(output string) []StackFrame {
+	var frames []StackFrame
+	for line := range strings.SplitSeq(output, "\n") {
+		m := lldbFrameRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		level, _ := strconv.Atoi(m[1])
+		lineNumber, _ := strconv.Atoi(m[5])
+		function := m[3]
+		if i := strings.Index(function, " + "); i >= 0 { // like "start + 2236"
+			function = function[:i]
+		}
+		frames = append(frames, StackFrame{Level: level, Address: m[2], Function: function, File: m[4], Line: lineNumber})
+	}
+	return frames
+}
+
+// parseLLDBVariables parses the output of LLDB's "frame variable" command.
+// Only the first line of structs and arrays, which span several lines, is used.
+func parseLLDBVariables(output string) []Variable {
+	var variables []Variable
+	for line := range strings.SplitSeq(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue // a field of a struct or an element of an array
+		}
+		m := lldbVariableRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		value := m[3]
+		if value == "{" {
+			value = "{...}"
+		}
+		variables = append(variables, Variable{Type: m[1], Name: m[2], Value: value})
+	}
+	return variables
+}
+
+// DebugSelectFrame selects the given frame in the call stack, so that the locals of that frame are
+// shown, and moves to the source line of the frame if it is in the current file
+func (e *Editor) DebugSelectFrame(n int, c *vt.Canvas, status *StatusBar) error {
+	if e.debugger == nil || !e.debugger.ProgramRunning() {
+		return errors.New("the program is not running")
+	}
+	frames, err := e.debugger.Stack()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n >= len(frames) {
+		return fmt.Errorf("there is no frame #%d", n)
+	}
+	if err := e.debugger.SelectFrame(n); err != nil {
+		return err
+	}
+	debugSelectedFrame = n
+	frame := frames[n]
+	if frame.Line > 0 && filepath.Base(frame.File) == filepath.Base(e.filename) {
+		e.redraw.Store(e.GoToLineNumber(LineNumber(frame.Line), c, status, true))
+		status.SetMessage("Selected frame " + frame.String())
+	} else if frame.Line > 0 {
+		status.SetMessage(fmt.Sprintf("Selected frame #%d, which is in %s", n, filepath.Base(frame.File)))
+	} else {
+		status.SetMessage(fmt.Sprintf("Selected frame #%d, which has no source", n))
+	}
+	e.redraw.Store(true)
+	return nil
+}
+
+// DrawStackAndLocals will draw the call stack and the local variables of the selected frame in the
+// lower right, in place of the registers, when that layout has been selected with ctrl-p
+func (e *Editor) DrawStackAndLocals(c *vt.Canvas, repositionCursor bool) error {
+	defer func() {
+		// Reposition the cursor
+		if repositionCursor {
+			e.EnableAndPlaceCursor(c)
+		}
+	}()
+
+	if e.debugShowRegisters != stackAndLocalsWindow || e.debugger == nil || !e.debugger.ProgramRunning() {
+		return nil
+	}
+
+	frames, err := e.debugger.Stack()
+	if err != nil {
+		return err
+	}
+	locals, err := e.debugger.Locals()
+	if err != nil {
+		return err
+	}
+
+	canvasBox := NewCanvasBox(c)
+
+	// The same placement as the narrow register box, below the watches box
+	lowerRightBox := NewBox()
+	lowerRightBox.LowerRightPlacement(canvasBox, 40)
+	if watchesBoxBottom > 0 && watchesBoxBottom+1 < canvasBox.H {
+		desiredY := watchesBoxBottom + 1
+		if desiredY > lowerRightBox.Y {
+			lowerRightBox.H -= desiredY - lowerRightBox.Y
+		}
+		lowerRightBox.Y = desiredY
+	}
+	if showInstructionPane {
+		lowerRightBox.H = int(float64(lowerRightBox.H) * 0.9)
+	}
+	if lowerRightBox.H < 6 {
+		return nil
+	}
+
+	// The call stack gets the upper half and the locals get the lower half
+	stackBox := *lowerRightBox
+	stackBox.H = lowerRightBox.H / 2
+	localsBox := *lowerRightBox
+	localsBox.Y = stackBox.Y + stackBox.H
+	localsBox.H = lowerRightBox.H - stackBox.H
+
+	bt := e.NewBoxTheme()
+	bt.Background = &e.DebugRegistersBackground
+
+	drawPane := func(r *Box, title string, items []string, selected int) {
+		e.DrawBox(bt, c, r)
+		e.DrawTitle(bt, c, r, title, true)
+		listBox := NewBox()
+		listBox.FillWithMargins(r, 2, 1)
+		if listBox.W <= 0 || listBox.H <= 0 {
+			return
+		}
+		// Scroll so that the selected item is visible
+		if selected >= listBox.H {
+			items = items[selected-listBox.H+1:]
+			selected = listBox.H - 1
+		}
+		if len(items) > listBox.H {
+			items = items[:listBox.H]
+		}
+		for i, item := range items {
+			items[i] = chopRunes(asciiFallback(item), listBox.W)
+		}
+		e.DrawList(bt, c, listBox, items, selected)
+	}
+
+	frameItems := make([]string, len(frames))
+	for i, frame := range frames {
+		frameItems[i] = frame.String()
+	}
+	if debugSelectedFrame >= len(frames) {
+		debugSelectedFrame = 0
+	}
+	drawPane(&stackBox, "Call stack", frameItems, debugSelectedFrame)
+
+	localItems := make([]string, len(locals))
+	for i, variable := range locals {
+		localItems[i] = variable.String()
+	}
+	drawPane(&localsBox, fmt.Sprintf("Locals in frame #%d", debugSelectedFrame), localItems, -1)
+
+	// Blit
+	c.HideCursorAndDraw()
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseGDBFrames(t *testing.T) {
+	payload := map[string]any{
+		"stack": []any{
+			map[string]any{"frame": map[string]any{"level": "0", "addr": "0x401136", "func": "add", "file": "main.c", "fullname": "/tmp/main.c", "line": "4"}},
+			map[string]any{"frame": map[string]any{"level": "1", "addr": "0x401150", "func": "main", "file": "main.c", "line": "9"}},
+			map[string]any{"frame": map[string]any{"level": "2", "addr": "0x7ffff7c29d90"}},
+		},
+	}
+	frames := parseGDBFrames(payload)
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(frames))
+	}
+	if frames[0].File != "/tmp/main.c" || frames[0].Line != 4 || frames[0].Function != "add" {
+		t.Errorf("unexpected first frame: %+v", frames[0])
+	}
+	if frames[1].File != "main.c" || frames[1].Level != 1 {
+		t.Errorf("expected the file name to be used when there is no full name, got %+v", frames[1])
+	}
+	if s := frames[2].String(); s != "#2 ?? 0x7ffff7c29d90" {
+		t.Errorf("unexpected description of a frame without source: %s", s)
+	}
+}
+
+func TestParseGDBVariables(t *testing.T) {
+	payload := map[string]any{
+		"variables": []any{
+			map[string]any{"name": "x", "type": "int", "value": "5"},
+			map[string]any{"name": "numbers", "type": "int [3]"},
+		},
+	}
+	variables := parseGDBVariables(payload)
+	if len(variables) != 2 || variables[0].String() != "x: 5" || variables[1].String() != "numbers: int [3]" {
+		t.Errorf("unexpected variables: %+v", variables)
+	}
+}
+
+func TestParseLLDBOutput(t *testing.T) {
+	bt := "bt\r\n* thread #1, queue = 'com.apple.main-thread', stop reason = breakpoint 1.1\r\n" +
+		"  * frame #0: 0x0000000100003f84 a.out`add(a=1, b=2) at main.c:4:9\r\n" +
+		"    frame #1: 0x0000000100003fa8 a.out`main at main.c:9:5\r\n" +
+		"    frame #2: 0x0000000180ad20e0 dyld`start + 2360\r\n"
+	frames := parseLLDBFrames(bt)
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d: %+v", len(frames), frames)
+	}
+	if frames[0].Function != "add(a=1, b=2)" || frames[0].File != "main.c" || frames[0].Line != 4 {
+		t.Errorf("unexpected first frame: %+v", frames[0])
+	}
+	if frames[2].Function != "start" || frames[2].Line != 0 || frames[2].Level != 2 {
+		t.Errorf("unexpected last frame: %+v", frames[2])
+	}
+
+	variables := parseLLDBVariables("frame variable\r\n(int) a = 1\r\n(point) p = {\r\n  x = 1\r\n  y = 2\r\n}\r\n(const char *) s = 0x0000000100003fb0 \"hi\"\r\n")
+	if len(variables) != 3 {
+		t.Fatalf("expected 3 variables, got %d: %+v", len(variables), variables)
+	}
+	if variables[1].String() != "p: {...}" || variables[2].Type != "const char *" {
+		t.Errorf("unexpected variables: %+v", variables)
+	}
+}
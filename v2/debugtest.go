@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt"
+)
+
+// goTestPrefixes are the prefixes of the Go functions that can be selected when running a test binary
+var goTestPrefixes = []string{"Test", "Fuzz", "Example", "Benchmark"}
+
+// CurrentTestName returns the name of the Go or Rust test function that the cursor is in,
+// and the line index of the function definition. Returns false if the cursor is not in a test.
+func (e *Editor) CurrentTestName() (string, LineIndex, bool) {
+	name, funcLineIndex := e.FunctionNameForLineIndex(e.LineIndex())
+	if name == "" {
+		return "", 0, false
+	}
+	switch e.mode {
+	case mode.Go:
+		if !strings.HasSuffix(e.filename, "_test.go") {
+			return "", 0, false
+		}
+		for _, prefix := range goTestPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				return name, funcLineIndex, true
+			}
+		}
+	case mode.Rust:
+		// Look for #[test] or an attribute like #[tokio::test] above the function
+		for i := funcLineIndex - 1; i >= 0; i-- {
+			trimmedLine := strings.TrimSpace(e.Line(i))
+			if trimmedLine == "#[test]" || strings.HasSuffix(trimmedLine, "::test]") {
+				return name, funcLineIndex, true
+			}
+			if !strings.HasPrefix(trimmedLine, "#[") && !strings.HasPrefix(trimmedLine, "//") {
+				break
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// rustModules returns the names of the mod blocks that the given line is in, outermost first
+func (e *Editor) rustModules(n LineIndex) []string {
+	var modules []string
+	indentation := len(e.LeadingWhitespaceAt(n))
+	for i := n - 1; i >= 0 && indentation > 0; i-- {
+		trimmedLine := strings.TrimSpace(e.Line(i))
+		lineIndentation := len(e.LeadingWhitespaceAt(i))
+		if trimmedLine == "" || lineIndentation >= indentation {
+			continue
+		}
+		indentation = lineIndentation
+		fields := strings.Fields(strings.TrimSuffix(trimmedLine, "{"))
+		if len(fields) >= 2 && fields[len(fields)-2] == "mod" && strings.HasSuffix(trimmedLine, "{") {
+			modules = append([]string{fields[len(fields)-1]}, modules...)
+		}
+	}
+	return modules
+}
+
+// rustTestPath returns the full path of a Rust test, like "math::tests::it_adds", given the path
+// of the source file relative to the project directory and the mod blocks that the test is in
+func rustTestPath(relFilename string, modules []string, name string) string {
+	var path []string
+	if rest, ok := strings.CutPrefix(filepath.ToSlash(relFilename), "src/"); ok && !strings.HasPrefix(rest, "bin/") {
+		// Files in src/ are modules of the library or the executable, except for the crate roots
+		rest = strings.TrimSuffix(strings.TrimSuffix(rest, ".rs"), "/mod")
+		if rest != "lib" && rest != "main" {
+			path = strings.Split(rest, "/")
+		}
+	}
+	path = append(path, modules...)
+	return strings.Join(append(path, name), "::")
+}
+
+// testProgramArguments returns the arguments that makes a test binary run only the given test.
+// For Rust, the name must be the full path of the test, like "tests::it_adds".
+func testProgramArguments(m mode.Mode, name string) []string {
+	if m == mode.Rust {
+		// Run the test in the main thread and let the output through, which is easier to follow
+		return []string{name, "--exact", "--nocapture", "--test-threads=1"}
+	}
+	if strings.HasPrefix(name, "Benchmark") {
+		return []string{"-test.run", "^$", "-test.bench", "^" + name + "$", "-test.v"}
+	}
+	return []string{"-test.run", "^" + name + "$", "-test.v"}
+}
+
+// cargoTestExecutable finds the test binary for the given source file in the output of
+// "cargo test --no-run --message-format=json". Integration tests have their own binary,
+// while unit tests are in the binary of the library or the executable.
+func cargoTestExecutable(output []byte, absFilename string) string {
+	var (
+		found    string
+		scanner  = bufio.NewScanner(bytes.NewReader(output))
+		artifact struct {
+			Reason string `json:"reason"`
+			Target struct {
+				SrcPath string   `json:"src_path"`
+				Kind    []string `json:"kind"`
+			} `json:"target"`
+			Executable string `json:"executable"`
+			Profile    struct {
+				Test bool `json:"test"`
+			} `json:"profile"`
+		}
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		artifact.Executable = ""
+		artifact.Target.Kind = nil
+		if err := json.Unmarshal(scanner.Bytes(), &artifact); err != nil {
+			continue
+		}
+		if artifact.Reason != "compiler-artifact" || !artifact.Profile.Test || artifact.Executable == "" {
+			continue
+		}
+		if artifact.Target.SrcPath == absFilename {
+			return artifact.Executable
+		}
+		if found == "" && len(artifact.Target.Kind) > 0 && (artifact.Target.Kind[0] == "lib" || artifact.Target.Kind[0] == "bin") {
+			found = artifact.Executable
+		}
+	}
+	return found
+}
+
+// cargoProjectDir returns the directory with the Cargo.toml file for the given source directory
+func cargoProjectDir(sourceDir string) (string, error) {
+	projectDir := sourceDir
+	for !files.IsFile(filepath.Join(projectDir, "Cargo.toml")) {
+		parentDir := filepath.Dir(projectDir)
+		if parentDir == projectDir {
+			return "", errors.New("could not find Cargo.toml")
+		}
+		projectDir = parentDir
+	}
+	return projectDir, nil
+}
+
+// buildTestBinary builds the test binary for the Go package or Rust crate that the given file is in,
+// with debug information, and returns the path to it. A Go test binary is placed in a new temporary
+// directory, which is also returned, so that it can be removed when debugging ends.
+func (e *Editor) buildTestBinary(absFilename string) (string, string, error) {
+	sourceDir := filepath.Dir(absFilename)
+	switch e.mode {
+	case mode.Go:
+		testDir, err := os.MkdirTemp("", "o-debugtest-")
+		if err != nil {
+			return "", "", err
+		}
+		testBinary := filepath.Join(testDir, filepath.Base(sourceDir)+".test")
+		cmd := exec.Command("go", "test", "-c", "-gcflags=all=-N -l", "-o", testBinary)
+		cmd.Dir = sourceDir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			os.RemoveAll(testDir)
+			return "", "", fmt.Errorf("could not build the tests: %s", strings.TrimSpace(string(output)))
+		}
+		return testBinary, testDir, nil
+	case mode.Rust:
+		projectDir, err := cargoProjectDir(sourceDir)
+		if err != nil {
+			return "", "", err
+		}
+		cmd := exec.Command("cargo", "test", "--no-run", "--message-format=json")
+		cmd.Dir = projectDir
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return "", "", fmt.Errorf("could not build the tests: %s", strings.TrimSpace(stderr.String()))
+		}
+		if testBinary := cargoTestExecutable(output, absFilename); testBinary != "" {
+			return testBinary, "", nil
+		}
+		return "", "", errors.New("could not find the test binary for " + filepath.Base(absFilename))
+	}
+	return "", "", errors.New("debugging tests is only supported for Go and Rust")
+}
+
+// DebugTest builds the test binary and starts a debug session that only runs the test the cursor is in.
+// The program stops at the first breakpoint, or at the start of the test if the file has no breakpoints.
+func (e *Editor) DebugTest(c *vt.Canvas, tty *vt.TTY, status *StatusBar) error {
+	name, funcLineIndex, ok := e.CurrentTestName()
+	if !ok {
+		return errors.New("the cursor is not in a test function")
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+
+	status.ClearAll(c, false)
+	status.SetMessage("Building the tests")
+	status.ShowNoTimeout(c, e)
+
+	testBinary, testDir, err := e.buildTestBinary(absFilename)
+	if err != nil {
+		return err
+	}
+	testPath := name
+	if e.mode == mode.Rust {
+		projectDir, err := cargoProjectDir(filepath.Dir(absFilename))
+		if err != nil {
+			return err
+		}
+		relFilename, err := filepath.Rel(projectDir, absFilename)
+		if err != nil {
+			return err
+		}
+		testPath = rustTestPath(relFilename, e.rustModules(funcLineIndex), name)
+	}
+
+	// A debugger that was started for the main program can not be reused
+	e.DebugEnd()
+	e.debugTestDir = testDir // removed by DebugEnd
+	if err := e.DebugStartSession(c, tty, status, testBinary, testProgramArguments(e.mode, testPath)...); err != nil {
+		e.DebugEnd()
+		return err
+	}
+	e.debugMode = true
+
+	if len(allBreakpoints().Get(absFilename)) == 0 {
+		// Only for this session, so it is not added to the stored breakpoints
+		if err := e.debugger.ActivateBreakpoint(filepath.Base(absFilename), int(funcLineIndex.LineNumber()), "", 0); err != nil {
+			e.DebugEnd()
+			return err
+		}
+	}
+
+	if err := e.debugger.Continue(); err != nil {
+		e.DebugEnd()
+		return err
+	}
+	if e.debugComplete.Load() {
+		e.DebugEnd()
+		status.SetMessageAfterRedraw(name + " completed without stopping")
+		return nil
+	}
+	status.SetMessageAfterRedraw("Debugging " + name)
+	e.redrawCursor.Store(true)
+	return nil
+}
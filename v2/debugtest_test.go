@@ -0,0 +1,115 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestCurrentTestName(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.filename = "add_test.go"
+	lines := []string{
+		"func helper() int {",
+		"\treturn 1",
+		"}",
+		"",
+		"func TestAdd(t *testing.T) {",
+		"\tif helper() != 1 {",
+		"\t\tt.Fail()",
+		"\t}",
+		"}",
+	}
+	for i, line := range lines {
+		e.SetLine(LineIndex(i), line)
+	}
+	if name, funcLineIndex, ok := e.currentTestNameAt(6); !ok || name != "TestAdd" || funcLineIndex != 4 {
+		t.Errorf("expected to be in TestAdd at line index 4, got %q, %d, %v", name, funcLineIndex, ok)
+	}
+	if name, _, ok := e.currentTestNameAt(1); ok {
+		t.Errorf("expected helper not to be a test, got %q", name)
+	}
+	e.filename = "add.go"
+	if _, _, ok := e.currentTestNameAt(6); ok {
+		t.Error("expected no tests outside of _test.go files")
+	}
+
+	e = NewSimpleEditor(80)
+	e.mode = mode.Rust
+	lines = []string{
+		"mod tests {",
+		"    fn helper() {",
+		"    }",
+		"",
+		"    #[test]",
+		"    // Adding",
+		"    fn it_adds() {",
+		"        assert_eq!(2, 1 + 1);",
+		"    }",
+		"}",
+	}
+	for i, line := range lines {
+		e.SetLine(LineIndex(i), line)
+	}
+	if name, funcLineIndex, ok := e.currentTestNameAt(7); !ok || name != "it_adds" || funcLineIndex != 6 {
+		t.Errorf("expected to be in it_adds at line index 6, got %q, %d, %v", name, funcLineIndex, ok)
+	}
+	if name, _, ok := e.currentTestNameAt(1); ok {
+		t.Errorf("expected helper not to be a test, got %q", name)
+	}
+	if modules := e.rustModules(6); !slices.Equal(modules, []string{"tests"}) {
+		t.Errorf("expected it_adds to be in the tests module, got %v", modules)
+	}
+}
+
+func TestTestProgramArguments(t *testing.T) {
+	if args := testProgramArguments(mode.Go, "TestAdd"); !slices.Equal(args, []string{"-test.run", "^TestAdd$", "-test.v"}) {
+		t.Errorf("unexpected Go arguments: %v", args)
+	}
+	if args := testProgramArguments(mode.Rust, "tests::it_adds"); args[0] != "tests::it_adds" || args[1] != "--exact" {
+		t.Errorf("unexpected Rust arguments: %v", args)
+	}
+}
+
+func TestRustTestPath(t *testing.T) {
+	tests := []struct {
+		relFilename string
+		modules     []string
+		expected    string
+	}{
+		{"src/lib.rs", []string{"tests"}, "tests::it_adds"},
+		{"src/main.rs", nil, "it_adds"},
+		{"src/math.rs", []string{"tests"}, "math::tests::it_adds"},
+		{"src/math/mod.rs", []string{"tests", "inner"}, "math::tests::inner::it_adds"},
+		{"src/math/add.rs", []string{"tests"}, "math::add::tests::it_adds"},
+		{"src/bin/tool.rs", []string{"tests"}, "tests::it_adds"},
+		{"tests/api.rs", nil, "it_adds"},
+	}
+	for _, test := range tests {
+		if path := rustTestPath(test.relFilename, test.modules, "it_adds"); path != test.expected {
+			t.Errorf("%s %v: expected %q, got %q", test.relFilename, test.modules, test.expected, path)
+		}
+	}
+}
+
+func TestCargoTestExecutable(t *testing.T) {
+	output := []byte(`{"reason":"compiler-artifact","target":{"kind":["lib"],"src_path":"/p/src/lib.rs"},"profile":{"test":false},"executable":null}
+{"reason":"compiler-artifact","target":{"kind":["lib"],"src_path":"/p/src/lib.rs"},"profile":{"test":true},"executable":"/p/target/debug/deps/p-1111"}
+{"reason":"compiler-artifact","target":{"kind":["test"],"src_path":"/p/tests/api.rs"},"profile":{"test":true},"executable":"/p/target/debug/deps/api-2222"}
+{"reason":"build-finished","success":true}
+`)
+	if exe := cargoTestExecutable(output, "/p/tests/api.rs"); exe != "/p/target/debug/deps/api-2222" {
+		t.Errorf("expected the integration test binary, got %q", exe)
+	}
+	if exe := cargoTestExecutable(output, "/p/src/math.rs"); exe != "/p/target/debug/deps/p-1111" {
+		t.Errorf("expected the library test binary for a module, got %q", exe)
+	}
+}
+
+// currentTestNameAt moves the cursor to the given line index, then returns the current test name
+func (e *Editor) currentTestNameAt(n LineIndex) (string, LineIndex, bool) {
+	e.pos.SetY(int(n))
+	return e.CurrentTestName()
+}
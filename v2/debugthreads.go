@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt"
+)
+
+// Thread is a thread, or a goroutine for Delve, in the debugged program
+type Thread struct {
+	Name     string
+	Function string // the function that the thread is in
+	File     string
+	ID       int
+	Line     int // 0 if there is no source line for the location of the thread
+	Current  bool
+}
+
+// String returns a short description of the thread, like "2 worker: compute main.c:12"
+func (t Thread) String() string {
+	s := strconv.Itoa(t.ID)
+	if t.Name != "" {
+		s += " " + t.Name
+	}
+	if t.Function != "" {
+		s += ": " + t.Function
+	}
+	if t.File != "" && t.Line > 0 {
+		s += fmt.Sprintf(" %s:%d", filepath.Base(t.File), t.Line)
+	}
+	return s
+}
+
+// lldbThreadRegexp matches a thread from "thread list", like
+// "* thread #1: tid = 0x1c03, 0x0000000100003f84 a.out`main at main.c:4:9, queue = 'com.apple.main-thread'"
+var lldbThreadRegexp = regexp.MustCompile("^(\\*)?\\s*thread #(\\d+): tid = [^,]+, 0x[0-9a-fA-F]+ (?:[^`]*`)?(.+?)(?: at ([^:]+):(\\d+)(?::\\d+)?)?(?:, name = '([^']*)')?(?:, .*)?$")
+
+// parseGDBThreads parses the payload of a GDB/MI -thread-info response
+func parseGDBThreads(payload map[string]any) []Thread {
+	list, _ := payload["threads"].([]any)
+	currentID := gdbString(payload, "current-thread-id")
+	threads := make([]Thread, 0, len(list))
+	for _, item := range list {
+		threadMap, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		id := gdbString(threadMap, "id")
+		thread := Thread{Name: gdbString(threadMap, "name"), Current: id == currentID}
+		thread.ID, _ = strconv.Atoi(id)
+		if thread.Name == "" {
+			thread.Name = gdbString(threadMap, "target-id")
+		}
+		if frameMap, ok := threadMap["frame"].(map[string]any); ok {
+			thread.Function = gdbString(frameMap, "func")
+			thread.File = gdbString(frameMap, "fullname")
+			if thread.File == "" {
+				thread.File = gdbString(frameMap, "file")
+			}
+			thread.Line, _ = strconv.Atoi(gdbString(frameMap, "line"))
+		}
+		threads = append(threads, thread)
+	}
+	return threads
+}
+
+// parseLLDBThreads parses the output of "thread list"
+func parseLLDBThreads(output string) []Thread {
+	var threads []Thread
+	for line := range strings.SplitSeq(output, "\n") {
+		m := lldbThreadRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		thread := Thread{Current: m[1] == "*", Function: strings.TrimSpace(m[3]), File: m[4], Name: m[6]}
+		thread.ID, _ = strconv.Atoi(m[2])
+		thread.Line, _ = strconv.Atoi(m[5])
+		threads = append(threads, thread)
+	}
+	return threads
+}
+
+// DebugSelectThread makes the thread with the given index in the thread list the current one, so that
+// stepping, the call stack and the locals are for that thread, and moves to its line if it is in the current file
+func (e *Editor) DebugSelectThread(index int, c *vt.Canvas, status *StatusBar) error {
+	if e.debugger == nil || !e.debugger.ProgramRunning() {
+		return errors.New("the program is not running")
+	}
+	threads, err := e.debugger.Threads()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(threads) {
+		return errors.New("there are no more threads")
+	}
+	thread := threads[index]
+	if err := e.debugger.SelectThread(thread.ID); err != nil {
+		return err
+	}
+	debugSelectedFrame = 0
+	debugMemoryStale = true
+	debugInlineStale = true
+	if thread.Line > 0 && filepath.Base(thread.File) == filepath.Base(e.filename) {
+		e.debugLine.Store(int64(thread.Line - 1))
+		e.redraw.Store(e.GoToLineNumber(LineNumber(thread.Line), c, status, true))
+		status.SetMessage("Selected thread " + thread.String())
+	} else if thread.Line > 0 {
+		status.SetMessage(fmt.Sprintf("Selected thread %d, which is in %s", thread.ID, filepath.Base(thread.File)))
+	} else {
+		status.SetMessage(fmt.Sprintf("Selected thread %d, which has no source", thread.ID))
+	}
+	e.redraw.Store(true)
+	return nil
+}
+
+// DebugSelectNextThread selects the thread above (-1) or below (+1) the current one in the thread list
+func (e *Editor) DebugSelectNextThread(delta int, c *vt.Canvas, status *StatusBar) error {
+	if e.debugger == nil || !e.debugger.ProgramRunning() {
+		return errors.New("the program is not running")
+	}
+	threads, err := e.debugger.Threads()
+	if err != nil {
+		return err
+	}
+	for i, thread := range threads {
+		if thread.Current {
+			return e.DebugSelectThread(i+delta, c, status)
+		}
+	}
+	return e.DebugSelectThread(0, c, status)
+}
+
+// DrawThreads will draw the threads of the program in the lower right, when that layout has been
+// selected with ctrl-p. The current thread is highlighted.
+func (e *Editor) DrawThreads(c *vt.Canvas, repositionCursor bool) error {
+	defer func() {
+		// Reposition the cursor
+		if repositionCursor {
+			e.EnableAndPlaceCursor(c)
+		}
+	}()
+
+	if e.debugShowRegisters != threadsWindow || e.debugger == nil || !e.debugger.ProgramRunning() {
+		return nil
+	}
+
+	threads, err := e.debugger.Threads()
+	if err != nil {
+		return err
+	}
+
+	canvasBox := NewCanvasBox(c)
+
+	// The same placement as the narrow register box, below the watches box
+	lowerRightBox := NewBox()
+	lowerRightBox.LowerRightPlacement(canvasBox, 40)
+	if watchesBoxBottom > 0 && watchesBoxBottom+1 < canvasBox.H {
+		desiredY := watchesBoxBottom + 1
+		if desiredY > lowerRightBox.Y {
+			lowerRightBox.H -= desiredY - lowerRightBox.Y
+		}
+		lowerRightBox.Y = desiredY
+	}
+	if showInstructionPane {
+		lowerRightBox.H = int(float64(lowerRightBox.H) * 0.9)
+	}
+	if lowerRightBox.H < 4 {
+		return nil
+	}
+
+	bt := e.NewBoxTheme()
+	bt.Background = &e.DebugRegistersBackground
+
+	e.DrawBox(bt, c, lowerRightBox)
+	e.DrawTitle(bt, c, lowerRightBox, fmt.Sprintf("Threads (%d)", len(threads)), true)
+
+	listBox := NewBox()
+	listBox.FillWithMargins(lowerRightBox, 2, 1)
+	if listBox.W <= 0 || listBox.H <= 0 {
+		return nil
+	}
+
+	items := make([]string, len(threads))
+	selected := -1
+	for i, thread := range threads {
+		items[i] = thread.String()
+		if thread.Current {
+			selected = i
+		}
+	}
+	// Scroll so that the current thread is visible
+	if selected >= listBox.H {
+		items = items[selected-listBox.H+1:]
+		selected = listBox.H - 1
+	}
+	if len(items) > listBox.H {
+		items = items[:listBox.H]
+	}
+	for i, item := range items {
+		items[i] = chopRunes(asciiFallback(item), listBox.W)
+	}
+	e.DrawList(bt, c, listBox, items, selected)
+
+	// Blit
+	c.HideCursorAndDraw()
+
+	return nil
+}
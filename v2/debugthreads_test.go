@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGDBThreads(t *testing.T) {
+	payload := map[string]any{
+		"threads": []any{
+			map[string]any{"id": "2", "target-id": "Thread 0x7ffff7a00640 (LWP 1235)", "name": "worker", "state": "stopped",
+				"frame": map[string]any{"level": "0", "func": "compute", "file": "main.c", "fullname": "/tmp/main.c", "line": "12"}},
+			map[string]any{"id": "1", "target-id": "Thread 0x7ffff7d86740 (LWP 1234)", "state": "stopped",
+				"frame": map[string]any{"level": "0", "func": "__futex_abstimed_wait_common", "addr": "0x00007ffff7e1c117"}},
+		},
+		"current-thread-id": "1",
+	}
+	expected := []Thread{
+		{ID: 2, Name: "worker", Function: "compute", File: "/tmp/main.c", Line: 12},
+		{ID: 1, Name: "Thread 0x7ffff7d86740 (LWP 1234)", Function: "__futex_abstimed_wait_common", Current: true},
+	}
+	if threads := parseGDBThreads(payload); !reflect.DeepEqual(threads, expected) {
+		t.Errorf("expected %v, got %v", expected, threads)
+	}
+	if s := expected[0].String(); s != "2 worker: compute main.c:12" {
+		t.Errorf("unexpected thread description: %q", s)
+	}
+}
+
+func TestParseLLDBThreads(t *testing.T) {
+	output := "thread list\r\n" +
+		"Process 1234 stopped\r\n" +
+		"* thread #1: tid = 0x1c03, 0x0000000100003f84 a.out`main at main.c:4:9, queue = 'com.apple.main-thread', stop reason = breakpoint 1.1\r\n" +
+		"  thread #2: tid = 0x1c04, 0x00000001800a1f10 libsystem_kernel.dylib`__semwait_signal + 8, name = 'worker'\r\n"
+	expected := []Thread{
+		{ID: 1, Function: "main", File: "main.c", Line: 4, Current: true},
+		{ID: 2, Name: "worker", Function: "__semwait_signal + 8"},
+	}
+	if threads := parseLLDBThreads(output); !reflect.DeepEqual(threads, expected) {
+		t.Errorf("expected %v, got %v", expected, threads)
+	}
+}
@@ -44,10 +44,9 @@ const (
 type Editor struct {
 	debugger                     Debugger          // connection to debugger, if debugMode is enabled
 	detectedTabs                 *bool             // were tab or space indentations detected when loading the data?
-	breakpoint                   *Position         // for the breakpoint/jump functionality in debug mode
 	bookmark                     *Position         // for the bookmark/jump functionality
 	sameFilePortal               *Portal           // a portal that points to the same file
-	lines                        map[int][]rune    // the contents of the current document
+	lines                        *LineBuffer       // the contents of the current document
 	linesMut                     *sync.Mutex       // protects concurrent access to lines (e.g. signal handler save vs main goroutine)
 	macro                        *Macro            // the contents of the current macro (will be cleared when esc is pressed)
 	hlCache                      *highlightCache   // cached QuoteState checkpoints for fast redraw of large files
@@ -55,6 +54,7 @@ type Editor struct {
 	blockCursors                 map[int]int       // per-line cursor X positions for block editing (line Y -> X)
 	selection                    *Selection        // active text selection, nil if none
 	filename                     string            // the current filename
+	debugTestDir                 string            // a temporary directory with the test binary that is being debugged
 	searchTerm                   string            // the current search term, used when searching
 	stickySearchTerm             string            // used when going to the next match with ctrl-n, unless esc has been pressed
 	debugConsoleOutput           string            // accumulated GDB console output
@@ -66,7 +66,7 @@ type Editor struct {
 	softWrapLimit                int               // soft wrap limit for "reflow text" and the column indicator
 	wrapLimitWhenTyping          int               // wrap limit when typing (0 means use softWrapLimit)
 	mode                         mode.Mode         // a filetype mode, like for git, markdown or various programming languages
-	debugShowRegisters           int               // show no register box, show changed registers, show all changed registers
+	debugShowRegisters           int               // show no register box, show changed registers, show all changed registers, the call stack or memory
 	previousY                    int               // previous cursor position
 	previousX                    int               // previous cursor position
 	lineBeforeSearch             LineIndex         // save the current line number before jumping between search results
@@ -132,6 +132,9 @@ type Editor struct {
 	fastInputMode               bool         // reduce input latency for real-time use
 	pasteMode                   bool         // insert incoming key data as raw text
 	cycleFilenames              bool
+	// signature help is requested in the background, while typing
+	signatureHelp         *signatureHelpState // the function signature that is shown above the cursor line, nil if none
+	signatureHelpRequests atomic.Uint64       // counts the requests, so that only the answer to the latest one is shown
 }
 
 // InBookMode reports whether any book mode (text or graphical) is active.
@@ -156,7 +159,6 @@ func (e *Editor) Copy(withLines bool) *Editor {
 		detectedTabsCopy := *e.detectedTabs
 		e2.detectedTabs = &detectedTabsCopy
 	}
-	e2.breakpoint = e.breakpoint         //.Copy()
 	e2.debugger = e.debugger             //.Copy()
 	e2.sameFilePortal = e.sameFilePortal //.Copy()
 	if withLines {
@@ -245,7 +247,7 @@ func (e *Editor) Copy(withLines bool) *Editor {
 
 // RestoreFrom replaces the document state of e with the given snapshot,
 // lines and position, while keeping the current book-mode rendering state.
-func (e *Editor) RestoreFrom(snap *Editor, lines map[int][]rune, pos Position) {
+func (e *Editor) RestoreFrom(snap *Editor, lines *LineBuffer, pos Position) {
 	// Save the rendering state that book mode controls
 	bookModeState := e.bookModeState.Load()
 	bookDarkMode := e.bookDarkMode
@@ -297,15 +299,10 @@ func (e *Editor) RestoreFrom(snap *Editor, lines map[int][]rune, pos Position) {
 	e.wrapLimitWhenTyping = wrapLimitWhenTyping
 }
 
-// CopyLines will create a new map[int][]rune struct that is the copy of all the lines in the editor
-func (e *Editor) CopyLines() map[int][]rune {
-	lines2 := make(map[int][]rune)
-	for key, runes := range e.lines {
-		runes2 := make([]rune, len(runes))
-		copy(runes2, runes)
-		lines2[key] = runes2
-	}
-	return lines2
+// CopyLines will create a copy of all the lines in the editor.
+// The lines are shared between the two until one of them is changed, so this is cheap.
+func (e *Editor) CopyLines() *LineBuffer {
+	return e.lines.Clone()
 }
 
 // MarkChanged marks the document as changed and bumps the book-mode content
@@ -322,26 +319,19 @@ func (e *Editor) MarkChanged() {
 func (e *Editor) Set(x int, index LineIndex, r rune) {
 	y := int(index)
 	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	_, ok := e.lines[y]
-	if !ok {
-		e.lines[y] = make([]rune, 0, x+1)
-	}
-	l := len(e.lines[y])
-	if x < l {
-		e.lines[y][x] = r
-		e.MarkChanged()
-		return
+		e.lines = NewLineBuffer()
 	}
+	// The line may be shared with undo snapshots, so change a copy of it
+	line := slices.Clone(e.lines.Line(y))
 	// If the line is too short, fill it up with spaces
-	if l <= x {
+	if l := len(line); l <= x {
 		n := (x + 1) - l
-		e.lines[y] = append(e.lines[y], []rune(strings.Repeat(" ", n))...)
+		line = append(line, []rune(strings.Repeat(" ", n))...)
 	}
 
 	// Set the rune
-	e.lines[y][x] = r
+	line[x] = r
+	e.lines.Set(y, line)
 	e.MarkChanged()
 }
 
@@ -350,7 +340,7 @@ func (e *Editor) Get(x int, y LineIndex) rune {
 	if e.lines == nil {
 		return ' '
 	}
-	runes, ok := e.lines[int(y)]
+	runes, ok := e.lines.Get(int(y))
 	if !ok {
 		return ' '
 	}
@@ -370,7 +360,7 @@ func (e *Editor) Line(n LineIndex) string {
 	if n < 0 {
 		return ""
 	}
-	if line, ok := e.lines[int(n)]; ok {
+	if line, ok := e.lines.Get(int(n)); ok {
 		return string(line)
 	}
 	return ""
@@ -379,7 +369,7 @@ func (e *Editor) Line(n LineIndex) string {
 // ScreenLine returns the screen contents of line number N, counting from 0.
 // The tabs are expanded.
 func (e *Editor) ScreenLine(n int) string {
-	if line, ok := e.lines[n]; ok {
+	if line, ok := e.lines.Get(n); ok {
 		var sb strings.Builder
 		skipX := e.pos.offsetX
 		for _, r := range line {
@@ -457,7 +447,7 @@ func (e *Editor) FirstDataPosition(n LineIndex) int {
 // CountRune will count the number of instances of the rune r in the line n
 func (e *Editor) CountRune(r rune, n LineIndex) int {
 	var counter int
-	line, ok := e.lines[int(n)]
+	line, ok := e.lines.Get(int(n))
 	if ok {
 		for _, l := range line {
 			if l == r {
@@ -470,7 +460,7 @@ func (e *Editor) CountRune(r rune, n LineIndex) int {
 
 // Len returns the number of lines
 func (e *Editor) Len() int {
-	return len(e.lines)
+	return e.lines.Len()
 }
 
 // String returns the contents of the editor
@@ -507,7 +497,7 @@ func (e *Editor) ContentsAndReverseSearchPrefix(prefix string) (string, LineInde
 
 // Clear removes all data from the editor
 func (e *Editor) Clear() {
-	e.lines = make(map[int][]rune)
+	e.lines = NewLineBuffer()
 	e.MarkChanged()
 }
 
@@ -563,12 +553,6 @@ func (e *Editor) Load(c *vt.Canvas, tty *vt.TTY, fnord FilenameOrData) (string,
 	return message, nil
 }
 
-// IndexByteLine represents a single line of text, as bytes and with a line index
-type IndexByteLine struct {
-	byteLine []byte
-	index    int
-}
-
 // PrepareEmpty clears the editor buffer and marks the content as unchanged.
 func (e *Editor) PrepareEmpty() (mode.Mode, error) {
 	e.Clear()
@@ -580,13 +564,13 @@ func (e *Editor) PrepareEmpty() (mode.Mode, error) {
 // Returns true if the line was trimmed
 func (e *Editor) TrimRight(index LineIndex) bool {
 	n := int(index)
-	line, ok := e.lines[n]
+	line, ok := e.lines.Get(n)
 	if !ok {
 		return false
 	}
 	trimmedLine := []rune(trimRightSpace(string(line)))
 	if len(trimmedLine) != len(line) {
-		e.lines[n] = trimmedLine
+		e.lines.Set(n, trimmedLine)
 		return true
 	}
 	return false
@@ -596,11 +580,11 @@ func (e *Editor) TrimRight(index LineIndex) bool {
 // Returns true if the line was trimmed
 func (e *Editor) TrimLeft(index LineIndex) bool {
 	n := int(index)
-	if line, ok := e.lines[n]; ok {
+	if line, ok := e.lines.Get(n); ok {
 		newRunes := []rune(strings.TrimLeftFunc(string(line), unicode.IsSpace))
 		// Compare lengths to detect trimming without full content comparison
 		if len(newRunes) != len(line) {
-			e.lines[n] = newRunes
+			e.lines.Set(n, newRunes)
 			return true
 		}
 	}
@@ -635,19 +619,16 @@ func (e *Editor) DeleteRestOfLine() {
 	}
 	y := int(e.DataY())
 	if e.lines == nil {
-		e.lines = make(map[int][]rune)
+		e.lines = NewLineBuffer()
 	}
-	v, ok := e.lines[y]
+	v, ok := e.lines.Get(y)
 	if !ok {
 		return
 	}
-	if v == nil {
-		e.lines[y] = make([]rune, 0)
-	}
-	if x > len(e.lines[y]) {
+	if x > len(v) {
 		return
 	}
-	e.lines[y] = e.lines[y][:x]
+	e.lines.Set(y, v[:x])
 	e.MarkChanged()
 }
 
@@ -657,30 +638,9 @@ func (e *Editor) DeleteLine(n LineIndex) {
 		// This should never happen
 		return
 	}
-	lastLineIndex := LineIndex(e.Len() - 1)
-	endOfDocument := n >= lastLineIndex
-	if endOfDocument {
-		// Just delete this line
-		delete(e.lines, int(n))
-		e.MarkChanged()
-		return
-	}
-	maxIndex := LineIndex(len(e.lines) - 1)
-	if maxIndex < 0 {
-		return
-	}
-	if _, ok := e.lines[int(maxIndex)]; !ok {
-		// The line numbers and the length of e.lines does not match
-		return
-	}
-	// Shift all lines after y:
-	// shift all lines after n one step closer to n, overwriting e.lines[n]
-	for index := n; index <= (maxIndex - 1); index++ {
-		i := int(index)
-		e.lines[i] = e.lines[i+1]
-	}
-	// Then delete the final item
-	delete(e.lines, int(maxIndex))
+	// The lines after n are moved one step closer to n
+	e.lines.Delete(int(n))
+	e.shiftBreakpoints(n, -1)
 
 	// This changes the document
 	e.MarkChanged()
@@ -705,27 +665,28 @@ func (e *Editor) Delete(c *vt.Canvas, useBlockMode bool) {
 
 	deleteThisRune := func() bool {
 		y := int(e.DataY())
-		lineLen := len(e.lines[y])
-		if _, ok := e.lines[y]; !ok || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(e.lines[y][0])) {
+		line, ok := e.lines.Get(y)
+		lineLen := len(line)
+		if !ok || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(line[0])) {
 			if useBlockMode {
 				return true // skip empty/whitespace lines in block mode
 			}
-			// All keys in the map that are > y should be shifted -1.
-			// This also overwrites e.lines[y].
+			// All lines after y are shifted one step up
 			e.DeleteLine(LineIndex(y))
 			e.MarkChanged()
 			return true // continue
 		}
 		x, err := e.DataX()
-		if err != nil || x > len(e.lines[y])-1 {
+		if err != nil || x > lineLen-1 {
 			// on the last index, just use every element but x
-			e.lines[y] = e.lines[y][:x]
+			line = line[:min(x, lineLen)]
+			e.lines.Set(y, line)
 			// check if the next line exists
-			if _, ok := e.lines[y+1]; ok {
+			if ok := e.lines.Has(y + 1); ok {
 				// then add the contents of the next line, if available
-				nextLine, ok := e.lines[y+1]
+				nextLine, ok := e.lines.Get(y + 1)
 				if ok && len(nextLine) > 0 && !e.blockMode {
-					e.lines[y] = append(e.lines[y], nextLine...)
+					e.lines.Set(y, append(line, nextLine...))
 					// then delete the next line
 					e.DeleteLine(LineIndex(y + 1))
 				}
@@ -734,7 +695,7 @@ func (e *Editor) Delete(c *vt.Canvas, useBlockMode bool) {
 			return true // continue
 		}
 		// Delete just this character
-		e.lines[y] = append(e.lines[y][:x], e.lines[y][x+1:]...)
+		e.lines.Set(y, slices.Concat(line[:x], line[x+1:]))
 		return true // continue
 	}
 
@@ -750,15 +711,13 @@ func (e *Editor) Delete(c *vt.Canvas, useBlockMode bool) {
 // Empty will check if the current editor contents are empty or not.
 // If there's only one line left and it is only whitespace, that will be considered empty as well.
 func (e *Editor) Empty() bool {
-	l := len(e.lines)
+	l := e.lines.Len()
 	if l == 0 {
 		return true
 	}
 	if l == 1 {
-		// Regardless of line number key, check the contents of the one remaining trimmed line
-		for _, line := range e.lines {
-			return strings.TrimSpace(string(line)) == ""
-		}
+		// Check the contents of the one remaining trimmed line
+		return strings.TrimSpace(string(e.lines.Line(0))) == ""
 	}
 	// > 1 lines
 	return false
@@ -768,9 +727,9 @@ func (e *Editor) Empty() bool {
 // to make sure that no line number below e.Len() points to a nil map.
 func (e *Editor) MakeConsistent() {
 	// Check if the keys in the map are consistent
-	for i := 0; i < len(e.lines); i++ {
-		if _, found := e.lines[i]; !found {
-			e.lines[i] = make([]rune, 0)
+	for i := 0; i < e.lines.Len(); i++ {
+		if found := e.lines.Has(i); !found {
+			e.lines.Set(i, make([]rune, 0))
 			e.MarkChanged()
 		}
 	}
@@ -779,14 +738,14 @@ func (e *Editor) MakeConsistent() {
 // WithinLimit will check if a line is within the soft wrap limit,
 // given a Y position.
 func (e *Editor) WithinLimit(y LineIndex) bool {
-	return len(e.lines[int(y)]) < e.softWrapLimit
+	return len(e.lines.Line(int(y))) < e.softWrapLimit
 }
 
 // LastWord will return the last word of a line,
 // given a Y position. Returns an empty string if there is no last word.
 func (e *Editor) LastWord(y int) string {
 	// TODO: Use a faster method
-	words := strings.Fields(strings.TrimSpace(string(e.lines[y])))
+	words := strings.Fields(strings.TrimSpace(string(e.lines.Line(y))))
 	if len(words) > 0 {
 		return words[len(words)-1]
 	}
@@ -800,18 +759,19 @@ func (e *Editor) LastWord(y int) string {
 // returns true if there was a space at the split point.
 func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune, bool) {
 	y := int(index)
+	runes := e.lines.Line(y)
 
 	if e.WithinLimit(index) {
-		return e.lines[y], make([]rune, 0), false
+		return runes, make([]rune, 0), false
 	}
 
 	if isSpace {
 		splitPosition, _ := e.DataX()
 		n := splitPosition
-		first := make([]rune, len(e.lines[y][:n]))
-		second := make([]rune, len(e.lines[y][n:]))
-		copy(first, e.lines[y][:n])
-		copy(second, e.lines[y][n:])
+		first := make([]rune, len(runes[:n]))
+		second := make([]rune, len(runes[n:]))
+		copy(first, runes[:n])
+		copy(second, runes[n:])
 		hasSpace := false
 		if len(second) > 0 && unicode.IsSpace(second[0]) {
 			second = second[1:]
@@ -821,11 +781,11 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 	}
 
 	// Use the wordwrap package for the core algorithm
-	line := string(e.lines[y])
+	line := string(runes)
 	maxBacktrack := e.softWrapLimit / 2
 	result := wordwrap.WrapLine(line, e.softWrapLimit, maxBacktrack)
 	if !result.Wrapped {
-		return e.lines[y], make([]rune, 0), false
+		return runes, make([]rune, 0), false
 	}
 
 	first := []rune(result.Left)
@@ -850,11 +810,11 @@ func (e *Editor) ReflowAllLines() bool {
 
 		if len(first) > 0 && len(second) > 0 {
 
-			e.lines[i] = first
+			e.lines.Set(i, first)
 			if spaceBetween {
 				second = append(second, ' ')
 			}
-			e.lines[i+1] = append(second, e.lines[i+1]...)
+			e.lines.Set(i+1, append(second, e.lines.Line(i+1)...))
 			e.InsertLineBelowAt(LineIndex(i + 1))
 
 			// This isn't perfect, but it helps move the cursor somewhere in
@@ -873,8 +833,8 @@ func (e *Editor) ReflowAllLines() bool {
 		e.pos.sy += insertedLines
 		if e.pos.sy < 0 {
 			e.pos.sy = 0
-		} else if e.pos.sy >= len(e.lines) {
-			e.pos.sy = len(e.lines) - 1
+		} else if e.pos.sy >= e.lines.Len() {
+			e.pos.sy = e.lines.Len() - 1
 		}
 		e.redraw.Store(true)
 		e.redrawCursor.Store(true)
@@ -905,23 +865,20 @@ func (e *Editor) InsertLineAbove() {
 	}
 
 	y := int(lineIndex)
-	maxIndex := len(e.lines) - 1
 
-	// Shift all lines from maxIndex down to y, each moving one position up
-	for i := maxIndex; i >= y; i-- {
-		e.lines[i+1] = e.lines[i]
-	}
-	// Insert a blank line at y
-	e.lines[y] = make([]rune, 0)
+	// Insert a blank line at y, which moves all lines from y and down one position
+	e.lines.Insert(y, make([]rune, 0))
+	e.shiftBreakpoints(lineIndex, 1)
 
 	if y == 0 {
 		y++
 	}
 
 	// Skip trailing newlines after this line
-	for i := len(e.lines) - 1; i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
+	for i := e.lines.Len() - 1; i > y; i-- {
+		if len(e.lines.Line(i)) == 0 {
+			e.lines.Delete(i)
+			e.shiftBreakpoints(LineIndex(i), -1)
 		} else {
 			break
 		}
@@ -941,26 +898,24 @@ func (e *Editor) InsertLineBelow() {
 // InsertLineBelowAt will attempt to insert a new line below the given y position
 func (e *Editor) InsertLineBelowAt(index LineIndex) {
 	y := int(index)
-	maxIndex := len(e.lines) - 1
+	maxIndex := e.lines.Len() - 1
 
 	// If we are at the last line, add an empty line at the end and return
 	if y >= maxIndex {
-		e.lines[y+1] = make([]rune, 0)
+		e.lines.Set(y+1, make([]rune, 0))
 		e.MarkChanged()
 		return
 	}
 
-	// Shift all lines from maxIndex down to y+1, each moving one position up
-	for i := maxIndex; i > y; i-- {
-		e.lines[i+1] = e.lines[i]
-	}
-	// Insert a blank line at y+1
-	e.lines[y+1] = make([]rune, 0)
+	// Insert a blank line at y+1, which moves all lines from y+1 and down one position
+	e.lines.Insert(y+1, make([]rune, 0))
+	e.shiftBreakpoints(index+1, 1)
 
 	// Skip trailing newlines after this line
-	for i := len(e.lines) - 1; i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
+	for i := e.lines.Len() - 1; i > y; i-- {
+		if len(e.lines.Line(i)) == 0 {
+			e.lines.Delete(i)
+			e.shiftBreakpoints(LineIndex(i), -1)
 		} else {
 			break
 		}
@@ -978,30 +933,30 @@ func (e *Editor) Insert(c *vt.Canvas, r rune) {
 		y := int(e.DataY())
 		// If there are no lines, initialize and set the 0th rune to the given one
 		if e.lines == nil {
-			e.lines = make(map[int][]rune)
-			e.lines[0] = []rune{r}
+			e.lines = NewLineBuffer()
+			e.lines.Set(0, []rune{r})
 			return true // continue
 		}
 		// If the current line is empty, initialize it with a line that is just the given rune
-		_, ok := e.lines[y]
+		line, ok := e.lines.Get(y)
 		if !ok {
-			e.lines[y] = []rune{r}
+			e.lines.Set(y, []rune{r})
 			return true // continue
 		}
-		if len(e.lines[y]) < x {
+		if len(line) < x {
 			// Can only insert in the existing block of text
 			return true // continue
 		}
-		newlineLength := len(e.lines[y]) + 1
+		newlineLength := len(line) + 1
 		newline := make([]rune, newlineLength)
 		for i := range x {
-			newline[i] = e.lines[y][i]
+			newline[i] = line[i]
 		}
 		newline[x] = r
 		for i := x + 1; i < newlineLength; i++ {
-			newline[i] = e.lines[y][i-1]
+			newline[i] = line[i-1]
 		}
-		e.lines[y] = newline
+		e.lines.Set(y, newline)
 		return true // continue
 	}
 
@@ -1017,11 +972,11 @@ func (e *Editor) Insert(c *vt.Canvas, r rune) {
 // CreateLineIfMissing will create a line at the given Y index, if it's missing
 func (e *Editor) CreateLineIfMissing(n LineIndex) {
 	if e.lines == nil {
-		e.lines = make(map[int][]rune)
+		e.lines = NewLineBuffer()
 	}
-	_, ok := e.lines[int(n)]
+	ok := e.lines.Has(int(n))
 	if !ok {
-		e.lines[int(n)] = make([]rune, 0)
+		e.lines.Set(int(n), make([]rune, 0))
 		e.MarkChanged()
 	}
 }
@@ -1050,18 +1005,8 @@ func (e *Editor) SetRainbow(rainbowParenthesis bool) {
 // Any previous contents of that line is removed.
 func (e *Editor) SetLine(n LineIndex, s string) {
 	e.CreateLineIfMissing(n)
-	e.lines[int(n)] = make([]rune, 0)
-	if s == "" {
-		e.MarkChanged()
-		return
-	}
-	counter := 0
-	// It's important not to use the index value when looping over a string,
-	// unless the byte index is what one's after, as opposed to the rune index.
-	for _, letter := range s {
-		e.Set(counter, n, letter)
-		counter++
-	}
+	e.lines.Set(int(n), []rune(s))
+	e.MarkChanged()
 }
 
 // SetCurrentLine will replace the current line with the given string
@@ -1081,7 +1026,7 @@ func (e *Editor) SplitLine() bool {
 	y := e.DataY()
 
 	// Get the contents of this line
-	runeLine := e.lines[int(y)]
+	runeLine := e.lines.Line(int(y))
 	if len(runeLine) < 2 {
 		// Did not split
 		return false
@@ -1111,7 +1056,7 @@ func (e *Editor) DataX() (int, error) {
 	found := false
 	dataX := 0
 	runeCounter := 0
-	for _, r := range e.lines[dataY] {
+	for _, r := range e.lines.Line(dataY) {
 		e.pos.mut.RLock()
 		// When we reached the correct screen position, use i as the data position
 		if screenCounter == (e.pos.sx + e.pos.offsetX) {
@@ -1154,30 +1099,30 @@ func (e *Editor) SetRune(r rune) {
 // InsertBelow will insert the given rune at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertBelow(y int, r rune) {
-	if _, ok := e.lines[y+1]; !ok {
+	if ok := e.lines.Has(y + 1); !ok {
 		// If the next line does not exist, create one containing just "r"
-		e.lines[y+1] = []rune{r}
-	} else if len(e.lines[y+1]) > 0 {
+		e.lines.Set(y+1, []rune{r})
+	} else if len(e.lines.Line(y+1)) > 0 {
 		// If the next line is non-empty, insert "r" at the start
-		e.lines[y+1] = append([]rune{r}, e.lines[y+1][:]...)
+		e.lines.Set(y+1, append([]rune{r}, e.lines.Line(y+1)...))
 	} else {
 		// The next line exists, but is of length 0, should not happen, just replace it
-		e.lines[y+1] = []rune{r}
+		e.lines.Set(y+1, []rune{r})
 	}
 }
 
 // InsertStringBelow will insert the given string at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertStringBelow(y int, s string) {
-	if _, ok := e.lines[y+1]; !ok {
+	if ok := e.lines.Has(y + 1); !ok {
 		// If the next line does not exist, create one containing the string
-		e.lines[y+1] = []rune(s)
-	} else if len(e.lines[y+1]) > 0 {
+		e.lines.Set(y+1, []rune(s))
+	} else if len(e.lines.Line(y+1)) > 0 {
 		// If the next line is non-empty, insert the string at the start
-		e.lines[y+1] = append([]rune(s), e.lines[y+1][:]...)
+		e.lines.Set(y+1, append([]rune(s), e.lines.Line(y+1)...))
 	} else {
 		// The next line exists, but is of length 0, should not happen, just replace it
-		e.lines[y+1] = []rune(s)
+		e.lines.Set(y+1, []rune(s))
 	}
 }
 
@@ -1209,7 +1154,7 @@ func (e *Editor) InsertString(c *vt.Canvas, s string) {
 // InsertText inserts a (possibly multi-line) string at the current data
 // position in a single pass and moves the cursor to the end of the inserted
 // text. Unlike inserting rune by rune with InsertStringAndMove, which is
-// O(n^2) for long lines and shifts the lines map once per inserted line, this
+// O(n^2) for long lines and shifts the lines once per inserted line, this
 // rebuilds the affected lines in one go. It keeps pasting large amounts of
 // text fast. The text is inserted literally; a full redraw follows.
 func (e *Editor) InsertText(c *vt.Canvas, s string) {
@@ -1225,16 +1170,16 @@ func (e *Editor) InsertText(c *vt.Canvas, s string) {
 	e.CreateLineIfMissing(LineIndex(y))
 
 	// The data X position, clamped to the current line contents
+	current := e.lines.Line(y)
 	x, err := e.DataX()
 	if err != nil {
-		x = len(e.lines[y])
+		x = len(current)
 	}
-	if x > len(e.lines[y]) {
-		x = len(e.lines[y])
+	if x > len(current) {
+		x = len(current)
 	}
 
 	// Split the current line into the part before and after the cursor
-	current := e.lines[y]
 	head := current[:x]
 	tail := current[x:]
 
@@ -1247,7 +1192,7 @@ func (e *Editor) InsertText(c *vt.Canvas, s string) {
 		newLine = append(newLine, head...)
 		newLine = append(newLine, seg...)
 		newLine = append(newLine, tail...)
-		e.lines[y] = newLine
+		e.lines.Set(y, newLine)
 		e.MarkChanged()
 		e.GoToLineIndexAndColIndex(LineIndex(y), ColIndex(x+len(seg)), c, nil, false, true)
 		e.redraw.Store(true)
@@ -1271,17 +1216,16 @@ func (e *Editor) InsertText(c *vt.Canvas, s string) {
 
 	added := len(segments) - 1 // the number of new lines being inserted
 
-	// Shift every line below the cursor line down by "added", in one pass
-	for i := len(e.lines) - 1; i > y; i-- {
-		e.lines[i+added] = e.lines[i]
-	}
-
-	// Place the rebuilt first and last lines, and the untouched middle lines
-	e.lines[y] = firstLine
+	// Place the rebuilt first line, and insert the middle lines and the rebuilt last line
+	// below it, which moves every line below the cursor line down by "added" in one go
+	newLines := make([][]rune, 0, added)
 	for i := 1; i < added; i++ {
-		e.lines[y+i] = []rune(segments[i])
+		newLines = append(newLines, []rune(segments[i]))
 	}
-	e.lines[y+added] = lastLine
+	newLines = append(newLines, lastLine)
+	e.lines.Set(y, firstLine)
+	e.lines.Insert(y+1, newLines...)
+	e.shiftBreakpoints(LineIndex(y+1), added)
 
 	// Keep a portal pointing at the same file in sync with the inserted lines
 	if e.sameFilePortal != nil {
@@ -1312,7 +1256,7 @@ func (e *Editor) LeftRune() rune {
 	x, err := e.DataX()
 	if err != nil {
 		// This is after the line contents, return the last rune
-		runes, ok := e.lines[int(y)]
+		runes, ok := e.lines.Get(int(y))
 		if !ok || len(runes) == 0 {
 			return rune(0)
 		}
@@ -2422,7 +2366,7 @@ func (e *Editor) Block(n LineIndex) string {
 		s      string
 	)
 	for {
-		line, ok = e.lines[int(n)]
+		line, ok = e.lines.Get(int(n))
 		n++
 		if !ok || len(line) == 0 {
 			// End of document, empty line or invalid line: end of block
@@ -2459,7 +2403,7 @@ func (e *Editor) FunctionBlock(n LineIndex) (string, error) {
 	}
 
 	for n := firstLineIndex; ; n++ {
-		line, ok = e.lines[int(n)]
+		line, ok = e.lines.Get(int(n))
 		if !ok || e.OnlyFunctionNameForLineIndex(n) != fname {
 			// End of document or end of function
 			return sb.String(), nil
@@ -2775,7 +2719,7 @@ func (e *Editor) LineContentsFromCursorPosition() string {
 // "." is included.
 func (e *Editor) CurrentWord() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Get(y)
 	if !ok {
 		// This should never happen
 		return ""
@@ -2834,7 +2778,7 @@ func (e *Editor) CurrentWord() string {
 // AnyTextBeforeCursor checks if there is any text before the cursor, on the same line
 func (e *Editor) AnyTextBeforeCursor() bool {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Get(y)
 	if !ok {
 		// This should never happen
 		return false
@@ -2902,9 +2846,12 @@ func (e *Editor) UserInput(c *vt.Canvas, tty *vt.TTY, status *StatusBar, title,
 		if e.debugMode {
 			e.DrawWatches(c, false) // don't reposition cursor
 			if e.debugger != nil && !e.debugComplete.Load() {
-				e.DrawRegisters(c, false)    // don't reposition cursor
-				e.DrawInstructions(c, false) // don't reposition cursor
-				e.DrawFlags(c, false)        // don't reposition cursor
+				e.DrawRegisters(c, false)      // don't reposition cursor
+				e.DrawStackAndLocals(c, false) // don't reposition cursor
+				e.DrawThreads(c, false)        // don't reposition cursor
+				e.DrawMemory(c, false)         // don't reposition cursor
+				e.DrawInstructions(c, false)   // don't reposition cursor
+				e.DrawFlags(c, false)          // don't reposition cursor
 			}
 			e.DrawDebugOutput(c, false)  // don't reposition cursor
 			e.DrawDebugConsole(c, false) // don't reposition cursor
@@ -3049,7 +2996,7 @@ func (e *Editor) SortBlock(c *vt.Canvas, status *StatusBar) {
 	startY := int(y)
 	endY := startY // exclusive end
 	for {
-		line, ok := e.lines[endY]
+		line, ok := e.lines.Get(endY)
 		if !ok || len(line) == 0 {
 			break
 		}
@@ -3068,13 +3015,13 @@ func (e *Editor) SortBlock(c *vt.Canvas, status *StatusBar) {
 	// Collect the lines as strings for sorting
 	sortable := make(sort.StringSlice, blockLen)
 	for i := range blockLen {
-		sortable[i] = string(e.lines[startY+i])
+		sortable[i] = string(e.lines.Line(startY + i))
 	}
 	sortable.Sort()
 
 	// Write sorted lines back in-place
 	for i := range blockLen {
-		e.lines[startY+i] = []rune(sortable[i])
+		e.lines.Set(startY+i, []rune(sortable[i]))
 	}
 
 	e.MarkChanged()
@@ -20,16 +20,16 @@ func TestEditor(t *testing.T) {
 func TestTrimRight(t *testing.T) {
 	e := NewSimpleEditor(0)
 	// Trim trailing spaces
-	e.lines = map[int][]rune{0: []rune("foo   ")}
+	e.lines = NewLineBufferFromLines([][]rune{[]rune("foo   ")})
 	changed := e.TrimRight(LineIndex(0))
 	if !changed {
 		t.Errorf("Expected TrimRight to report change for trailing spaces")
 	}
-	if got := string(e.lines[0]); got != "foo" {
+	if got := string(e.lines.Line(0)); got != "foo" {
 		t.Errorf("TrimRight: expected 'foo', got '%s'", got)
 	}
 	// No trimming when no trailing spaces
-	e.lines = map[int][]rune{1: []rune("bar")}
+	e.lines = NewLineBufferFromLines([][]rune{nil, []rune("bar")})
 	changed = e.TrimRight(LineIndex(1))
 	if changed {
 		t.Errorf("Expected TrimRight to report no change for 'bar'")
@@ -130,16 +130,16 @@ func ExampleEditor_InsertRune() {
 func TestTrimLeft(t *testing.T) {
 	e := NewSimpleEditor(0)
 	// Test trimming leading spaces
-	e.lines = map[int][]rune{0: []rune("   foo")}
+	e.lines = NewLineBufferFromLines([][]rune{[]rune("   foo")})
 	changed := e.TrimLeft(LineIndex(0))
 	if !changed {
 		t.Errorf("Expected TrimLeft to report change for leading spaces")
 	}
-	if got := string(e.lines[0]); got != "foo" {
+	if got := string(e.lines.Line(0)); got != "foo" {
 		t.Errorf("TrimLeft: expected 'foo', got '%s'", got)
 	}
 	// Test no trimming when no leading spaces
-	e.lines = map[int][]rune{1: []rune("bar")}
+	e.lines = NewLineBufferFromLines([][]rune{nil, []rune("bar")})
 	changed = e.TrimLeft(LineIndex(1))
 	if changed {
 		t.Errorf("Expected TrimLeft to report no change for 'bar'")
@@ -260,6 +260,14 @@ func formatTOML(data []byte) ([]byte, error) {
 }
 
 func (e *Editor) formatCode(c *vt.Canvas, tty *vt.TTY, status *StatusBar, jsonFormatToggle *bool) {
+	// Only the language server can format just the selected lines
+	if e.HasSelection() && e.lspFormattingAvailable() {
+		if err := e.FormatWithLSP(c, status); err != nil {
+			status.SetErrorAfterRedraw(err)
+		}
+		return
+	}
+
 	switch e.mode {
 	case mode.JSON: // Format JSON
 		data, err := formatJSON([]byte(e.String()), jsonFormatToggle, e.indentation.PerTab)
@@ -350,6 +358,16 @@ func (e *Editor) formatCode(c *vt.Canvas, tty *vt.TTY, status *StatusBar, jsonFo
 
 	e.InstallMissingTools()
 
+	// Format with the language server if there is no formatting utility for this mode, or if it is missing
+	if cmd, ok := e.GetFormatMap()[e.mode]; (!ok || files.WhichCached(cmd.Path) == "") && e.lspFormattingAvailable() {
+		if err := e.FormatWithLSP(c, status); err != nil {
+			status.ClearAll(c, false)
+			status.SetMessage(err.Error())
+			status.Show(c, e)
+		}
+		return
+	}
+
 	// Not in git mode, format Go or C++ code with goimports or clang-format
 	for formatMode, cmd := range e.GetFormatMap() {
 		if e.mode == formatMode && e.mode == mode.Go {
@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/xyproto/files"
-	"github.com/xyproto/mode"
 	"github.com/xyproto/vt"
 )
 
@@ -31,57 +29,16 @@ func (e *Editor) GoToDefinition(tty *vt.TTY, c *vt.Canvas, status *StatusBar) bo
 // Returns nil if LSP is not available or not ready
 func (e *Editor) tryLSPDefinition() *LSPLocation {
 	// Check if LSP is supported for this mode
-	config, ok := lspConfigs[e.mode]
-	if !ok {
+	if _, ok := lspConfigs[e.mode]; !ok {
 		return nil
 	}
 
-	// Get workspace root and absolute path
-	absPath, err := filepath.Abs(e.filename)
-	if err != nil {
-		return nil
-	}
-	workspaceRoot := findWorkspaceRoot(absPath, config.RootMarkerFiles)
-
-	// For standalone Rust files, pass an inline rust-project.json via linkedProjects
-	lspFilePath := absPath
-	if e.mode == mode.Rust && !hasCargoToml(workspaceRoot) {
-		workspaceRoot = filepath.Dir(absPath)
-		TriggerLSPInitialization(e.mode, workspaceRoot, rustProjectForFile(filepath.Base(absPath)))
-	} else {
-		TriggerLSPInitialization(e.mode, workspaceRoot)
-	}
-
-	// Check if LSP is already ready (non-blocking)
-	client := GetReadyLSPClient(e.mode, workspaceRoot)
+	// Ensure document is synced with LSP, if it is ready
+	client, uri := e.syncLSPDocumentIfReady(true)
 	if client == nil {
 		return nil // LSP not ready yet, use fallback
 	}
 
-	// Ensure document is synced with LSP
-	var buf bytes.Buffer
-	for i := 0; i < len(e.lines); i++ {
-		if lineContent, ok := e.lines[i]; ok {
-			buf.WriteString(string(lineContent))
-		}
-		buf.WriteRune('\n')
-	}
-
-	// Use the actual file path for the LSP URI
-	uri := "file://" + lspFilePath
-	if client.openedURI != uri {
-		if err := client.DidOpen(uri, config.LanguageID, buf.String()); err != nil {
-			return nil
-		}
-		client.openedURI = uri
-		client.openedVersion = 1
-	} else {
-		client.openedVersion++
-		if err := client.DidChange(uri, buf.String(), client.openedVersion); err != nil {
-			return nil
-		}
-	}
-
 	// Get current cursor position
 	line := int(e.DataY())
 	x, err := e.DataX()
@@ -102,6 +59,10 @@ func (e *Editor) tryLSPDefinition() *LSPLocation {
 func (e *Editor) jumpToLSPLocation(location *LSPLocation, tty *vt.TTY, c *vt.Canvas, status *StatusBar) bool {
 	// Parse URI (format: "file:///path/to/file")
 	targetPath := strings.TrimPrefix(location.URI, "file://")
+	if e.isCurrentLSPDocument(location.URI) {
+		// The current file, possibly as a copy in a temporary workspace
+		targetPath = e.filename
+	}
 
 	// Capture current state for back navigation
 	oldFilename := e.filename
@@ -271,70 +232,7 @@ func (e *Editor) textSearchDefinition(tty *vt.TTY, c *vt.Canvas, status *StatusB
 	}
 
 	if len(name) > 0 {
-		// Determine which file extensions to search
-		// For C-like languages, search across all C-family extensions (.c, .h, .cpp, etc.)
-		// For other languages, search only files with the same extension
-		var extensions []string
-		if cLikeness(e.mode) > 0 {
-			extensions = cExtensions
-		} else {
-			extensions = []string{filepath.Ext(e.filename)}
-		}
-
-		// Use a map to deduplicate files (avoid processing same file multiple times)
-		fileSet := make(map[string]bool)
-		var filenames []string
-
-		for _, ext := range extensions {
-			if curDirFilenames, err := filepath.Glob("*" + ext); err == nil {
-				for _, fn := range curDirFilenames {
-					if absFn, err := filepath.Abs(fn); err == nil {
-						if !fileSet[absFn] {
-							fileSet[absFn] = true
-							filenames = append(filenames, fn)
-						}
-					}
-				}
-			}
-			if absFilename, err := filepath.Abs(e.filename); err == nil {
-				sourceDir := filepath.Join(filepath.Dir(absFilename), "*"+ext)
-				if sourceDirFiles, err := filepath.Glob(sourceDir); err == nil {
-					for _, fn := range sourceDirFiles {
-						if absFn, err := filepath.Abs(fn); err == nil {
-							if !fileSet[absFn] {
-								fileSet[absFn] = true
-								filenames = append(filenames, fn)
-							}
-						}
-					}
-				}
-			}
-			if filenamesParent, err := filepath.Glob("../*" + ext); err == nil {
-				for _, fn := range filenamesParent {
-					if absFn, err := filepath.Abs(fn); err == nil {
-						if !fileSet[absFn] {
-							fileSet[absFn] = true
-							filenames = append(filenames, fn)
-						}
-					}
-				}
-			}
-		}
-
-		if len(filenames) > 0 { // success, found source files to examine
-			// Prioritize searching current file first, then others
-			var orderedFilenames []string
-			var otherFilenames []string
-			currentFileAbs, _ := filepath.Abs(e.filename)
-			for _, fn := range filenames {
-				if absFn, err := filepath.Abs(fn); err == nil && absFn == currentFileAbs {
-					orderedFilenames = append([]string{fn}, orderedFilenames...) // prepend current file
-				} else {
-					otherFilenames = append(otherFilenames, fn)
-				}
-			}
-			orderedFilenames = append(orderedFilenames, otherFilenames...)
-
+		if orderedFilenames := e.sourceFilenames(); len(orderedFilenames) > 0 { // success, found source files to examine
 			for _, goFile := range orderedFilenames {
 				// Normalize path to absolute for proper comparison
 				absGoFile, err := filepath.Abs(goFile)
@@ -441,6 +339,75 @@ func (e *Editor) textSearchDefinition(tty *vt.TTY, c *vt.Canvas, status *StatusB
 	return false
 }
 
+// sourceFilenames returns the source files that are searched when looking for definitions or references:
+// files with the same extension (or any C-family extension) in the current directory, the directory of
+// the current file and the parent directory. The current file comes first.
+func (e *Editor) sourceFilenames() []string {
+	// Determine which file extensions to search
+	// For C-like languages, search across all C-family extensions (.c, .h, .cpp, etc.)
+	// For other languages, search only files with the same extension
+	var extensions []string
+	if cLikeness(e.mode) > 0 {
+		extensions = cExtensions
+	} else {
+		extensions = []string{filepath.Ext(e.filename)}
+	}
+
+	// Use a map to deduplicate files (avoid processing same file multiple times)
+	fileSet := make(map[string]bool)
+	var filenames []string
+
+	for _, ext := range extensions {
+		if curDirFilenames, err := filepath.Glob("*" + ext); err == nil {
+			for _, fn := range curDirFilenames {
+				if absFn, err := filepath.Abs(fn); err == nil {
+					if !fileSet[absFn] {
+						fileSet[absFn] = true
+						filenames = append(filenames, fn)
+					}
+				}
+			}
+		}
+		if absFilename, err := filepath.Abs(e.filename); err == nil {
+			sourceDir := filepath.Join(filepath.Dir(absFilename), "*"+ext)
+			if sourceDirFiles, err := filepath.Glob(sourceDir); err == nil {
+				for _, fn := range sourceDirFiles {
+					if absFn, err := filepath.Abs(fn); err == nil {
+						if !fileSet[absFn] {
+							fileSet[absFn] = true
+							filenames = append(filenames, fn)
+						}
+					}
+				}
+			}
+		}
+		if filenamesParent, err := filepath.Glob("../*" + ext); err == nil {
+			for _, fn := range filenamesParent {
+				if absFn, err := filepath.Abs(fn); err == nil {
+					if !fileSet[absFn] {
+						fileSet[absFn] = true
+						filenames = append(filenames, fn)
+					}
+				}
+			}
+		}
+	}
+
+	// Prioritize searching current file first, then others
+	var orderedFilenames []string
+	var otherFilenames []string
+	currentFileAbs, _ := filepath.Abs(e.filename)
+	for _, fn := range filenames {
+		if absFn, err := filepath.Abs(fn); err == nil && absFn == currentFileAbs {
+			orderedFilenames = append([]string{fn}, orderedFilenames...) // prepend current file
+		} else {
+			otherFilenames = append(otherFilenames, fn)
+		}
+	}
+	orderedFilenames = append(orderedFilenames, otherFilenames...)
+	return orderedFilenames
+}
+
 // GoToInclude looks for an #include filename and jumps to it, or returns false.
 // returns the include filename (if found) and then true if a jump/switch was made.
 func (e *Editor) GoToInclude(tty *vt.TTY, c *vt.Canvas, status *StatusBar) (string, bool) {
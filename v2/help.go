@@ -46,8 +46,10 @@ F4          launch the file browser, also available from the ctrl-o menu
 F5          build or export (same as ctrl-space), or continue in debug mode
 F6          toggle block editing mode, also available from the ctrl-o menu
 F7          jump to the next typo
-F8          in debug mode, step over (same as F10, which some terminals take)
-F9          in debug mode, toggle a breakpoint (same as ctrl-b)
+F8          jump to the next diagnostic from the language server
+            in debug mode, step over (same as F10, which some terminals take)
+F9          jump to the previous diagnostic from the language server
+            in debug mode, toggle a breakpoint (same as ctrl-b)
 F10         in debug mode, step over (same as ctrl-o)
 F11         in debug mode, step out (same as ctrl-f)
 F12         go to a definition or include (same as ctrl-g)
@@ -72,6 +74,7 @@ ctrl-t      for C and C++, toggle between the header and implementation,
             for Clojure, evaluate the top-level form via nREPL,
             for Markdown, toggle checkboxes or launch the table editor
             for Agda, insert a symbol,
+            in debug mode, set a breakpoint condition or hit count
             for the rest, record and then play back a macro
 ctrl-c      to copy the current line, double press to copy the current block
             press thrice to copy the current function
@@ -105,8 +108,8 @@ Flags:
   -G, --book-mode-graphical      Book mode (graphics only, requires Kitty, iTerm2 or Sixel).
   -r, --release                  Build with release instead of debug mode whenever applicable.
   -x, --noapprox                 Disable approximate filename matching.
-  -n, --no-cache                 Avoid writing the location history, search history, highscore,
-                                 compilation and format command to ` + cacheDirForDoc + `.
+  -n, --no-cache                 Avoid writing the location history, search history, undo history,
+                                 highscore, compilation and format command to ` + cacheDirForDoc + `.
   -d, --debug                    Start the editor in debug mode.
   -k, --create-dir               When opening a new file, create directories as needed.
   -s, --digraphs                 List all possible digraphs.
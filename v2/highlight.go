@@ -366,7 +366,7 @@ func (e *Editor) WriteLines(c *vt.Canvas, fromline, toline LineIndex, cx, cy uin
 			if mDataY, mDataX, ok := e.findMatchingCurly(cursorDataYForCurly, cursorDataX); ok {
 				hasCurlyMatch = true
 				matchCurlyDataY = mDataY
-				matchCurlyDisplayX = rawToDisplayCol(e.lines[int(mDataY)], mDataX, e.indentation.PerTab)
+				matchCurlyDisplayX = rawToDisplayCol(e.lines.Line(int(mDataY)), mDataX, e.indentation.PerTab)
 				e.pos.mut.RLock()
 				cursorDisplayXForCurly = e.pos.sx + e.pos.offsetX
 				e.pos.mut.RUnlock()
@@ -374,6 +374,19 @@ func (e *Editor) WriteLines(c *vt.Canvas, fromline, toline LineIndex, cx, cy uin
 		}
 	}
 
+	// Diagnostics from the language server, if any, grouped by line
+	lineDiagnostics := diagnosticsByLine(e.Diagnostics())
+
+	// Breakpoints in debug mode, if any, by line
+	var lineBreakpoints map[LineIndex]Breakpoint
+	if e.debugMode {
+		lineBreakpoints = e.breakpointLines()
+	}
+
+	// Values of the local variables, for drawing them after the lines of the current function, in debug mode
+	inlineFrom, inlineTo, showInlineValues := e.debugInlineRange()
+	commentMarker := e.SingleLineCommentMarker()
+
 	// Loop from 0 to numlines (used as y+offset in the loop) to draw the text
 	for y = LineIndex(0); y < LineIndex(numLinesToDraw); y++ {
 
@@ -769,6 +782,9 @@ func (e *Editor) WriteLines(c *vt.Canvas, fromline, toline LineIndex, cx, cy uin
 				if e.showTypoHighlights {
 					e.applyTypoHighlights(line, singleLineCommentMarker, runesAndAttributes)
 				}
+				if lineDiagnostics != nil {
+					e.applyDiagnosticHighlights(LineIndex(y+offsetY), lineDiagnostics[LineIndex(y+offsetY)], runesAndAttributes)
+				}
 
 				// If e.rainbowParenthesis is true and we're not in a comment or a string, enable rainbow parenthesis
 				if e.mode != mode.Git && e.mode != mode.Email && e.rainbowParenthesis && q.None() && !q.hasSingleLineComment && !q.stoppedMultiLineComment {
@@ -992,6 +1008,37 @@ func (e *Editor) WriteLines(c *vt.Canvas, fromline, toline LineIndex, cx, cy uin
 			}
 		}
 
+		// Draw a marker and the condition after lines that have breakpoints, after the arrow, if any
+		bp, hasBreakpoint := lineBreakpoints[LineIndex(y+offsetY)]
+		if hasBreakpoint {
+			if debugCurrentLine {
+				e.drawBreakpointMarker(c, xp+4, yp, cw, bg, bp)
+			} else {
+				e.drawBreakpointMarker(c, xp, yp, cw, bg, bp)
+			}
+		}
+
+		// Draw the values of the local variables that are used on the line, after the arrow and the breakpoint marker, if any
+		inlineValues := ""
+		if showInlineValues && LineIndex(y+offsetY) >= inlineFrom && LineIndex(y+offsetY) <= inlineTo && bp.Condition == "" && bp.IgnoreCount == 0 {
+			inlineValues = inlineValuesText(e.Line(LineIndex(y+offsetY)), commentMarker, debugInlineLocals)
+		}
+		if inlineValues != "" {
+			x := xp
+			if debugCurrentLine {
+				x += 4
+			}
+			if hasBreakpoint {
+				x += 2
+			}
+			e.drawInlineValues(c, x, yp, cw, bg, inlineValues)
+		}
+
+		// Draw a marker and the message after lines that have diagnostics from the language server
+		if !debugCurrentLine && !hasBreakpoint && inlineValues == "" && lineDiagnostics != nil {
+			e.drawDiagnosticMarker(c, xp, yp, cw, bg, lineDiagnostics[LineIndex(y+offsetY)])
+		}
+
 		// Draw a dotted line to remind the user of where the N-column limit is
 		columnLimit := e.softWrapLimit
 		if e.wrapWhenTyping && e.wrapLimitWhenTyping > 0 {
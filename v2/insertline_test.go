@@ -148,7 +148,7 @@ func TestInsertLineMapContiguous(t *testing.T) {
 
 	n := e.Len()
 	for i := range n {
-		if _, ok := e.lines[i]; !ok {
+		if ok := e.lines.Has(i); !ok {
 			t.Errorf("gap in e.lines at key %d (Len=%d)", i, n)
 		}
 	}
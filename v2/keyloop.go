@@ -348,6 +348,9 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 		if filename, err := e.AbsFilename(); err == nil { // success
 			absFilename = filename
 		}
+		// Restore the undo history from the last time the file was edited, if the file is unchanged since then.
+		// Any returned error is ignored, since this is "best effort".
+		e.LoadUndoHistory(absFilename)
 	}
 
 	if parentIsMan == nil {
@@ -381,6 +384,15 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 	// Prepare a status bar
 	status := e.NewStatusBar(statusDuration, messageAfterRedraw)
 
+	// Let the user know if lsp.toml or dap.toml could not be used, while continuing with the built-in ones
+	if messageAfterRedraw == "" {
+		if lspConfigError != nil {
+			status.SetErrorAfterRedraw(lspConfigError)
+		} else if dapConfigError != nil {
+			status.SetErrorAfterRedraw(dapConfigError)
+		}
+	}
+
 	e.SetTheme(e.Theme)
 
 	// Re-enable sticky status bars after the theme has been (re-)applied,
@@ -597,6 +609,16 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 						c.HideCursorAndDraw()
 						e.linesMut.Unlock()
 					}
+					// Let the language server know about the changes, if it is running, so that it can publish diagnostics
+					e.linesMut.Lock()
+					e.syncLSPDiagnostics()
+					e.linesMut.Unlock()
+					if lspDiagnosticsChanged.CompareAndSwap(true, false) {
+						e.linesMut.Lock()
+						e.redraw.Store(true)
+						e.RedrawAtEndOfKeyLoop(c, status, false, true)
+						e.linesMut.Unlock()
+					}
 					continue
 				}
 			}
@@ -621,6 +643,10 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 					lastCopyY = -1
 					lastPasteY = -1
 					lastCutY = -1
+					if e.playBackMacroCount > 0 && e.macro.eachLine && !e.macroNextLine(c, status) {
+						// There are no more lines to play back the macro on
+						e.playBackMacroCount = 0
+					}
 					if e.playBackMacroCount > 0 {
 						// More iterations remain, get the first key of the next pass
 						key = e.macro.Next()
@@ -715,6 +741,12 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 		case "F7": // jump to the next typo
 			e.NanoNextTypo(c, status)
 
+		case "F8": // jump to the next diagnostic from the language server
+			e.GoToNextDiagnostic(c, status, true)
+
+		case "F9": // jump to the previous diagnostic from the language server
+			e.GoToNextDiagnostic(c, status, false)
+
 		case "c:23": // ctrl-w, format
 
 			if e.blockMode {
@@ -1934,6 +1966,7 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 			e.blockMode = false
 			e.blockCursors = nil
 			e.ClearSelection()
+			e.DismissSignatureHelp()
 			e.showTypoHighlights = false
 			c.ShowCursor()
 
@@ -2368,6 +2401,7 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 				status.SetErrorAfterRedraw(err)
 				break
 			}
+			undo.Tree().Sync(e)
 			e.EnableAndPlaceCursor(c)
 			e.redrawCursor.Store(true)
 			e.redraw.Store(true)
@@ -3215,6 +3249,14 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 					e.redraw.Store(true)
 				}
 				e.redrawCursor.Store(true)
+
+				// Show the signature of the function that is being called, when typing the arguments
+				switch r {
+				case '(', ',', ')':
+					if !e.blockMode {
+						e.UpdateSignatureHelp(c, status)
+					}
+				}
 			} else if len(key) > 0 {
 				// Unrecognized key combination, show an error message
 				displayKey := key
@@ -3278,6 +3320,18 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 			e.drawFuncName.Store(true)
 		}
 
+		// Show the diagnostic for the current line, if the cursor was just moved there
+		if justMovedByKeypress && status.messageAfterRedraw == "" {
+			if msg := e.DiagnosticMessageForLine(e.DataY()); msg != "" {
+				status.SetMessageAfterRedraw(msg)
+			}
+		}
+
+		// Hide the function signature when the cursor leaves the line it was shown for
+		if e.signatureHelp != nil && e.DataY() != e.signatureHelp.line {
+			e.DismissSignatureHelp()
+		}
+
 		// Draw and/or redraw everything, with slightly different behavior over ssh
 		justMovedUpOrDown := kh.PrevIsWithin(arrowKeyHighlightTime, verticalMovementKeys...)
 		// Frame skipping: in book mode (both graphical and text) a single
@@ -3326,6 +3380,9 @@ func Loop(tty *vt.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber Co
 			// Only call GDB-dependent drawing functions if the debugger is active and program hasn't exited
 			if e.debugger != nil && !e.debugComplete.Load() {
 				e.DrawRegisters(c, repositionCursor)
+				e.DrawStackAndLocals(c, repositionCursor)
+				e.DrawThreads(c, repositionCursor)
+				e.DrawMemory(c, repositionCursor)
 				e.DrawInstructions(c, repositionCursor)
 				e.DrawFlags(c, repositionCursor)
 			}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"iter"
+	"slices"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+// lineChunkSize is the number of lines in each chunk of a LineBuffer, when it is created.
+// Chunks that grow to twice this size are split in two.
+const lineChunkSize = 512
+
+// lineCacheSize is the number of chunks of undecoded lines that a LineBuffer keeps decoded lines for
+const lineCacheSize = 8
+
+// LineBuffer holds the lines of a document. The lines are stored in chunks, which are shared
+// between a buffer and its clones until one of them changes a chunk, so cloning is cheap even
+// for large documents. Lines that are loaded from a file are kept as bytes, and are only
+// decoded to runes when they are used or changed.
+//
+// The rune slices that are returned must not be modified, since they may be shared with clones.
+type LineBuffer struct {
+	data    []byte       // the contents of the file that the undecoded lines refer to, never modified
+	chunks  []*lineChunk // the lines, in order
+	starts  []int        // the index of the first line of each chunk, followed by the number of lines
+	binary  bool         // decode one rune per byte, instead of decoding UTF-8
+	changes lineChanges  // the lines that have changed since ResetChanges was called
+
+	cacheMut  sync.Mutex
+	cache     [lineCacheSize]decodedChunk // recently decoded lines, so that redrawing or searching does not decode them again
+	cacheNext int                         // the cache entry that is replaced next
+}
+
+// decodedChunk holds the lines of an undecoded chunk that have been decoded so far
+type decodedChunk struct {
+	chunk *lineChunk
+	lines [][]rune // nil for the lines that have not been decoded yet
+}
+
+// lineChanges keeps track of which lines of a buffer have changed, as the number of lines at the
+// start and at the end that are still the same. This is used for sending only the changed lines
+// to a language server, without comparing all the lines.
+type lineChanges struct {
+	tracked bool // ResetChanges has been called for this buffer
+	changed bool // lines have been set, inserted or deleted since then
+	prefix  int  // the number of lines at the start that have not changed
+	suffix  int  // the number of lines at the end that have not changed
+}
+
+// lineChunk is a run of lines. Either lines is set, or offsets refer to lines in the data of the buffer.
+type lineChunk struct {
+	owner   *LineBuffer // the buffer that may change this chunk in place, or nil if the chunk is shared
+	lines   [][]rune    // the decoded lines
+	offsets []int       // for undecoded lines: where each line starts in the data, followed by where the next line would start
+}
+
+// len returns the number of lines in the chunk
+func (ch *lineChunk) len() int {
+	if ch.offsets != nil {
+		return len(ch.offsets) - 1
+	}
+	return len(ch.lines)
+}
+
+// NewLineBuffer returns a buffer with no lines
+func NewLineBuffer() *LineBuffer {
+	return &LineBuffer{starts: []int{0}}
+}
+
+// NewLineBufferFromLines returns a buffer with the given lines, which are then owned by the buffer
+func NewLineBufferFromLines(lines [][]rune) *LineBuffer {
+	b := NewLineBuffer()
+	for start := 0; start < len(lines); start += lineChunkSize {
+		end := min(start+lineChunkSize, len(lines))
+		chunkLines := append(make([][]rune, 0, lineChunkSize), lines[start:end]...)
+		for k, runes := range chunkLines {
+			if runes == nil {
+				chunkLines[k] = []rune{}
+			}
+		}
+		b.chunks = append(b.chunks, &lineChunk{owner: b, lines: chunkLines})
+	}
+	b.updateStarts(0)
+	return b
+}
+
+// NewLineBufferFromBytes returns a buffer with one line per '\n'-terminated line in data, and a final
+// line after the last '\n', which may be empty. The data is only scanned for newlines here, and each
+// line is decoded when it is used. If binary is true, each byte is decoded to one rune.
+// The data must not be modified afterwards.
+func NewLineBufferFromBytes(data []byte, binary bool) *LineBuffer {
+	b := &LineBuffer{data: data, binary: binary}
+	offsets := make([]int, 1, lineChunkSize+1)
+	pos := 0
+	for {
+		i := bytes.IndexByte(data[pos:], '\n')
+		if i < 0 {
+			break
+		}
+		pos += i + 1
+		offsets = append(offsets, pos)
+		if len(offsets) == lineChunkSize+1 {
+			b.chunks = append(b.chunks, &lineChunk{owner: b, offsets: offsets})
+			offsets = make([]int, 1, lineChunkSize+1)
+			offsets[0] = pos
+		}
+	}
+	// The final line, which has no '\n' at the end. The next line would start after an imagined '\n'.
+	offsets = append(offsets, len(data)+1)
+	b.chunks = append(b.chunks, &lineChunk{owner: b, offsets: offsets})
+	b.updateStarts(0)
+	return b
+}
+
+// decode returns the runes of the line that starts at data[start] and is followed by a newline at data[next-1]
+func (b *LineBuffer) decode(start, next int) []rune {
+	line := b.data[start : next-1]
+	if !b.binary {
+		return bytes.Runes(line)
+	}
+	runes := make([]rune, len(line))
+	for i, c := range line {
+		runes[i] = rune(c)
+	}
+	return runes
+}
+
+// updateStarts recalculates the index of the first line of each chunk, from the given chunk and onwards
+func (b *LineBuffer) updateStarts(from int) {
+	if len(b.starts) != len(b.chunks)+1 {
+		b.starts = make([]int, len(b.chunks)+1)
+		from = 0
+	}
+	for i := from; i < len(b.chunks); i++ {
+		b.starts[i+1] = b.starts[i] + b.chunks[i].len()
+	}
+}
+
+// find returns the index of the chunk that has line y, and the index of the line within that chunk.
+// y must be within 0 and b.Len()-1.
+func (b *LineBuffer) find(y int) (int, int) {
+	i := sort.Search(len(b.chunks), func(i int) bool { return b.starts[i+1] > y })
+	return i, y - b.starts[i]
+}
+
+// Len returns the number of lines
+func (b *LineBuffer) Len() int {
+	if b == nil || len(b.starts) == 0 {
+		return 0
+	}
+	return b.starts[len(b.starts)-1]
+}
+
+// Has returns true if there is a line with the given index
+func (b *LineBuffer) Has(y int) bool {
+	return y >= 0 && y < b.Len()
+}
+
+// Line returns the runes of the line with the given index, or nil if there is no such line.
+// The returned slice must not be modified.
+func (b *LineBuffer) Line(y int) []rune {
+	if !b.Has(y) {
+		return nil
+	}
+	i, j := b.find(y)
+	ch := b.chunks[i]
+	if ch.offsets != nil {
+		return b.cachedLine(ch, j)
+	}
+	line := ch.lines[j]
+	if line == nil {
+		return []rune{}
+	}
+	return line[:len(line):len(line)] // so that appending to it never changes the stored line
+}
+
+// cachedLine returns line j of the undecoded chunk ch, and only decodes it if it is not in the cache
+func (b *LineBuffer) cachedLine(ch *lineChunk, j int) []rune {
+	b.cacheMut.Lock()
+	defer b.cacheMut.Unlock()
+	var entry *decodedChunk
+	for i := range b.cache {
+		if b.cache[i].chunk == ch {
+			entry = &b.cache[i]
+			break
+		}
+	}
+	if entry == nil {
+		entry = &b.cache[b.cacheNext]
+		b.cacheNext = (b.cacheNext + 1) % lineCacheSize
+		*entry = decodedChunk{chunk: ch, lines: make([][]rune, ch.len())}
+	}
+	if entry.lines[j] == nil {
+		entry.lines[j] = b.decode(ch.offsets[j], ch.offsets[j+1])
+	}
+	line := entry.lines[j]
+	return line[:len(line):len(line)]
+}
+
+// Get returns the runes of the line with the given index, and true, or nil and false if there is no such line.
+// The returned slice must not be modified.
+func (b *LineBuffer) Get(y int) ([]rune, bool) {
+	if !b.Has(y) {
+		return nil, false
+	}
+	return b.Line(y), true
+}
+
+// All returns an iterator over the line indices and lines, in order
+func (b *LineBuffer) All() iter.Seq2[int, []rune] {
+	return func(yield func(int, []rune) bool) {
+		if b == nil {
+			return
+		}
+		y := 0
+		for _, ch := range b.chunks {
+			for j := range ch.len() {
+				var line []rune
+				if ch.offsets != nil {
+					line = b.decode(ch.offsets[j], ch.offsets[j+1])
+				} else {
+					line = ch.lines[j][:len(ch.lines[j]):len(ch.lines[j])]
+				}
+				if !yield(y, line) {
+					return
+				}
+				y++
+			}
+		}
+	}
+}
+
+// writable returns chunk i, after making sure that it is decoded and only used by this buffer
+func (b *LineBuffer) writable(i int) *lineChunk {
+	ch := b.chunks[i]
+	if ch.owner == b && ch.offsets == nil {
+		return ch
+	}
+	ch2 := &lineChunk{owner: b}
+	if ch.offsets != nil {
+		ch2.lines = make([][]rune, ch.len(), max(ch.len(), lineChunkSize))
+		for j := range ch2.lines {
+			ch2.lines[j] = b.decode(ch.offsets[j], ch.offsets[j+1])
+		}
+	} else {
+		ch2.lines = append(make([][]rune, 0, max(len(ch.lines), lineChunkSize)), ch.lines...)
+	}
+	b.chunks[i] = ch2
+	return ch2
+}
+
+// Set replaces the line with the given index. If the index is past the last line, empty lines are
+// added up to it first. The buffer takes ownership of the given runes.
+func (b *LineBuffer) Set(y int, runes []rune) {
+	if y < 0 {
+		return
+	}
+	if y >= b.Len() {
+		b.Insert(y, runes)
+		return
+	}
+	if runes == nil {
+		runes = []rune{}
+	}
+	b.markChanged(y, y+1)
+	i, j := b.find(y)
+	b.writable(i).lines[j] = runes
+}
+
+// Insert inserts the given lines before the line with the given index. If the index is past the
+// last line, empty lines are added up to it first. The buffer takes ownership of the given runes.
+func (b *LineBuffer) Insert(y int, lines ...[]rune) {
+	if y < 0 || len(lines) == 0 {
+		return
+	}
+	if n := b.Len(); y > n {
+		lines = append(make([][]rune, y-n), lines...)
+		y = n
+	}
+	for k, runes := range lines {
+		if runes == nil {
+			lines[k] = []rune{}
+		}
+	}
+	b.markChanged(y, y)
+	if len(b.chunks) == 0 {
+		b.chunks = append(b.chunks, &lineChunk{owner: b, lines: make([][]rune, 0, lineChunkSize)})
+		b.updateStarts(0)
+	}
+	var i, j int
+	if y == b.Len() {
+		i = len(b.chunks) - 1
+		j = b.chunks[i].len()
+	} else {
+		i, j = b.find(y)
+	}
+	ch := b.writable(i)
+	ch.lines = slices.Insert(ch.lines, j, lines...)
+	if len(ch.lines) >= 2*lineChunkSize {
+		b.split(i)
+		return
+	}
+	b.updateStarts(i)
+}
+
+// split splits chunk i into chunks of lineChunkSize lines
+func (b *LineBuffer) split(i int) {
+	ch := b.chunks[i]
+	var parts []*lineChunk
+	for start := 0; start < len(ch.lines); start += lineChunkSize {
+		end := min(start+lineChunkSize, len(ch.lines))
+		parts = append(parts, &lineChunk{owner: b, lines: append(make([][]rune, 0, lineChunkSize), ch.lines[start:end]...)})
+	}
+	b.chunks = append(b.chunks[:i], append(parts, b.chunks[i+1:]...)...)
+	b.updateStarts(i)
+}
+
+// Delete removes the line with the given index, if there is one
+func (b *LineBuffer) Delete(y int) {
+	b.DeleteRange(y, y+1)
+}
+
+// DeleteRange removes the lines from index from up to, but not including, index to
+func (b *LineBuffer) DeleteRange(from, to int) {
+	from, to = max(from, 0), min(to, b.Len())
+	if to > from {
+		b.markChanged(from, to)
+	}
+	for to > from {
+		i, j := b.find(from)
+		ch := b.chunks[i]
+		n := min(ch.len()-j, to-from) // the number of lines to remove from this chunk
+		if n == ch.len() {
+			b.chunks = append(b.chunks[:i], b.chunks[i+1:]...)
+		} else {
+			ch = b.writable(i)
+			ch.lines = slices.Delete(ch.lines, j, j+n)
+		}
+		b.updateStarts(i)
+		to -= n
+	}
+}
+
+// markChanged records that the lines from index from up to, but not including, index to are about to be
+// replaced by other lines. The lines after them are left as they are.
+func (b *LineBuffer) markChanged(from, to int) {
+	c := &b.changes
+	if !c.tracked {
+		return
+	}
+	unchangedAfter := b.Len() - to
+	if !c.changed {
+		c.prefix, c.suffix, c.changed = from, unchangedAfter, true
+		return
+	}
+	c.prefix = min(c.prefix, from)
+	c.suffix = min(c.suffix, unchangedAfter)
+}
+
+// ResetChanges starts keeping track of which lines are changed, from the current lines
+func (b *LineBuffer) ResetChanges() {
+	if b != nil {
+		b.changes = lineChanges{tracked: true}
+	}
+}
+
+// Changed returns true if lines have been changed since ResetChanges was last called,
+// or if ResetChanges has not been called for this buffer
+func (b *LineBuffer) Changed() bool {
+	return b == nil || !b.changes.tracked || b.changes.changed
+}
+
+// Changes returns how many lines at the start and at the end of the buffer have not changed since
+// ResetChanges was last called, and true. If nothing has changed, all lines are counted as being
+// at the start. Returns false if ResetChanges has not been called for this buffer.
+func (b *LineBuffer) Changes() (prefix, suffix int, tracked bool) {
+	if b == nil || !b.changes.tracked {
+		return 0, 0, false
+	}
+	if !b.changes.changed {
+		return b.Len(), 0, true
+	}
+	return b.changes.prefix, b.changes.suffix, true
+}
+
+// Clone returns a copy of the buffer. The chunks are shared until either buffer changes them.
+// Changes are not tracked for the copy until ResetChanges is called for it.
+func (b *LineBuffer) Clone() *LineBuffer {
+	if b == nil {
+		return nil
+	}
+	b2 := &LineBuffer{data: b.data, binary: b.binary}
+	b2.chunks = append([]*lineChunk(nil), b.chunks...)
+	b2.starts = append([]int(nil), b.starts...)
+	for _, ch := range b.chunks {
+		ch.owner = nil // now shared, so both buffers must copy it before changing it
+	}
+	return b2
+}
+
+// MemoryFootprint returns roughly how many bytes the lines use, counting shared chunks and data as well
+func (b *LineBuffer) MemoryFootprint() uint64 {
+	return b.footprint(make(map[unsafe.Pointer]bool))
+}
+
+// footprint returns roughly how many bytes the lines use, skipping the chunks and data that are in seen,
+// and then adding them to seen. This is for counting the memory of several clones without counting
+// what they share more than once.
+func (b *LineBuffer) footprint(seen map[unsafe.Pointer]bool) uint64 {
+	if b == nil {
+		return 0
+	}
+	sum := uint64(cap(b.starts)) * uint64(unsafe.Sizeof(0))
+	if p := unsafe.Pointer(unsafe.SliceData(b.data)); p != nil && !seen[p] {
+		seen[p] = true
+		sum += uint64(cap(b.data))
+	}
+	for _, ch := range b.chunks {
+		if seen[unsafe.Pointer(ch)] {
+			continue
+		}
+		seen[unsafe.Pointer(ch)] = true
+		sum += uint64(cap(ch.offsets)) * uint64(unsafe.Sizeof(0))
+		for _, line := range ch.lines {
+			sum += uint64(cap(line)) * uint64(unsafe.Sizeof(rune(0)))
+		}
+	}
+	return sum
+}
+
+// sameLine returns true if b and other have the same line at the given index in b and in other
+func (b *LineBuffer) sameLine(y int, other *LineBuffer, otherY int) bool {
+	return slices.Equal(b.Line(y), other.Line(otherY))
+}
+
+// commonPrefix returns how many lines at the start b and other have in common.
+// Chunks that are shared between the two are skipped without comparing the lines.
+func (b *LineBuffer) commonPrefix(other *LineBuffer) int {
+	n := min(b.Len(), other.Len())
+	y := 0
+	if b != nil && other != nil {
+		for i := 0; i < len(b.chunks) && i < len(other.chunks); i++ {
+			if b.chunks[i] != other.chunks[i] || b.starts[i+1] != other.starts[i+1] {
+				break
+			}
+			y = b.starts[i+1]
+		}
+	}
+	for y < n && b.sameLine(y, other, y) {
+		y++
+	}
+	return y
+}
+
+// commonSuffix returns how many lines at the end b and other have in common, but at most limit lines.
+// Chunks that are shared between the two are skipped without comparing the lines.
+func (b *LineBuffer) commonSuffix(other *LineBuffer, limit int) int {
+	bLen, otherLen := b.Len(), other.Len()
+	count := 0
+	if b != nil && other != nil {
+		for i, j := len(b.chunks)-1, len(other.chunks)-1; i >= 0 && j >= 0 && b.chunks[i] == other.chunks[j]; i, j = i-1, j-1 {
+			if count+b.chunks[i].len() > limit {
+				break
+			}
+			count += b.chunks[i].len()
+		}
+	}
+	for count < limit && b.sameLine(bLen-1-count, other, otherLen-1-count) {
+		count++
+	}
+	return count
+}
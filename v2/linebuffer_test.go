@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lineBufferStrings returns every line in the buffer as a string slice
+func lineBufferStrings(b *LineBuffer) []string {
+	var out []string
+	for _, runes := range b.All() {
+		out = append(out, string(runes))
+	}
+	return out
+}
+
+func TestLineBufferFromBytes(t *testing.T) {
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"", []string{""}},
+		{"a", []string{"a"}},
+		{"a\n", []string{"a", ""}},
+		{"a\n\nbø\n", []string{"a", "", "bø", ""}},
+	}
+	for _, tt := range tests {
+		b := NewLineBufferFromBytes([]byte(tt.data), false)
+		if got := lineBufferStrings(b); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%q: got %q, want %q", tt.data, got, tt.want)
+		}
+		if b.Len() != len(tt.want) {
+			t.Errorf("%q: got Len %d, want %d", tt.data, b.Len(), len(tt.want))
+		}
+	}
+}
+
+func TestLineBufferBinary(t *testing.T) {
+	b := NewLineBufferFromBytes([]byte{0xff, 0x00, '\n', 0xc3, 0xb8}, true)
+	if b.Len() != 2 {
+		t.Fatalf("got Len %d, want 2", b.Len())
+	}
+	if got := b.Line(1); len(got) != 2 || got[0] != 0xc3 || got[1] != 0xb8 {
+		t.Errorf("expected one rune per byte, got %v", got)
+	}
+}
+
+func TestLineBufferManyLines(t *testing.T) {
+	const n = 5*lineChunkSize + 7
+	var sb strings.Builder
+	for i := range n {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	b := NewLineBufferFromBytes([]byte(sb.String()), false)
+	b.Delete(n) // the empty line after the last '\n'
+	if b.Len() != n {
+		t.Fatalf("got Len %d, want %d", b.Len(), n)
+	}
+
+	// Insert enough lines in one place to make the chunk split
+	lines := make([][]rune, 2*lineChunkSize)
+	for i := range lines {
+		lines[i] = []rune(fmt.Sprintf("new %d", i))
+	}
+	b.Insert(lineChunkSize+1, lines...)
+	if b.Len() != n+len(lines) {
+		t.Fatalf("got Len %d, want %d", b.Len(), n+len(lines))
+	}
+	if got := string(b.Line(lineChunkSize)); got != fmt.Sprintf("line %d", lineChunkSize) {
+		t.Errorf("got %q before the inserted lines", got)
+	}
+	if got := string(b.Line(lineChunkSize + 1)); got != "new 0" {
+		t.Errorf("got %q as the first inserted line", got)
+	}
+	if got := string(b.Line(lineChunkSize + 1 + len(lines))); got != fmt.Sprintf("line %d", lineChunkSize+1) {
+		t.Errorf("got %q after the inserted lines", got)
+	}
+
+	// Delete the inserted lines again, across chunks
+	b.DeleteRange(lineChunkSize+1, lineChunkSize+1+len(lines))
+	for i := 0; i < n; i += 97 {
+		if got := string(b.Line(i)); got != fmt.Sprintf("line %d", i) {
+			t.Fatalf("line %d: got %q", i, got)
+		}
+	}
+	if b.Len() != n {
+		t.Fatalf("got Len %d, want %d", b.Len(), n)
+	}
+}
+
+func TestLineBufferSetPastEnd(t *testing.T) {
+	b := NewLineBuffer()
+	b.Set(2, []rune("c"))
+	if got := lineBufferStrings(b); strings.Join(got, "|") != "||c" {
+		t.Errorf("got %q", got)
+	}
+	if b.Has(3) || b.Line(3) != nil {
+		t.Errorf("expected no line 3")
+	}
+	if _, ok := b.Get(-1); ok {
+		t.Errorf("expected no line -1")
+	}
+}
+
+func TestLineBufferClone(t *testing.T) {
+	b := NewLineBufferFromBytes([]byte("a\nb\nc"), false)
+	b2 := b.Clone()
+	b.Set(0, []rune("x"))
+	b.Delete(1)
+	b2.Insert(3, []rune("d"))
+	if got := strings.Join(lineBufferStrings(b), "|"); got != "x|c" {
+		t.Errorf("got %q", got)
+	}
+	if got := strings.Join(lineBufferStrings(b2), "|"); got != "a|b|c|d" {
+		t.Errorf("got %q from the clone", got)
+	}
+	// Appending to a returned line must not change the line in the buffer
+	_ = append(b2.Line(3), 'e')
+	if got := string(b2.Line(3)); got != "d" {
+		t.Errorf("got %q after appending to a returned line", got)
+	}
+}
+
+func TestLineBufferCachesDecodedLines(t *testing.T) {
+	b := NewLineBufferFromBytes([]byte("abc\ndef\n"), false)
+	first, second := b.Line(1), b.Line(1)
+	if string(first) != "def" || &first[0] != &second[0] {
+		t.Errorf("expected the decoded line to be reused, got %q and %q", string(first), string(second))
+	}
+	// Changing a line must not return the old line from the cache
+	b.Set(1, []rune("xyz"))
+	if got := string(b.Line(1)); got != "xyz" {
+		t.Errorf("expected the changed line, got %q", got)
+	}
+}
+
+func TestOpinionatedBytes(t *testing.T) {
+	data := []byte("a\nb\n")
+	if got := opinionatedBytes(data); &got[0] != &data[0] {
+		t.Error("expected data without anything to replace to be returned as it is")
+	}
+	if got := string(opinionatedBytes([]byte("a\r\nb\u00a0c\rd"))); got != "a\nb c\nd" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLineBufferChanges(t *testing.T) {
+	b := NewLineBufferFromBytes([]byte("a\nb\nc\nd"), false)
+	if _, _, tracked := b.Changes(); tracked {
+		t.Error("expected changes not to be tracked before ResetChanges")
+	}
+	b.ResetChanges()
+	if prefix, suffix, _ := b.Changes(); prefix != 4 || suffix != 0 || b.Changed() {
+		t.Errorf("expected no changes, got %d and %d", prefix, suffix)
+	}
+	b.Set(2, []rune("C"))
+	b.Insert(1, []rune("x"), []rune("y"))
+	if prefix, suffix, _ := b.Changes(); prefix != 1 || suffix != 1 || !b.Changed() {
+		t.Errorf("expected 1 unchanged line at the start and 1 at the end, got %d and %d", prefix, suffix)
+	}
+	b.Delete(b.Len() - 1)
+	if prefix, suffix, _ := b.Changes(); prefix != 1 || suffix != 0 {
+		t.Errorf("expected 1 unchanged line at the start and none at the end, got %d and %d", prefix, suffix)
+	}
+	if _, _, tracked := b.Clone().Changes(); tracked {
+		t.Error("expected changes not to be tracked for a clone")
+	}
+}
+
+func TestUndoSharesUnchangedLines(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte(strings.Repeat("some text\n", 4*lineChunkSize)))
+	u := NewUndo(10, 0)
+	u.Snapshot(e)
+	one := u.MemoryFootprint()
+	e.SetLine(0, "changed")
+	u.Snapshot(e)
+	two := u.MemoryFootprint()
+	// The second snapshot only adds the one chunk that changed
+	if perSnapshot := e.lines.MemoryFootprint(); two-one >= perSnapshot/2 {
+		t.Errorf("the second snapshot used %d bytes, the lines use %d bytes", two-one, perSnapshot)
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Line(0); got != "some text" {
+		t.Errorf("got %q after undo", got)
+	}
+}
@@ -1,13 +1,9 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
-	"io"
 	"os"
-	"runtime"
 	"strings"
-	"sync"
 
 	"github.com/xyproto/binary"
 	"github.com/xyproto/mode"
@@ -34,178 +30,57 @@ func (e *Editor) ReadFileAndProcessLines(filename string) error {
 	}
 	e.binaryFile = e.looksBinary(data)
 	if !e.binaryFile {
-		data = []byte(opinionatedStringReplacer.Replace(string(data)))
+		data = opinionatedBytes(data)
 	}
 
-	var (
-		reader           = bufio.NewReader(bytes.NewReader(data))
-		lines            = make(map[int][]rune)
-		index            int
-		tabIndentCounter int64
-		minSpaces        int
-		first            byte
-	)
-
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			return err
-		}
-		// Remove the newline character at the end of the line
-		if len(line) > 0 && line[len(line)-1] == '\n' {
-			line = line[:len(line)-1]
-		}
-		// Treat a trailing '\n' as a line terminator, not an extra empty line.
-		// For binary files, the trailing newline is data and must be preserved.
-		if err == io.EOF && len(line) == 0 && index > 0 && !e.binaryFile {
-			break
-		}
-		if e.binaryFile {
-			// One rune per byte (rune value == byte value 0..255) so save round-trips.
-			runes := make([]rune, len(line))
-			for i := 0; i < len(line); i++ {
-				runes[i] = rune(line[i])
-			}
-			lines[index] = runes
-		} else {
-			if len(line) > 2 {
-				first = line[0]
-				if first == '\t' {
-					tabIndentCounter++
-				} else if first == ' ' && line[1] == ' ' {
-					tabIndentCounter--
-					// Count leading spaces to detect indentation width
-					spaces := 0
-					for i := 0; i < len(line) && line[i] == ' '; i++ {
-						spaces++
-					}
-					if spaces >= 2 && (minSpaces == 0 || spaces < minSpaces) {
-						minSpaces = spaces
-					}
-				}
-			}
-			lines[index] = []rune(line)
-		}
-		index++
-
-		if err == io.EOF {
-			break
-		}
+	lines := NewLineBufferFromBytes(data, e.binaryFile)
+	// Treat a trailing '\n' as a line terminator, not an extra empty line.
+	// For binary files, the trailing newline is data and must be preserved.
+	if n := lines.Len(); n > 1 && !e.binaryFile && len(lines.Line(n-1)) == 0 {
+		lines.Delete(n - 1)
 	}
 	e.Clear()
 	e.lines = lines
 	if !e.binaryFile {
-		if detectedTabs := tabIndentCounter > 0; detectedTabs {
-			e.detectedTabs = &detectedTabs
-			e.indentation.Spaces = false
-		} else if tabIndentCounter < 0 {
-			detectedTabs := false
-			e.detectedTabs = &detectedTabs
-			e.indentation.Spaces = true
-			if minSpaces >= 2 {
-				e.indentation.PerTab = minSpaces
-			}
-		}
+		e.detectIndentation(data)
 	}
 	e.MarkChanged()
 	return nil
 }
 
-// LoadByteLine loads a single byte line
-func (e *Editor) LoadByteLine(ib IndexByteLine, eMut, tcMut *sync.RWMutex, tabIndentCounter, minSpaces, numLines *int) {
-	// Require at least two bytes. Ignore lines with a single tab indentation or a single space
-	if len(ib.byteLine) > 2 {
-		first := ib.byteLine[0]
-		if first == '\t' {
-			tcMut.Lock()
-			*tabIndentCounter++ // a tab indentation counts like a positive tab indentation
-			tcMut.Unlock()
-		} else if first == ' ' && ib.byteLine[1] == ' ' { // assume that two spaces is the smallest space indentation
-			tcMut.Lock()
-			*tabIndentCounter-- // a space indentation counts like a negative tab indentation
+// detectIndentation counts the lines that are indented with tabs and the lines that are indented
+// with spaces, and then sets the indentation of the editor to the most common one.
+// Lines with a single tab indentation or a single space, and lines shorter than three bytes, are ignored.
+func (e *Editor) detectIndentation(data []byte) {
+	var (
+		tabIndentCounter int
+		minSpaces        int
+	)
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		// Require at least three bytes
+		if len(line) <= 2 {
+			continue
+		}
+		if first := line[0]; first == '\t' {
+			tabIndentCounter++ // a tab indentation counts like a positive tab indentation
+		} else if first == ' ' && line[1] == ' ' { // assume that two spaces is the smallest space indentation
+			tabIndentCounter-- // a space indentation counts like a negative tab indentation
 			// Count leading spaces to detect indentation width
 			spaces := 0
-			for i := 0; i < len(ib.byteLine) && ib.byteLine[i] == ' '; i++ {
+			for spaces < len(line) && line[spaces] == ' ' {
 				spaces++
 			}
-			if spaces >= 2 && (*minSpaces == 0 || spaces < *minSpaces) {
-				*minSpaces = spaces
+			if minSpaces == 0 || spaces < minSpaces {
+				minSpaces = spaces
 			}
-			tcMut.Unlock()
 		}
 	}
-	eMut.Lock()
-	e.lines[ib.index] = bytes.Runes(ib.byteLine)
-	*numLines++
-	eMut.Unlock()
-}
-
-// LoadBytes replaces the current editor contents with the given bytes
-func (e *Editor) LoadBytes(data []byte) {
-	e.binaryFile = e.looksBinary(data)
-	if !e.binaryFile {
-		data = []byte(opinionatedStringReplacer.Replace(string(data)))
-	}
-
-	lineCount := bytes.Count(data, []byte{'\n'}) + 1
-
-	// Binary path: one rune per byte (no UTF-8 decode, no indentation detection).
-	if e.binaryFile {
-		byteLines := bytes.Split(data, []byte{'\n'})
-		for i := range lineCount {
-			runes := make([]rune, len(byteLines[i]))
-			for j := 0; j < len(byteLines[i]); j++ {
-				runes[j] = rune(byteLines[i][j])
-			}
-			e.lines[i] = runes
-		}
-		e.MarkChanged()
-		return
-	}
-
-	var (
-		// Split the bytes into lines
-		byteLines = bytes.Split(data, []byte{'\n'})
-
-		// Place the lines into the editor, while counting tab indentations vs space indentations
-		tabIndentCounter int
-
-		// Minimum leading space count for detecting spaces-per-tab
-		minSpaces int
-
-		// Count the number of lines as the lines are being processed
-		numLines int
-
-		// Mutex for the editor lines and the numLines counter
-		eMut sync.RWMutex
-
-		// Mutex for the tabIndentCounter and minSpaces
-		tcMut sync.RWMutex
-	)
-
-	workerCount := max(runtime.GOMAXPROCS(0), 1)
-	jobs := make(chan IndexByteLine, workerCount*2)
-	var wg sync.WaitGroup
-	wg.Add(workerCount)
-	for range workerCount {
-		go func() {
-			defer wg.Done()
-			for ib := range jobs {
-				e.LoadByteLine(ib, &eMut, &tcMut, &tabIndentCounter, &minSpaces, &numLines)
-			}
-		}()
-	}
-	for i := range lineCount {
-		jobs <- IndexByteLine{byteLines[i], i}
-	}
-	close(jobs)
-	wg.Wait()
-
-	// If the last line is empty, delete it
-	if numLines > 0 && len(e.lines[numLines-1]) == 0 {
-		delete(e.lines, numLines-1)
-	}
-
 	if detectedTabs := tabIndentCounter > 0; detectedTabs {
 		// More tab indentations than space indentations
 		e.detectedTabs = &detectedTabs
@@ -219,6 +94,25 @@ func (e *Editor) LoadBytes(data []byte) {
 			e.indentation.PerTab = minSpaces
 		}
 	}
+}
+
+// LoadBytes replaces the current editor contents with the given bytes
+func (e *Editor) LoadBytes(data []byte) {
+	e.binaryFile = e.looksBinary(data)
+	if !e.binaryFile {
+		data = opinionatedBytes(data)
+	}
+
+	// Binary files get one rune per byte, and no indentation detection
+	e.lines = NewLineBufferFromBytes(data, e.binaryFile)
+
+	if !e.binaryFile {
+		// If the last line is empty, delete it
+		if n := e.lines.Len(); n > 0 && len(e.lines.Line(n-1)) == 0 {
+			e.lines.Delete(n - 1)
+		}
+		e.detectIndentation(data)
+	}
 
 	// Mark the editor contents as "changed"
 	e.MarkChanged()
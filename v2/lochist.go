@@ -603,7 +603,7 @@ func (locationHistory LocationHistory) KeepNewest(n int) LocationHistory {
 	return newLocationHistory
 }
 
-// CloseLocksAndLocationHistory tries to close any active file locks and save the location history
+// CloseLocksAndLocationHistory tries to close any active file locks and save the location history and the undo history
 func (e *Editor) CloseLocksAndLocationHistory(absFilename string, lockTimestamp time.Time, forceFlag bool, wg *sync.WaitGroup) {
 	if canUseLocks.Load() {
 		wg.Go(func() {
@@ -625,4 +625,8 @@ func (e *Editor) CloseLocksAndLocationHistory(absFilename string, lockTimestamp
 	wg.Go(func() {
 		e.SaveLocationCustom(e.locationKeyFor(absFilename), locationHistory)
 	})
+	// Save the undo history, so that it can be restored the next time the file is opened
+	wg.Go(func() {
+		e.SaveUndoHistory(absFilename)
+	})
 }
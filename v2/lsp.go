@@ -12,11 +12,13 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 	"unicode"
+	"unicode/utf16"
 
 	"github.com/xyproto/files"
 	"github.com/xyproto/mode"
@@ -43,12 +45,15 @@ type LSPClient struct {
 	msgCh          chan map[string]any // receives parsed messages from the background readLoop
 	done           chan struct{}       // closed by Shutdown to unblock readLoop
 	workspaceRoot  string
-	openedURI      string
-	linkedProjects []any          // inline rust-project.json objects for standalone Rust files
-	initOptions    map[string]any // extra initializationOptions, ie. the nixpkgs expression for nixd
-	openedVersion  int
+	linkedProjects []any                       // inline rust-project.json objects for standalone Rust files
+	initOptions    map[string]any              // extra initializationOptions, ie. the nixpkgs expression for nixd
+	documents      map[string]*lspOpenDocument // the open documents, by URI
+	responses      map[int]map[string]any      // responses that arrived while waiting for another response
+	appliedEdits   chan lspApplyEditRequest    // workspace/applyEdit requests, while a command is being executed
+	syncKind       int                         // TextDocumentSyncKind from the server capabilities
 	requestID      int
 	mutex          sync.Mutex
+	readMutex      sync.Mutex // held while waiting for a response, so that only one goroutine reads at a time
 	running        bool
 	initialized    bool
 }
@@ -85,19 +90,45 @@ type LSPCompletionList struct {
 	IsIncomplete bool                `json:"isIncomplete"`
 }
 
+// LSPPosition is a zero-based line and character offset in a document
+type LSPPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// lspCharacter converts a rune index in a line to a character offset, which the language server
+// counts in UTF-16 code units. Runes outside of the Basic Multilingual Plane count as two.
+func lspCharacter(runes []rune, x int) int {
+	n := 0
+	for _, r := range runes[:min(max(x, 0), len(runes))] {
+		n += utf16.RuneLen(r)
+	}
+	return n + max(x-len(runes), 0)
+}
+
+// runeIndexFromLSP converts a character offset from the language server, in UTF-16 code units,
+// to a rune index in the given line. Offsets past the end of the line give the length of the line.
+func runeIndexFromLSP(runes []rune, character int) int {
+	units := 0
+	for i, r := range runes {
+		if units >= character {
+			return i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return len(runes)
+}
+
+// LSPRange is a range in a document, where the end position is exclusive
+type LSPRange struct {
+	Start LSPPosition `json:"start"`
+	End   LSPPosition `json:"end"`
+}
+
 // LSPLocation represents a location in a file
 type LSPLocation struct {
-	URI   string `json:"uri"`
-	Range struct {
-		Start struct {
-			Line      int `json:"line"`
-			Character int `json:"character"`
-		} `json:"start"`
-		End struct {
-			Line      int `json:"line"`
-			Character int `json:"character"`
-		} `json:"end"`
-	} `json:"range"`
+	URI   string   `json:"uri"`
+	Range LSPRange `json:"range"`
 }
 
 type scoredItem struct {
@@ -107,7 +138,7 @@ type scoredItem struct {
 
 // lineUpToX returns the content of the given line up to position x
 func (e *Editor) lineUpToX(line, x int) string {
-	if lineRunes, ok := e.lines[line]; ok {
+	if lineRunes, ok := e.lines.Get(line); ok {
 		if x >= 0 && x <= len(lineRunes) {
 			return string(lineRunes[:x])
 		}
@@ -182,6 +213,9 @@ const (
 	lspCompletionTimeout     = 10 * time.Second
 	lspCompletionWaitTimeout = 3 * time.Second
 	lspDefinitionTimeout     = 200 * time.Millisecond
+	lspHoverTimeout          = 3 * time.Second
+	lspRenameTimeout         = 10 * time.Second
+	lspReferencesTimeout     = 5 * time.Second
 	lspShutdownTimeout       = 2 * time.Second
 )
 
@@ -224,15 +258,18 @@ var (
 	lspMutex       sync.Mutex
 	lspTempDirs    = make(map[string]string) // file path -> temp directory
 	lspFileMapping = make(map[string]string) // original file path -> temp workspace file path
+	lspStarting    = make(map[string]bool)   // keys of clients that are being started in the background
+	lspFailed      = make(map[string]bool)   // keys of clients that failed to start in the background
 )
 
 // LSPConfig holds configuration for a language server
 type LSPConfig struct {
-	Command         string
-	Args            []string
-	LanguageID      string
-	RootMarkerFiles []string
-	FileExtensions  []string
+	InitializationOptions map[string]any // only used for Command, not for the fallbacks
+	Command               string
+	Args                  []string
+	LanguageID            string
+	RootMarkerFiles       []string
+	FileExtensions        []string
 }
 
 // Language server configurations
@@ -399,8 +436,13 @@ func nixosOptionsExpr() string {
 
 // lspInitializationOptions returns the initializationOptions for the given language
 // server, or nil. nixd can not complete from nixpkgs without being told to evaluate it.
+// Options from lsp.toml are added on top, for the configured command.
 func lspInitializationOptions(m mode.Mode, command, workspaceRoot string) map[string]any {
+	config := lspConfigs[m]
 	if m != mode.Nix || command != "nixd" {
+		if command == config.Command {
+			return config.InitializationOptions
+		}
 		return nil
 	}
 	options := map[string]any{}
@@ -418,6 +460,9 @@ func lspInitializationOptions(m mode.Mode, command, workspaceRoot string) map[st
 			"nixos": map[string]any{"expr": expr},
 		}
 	}
+	if command == config.Command {
+		maps.Copy(options, config.InitializationOptions)
+	}
 	return options
 }
 
@@ -554,8 +599,10 @@ func (lsp *LSPClient) readLoop() {
 		if method, hasMethod := result["method"].(string); hasMethod {
 			if reqID, hasID := result["id"]; hasID {
 				lsp.answerServerRequest(method, reqID, result["params"])
+			} else if method == "textDocument/publishDiagnostics" {
+				storeLSPDiagnostics(result["params"])
 			}
-			continue // notifications are not handled yet
+			continue // other notifications are not handled yet
 		}
 		select {
 		case lsp.msgCh <- result:
@@ -567,6 +614,7 @@ func (lsp *LSPClient) readLoop() {
 
 // answerServerRequest replies to a request from the language server. workspace/configuration
 // needs one settings object per requested item, which is how nixd picks up its nixpkgs expression.
+// workspace/applyEdit is sent by servers that execute code actions as commands.
 func (lsp *LSPClient) answerServerRequest(method string, reqID, params any) {
 	var result any
 	if method == "workspace/configuration" {
@@ -585,7 +633,19 @@ func (lsp *LSPClient) answerServerRequest(method string, reqID, params any) {
 			}
 		}
 		result = settings
+	} else if method == "workspace/applyEdit" {
+		// The reply is sent by ExecuteCommand, once the editor has applied the edit
+		err := lsp.queueAppliedEdit(reqID, params)
+		if err == nil {
+			return
+		}
+		result = map[string]any{"applied": false, "failureReason": err.Error()}
 	}
+	lsp.reply(reqID, result)
+}
+
+// reply sends the result of a request from the language server
+func (lsp *LSPClient) reply(reqID, result any) {
 	lsp.mutex.Lock()
 	defer lsp.mutex.Unlock()
 	if !lsp.running {
@@ -599,25 +659,46 @@ func (lsp *LSPClient) answerServerRequest(method string, reqID, params any) {
 }
 
 // readResponse reads the JSON-RPC response matching expectedID.
-// NOTE: only one goroutine should call readResponse at a time;
-// concurrent callers would race on msgCh and discard each other's responses.
+// Callers in other goroutines wait for their turn, and responses to their requests are kept for them.
 func (lsp *LSPClient) readResponse(expectedID int, timeout time.Duration) (map[string]any, error) {
+	return lsp.readResponseApplyingEdits(expectedID, timeout, nil, nil)
+}
+
+// readResponseApplyingEdits is like readResponse, but also applies the edits that the server
+// asks the editor to apply while waiting, and replies with whether they could be applied
+func (lsp *LSPClient) readResponseApplyingEdits(expectedID int, timeout time.Duration, requests <-chan lspApplyEditRequest, apply func(*LSPWorkspaceEdit) error) (map[string]any, error) {
+	lsp.readMutex.Lock()
+	defer lsp.readMutex.Unlock()
+	if response, ok := lsp.responses[expectedID]; ok {
+		delete(lsp.responses, expectedID)
+		return response, nil
+	}
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
 	for {
 		select {
+		case request := <-requests:
+			result := map[string]any{"applied": true}
+			if err := apply(request.edit); err != nil {
+				result = map[string]any{"applied": false, "failureReason": err.Error()}
+			}
+			lsp.reply(request.id, result)
 		case result, ok := <-lsp.msgCh:
 			if !ok {
 				lsp.mutex.Lock()
 				lsp.running = false
-				lsp.openedURI = ""
+				lsp.documents = nil
 				lsp.mutex.Unlock()
 				return nil, errors.New("LSP connection closed")
 			}
 			if idVal, hasID := result["id"]; hasID {
-				if id, ok := idVal.(float64); ok && int(id) == expectedID {
+				id, ok := idVal.(float64)
+				if ok && int(id) == expectedID {
 					return result, nil
 				}
+				if ok {
+					lsp.keepResponse(int(id), result)
+				}
 				continue
 			}
 			// no id or method, skip
@@ -627,6 +708,20 @@ func (lsp *LSPClient) readResponse(expectedID int, timeout time.Duration) (map[s
 	}
 }
 
+// keepResponse stores a response to another request than the one that is being waited for, so that
+// it can be read by the goroutine that sent that request. Only the most recent responses are kept,
+// so when there are too many, the response to the oldest request (the lowest ID) is dropped.
+func (lsp *LSPClient) keepResponse(id int, response map[string]any) {
+	const maxKeptResponses = 16
+	if lsp.responses == nil {
+		lsp.responses = make(map[int]map[string]any)
+	}
+	if len(lsp.responses) >= maxKeptResponses {
+		delete(lsp.responses, slices.Min(slices.Collect(maps.Keys(lsp.responses))))
+	}
+	lsp.responses[id] = response
+}
+
 // Initialize sends the initialize request to the language server
 func (lsp *LSPClient) Initialize() error {
 	params := map[string]any{
@@ -638,9 +733,13 @@ func (lsp *LSPClient) Initialize() error {
 				// nixd fetches its configuration with workspace/configuration and
 				// gives up on completions entirely if the client can not serve it
 				"configuration": true,
+				"applyEdit":     true,
 				"didChangeConfiguration": map[string]any{
 					"dynamicRegistration": true,
 				},
+				"workspaceEdit": map[string]any{
+					"documentChanges": true,
+				},
 			},
 			"textDocument": map[string]any{
 				"completion": map[string]any{
@@ -648,6 +747,38 @@ func (lsp *LSPClient) Initialize() error {
 						"snippetSupport": false,
 					},
 				},
+				"hover": map[string]any{
+					"contentFormat": []string{"markdown", "plaintext"},
+				},
+				"synchronization": map[string]any{
+					"didSave": false,
+				},
+				"rename":          map[string]any{},
+				"references":      map[string]any{},
+				"formatting":      map[string]any{},
+				"rangeFormatting": map[string]any{},
+				"documentSymbol": map[string]any{
+					"hierarchicalDocumentSymbolSupport": true,
+				},
+				"codeAction": map[string]any{
+					"codeActionLiteralSupport": map[string]any{
+						"codeActionKind": map[string]any{
+							"valueSet": []string{"", "quickfix", "refactor", "refactor.extract", "refactor.inline", "refactor.rewrite", "source", "source.organizeImports", "source.fixAll"},
+						},
+					},
+					"dataSupport": true,
+					"resolveSupport": map[string]any{
+						"properties": []string{"edit"},
+					},
+				},
+				"signatureHelp": map[string]any{
+					"signatureInformation": map[string]any{
+						"parameterInformation": map[string]any{
+							"labelOffsetSupport": true,
+						},
+						"activeParameterSupport": true,
+					},
+				},
 			},
 		},
 	}
@@ -659,11 +790,20 @@ func (lsp *LSPClient) Initialize() error {
 	if len(initOptions) > 0 {
 		params["initializationOptions"] = initOptions
 	}
-	if id, err := lsp.sendRequest("initialize", params); err != nil {
+	id, err := lsp.sendRequest("initialize", params)
+	if err != nil {
 		return err
-	} else if _, err := lsp.readResponse(id, lspInitTimeout); err != nil {
+	}
+	response, err := lsp.readResponse(id, lspInitTimeout)
+	if err != nil {
 		return err
 	}
+	lsp.syncKind = lspSyncFull
+	if result, ok := response["result"].(map[string]any); ok {
+		if capabilities, ok := result["capabilities"].(map[string]any); ok {
+			lsp.syncKind = textDocumentSyncKind(capabilities)
+		}
+	}
 	if err := lsp.sendNotification("initialized", map[string]any{}); err != nil {
 		return err
 	}
@@ -712,15 +852,13 @@ func (lsp *LSPClient) DidOpen(uri, languageID, text string) error {
 }
 
 // DidChange notifies the language server that a document was changed
-func (lsp *LSPClient) DidChange(uri, text string, version int) error {
+func (lsp *LSPClient) DidChange(uri string, changes []LSPContentChange, version int) error {
 	params := map[string]any{
 		"textDocument": map[string]any{
 			"uri":     uri,
 			"version": version,
 		},
-		"contentChanges": []map[string]any{
-			{"text": text},
-		},
+		"contentChanges": changes,
 	}
 	return lsp.sendNotification("textDocument/didChange", params)
 }
@@ -835,6 +973,134 @@ func (lsp *LSPClient) GetDefinition(uri string, line, character int, timeout tim
 	return nil, errors.New("could not parse definition response")
 }
 
+// GetHover requests hover information for the symbol at the given position, as Markdown
+func (lsp *LSPClient) GetHover(uri string, line, character int, timeout time.Duration) (string, error) {
+	if !lsp.initialized {
+		return "", errors.New("LSP client not initialized")
+	}
+	params := map[string]any{
+		"textDocument": map[string]any{
+			"uri": uri,
+		},
+		"position": map[string]any{
+			"line":      line,
+			"character": character,
+		},
+	}
+	id, err := lsp.sendRequest("textDocument/hover", params)
+	if err != nil {
+		return "", err
+	}
+	response, err := lsp.readResponse(id, timeout)
+	if err != nil {
+		return "", err
+	}
+	resultData, ok := response["result"]
+	if !ok {
+		if errorData, hasError := response["error"]; hasError {
+			return "", fmt.Errorf("LSP error: %v", errorData)
+		}
+		return "", errors.New("no result in hover response")
+	}
+	resultMap, ok := resultData.(map[string]any)
+	if !ok {
+		return "", errors.New("no hover information found")
+	}
+	return strings.TrimSpace(hoverMarkdown(resultMap["contents"])), nil
+}
+
+// Rename requests the changes that are needed for renaming the symbol at the given position
+func (lsp *LSPClient) Rename(uri string, line, character int, newName string, timeout time.Duration) (*LSPWorkspaceEdit, error) {
+	if !lsp.initialized {
+		return nil, errors.New("LSP client not initialized")
+	}
+	params := map[string]any{
+		"textDocument": map[string]any{
+			"uri": uri,
+		},
+		"position": map[string]any{
+			"line":      line,
+			"character": character,
+		},
+		"newName": newName,
+	}
+	id, err := lsp.sendRequest("textDocument/rename", params)
+	if err != nil {
+		return nil, err
+	}
+	response, err := lsp.readResponse(id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if errorData, hasError := response["error"]; hasError {
+		if errorMap, ok := errorData.(map[string]any); ok {
+			if msg, ok := errorMap["message"].(string); ok && msg != "" {
+				return nil, errors.New(msg)
+			}
+		}
+		return nil, fmt.Errorf("LSP error: %v", errorData)
+	}
+	resultData, ok := response["result"]
+	if !ok || resultData == nil {
+		return nil, errors.New("nothing to rename")
+	}
+	resultBytes, err := json.Marshal(resultData)
+	if err != nil {
+		return nil, err
+	}
+	var edit LSPWorkspaceEdit
+	if err := json.Unmarshal(resultBytes, &edit); err != nil {
+		return nil, errors.New("could not parse rename response")
+	}
+	return &edit, nil
+}
+
+// GetReferences requests all references to the symbol at the given position, including the declaration
+func (lsp *LSPClient) GetReferences(uri string, line, character int, timeout time.Duration) ([]LSPLocation, error) {
+	if !lsp.initialized {
+		return nil, errors.New("LSP client not initialized")
+	}
+	params := map[string]any{
+		"textDocument": map[string]any{
+			"uri": uri,
+		},
+		"position": map[string]any{
+			"line":      line,
+			"character": character,
+		},
+		"context": map[string]any{
+			"includeDeclaration": true,
+		},
+	}
+	id, err := lsp.sendRequest("textDocument/references", params)
+	if err != nil {
+		return nil, err
+	}
+	response, err := lsp.readResponse(id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	resultData, ok := response["result"]
+	if !ok {
+		if errorData, hasError := response["error"]; hasError {
+			return nil, fmt.Errorf("LSP error: %v", errorData)
+		}
+		return nil, errors.New("no result in references response")
+	}
+	if resultData == nil {
+		return nil, nil
+	}
+	resultBytes, err := json.Marshal(resultData)
+	if err != nil {
+		return nil, err
+	}
+	var locations []LSPLocation
+	if err := json.Unmarshal(resultBytes, &locations); err != nil {
+		return nil, errors.New("could not parse references response")
+	}
+	return locations, nil
+}
+
 // Shutdown cleanly shuts down the LSP client
 func (lsp *LSPClient) Shutdown() error {
 	lsp.mutex.Lock()
@@ -908,6 +1174,19 @@ func GetReadyLSPClient(m mode.Mode, workspaceRoot string) *LSPClient {
 	return nil
 }
 
+// hasLSPClient returns true if a language server has been started for the given mode, in any workspace
+func hasLSPClient(m mode.Mode) bool {
+	lspMutex.Lock()
+	defer lspMutex.Unlock()
+	prefix := lspClientKey(m, "")
+	for key := range lspClients {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetOrCreateLSPClient returns the LSP client for the given mode, creating it if needed
 func GetOrCreateLSPClient(ctx context.Context, m mode.Mode, workspaceRoot string, linkedProjects ...any) (*LSPClient, error) {
 	key := lspClientKey(m, workspaceRoot)
@@ -1011,15 +1290,23 @@ func TriggerLSPInitialization(m mode.Mode, workspaceRoot string, linkedProjects
 	// quick check -- if already exists, return
 	lspMutex.Lock()
 	key := lspClientKey(m, workspaceRoot)
-	if client, exists := lspClients[key]; exists && client != nil {
+	if client, exists := lspClients[key]; (exists && client != nil) || lspStarting[key] || lspFailed[key] {
 		lspMutex.Unlock()
 		return
 	}
+	lspStarting[key] = true
 	lspMutex.Unlock()
 
 	// start LSP in the background
 	go func() {
-		GetOrCreateLSPClient(context.Background(), m, workspaceRoot, linkedProjects...)
+		_, err := GetOrCreateLSPClient(context.Background(), m, workspaceRoot, linkedProjects...)
+		lspMutex.Lock()
+		delete(lspStarting, key)
+		if err != nil {
+			// don't keep relaunching a server that fails to start
+			lspFailed[key] = true
+		}
+		lspMutex.Unlock()
 	}()
 }
 
@@ -1467,35 +1754,24 @@ func (e *Editor) GetLSPCompletions() ([]LSPCompletionItem, error) {
 	if err != nil {
 		x = 0
 		// If position is after data, use the line length
-		if lineRunes, ok := e.lines[line]; ok {
+		if lineRunes, ok := e.lines.Get(line); ok {
 			x = len(lineRunes)
 		}
 	}
 
 	currentLine := e.lineUpToX(line, x)
-	fileContent := e.String()
 
 	uri := "file://" + lspFilePath
-	if needsWorkspaceSetup(e.mode) && lspFilePath != absPath {
-		os.WriteFile(lspFilePath, []byte(fileContent), 0644)
+	if needsWorkspaceSetup(e.mode) && lspFilePath != absPath && !client.IsOpen(uri) {
+		os.WriteFile(lspFilePath, []byte(e.String()), 0644)
 	}
 
-	if client.openedURI != uri {
-		if err := client.DidOpen(uri, config.LanguageID, fileContent); err != nil {
-			client.openedURI = ""
-			return nil, err
-		}
-		client.openedURI = uri
-		client.openedVersion = 1
-	} else {
-		client.openedVersion++
-		if err := client.DidChange(uri, fileContent, client.openedVersion); err != nil {
-			client.openedURI = ""
-			return nil, err
-		}
-		if slowToWarmUp(e.mode) {
-			time.Sleep(50 * time.Millisecond)
-		}
+	opened, err := client.SyncDocument(uri, config.LanguageID, e.lines)
+	if err != nil {
+		return nil, err
+	}
+	if !opened && slowToWarmUp(e.mode) {
+		time.Sleep(50 * time.Millisecond)
 	}
 
 	// detect trigger character (only if cursor is immediately after "." or "::")
@@ -1522,6 +1798,104 @@ func (e *Editor) GetLSPCompletions() ([]LSPCompletionItem, error) {
 	return items, nil
 }
 
+// lspDocument describes where the current file lives, as seen by its language server
+type lspDocument struct {
+	config         LSPConfig
+	absPath        string // the file that is being edited
+	lspFilePath    string // the file that is sent to the language server, may be in a temporary workspace
+	workspaceRoot  string
+	linkedProjects []any
+}
+
+// lspDocumentForEditor finds the language server configuration and workspace for the current file
+func (e *Editor) lspDocumentForEditor() (*lspDocument, error) {
+	config, ok := lspConfigs[e.mode]
+	if !ok {
+		return nil, fmt.Errorf("LSP not supported for mode %v", e.mode)
+	}
+
+	absPath, err := filepath.Abs(e.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &lspDocument{
+		config:        config,
+		absPath:       absPath,
+		lspFilePath:   absPath,
+		workspaceRoot: findWorkspaceRoot(absPath, config.RootMarkerFiles),
+	}
+	if e.mode == mode.Rust && !hasCargoToml(doc.workspaceRoot) {
+		doc.linkedProjects = []any{rustProjectForFile(filepath.Base(absPath))}
+		doc.workspaceRoot = filepath.Dir(absPath)
+	} else if e.mode == mode.C || e.mode == mode.Cpp {
+		doc.workspaceRoot, doc.lspFilePath = ensureCWorkspace(doc.workspaceRoot, absPath, config.LanguageID)
+	} else if e.mode == mode.Gleam && !hasGleamToml(doc.workspaceRoot) {
+		doc.workspaceRoot, doc.lspFilePath = ensureGleamWorkspace(absPath)
+	}
+	return doc, nil
+}
+
+// sendLSPDocument sends the current editor contents to the language server,
+// with didOpen the first time and only the changed lines after that. Returns the document URI.
+func (e *Editor) sendLSPDocument(client *LSPClient, doc *lspDocument) (string, error) {
+	uri := "file://" + doc.lspFilePath
+	if needsWorkspaceSetup(e.mode) && doc.lspFilePath != doc.absPath && !client.IsOpen(uri) {
+		os.WriteFile(doc.lspFilePath, []byte(e.String()), 0644)
+	}
+	setLSPDocumentURI(doc.absPath, uri)
+	if _, err := client.SyncDocument(uri, doc.config.LanguageID, e.lines); err != nil {
+		return "", err
+	}
+	return uri, nil
+}
+
+// syncLSPDocument finds or starts the language server for the current file and
+// sends it the current editor contents. Returns the client and the document URI.
+func (e *Editor) syncLSPDocument() (*LSPClient, string, error) {
+	doc, err := e.lspDocumentForEditor()
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := GetOrCreateLSPClient(context.Background(), e.mode, doc.workspaceRoot, doc.linkedProjects...)
+	if err != nil {
+		return nil, "", err
+	}
+	if !client.initialized {
+		return nil, "", errors.New("LSP client not initialized")
+	}
+	uri, err := e.sendLSPDocument(client, doc)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, uri, nil
+}
+
+// syncLSPDocumentIfReady is like syncLSPDocument, but never waits for the language server.
+// If the server is not running yet, nil is returned, and if start is true, the server is also
+// started in the background. Only actions that the user asks for should start a server.
+func (e *Editor) syncLSPDocumentIfReady(start bool) (*LSPClient, string) {
+	doc, err := e.lspDocumentForEditor()
+	if err != nil {
+		return nil, ""
+	}
+	if _, _, found := lspServerFor(e.mode); !found {
+		return nil, ""
+	}
+	if start {
+		TriggerLSPInitialization(e.mode, doc.workspaceRoot, doc.linkedProjects...)
+	}
+	client := GetReadyLSPClient(e.mode, doc.workspaceRoot)
+	if client == nil {
+		return nil, ""
+	}
+	uri, err := e.sendLSPDocument(client, doc)
+	if err != nil {
+		return nil, ""
+	}
+	return client, uri
+}
+
 // ShutdownAllLSPClients shuts down all running LSP clients
 func ShutdownAllLSPClients() {
 	lspMutex.Lock()
@@ -1655,13 +2029,12 @@ func (e *Editor) handleLSPCompletion(c *vt.Canvas, status *StatusBar, tty *vt.TT
 	x, err := e.DataX()
 	if err != nil {
 		x = 0
-		if lineRunes, ok := e.lines[line]; ok {
+		if lineRunes, ok := e.lines.Get(line); ok {
 			x = len(lineRunes)
 		}
 	}
 
 	currentLine := e.lineUpToX(line, x)
-	fileContent := e.String()
 
 	// check if completing right after a trigger character
 	var needsPlaceholder bool
@@ -1673,8 +2046,10 @@ func (e *Editor) handleLSPCompletion(c *vt.Canvas, status *StatusBar, tty *vt.TT
 	}
 
 	// for Zig, add a placeholder identifier to help the LSP with incomplete syntax
+	var fileContent string
 	if needsPlaceholder && e.mode == mode.Zig {
 		// Insert placeholder "X" at the cursor position
+		fileContent = e.String()
 		lines := strings.Split(fileContent, "\n")
 		if line >= 0 && line < len(lines) {
 			currentLineStr := lines[line]
@@ -1685,35 +2060,27 @@ func (e *Editor) handleLSPCompletion(c *vt.Canvas, status *StatusBar, tty *vt.TT
 		}
 	}
 
-	// update the physical file in temp workspace, if any
-	if needsWorkspaceSetup(e.mode) && lspFilePath != absPath {
-		os.WriteFile(lspFilePath, []byte(fileContent), 0644)
+	// create the physical file in temp workspace, if any
+	uri := "file://" + lspFilePath
+	if needsWorkspaceSetup(e.mode) && lspFilePath != absPath && !client.IsOpen(uri) {
+		os.WriteFile(lspFilePath, []byte(e.String()), 0644)
 	}
 
 	startSpinner("")
 
-	uri := "file://" + lspFilePath
-	if client.openedURI != uri {
-		if err := client.DidOpen(uri, config.LanguageID, fileContent); err != nil {
-			stopSpinner()
-			client.openedURI = ""
-			status.SetMessageAfterRedraw(fmt.Sprintf("%s error: %v", lspCommand, err))
-			return false
-		}
-		client.openedURI = uri
-		client.openedVersion = 1
-
+	var opened bool
+	if fileContent != "" {
+		opened, err = client.SyncDocumentText(uri, config.LanguageID, fileContent)
 	} else {
-		client.openedVersion++
-		if err := client.DidChange(uri, fileContent, client.openedVersion); err != nil {
-			stopSpinner()
-			client.openedURI = ""
-			status.SetMessageAfterRedraw(fmt.Sprintf("%s error: %v", lspCommand, err))
-			return false
-		}
-		if slowToWarmUp(e.mode) {
-			time.Sleep(50 * time.Millisecond)
-		}
+		opened, err = client.SyncDocument(uri, config.LanguageID, e.lines)
+	}
+	if err != nil {
+		stopSpinner()
+		status.SetMessageAfterRedraw(fmt.Sprintf("%s error: %v", lspCommand, err))
+		return false
+	}
+	if !opened && slowToWarmUp(e.mode) {
+		time.Sleep(50 * time.Millisecond)
 	}
 
 	// detect trigger character (only if cursor is immediately after "." or "::")
@@ -1739,7 +2106,7 @@ func (e *Editor) handleLSPCompletion(c *vt.Canvas, status *StatusBar, tty *vt.TT
 		items, err = client.GetCompletions(uri, line, x, triggerChar)
 		if err != nil {
 			stopSpinner()
-			client.openedURI = ""
+			client.setOpenDocument(uri, nil)
 			status.SetMessageAfterRedraw(fmt.Sprintf("%s error: %v", lspCommand, err))
 			return false
 		}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/xyproto/mode"
+	"github.com/xyproto/vt"
 )
 
 func TestCompletionFiltering(t *testing.T) {
@@ -140,3 +147,663 @@ func TestNixCompletionFiltering(t *testing.T) {
 		}
 	}
 }
+
+func TestHoverMarkdown(t *testing.T) {
+	for _, tc := range []struct {
+		contents any
+		want     string
+	}{
+		{map[string]any{"kind": "markdown", "value": "func Println()"}, "func Println()"},
+		{"plain text", "plain text"},
+		{map[string]any{"language": "go", "value": "var x int"}, "```go\nvar x int\n```"},
+		{[]any{"first", map[string]any{"language": "c", "value": "int x;"}}, "first\n\n```c\nint x;\n```"},
+		{nil, ""},
+	} {
+		if got := hoverMarkdown(tc.contents); got != tc.want {
+			t.Errorf("hoverMarkdown(%v) = %q, want %q", tc.contents, got, tc.want)
+		}
+	}
+}
+
+func TestHoverLines(t *testing.T) {
+	markdown := "```go\nfunc Println(a ...any) (n int, err error)\n```\n\n---\n\n### Println formats\n\nSee [`fmt.Println` on pkg.go.dev](https://pkg.go.dev/fmt#Println)\\."
+	got := hoverLines(markdown, 80)
+	want := []string{
+		"  func Println(a ...any) (n int, err error)",
+		"",
+		"Println formats",
+		"",
+		"See fmt.Println on pkg.go.dev.",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("hoverLines() = %q, want %q", got, want)
+	}
+	for _, line := range hoverLines(strings.Repeat("word ", 40), 20) {
+		if len([]rune(line)) > 20 {
+			t.Errorf("line %q is wider than 20", line)
+		}
+	}
+}
+
+func TestDiagnosticHighlightsInUTF16(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("😀 x := y\n"))
+	runes := e.lines.Line(0)
+	attributes := make([]vt.CharAttribute, len(runes))
+	for i, r := range runes {
+		attributes[i] = vt.CharAttribute{R: r, A: vt.Default}
+	}
+	// The emoji is two UTF-16 code units, so character 3 is the "x"
+	e.applyDiagnosticHighlights(0, []LSPDiagnostic{{Range: LSPRange{
+		Start: LSPPosition{Line: 0, Character: 3},
+		End:   LSPPosition{Line: 0, Character: 4},
+	}}}, attributes)
+	for i, ca := range attributes {
+		if underlined := ca.A != vt.Default; underlined != (i == 2) {
+			t.Errorf("rune %d (%q): underlined is %v", i, ca.R, underlined)
+		}
+	}
+}
+
+func TestStoreLSPDiagnostics(t *testing.T) {
+	const uri = "file:///tmp/orbiton_diagnostics_test.go"
+	storeLSPDiagnostics(map[string]any{
+		"uri": uri,
+		"diagnostics": []any{
+			map[string]any{"message": "second", "severity": 2, "range": map[string]any{
+				"start": map[string]any{"line": 7, "character": 1}, "end": map[string]any{"line": 7, "character": 4}}},
+			map[string]any{"message": "first\nmore details", "source": "compiler", "range": map[string]any{
+				"start": map[string]any{"line": 2, "character": 0}, "end": map[string]any{"line": 3, "character": 2}}},
+		},
+	})
+	lspDiagnosticsMutex.RLock()
+	diagnostics := lspDiagnostics[uri]
+	lspDiagnosticsMutex.RUnlock()
+	if len(diagnostics) != 2 || diagnostics[0].Message != "first\nmore details" {
+		t.Fatalf("expected 2 diagnostics sorted by position, got %v", diagnostics)
+	}
+	if got := diagnosticText(diagnostics[0]); got != "error: first (compiler)" {
+		t.Errorf("diagnosticText() = %q", got)
+	}
+	byLine := diagnosticsByLine(diagnostics)
+	if len(byLine[2]) != 1 || len(byLine[3]) != 1 || len(byLine[7]) != 1 || len(byLine[5]) != 0 {
+		t.Errorf("unexpected diagnostics by line: %v", byLine)
+	}
+	if d := mostSevere(diagnostics); d.Message != "first\nmore details" {
+		t.Errorf("mostSevere() = %v", d)
+	}
+	storeLSPDiagnostics(map[string]any{"uri": uri, "diagnostics": []any{}})
+	lspDiagnosticsMutex.RLock()
+	_, found := lspDiagnostics[uri]
+	lspDiagnosticsMutex.RUnlock()
+	if found {
+		t.Error("diagnostics should be removed when an empty list is published")
+	}
+}
+
+func TestExpandedRuneIndex(t *testing.T) {
+	runes := []rune("\t\tx := 1")
+	if got := expandedRuneIndex(runes, 2, 4); got != 8 {
+		t.Errorf("expandedRuneIndex(..., 2, 4) = %d, want 8", got)
+	}
+	if got := expandedRuneIndex(runes, 0, 4); got != 0 {
+		t.Errorf("expandedRuneIndex(..., 0, 4) = %d, want 0", got)
+	}
+}
+
+func TestApplyLSPTextEdits(t *testing.T) {
+	edit := func(sl, sc, el, ec int, text string) LSPTextEdit {
+		return LSPTextEdit{NewText: text, Range: LSPRange{Start: LSPPosition{sl, sc}, End: LSPPosition{el, ec}}}
+	}
+	lines := []string{"func foo() {", "\tfoo()", "}"}
+	// the edits are given in order, but must be applied from the end
+	got := applyLSPTextEdits(lines, []LSPTextEdit{edit(0, 5, 0, 8, "bar"), edit(1, 1, 1, 4, "bar")})
+	if want := "func bar() {\n\tbar()\n}"; strings.Join(got, "\n") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, "\n"), want)
+	}
+	if strings.Join(lines, "\n") != "func foo() {\n\tfoo()\n}" {
+		t.Error("the given lines should not be modified")
+	}
+	// multi-line edits, both removing and inserting lines
+	got = applyLSPTextEdits(lines, []LSPTextEdit{edit(0, 11, 2, 1, "{ return }"), edit(0, 0, 0, 0, "// x\n")})
+	if want := "// x\nfunc foo() { return }"; strings.Join(got, "\n") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, "\n"), want)
+	}
+	// the characters are counted in UTF-16 code units, where 😀 counts as two
+	got = applyLSPTextEdits([]string{`s := "😀" + foo`}, []LSPTextEdit{edit(0, 12, 0, 15, "bar")})
+	if want := `s := "😀" + bar`; got[0] != want {
+		t.Errorf("got %q, want %q", got[0], want)
+	}
+	if x := lspCharacter([]rune(`s := "😀" + foo`), 11); x != 12 {
+		t.Errorf("expected rune index 11 to be character 12, got %d", x)
+	}
+}
+
+func TestLSPWorkspaceEditEdits(t *testing.T) {
+	we := &LSPWorkspaceEdit{
+		Changes: map[string][]LSPTextEdit{"file:///a.go": {{NewText: "x"}}},
+		DocumentChanges: []json.RawMessage{
+			json.RawMessage(`{"textDocument":{"uri":"file:///b.go","version":1},"edits":[{"newText":"y","range":{"start":{"line":1,"character":2},"end":{"line":1,"character":3}}}]}`),
+			json.RawMessage(`{"kind":"create","uri":"file:///c.go"}`),
+		},
+	}
+	edits := we.Edits()
+	if len(edits) != 2 || len(edits["file:///a.go"]) != 1 || len(edits["file:///b.go"]) != 1 {
+		t.Fatalf("unexpected edits: %v", edits)
+	}
+	if e := edits["file:///b.go"][0]; e.NewText != "y" || e.Range.Start.Character != 2 {
+		t.Errorf("unexpected edit: %v", e)
+	}
+	if got := uriToPath("file:///tmp/a%20b.go"); got != "/tmp/a b.go" {
+		t.Errorf("uriToPath() = %q", got)
+	}
+}
+
+func TestApplyLSPWorkspaceEditUndo(t *testing.T) {
+	other := filepath.Join(t.TempDir(), "other.go")
+	if err := os.WriteFile(other, []byte("package main\n\nvar foo = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filepath.Join(t.TempDir(), "main.go")
+	e.InsertStringAndMove(nil, "foo")
+	r := NewUndo(64, 1024*1024)
+	u := NewUndo(64, 1024*1024).WithRedoBuffer(r)
+	we := &LSPWorkspaceEdit{Changes: map[string][]LSPTextEdit{
+		"file://" + other: {{NewText: "bar", Range: LSPRange{Start: LSPPosition{2, 4}, End: LSPPosition{2, 7}}}},
+	}}
+	changed, err := e.ApplyLSPWorkspaceEdit(u, we)
+	if err != nil || len(changed) != 1 || changed[0] != other {
+		t.Fatalf("ApplyLSPWorkspaceEdit() = %v, %v", changed, err)
+	}
+	if data, _ := os.ReadFile(other); string(data) != "package main\n\nvar bar = 1\n" {
+		t.Fatalf("unexpected contents after the edit: %q", data)
+	}
+	// undo writes the original contents back, and redo applies the edit again
+	r.Snapshot(e)
+	if err := u.Restore(e); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if data, _ := os.ReadFile(other); string(data) != "package main\n\nvar foo = 1\n" {
+		t.Errorf("unexpected contents after undo: %q", data)
+	}
+	if err := r.Restore(e); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if data, _ := os.ReadFile(other); string(data) != "package main\n\nvar bar = 1\n" {
+		t.Errorf("unexpected contents after redo: %q", data)
+	}
+}
+
+// TestApplyLSPWorkspaceEditsOneSnapshot applies an edit to the buffer and then one to another file,
+// like a code action with both an edit and a command, and checks that one undo reverts both
+func TestApplyLSPWorkspaceEditsOneSnapshot(t *testing.T) {
+	other := filepath.Join(t.TempDir(), "other.go")
+	if err := os.WriteFile(other, []byte("var foo = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filepath.Join(t.TempDir(), "main.go")
+	e.InsertStringAndMove(nil, "foo")
+	u := NewUndo(64, 0)
+	var snapshotTaken bool
+	bufferEdit := &LSPWorkspaceEdit{Changes: map[string][]LSPTextEdit{
+		"file://" + e.filename: {{NewText: "bar", Range: LSPRange{Start: LSPPosition{0, 0}, End: LSPPosition{0, 3}}}},
+	}}
+	fileEdit := &LSPWorkspaceEdit{Changes: map[string][]LSPTextEdit{
+		"file://" + other: {{NewText: "bar", Range: LSPRange{Start: LSPPosition{0, 4}, End: LSPPosition{0, 7}}}},
+	}}
+	for _, we := range []*LSPWorkspaceEdit{bufferEdit, fileEdit} {
+		if _, err := e.applyLSPWorkspaceEdit(u, we, &snapshotTaken); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if u.Len() != 1 {
+		t.Fatalf("expected one undo snapshot, got %d", u.Len())
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(other); e.Line(0) != "foo" || string(data) != "var foo = 1\n" {
+		t.Errorf("expected both edits to be undone, got %q and %q", e.Line(0), data)
+	}
+}
+
+func TestWordOccurrences(t *testing.T) {
+	line := []rune("foo(foobar, foo) + _foo + foo")
+	got := wordOccurrences(line, []rune("foo"), mode.Go)
+	if len(got) != 3 || got[0] != 0 || got[1] != 12 || got[2] != 26 {
+		t.Errorf("wordOccurrences() = %v, want [0 12 26]", got)
+	}
+	if got := wordOccurrences([]rune("my-var myvar"), []rune("my"), mode.Nix); len(got) != 0 {
+		t.Errorf("in Nix, - is part of identifiers, got %v", got)
+	}
+}
+
+// lastDidChange returns the content changes and the version of the last message in sent
+func lastDidChange(t *testing.T, sent *bufferWriteCloser) ([]LSPContentChange, int) {
+	t.Helper()
+	messages := strings.Split(sent.String(), "Content-Length: ")
+	body := messages[len(messages)-1]
+	body = body[strings.Index(body, "{"):]
+	var msg struct {
+		Method string `json:"method"`
+		Params struct {
+			TextDocument struct {
+				Version int `json:"version"`
+			} `json:"textDocument"`
+			ContentChanges []LSPContentChange `json:"contentChanges"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal([]byte(body), &msg); err != nil || msg.Method != "textDocument/didChange" {
+		t.Fatalf("expected didChange, got %q (%v)", body, err)
+	}
+	return msg.Params.ContentChanges, msg.Params.TextDocument.Version
+}
+
+func TestSyncDocumentSendsChangedLines(t *testing.T) {
+	tests := []func(b *LineBuffer){
+		func(b *LineBuffer) { b.Set(1, []rune("B")) },
+		func(b *LineBuffer) { b.Delete(1) },
+		func(b *LineBuffer) { b.Insert(2, []rune("b2")) },
+		func(b *LineBuffer) { b.Insert(3, []rune("d")) },
+		func(b *LineBuffer) { b.Set(2, []rune("cæ😀")); b.Insert(0, []rune("0")) },
+		func(b *LineBuffer) { b.DeleteRange(0, 3) },
+		func(b *LineBuffer) { b.Insert(1, []rune("x")); b.Delete(2) },
+	}
+	const uri = "file:///tmp/main.go"
+	for i, change := range tests {
+		lsp, sent := newFakeLSPClient()
+		lsp.syncKind = lspSyncIncremental
+		b := NewLineBufferFromBytes([]byte("a\nb\nc"), false)
+		if opened, err := lsp.SyncDocument(uri, "go", b); err != nil || !opened {
+			t.Fatalf("expected the document to be opened, got %v", err)
+		}
+		sent.Reset()
+		if _, err := lsp.SyncDocument(uri, "go", b); err != nil || sent.Len() > 0 {
+			t.Fatalf("expected nothing to be sent for an unchanged document, got %q (%v)", sent.String(), err)
+		}
+		oldText := linesText(b, 0, b.Len())
+		change(b)
+		if _, err := lsp.SyncDocument(uri, "go", b); err != nil {
+			t.Fatal(err)
+		}
+		changes, version := lastDidChange(t, sent)
+		if len(changes) != 1 || changes[0].Range == nil || version != 2 {
+			t.Fatalf("test %d: expected one change with a range and version 2, got %+v and %d", i, changes, version)
+		}
+		edit := LSPTextEdit{NewText: changes[0].Text, Range: *changes[0].Range}
+		got := strings.Join(applyLSPTextEdits(strings.Split(oldText, "\n"), []LSPTextEdit{edit}), "\n")
+		if want := linesText(b, 0, b.Len()); got != want {
+			t.Errorf("test %d: applying %+v to %q gave %q, expected %q", i, changes[0], oldText, got, want)
+		}
+	}
+}
+
+func TestSyncDocumentFullAndPerURI(t *testing.T) {
+	lsp, sent := newFakeLSPClient()
+	lsp.syncKind = lspSyncIncremental
+	a := NewLineBufferFromBytes([]byte("a\n"), false)
+	b := NewLineBufferFromBytes([]byte("b\n"), false)
+	lsp.SyncDocument("file:///tmp/a.go", "go", a)
+	lsp.SyncDocument("file:///tmp/b.go", "go", b)
+	// Switching back to the first document changes it, instead of opening it again
+	a2 := a.Clone()
+	a2.Set(0, []rune("A"))
+	sent.Reset()
+	if opened, err := lsp.SyncDocument("file:///tmp/a.go", "go", a2); err != nil || opened {
+		t.Fatalf("expected the document to still be open, got %v", err)
+	}
+	// The lines are not the ones that were sent, so the full contents are sent
+	if changes, _ := lastDidChange(t, sent); len(changes) != 1 || changes[0].Range != nil || changes[0].Text != "A\n\n" {
+		t.Errorf("expected the full contents to be sent, got %+v", changes)
+	}
+	// With full sync, the full contents are sent, but only if something has changed
+	lsp.syncKind = lspSyncFull
+	sent.Reset()
+	lsp.SyncDocument("file:///tmp/b.go", "go", b)
+	if sent.Len() > 0 {
+		t.Errorf("expected nothing to be sent, got %q", sent.String())
+	}
+	b.Set(0, []rune("B"))
+	lsp.SyncDocument("file:///tmp/b.go", "go", b)
+	if changes, version := lastDidChange(t, sent); len(changes) != 1 || changes[0].Range != nil || changes[0].Text != "B\n\n" || version != 2 {
+		t.Errorf("expected the full contents to be sent, got %+v and version %d", changes, version)
+	}
+}
+
+func TestTextDocumentSyncKind(t *testing.T) {
+	if kind := textDocumentSyncKind(map[string]any{"textDocumentSync": float64(2)}); kind != lspSyncIncremental {
+		t.Errorf("expected incremental sync, got %d", kind)
+	}
+	if kind := textDocumentSyncKind(map[string]any{"textDocumentSync": map[string]any{"openClose": true, "change": float64(1)}}); kind != lspSyncFull {
+		t.Errorf("expected full sync, got %d", kind)
+	}
+	if kind := textDocumentSyncKind(map[string]any{}); kind != lspSyncFull {
+		t.Errorf("expected full sync by default, got %d", kind)
+	}
+}
+
+func TestParseLSPConfigs(t *testing.T) {
+	configs := map[mode.Mode]LSPConfig{
+		mode.Python: {Command: "pyright-langserver", Args: []string{"--stdio"}, LanguageID: "python", RootMarkerFiles: []string{".git"}, FileExtensions: []string{".py"}},
+		mode.Cpp:    {Command: "clangd", Args: []string{"--background-index"}, LanguageID: "cpp"},
+	}
+	const data = `
+[python]
+command = "basedpyright-langserver"
+
+[cpp]
+args = ["--background-index", "--clang-tidy"]
+
+[typescript]
+command = "typescript-language-server"
+args = ["--stdio"]
+extensions = [".ts", ".tsx"]
+
+[java]
+command = "jdtls"
+root_markers = ["pom.xml", "build.gradle"]
+
+[java.initialization_options]
+bundles = []
+`
+	if err := parseLSPConfigs([]byte(data), configs); err != nil {
+		t.Fatal(err)
+	}
+	if python := configs[mode.Python]; python.Command != "basedpyright-langserver" || len(python.Args) != 1 || python.LanguageID != "python" {
+		t.Errorf("expected only the command to be replaced for Python, got %+v", python)
+	}
+	if cpp := configs[mode.Cpp]; cpp.Command != "clangd" || len(cpp.Args) != 2 {
+		t.Errorf("expected only the arguments to be replaced for C++, got %+v", cpp)
+	}
+	if ts := configs[mode.TypeScript]; ts.Command != "typescript-language-server" || ts.LanguageID != "typescript" || len(ts.FileExtensions) != 2 {
+		t.Errorf("unexpected TypeScript configuration: %+v", ts)
+	}
+	if java := configs[mode.Java]; java.Command != "jdtls" || len(java.RootMarkerFiles) != 2 || java.InitializationOptions == nil {
+		t.Errorf("unexpected Java configuration: %+v", java)
+	}
+	if err := parseLSPConfigs([]byte("[kotlin]\nargs = []\n"), configs); err == nil {
+		t.Error("expected an error for a new language without a command")
+	}
+	if err := parseLSPConfigs([]byte("[nosuchlanguage]\ncommand = \"x\"\n"), configs); err == nil {
+		t.Error("expected an error for an unknown language")
+	}
+}
+
+// TestLoadLSPConfigsKeepsBuiltInOnError checks that an error in lsp.toml leaves the built-in configurations as they are
+func TestLoadLSPConfigsKeepsBuiltInOnError(t *testing.T) {
+	oldFilename, oldConfigs := lspConfigFilename, lspConfigs
+	defer func() {
+		lspConfigFilename, lspConfigs = oldFilename, oldConfigs
+	}()
+	lspConfigFilename = filepath.Join(t.TempDir(), "lsp.toml")
+	// The first entry is fine, while the second one has an error
+	if err := os.WriteFile(lspConfigFilename, []byte("[python]\ncommand = \"x\"\n\n[zzz]\ncommand = \"y\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pythonCommand := lspConfigs[mode.Python].Command
+	if err := LoadLSPConfigs(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := lspConfigs[mode.Python].Command; got != pythonCommand {
+		t.Errorf("expected the built-in Python command %q, got %q", pythonCommand, got)
+	}
+}
+
+func TestActiveSignature(t *testing.T) {
+	var help LSPSignatureHelp
+	data := `{"signatures":[{"label":"func Repeat(s string, count int) string","parameters":[{"label":"s string"},{"label":"count int"}]}],"activeParameter":1}`
+	if err := json.Unmarshal([]byte(data), &help); err != nil {
+		t.Fatal(err)
+	}
+	label, start, end := help.activeSignature()
+	if got := string([]rune(label)[start:end]); got != "count int" {
+		t.Errorf("expected the second parameter to be active, got %q", got)
+	}
+	// offsets are in UTF-16 code units, and the activeParameter of the signature takes precedence
+	data = `{"signatures":[{"label":"fn æ(😀: i32, b: i32)","activeParameter":0,"parameters":[{"label":[5,12]},{"label":[14,20]}]}],"activeParameter":1}`
+	if err := json.Unmarshal([]byte(data), &help); err != nil {
+		t.Fatal(err)
+	}
+	label, start, end = help.activeSignature()
+	if got := string([]rune(label)[start:end]); got != "😀: i32" {
+		t.Errorf("expected the first parameter to be active, got %q", got)
+	}
+	help.Signatures[0].Parameters = nil
+	if _, start, end := help.activeSignature(); start != -1 || end != -1 {
+		t.Errorf("expected no active parameter, got %d, %d", start, end)
+	}
+}
+
+func TestParseCodeActions(t *testing.T) {
+	var result []any
+	data := `[
+		{"title":"Add import: \"fmt\"","kind":"quickfix","isPreferred":true,"edit":{"changes":{"file:///tmp/main.go":[{"range":{"start":{"line":2,"character":0},"end":{"line":2,"character":0}},"newText":"import \"fmt\"\n"}]}}},
+		{"title":"Organize imports","command":"source.organizeImports","arguments":["file:///tmp/main.go"]},
+		{"title":"Extract function","kind":"refactor.extract","command":{"title":"Extract function","command":"gopls.apply_fix","arguments":[1]}},
+		{"title":"Fill struct","kind":"refactor.rewrite","data":{"id":7}},
+		"not an action",
+		{"kind":"quickfix"}
+	]`
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	actions := parseCodeActions(result)
+	if len(actions) != 4 {
+		t.Fatalf("expected 4 code actions, got %d", len(actions))
+	}
+	if a := actions[0]; a.Edit == nil || len(a.Edit.Changes["file:///tmp/main.go"]) != 1 || !a.IsPreferred || a.Command != nil {
+		t.Errorf("expected a preferred code action with an edit, got %+v", a)
+	}
+	if a := actions[1]; a.Command == nil || a.Command.Command != "source.organizeImports" || a.Title != "Organize imports" || len(a.Command.Arguments) != 1 {
+		t.Errorf("expected a plain command, got %+v", a)
+	}
+	if a := actions[2]; a.Command == nil || a.Command.Command != "gopls.apply_fix" || a.Kind != "refactor.extract" {
+		t.Errorf("expected a code action with a command, got %+v", a)
+	}
+	if a := actions[3]; a.Edit != nil || a.Command != nil || a.Data == nil || a.raw["title"] != "Fill struct" {
+		t.Errorf("expected a code action that needs to be resolved, got %+v", a)
+	}
+}
+
+// TestExecuteCommandAppliesEdits checks that edits the server asks for while executing a command
+// are applied before the server is told that they were applied
+func TestExecuteCommandAppliesEdits(t *testing.T) {
+	lsp, sent := newFakeLSPClient()
+	lsp.msgCh = make(chan map[string]any, 1)
+	var params any
+	data := `{"label":"Extract function","edit":{"changes":{"file:///tmp/main.go":[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":1}},"newText":"x"}]}}}`
+	if err := json.Unmarshal([]byte(data), &params); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits are refused when no command is being executed
+	lsp.answerServerRequest("workspace/applyEdit", 6, params)
+	if reply := sent.String(); !strings.Contains(reply, `"applied":false`) {
+		t.Fatalf("expected the edit to be refused, got %s", reply)
+	}
+	sent.Reset()
+
+	go func() {
+		// Wait for the command to be sent, then ask for an edit before responding, like gopls does
+		for {
+			lsp.mutex.Lock()
+			executing := lsp.appliedEdits != nil
+			lsp.mutex.Unlock()
+			if executing {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		lsp.answerServerRequest("workspace/applyEdit", 7, params)
+		lsp.msgCh <- map[string]any{"jsonrpc": "2.0", "id": float64(1), "result": nil}
+	}()
+	var applied []*LSPWorkspaceEdit
+	err := lsp.ExecuteCommand(&LSPCommand{Command: "gopls.apply_fix"}, time.Second, func(edit *LSPWorkspaceEdit) error {
+		applied = append(applied, edit)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || len(applied[0].Changes["file:///tmp/main.go"]) != 1 {
+		t.Errorf("expected one applied edit, got %v", applied)
+	}
+	if reply := sent.String(); !strings.Contains(reply, `"id":7`) || !strings.Contains(reply, `"applied":true`) {
+		t.Errorf("expected the server to be told that the edit was applied, got %s", reply)
+	}
+}
+
+func TestDiagnosticsInRange(t *testing.T) {
+	diagnostics := []LSPDiagnostic{
+		{Message: "a", Range: LSPRange{Start: LSPPosition{Line: 1}, End: LSPPosition{Line: 1, Character: 4}}},
+		{Message: "b", Range: LSPRange{Start: LSPPosition{Line: 3}, End: LSPPosition{Line: 5}}},
+		{Message: "c", Range: LSPRange{Start: LSPPosition{Line: 8}, End: LSPPosition{Line: 8}}},
+	}
+	r := LSPRange{Start: LSPPosition{Line: 4, Character: 2}, End: LSPPosition{Line: 4, Character: 2}}
+	if found := diagnosticsInRange(diagnostics, r); len(found) != 1 || found[0].Message != "b" {
+		t.Errorf("expected only the diagnostic that spans the cursor line, got %v", found)
+	}
+	r = LSPRange{Start: LSPPosition{Line: 0}, End: LSPPosition{Line: 8}}
+	if found := diagnosticsInRange(diagnostics, r); len(found) != 3 {
+		t.Errorf("expected all diagnostics in the selection, got %v", found)
+	}
+}
+
+func TestParseDocumentSymbols(t *testing.T) {
+	var result []any
+	data := `[
+		{"name":"Editor","kind":23,"range":{"start":{"line":2,"character":0},"end":{"line":9,"character":1}},"selectionRange":{"start":{"line":2,"character":5},"end":{"line":2,"character":11}},
+		 "children":[{"name":"lines","kind":8,"range":{"start":{"line":3,"character":1},"end":{"line":3,"character":20}},"selectionRange":{"start":{"line":3,"character":1},"end":{"line":3,"character":6}}}]},
+		{"name":"(*Editor).Save","kind":6,"range":{"start":{"line":11,"character":0},"end":{"line":14,"character":1}},"selectionRange":{"start":{"line":11,"character":18},"end":{"line":11,"character":22}}}
+	]`
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	outline, err := parseDocumentSymbols(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outline) != 2 {
+		t.Fatalf("expected the struct field to be left out, got %v", outline)
+	}
+	if s := outline[0]; s.Name != "Editor" || s.Kind != "struct" || s.Line != 2 || s.Col != 5 {
+		t.Errorf("unexpected first symbol: %+v", s)
+	}
+	if s := outline[1]; s.Kind != "method" || s.Line != 11 {
+		t.Errorf("unexpected second symbol: %+v", s)
+	}
+
+	data = `[{"name":"main","kind":12,"location":{"uri":"file:///tmp/main.c","range":{"start":{"line":4,"character":4},"end":{"line":8,"character":1}}}}]`
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	if outline, err := parseDocumentSymbols(result); err != nil || len(outline) != 1 || outline[0].Kind != "function" || outline[0].Line != 4 {
+		t.Errorf("unexpected symbol information: %v %v", outline, err)
+	}
+}
+
+func TestHeuristicOutline(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte("package main\n\n// Editor is an editor\ntype Editor struct {\n\tlines []string\n}\n\nfunc (e *Editor) Save() error {\n\treturn nil\n}\n\nfunc main() {\n}\n"))
+	outline := e.heuristicOutline()
+	if len(outline) != 3 {
+		t.Fatalf("expected 3 symbols, got %v", outline)
+	}
+	if s := outline[0]; s.Name != "Editor" || s.Kind != "type" || s.Line != 3 {
+		t.Errorf("unexpected type: %+v", s)
+	}
+	if s := outline[1]; s.Name != "Save" || s.Kind != "method" || s.Line != 7 {
+		t.Errorf("unexpected method: %+v", s)
+	}
+	if s := outline[2]; s.Name != "main" || s.Kind != "function" || s.Line != 11 {
+		t.Errorf("unexpected function: %+v", s)
+	}
+
+	e.mode = mode.Markdown
+	e.LoadBytes([]byte("# Title\n\nText\n\n```sh\n# not a heading\n```\n\n## Usage ##\n"))
+	outline = e.heuristicOutline()
+	if len(outline) != 2 || outline[0].Name != "Title" || outline[1].Name != "Usage" || outline[1].Depth != 1 {
+		t.Errorf("unexpected headings: %v", outline)
+	}
+}
+
+// bufferWriteCloser collects the messages that are sent to a fake language server
+type bufferWriteCloser struct {
+	bytes.Buffer
+}
+
+func (*bufferWriteCloser) Close() error { return nil }
+
+// newFakeLSPClient returns a client that receives the given responses, as if they were
+// sent by a language server, and collects the requests in the returned buffer
+func newFakeLSPClient(responses ...string) (*LSPClient, *bufferWriteCloser) {
+	sent := &bufferWriteCloser{}
+	lsp := &LSPClient{
+		stdin:       sent,
+		msgCh:       make(chan map[string]any, len(responses)),
+		running:     true,
+		initialized: true,
+	}
+	for _, response := range responses {
+		var msg map[string]any
+		if err := json.Unmarshal([]byte(response), &msg); err == nil {
+			lsp.msgCh <- msg
+		}
+	}
+	return lsp, sent
+}
+
+func TestGetRangeFormatting(t *testing.T) {
+	lsp, sent := newFakeLSPClient(`{"jsonrpc":"2.0","id":1,"result":[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":2}},"newText":"\t"}]}`)
+	r := LSPRange{Start: LSPPosition{Line: 1}, End: LSPPosition{Line: 3}}
+	edits, err := lsp.GetRangeFormatting("file:///tmp/init.lua", r, map[string]any{"tabSize": 4, "insertSpaces": false}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 1 || edits[0].NewText != "\t" {
+		t.Errorf("unexpected edits: %v", edits)
+	}
+	if request := sent.String(); !strings.Contains(request, `"method":"textDocument/rangeFormatting"`) || !strings.Contains(request, `"insertSpaces":false`) {
+		t.Errorf("unexpected request: %s", request)
+	}
+
+	lsp, _ = newFakeLSPClient(`{"jsonrpc":"2.0","id":1,"result":null}`, `{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"formatting is not supported"}}`)
+	if edits, err := lsp.GetFormatting("file:///tmp/init.lua", nil, time.Second); err != nil || len(edits) != 0 {
+		t.Errorf("expected no edits for a formatted document, got %v %v", edits, err)
+	}
+	if _, err := lsp.GetFormatting("file:///tmp/init.lua", nil, time.Second); err == nil || err.Error() != "formatting is not supported" {
+		t.Errorf("expected the error message from the server, got %v", err)
+	}
+}
+
+func TestKeepResponseDropsTheOldest(t *testing.T) {
+	lsp := &LSPClient{}
+	for id := 1; id <= 20; id++ {
+		lsp.keepResponse(id, map[string]any{"id": float64(id)})
+	}
+	if len(lsp.responses) != 16 {
+		t.Fatalf("expected 16 kept responses, got %d", len(lsp.responses))
+	}
+	for id := 1; id <= 20; id++ {
+		if _, ok := lsp.responses[id]; ok != (id > 4) {
+			t.Errorf("response %d: kept is %v", id, ok)
+		}
+	}
+}
+
+func TestReadResponseKeepsOtherResponses(t *testing.T) {
+	lsp, _ := newFakeLSPClient(`{"jsonrpc":"2.0","id":2,"result":"second"}`, `{"jsonrpc":"2.0","id":1,"result":"first"}`)
+	// The response to request 2 arrives first, while waiting for request 1, and must be kept for later
+	for _, id := range []int{1, 2} {
+		response, err := lsp.readResponse(id, time.Second)
+		if err != nil {
+			t.Fatalf("request %d: %v", id, err)
+		}
+		if want := map[int]string{1: "first", 2: "second"}[id]; response["result"] != want {
+			t.Errorf("request %d: expected %q, got %v", id, want, response["result"])
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// lspCodeActionTimeout is for requesting, resolving and executing code actions
+const lspCodeActionTimeout = 5 * time.Second
+
+// LSPCommand is a command that the language server can execute with workspace/executeCommand
+type LSPCommand struct {
+	Title     string `json:"title"`
+	Command   string `json:"command"`
+	Arguments []any  `json:"arguments,omitempty"`
+}
+
+// LSPCodeAction is a quick fix or refactoring, like adding a missing import or extracting a function.
+// Servers may also return a plain LSPCommand, which is stored in Command with the same Title.
+type LSPCodeAction struct {
+	Edit        *LSPWorkspaceEdit `json:"edit,omitempty"`
+	Command     *LSPCommand       `json:"command,omitempty"`
+	Data        any               `json:"data,omitempty"`
+	Title       string            `json:"title"`
+	Kind        string            `json:"kind,omitempty"`
+	IsPreferred bool              `json:"isPreferred,omitempty"`
+	raw         map[string]any    // the action as it was received, for codeAction/resolve
+}
+
+// parseCodeActions parses the result of a textDocument/codeAction request, which is a list of
+// CodeAction and Command objects. A Command has a command string where a CodeAction has an object.
+func parseCodeActions(result []any) []LSPCodeAction {
+	actions := make([]LSPCodeAction, 0, len(result))
+	for _, item := range result {
+		raw, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(raw)
+		if err != nil {
+			continue
+		}
+		if _, isCommand := raw["command"].(string); isCommand {
+			var command LSPCommand
+			if err := json.Unmarshal(data, &command); err != nil {
+				continue
+			}
+			actions = append(actions, LSPCodeAction{Title: command.Title, Command: &command, raw: raw})
+			continue
+		}
+		var action LSPCodeAction
+		if err := json.Unmarshal(data, &action); err != nil || action.Title == "" {
+			continue
+		}
+		action.raw = raw
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// GetCodeActions requests the code actions for the given range, passing along the diagnostics for that range
+func (lsp *LSPClient) GetCodeActions(uri string, r LSPRange, diagnostics []LSPDiagnostic, timeout time.Duration) ([]LSPCodeAction, error) {
+	if !lsp.initialized {
+		return nil, errors.New("LSP client not initialized")
+	}
+	if diagnostics == nil {
+		diagnostics = []LSPDiagnostic{}
+	}
+	params := map[string]any{
+		"textDocument": map[string]any{
+			"uri": uri,
+		},
+		"range": r,
+		"context": map[string]any{
+			"diagnostics": diagnostics,
+		},
+	}
+	id, err := lsp.sendRequest("textDocument/codeAction", params)
+	if err != nil {
+		return nil, err
+	}
+	response, err := lsp.readResponse(id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	resultData, ok := response["result"]
+	if !ok {
+		if errorData, hasError := response["error"]; hasError {
+			return nil, fmt.Errorf("LSP error: %v", errorData)
+		}
+		return nil, errors.New("no result in code action response")
+	}
+	result, _ := resultData.([]any)
+	return parseCodeActions(result), nil
+}
+
+// ResolveCodeAction asks the language server to fill in the edit of a code action,
+// for servers that leave it out of the list of code actions
+func (lsp *LSPClient) ResolveCodeAction(action LSPCodeAction, timeout time.Duration) (LSPCodeAction, error) {
+	id, err := lsp.sendRequest("codeAction/resolve", action.raw)
+	if err != nil {
+		return action, err
+	}
+	response, err := lsp.readResponse(id, timeout)
+	if err != nil {
+		return action, err
+	}
+	resultData, ok := response["result"].(map[string]any)
+	if !ok {
+		if errorData, hasError := response["error"]; hasError {
+			return action, fmt.Errorf("LSP error: %v", errorData)
+		}
+		return action, errors.New("no result in code action resolve response")
+	}
+	resolved := parseCodeActions([]any{resultData})
+	if len(resolved) == 0 {
+		return action, errors.New("could not parse code action resolve response")
+	}
+	return resolved[0], nil
+}
+
+// lspApplyEditRequest is a workspace/applyEdit request from the language server
+type lspApplyEditRequest struct {
+	id   any
+	edit *LSPWorkspaceEdit
+}
+
+// ExecuteCommand asks the language server to execute a command. Edits that the server asks
+// the editor to make while executing the command are passed to apply, and the server is told
+// if they could be applied.
+func (lsp *LSPClient) ExecuteCommand(command *LSPCommand, timeout time.Duration, apply func(*LSPWorkspaceEdit) error) error {
+	params := map[string]any{
+		"command": command.Command,
+	}
+	if len(command.Arguments) > 0 {
+		params["arguments"] = command.Arguments
+	}
+	requests := make(chan lspApplyEditRequest, 8)
+	lsp.mutex.Lock()
+	lsp.appliedEdits = requests
+	lsp.mutex.Unlock()
+	defer func() {
+		lsp.mutex.Lock()
+		lsp.appliedEdits = nil
+		lsp.mutex.Unlock()
+	}()
+	id, err := lsp.sendRequest("workspace/executeCommand", params)
+	if err != nil {
+		return err
+	}
+	response, err := lsp.readResponseApplyingEdits(id, timeout, requests, apply)
+	if err != nil {
+		return err
+	}
+	if errorData, hasError := response["error"]; hasError {
+		if errorMap, ok := errorData.(map[string]any); ok {
+			if msg, ok := errorMap["message"].(string); ok && msg != "" {
+				return errors.New(msg)
+			}
+		}
+		return fmt.Errorf("LSP error: %v", errorData)
+	}
+	return nil
+}
+
+// queueAppliedEdit passes an edit from a workspace/applyEdit request from the server on to
+// the command that is being executed, which applies it and replies to the server
+func (lsp *LSPClient) queueAppliedEdit(reqID, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	var request struct {
+		Edit LSPWorkspaceEdit `json:"edit"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return err
+	}
+	lsp.mutex.Lock()
+	defer lsp.mutex.Unlock()
+	if lsp.appliedEdits == nil {
+		return errors.New("edits are only applied while executing a command")
+	}
+	select {
+	case lsp.appliedEdits <- lspApplyEditRequest{id: reqID, edit: &request.Edit}:
+		return nil
+	default:
+		return errors.New("too many edits at once")
+	}
+}
+
+// lspSelectionRange returns the selection, or the position of the cursor if there is no selection.
+// The characters are counted in UTF-16 code units, as the language server expects.
+func (e *Editor) lspSelectionRange() LSPRange {
+	if e.HasSelection() {
+		startY, startDisplayX := e.selection.start()
+		endY, endDisplayX := e.selection.end()
+		return LSPRange{
+			Start: LSPPosition{Line: int(startY), Character: lspCharacter(e.lines.Line(int(startY)), e.displayXToDataX(startY, startDisplayX))},
+			End:   LSPPosition{Line: int(endY), Character: lspCharacter(e.lines.Line(int(endY)), e.displayXToDataX(endY, endDisplayX))},
+		}
+	}
+	y := int(e.DataY())
+	x, err := e.DataX()
+	if err != nil {
+		x = len(e.lines.Line(y))
+	}
+	position := LSPPosition{Line: y, Character: lspCharacter(e.lines.Line(y), x)}
+	return LSPRange{Start: position, End: position}
+}
+
+// diagnosticsInRange returns the diagnostics that overlap the lines of the given range
+func diagnosticsInRange(diagnostics []LSPDiagnostic, r LSPRange) []LSPDiagnostic {
+	var found []LSPDiagnostic
+	for _, d := range diagnostics {
+		if d.Range.End.Line >= r.Start.Line && d.Range.Start.Line <= r.End.Line {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// CodeActions lists the quick fixes and refactorings that the language server offers for the
+// selection or the cursor position, and applies the one that is selected, after taking an undo
+// snapshot. Returns true if something was changed.
+func (e *Editor) CodeActions(tty *vt.TTY, c *vt.Canvas, status *StatusBar, undo *Undo) bool {
+	config, ok := lspConfigs[e.mode]
+	if !ok {
+		status.SetErrorMessageAfterRedraw("No language server is configured for " + e.mode.String())
+		return false
+	}
+
+	lspCommand, _, found := lspServerFor(e.mode)
+	if !found {
+		status.SetErrorMessageAfterRedraw(config.Command + " is missing")
+		return false
+	}
+
+	status.SetMessage("Waiting for " + lspCommand)
+	status.ShowNoTimeout(c, e)
+
+	client, uri, err := e.syncLSPDocument()
+	if err != nil {
+		status.ClearAll(c, false)
+		status.SetErrorMessageAfterRedraw(fmt.Sprintf("%s: %v", lspCommand, err))
+		return false
+	}
+
+	r := e.lspSelectionRange()
+	actions, err := client.GetCodeActions(uri, r, diagnosticsInRange(e.Diagnostics(), r), lspCodeActionTimeout)
+	status.ClearAll(c, false)
+	if err != nil {
+		status.SetErrorMessageAfterRedraw(fmt.Sprintf("%s: %v", lspCommand, err))
+		return false
+	}
+	if len(actions) == 0 {
+		status.SetMessageAfterRedraw("No code actions available here")
+		return false
+	}
+
+	items := make([]string, len(actions))
+	for i, action := range actions {
+		items[i] = action.Title
+		if action.IsPreferred {
+			items[i] += " (preferred)"
+		}
+	}
+	index := e.PickFromList(tty, c, status, "Code actions", items, "Press return to apply, or Esc or q to cancel.")
+	if index < 0 {
+		return false
+	}
+	action := actions[index]
+
+	status.SetMessage("Waiting for " + lspCommand)
+	status.ShowNoTimeout(c, e)
+	defer status.ClearAll(c, false)
+
+	if action.Edit == nil && action.Command == nil && action.Data != nil {
+		if action, err = client.ResolveCodeAction(action, lspCodeActionTimeout); err != nil {
+			status.SetErrorMessageAfterRedraw(fmt.Sprintf("%s: %v", lspCommand, err))
+			return false
+		}
+	}
+
+	// The edit is applied first, then the command is executed, as described by the specification.
+	// One undo snapshot is taken for all of the changes, so that they can be undone at once.
+	var (
+		changed       []string
+		snapshotTaken bool
+	)
+	apply := func(edit *LSPWorkspaceEdit) error {
+		paths, err := e.applyLSPWorkspaceEdit(undo, edit, &snapshotTaken)
+		changed = append(changed, paths...)
+		return err
+	}
+	if action.Edit != nil {
+		if err := apply(action.Edit); err != nil {
+			status.SetErrorMessageAfterRedraw(fmt.Sprintf("%s: %v", action.Title, err))
+			return len(changed) > 0
+		}
+	}
+	if action.Command != nil {
+		// Let the server see the document with the edit applied, before executing the command
+		if action.Edit != nil {
+			if client, _, err = e.syncLSPDocument(); err != nil {
+				status.SetErrorMessageAfterRedraw(fmt.Sprintf("%s: %v", lspCommand, err))
+				return len(changed) > 0
+			}
+		}
+		if err := client.ExecuteCommand(action.Command, lspCodeActionTimeout, apply); err != nil {
+			status.SetErrorMessageAfterRedraw(fmt.Sprintf("%s: %v", lspCommand, err))
+			return len(changed) > 0
+		}
+	}
+	if len(changed) == 0 {
+		status.SetMessageAfterRedraw(action.Title + ": nothing was changed")
+		return false
+	}
+	e.ClearSelection()
+	status.SetMessageAfterRedraw(action.Title)
+	return true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/xyproto/mode"
+)
+
+// lspConfigFilename is where extra or overriding language server configurations can be placed
+var lspConfigFilename = filepath.Join(userConfigDir, "o", "lsp.toml")
+
+// lspConfigEntry is one table in lsp.toml, like [python] or [typescript]
+type lspConfigEntry struct {
+	InitializationOptions map[string]any `toml:"initialization_options"`
+	Command               string         `toml:"command"`
+	LanguageID            string         `toml:"language_id"`
+	Args                  []string       `toml:"args"`
+	RootMarkers           []string       `toml:"root_markers"`
+	Extensions            []string       `toml:"extensions"`
+}
+
+// modeFromLSPConfigName finds the editor mode for a table name in lsp.toml, like "python", "c++" or
+// the language ID of one of the given configurations, like "cpp". If the name is not recognized,
+// the mode is detected from the file extensions, if any.
+func modeFromLSPConfigName(name string, extensions []string, configs map[mode.Mode]LSPConfig) (mode.Mode, bool) {
+	for m, config := range configs {
+		if strings.EqualFold(config.LanguageID, name) {
+			return m, true
+		}
+	}
+	for m := mode.Mode(mode.Blank + 1); m <= mode.Zig; m++ {
+		if strings.EqualFold(m.String(), name) {
+			return m, true
+		}
+	}
+	for _, ext := range extensions {
+		if m := mode.Detect("file" + ext); m != mode.Blank && m != mode.Text {
+			return m, true
+		}
+	}
+	return mode.Blank, false
+}
+
+// mergeLSPConfig returns the given configuration with the fields that are set in the entry replaced
+func mergeLSPConfig(config LSPConfig, entry lspConfigEntry) LSPConfig {
+	if entry.Command != "" {
+		config.Command = entry.Command
+	}
+	if entry.Args != nil {
+		config.Args = entry.Args
+	}
+	if entry.LanguageID != "" {
+		config.LanguageID = entry.LanguageID
+	}
+	if entry.RootMarkers != nil {
+		config.RootMarkerFiles = entry.RootMarkers
+	}
+	if entry.Extensions != nil {
+		config.FileExtensions = entry.Extensions
+	}
+	if entry.InitializationOptions != nil {
+		config.InitializationOptions = entry.InitializationOptions
+	}
+	return config
+}
+
+// parseLSPConfigs parses the contents of lsp.toml and merges the entries with the given configurations,
+// which are modified in place. Languages without a built-in configuration must at least have a command.
+func parseLSPConfigs(data []byte, configs map[mode.Mode]LSPConfig) error {
+	var entries map[string]lspConfigEntry
+	if _, err := toml.Decode(string(data), &entries); err != nil {
+		return err
+	}
+	// Go through the entries in a predictable order, so that errors are reported consistently
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := entries[name]
+		m, found := modeFromLSPConfigName(name, entry.Extensions, configs)
+		if !found {
+			return fmt.Errorf("[%s]: unknown language, try adding extensions = [\".ext\"]", name)
+		}
+		config, builtIn := configs[m]
+		if !builtIn {
+			if entry.Command == "" {
+				return fmt.Errorf("[%s]: command is missing", name)
+			}
+			config = LSPConfig{
+				LanguageID:      strings.ToLower(name),
+				RootMarkerFiles: []string{".git"},
+			}
+		}
+		configs[m] = mergeLSPConfig(config, entry)
+	}
+	return nil
+}
+
+// lspConfigError is set if lsp.toml could not be used, so that it can be shown in the status bar
+var lspConfigError error
+
+// LoadLSPConfigs merges the language server configurations in lsp.toml in the config directory,
+// if it exists, with the built-in ones. If lsp.toml has an error, the built-in ones are left as they are.
+func LoadLSPConfigs() error {
+	data, err := os.ReadFile(lspConfigFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	configs := maps.Clone(lspConfigs)
+	if err := parseLSPConfigs(data, configs); err != nil {
+		return fmt.Errorf("%s: %w", lspConfigFilename, err)
+	}
+	lspConfigs = configs
+	return nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xyproto/vt"
+)
+
+// LSP DiagnosticSeverity constants (from the LSP specification)
+const (
+	lspSeverityError       = 1
+	lspSeverityWarning     = 2
+	lspSeverityInformation = 3
+	lspSeverityHint        = 4
+)
+
+// LSPDiagnostic is an error, warning or hint that a language server has published for a document
+type LSPDiagnostic struct {
+	Code     any      `json:"code,omitempty"` // kept so that the diagnostic can be sent back along with code action requests
+	Data     any      `json:"data,omitempty"`
+	Message  string   `json:"message"`
+	Source   string   `json:"source"`
+	Range    LSPRange `json:"range"`
+	Severity int      `json:"severity"`
+}
+
+var (
+	lspDiagnostics        = make(map[string][]LSPDiagnostic) // document URI -> diagnostics, sorted by position
+	lspDocumentURIs       = make(map[string]string)          // absolute filename -> the URI that was sent to the language server
+	lspDiagnosticsMutex   sync.RWMutex
+	lspDiagnosticsChanged atomic.Bool // set when new diagnostics arrive, so that the editor can redraw
+)
+
+// storeLSPDiagnostics stores the diagnostics from a textDocument/publishDiagnostics notification
+func storeLSPDiagnostics(params any) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	var published struct {
+		URI         string          `json:"uri"`
+		Diagnostics []LSPDiagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(data, &published); err != nil || published.URI == "" {
+		return
+	}
+	diagnostics := published.Diagnostics
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Range.Start, diagnostics[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+	lspDiagnosticsMutex.Lock()
+	if len(diagnostics) == 0 {
+		delete(lspDiagnostics, published.URI)
+	} else {
+		lspDiagnostics[published.URI] = diagnostics
+	}
+	lspDiagnosticsMutex.Unlock()
+	lspDiagnosticsChanged.Store(true)
+}
+
+// setLSPDocumentURI remembers which URI the given file was sent to the language server as
+func setLSPDocumentURI(absPath, uri string) {
+	lspDiagnosticsMutex.Lock()
+	lspDocumentURIs[absPath] = uri
+	lspDiagnosticsMutex.Unlock()
+}
+
+// Diagnostics returns the diagnostics that the language server has published for the current file
+func (e *Editor) Diagnostics() []LSPDiagnostic {
+	if _, ok := lspConfigs[e.mode]; !ok {
+		return nil
+	}
+	absPath, err := filepath.Abs(e.filename)
+	if err != nil {
+		return nil
+	}
+	lspDiagnosticsMutex.RLock()
+	defer lspDiagnosticsMutex.RUnlock()
+	uri, ok := lspDocumentURIs[absPath]
+	if !ok {
+		return nil
+	}
+	return lspDiagnostics[uri]
+}
+
+// diagnosticsByLine groups the given diagnostics by each line they span
+func diagnosticsByLine(diagnostics []LSPDiagnostic) map[LineIndex][]LSPDiagnostic {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+	byLine := make(map[LineIndex][]LSPDiagnostic)
+	for _, d := range diagnostics {
+		for y := d.Range.Start.Line; y <= max(d.Range.End.Line, d.Range.Start.Line); y++ {
+			byLine[LineIndex(y)] = append(byLine[LineIndex(y)], d)
+		}
+	}
+	return byLine
+}
+
+// mostSevere returns the most severe of the given diagnostics.
+// A missing severity is treated as an error, as recommended by the specification.
+func mostSevere(diagnostics []LSPDiagnostic) LSPDiagnostic {
+	var found LSPDiagnostic
+	for i, d := range diagnostics {
+		if d.Severity == 0 {
+			d.Severity = lspSeverityError
+		}
+		if i == 0 || d.Severity < found.Severity {
+			found = d
+		}
+	}
+	return found
+}
+
+// diagnosticColor returns the color that is used for marking diagnostics of the given severity
+func (e *Editor) diagnosticColor(severity int) vt.AttributeColor {
+	switch severity {
+	case lspSeverityWarning:
+		return e.SearchHighlight
+	case lspSeverityInformation, lspSeverityHint:
+		return e.CommentColor
+	default:
+		return e.UnmatchedParenColor
+	}
+}
+
+// diagnosticText returns a one-line description of the given diagnostic, for the status bar
+func diagnosticText(d LSPDiagnostic) string {
+	var kind string
+	switch d.Severity {
+	case lspSeverityWarning:
+		kind = "warning"
+	case lspSeverityInformation:
+		kind = "info"
+	case lspSeverityHint:
+		kind = "hint"
+	default:
+		kind = "error"
+	}
+	msg, _, _ := strings.Cut(strings.TrimSpace(d.Message), "\n")
+	if d.Source != "" {
+		return fmt.Sprintf("%s: %s (%s)", kind, msg, d.Source)
+	}
+	return kind + ": " + msg
+}
+
+// expandedRuneIndex converts a rune index in a line to a rune index in the same line with expanded tabs
+func expandedRuneIndex(runes []rune, x, perTab int) int {
+	expanded := x
+	for i := 0; i < x && i < len(runes); i++ {
+		if runes[i] == '\t' {
+			expanded += perTab - 1
+		}
+	}
+	return expanded
+}
+
+// applyDiagnosticHighlights underlines the parts of the given line that the diagnostics refer to.
+// runesAndAttributes is for the line with expanded tabs.
+func (e *Editor) applyDiagnosticHighlights(lineIndex LineIndex, diagnostics []LSPDiagnostic, runesAndAttributes []vt.CharAttribute) {
+	if len(diagnostics) == 0 || len(runesAndAttributes) == 0 {
+		return
+	}
+	runes := e.lines.Line(int(lineIndex))
+	for _, d := range diagnostics {
+		startX, endX := 0, len(runes)
+		if d.Range.Start.Line == int(lineIndex) {
+			startX = runeIndexFromLSP(runes, d.Range.Start.Character)
+		}
+		if d.Range.End.Line == int(lineIndex) {
+			endX = runeIndexFromLSP(runes, d.Range.End.Character)
+		}
+		if endX <= startX { // mark at least one character
+			endX = startX + 1
+		}
+		from := expandedRuneIndex(runes, startX, e.indentation.PerTab)
+		to := expandedRuneIndex(runes, endX, e.indentation.PerTab)
+		if from >= len(runesAndAttributes) { // past the end of the line, mark the last character
+			from = len(runesAndAttributes) - 1
+		}
+		color := e.diagnosticColor(d.Severity).Combine(vt.Underscore)
+		for k := from; k < to && k < len(runesAndAttributes); k++ {
+			runesAndAttributes[k].A = color
+		}
+	}
+}
+
+// drawDiagnosticMarker draws a marker and the most severe diagnostic message after the end of a line
+func (e *Editor) drawDiagnosticMarker(c *vt.Canvas, xp, yp, cw uint, bg vt.AttributeColor, diagnostics []LSPDiagnostic) {
+	if len(diagnostics) == 0 || xp+2 >= cw {
+		return
+	}
+	d := mostSevere(diagnostics)
+	color := e.diagnosticColor(d.Severity)
+	marker := '●'
+	if useASCII {
+		marker = '!'
+	}
+	c.WriteRuneBNoLock(xp+1, yp, color, bg, marker)
+	msg, _, _ := strings.Cut(strings.TrimSpace(d.Message), "\n")
+	msg = asciiFallback(msg)
+	if available := int(cw) - int(xp+3); available > 0 {
+		c.Write(xp+3, yp, e.CommentColor, bg, chopRunes(msg, available))
+	}
+}
+
+// DiagnosticMessageForLine returns a status bar message for the most severe diagnostic on the given line, if any
+func (e *Editor) DiagnosticMessageForLine(y LineIndex) string {
+	diagnostics := diagnosticsByLine(e.Diagnostics())[y]
+	if len(diagnostics) == 0 {
+		return ""
+	}
+	msg := diagnosticText(mostSevere(diagnostics))
+	if len(diagnostics) > 1 {
+		msg += fmt.Sprintf(" (+%d more)", len(diagnostics)-1)
+	}
+	return msg
+}
+
+// GoToNextDiagnostic moves the cursor to the next (or previous) diagnostic in the current file,
+// wrapping around at the end (or start) of the file. Returns false if there are no diagnostics.
+func (e *Editor) GoToNextDiagnostic(c *vt.Canvas, status *StatusBar, forward bool) bool {
+	diagnostics := e.Diagnostics()
+	if len(diagnostics) == 0 {
+		status.SetMessageAfterRedraw("No diagnostics")
+		return false
+	}
+	y := int(e.DataY())
+	x, err := e.DataX()
+	if err != nil {
+		x = 0
+	}
+	// The diagnostics are in UTF-16 code units, so compare with the cursor position in the same unit
+	character := lspCharacter(e.lines.Line(y), x)
+	after := func(d LSPDiagnostic) bool {
+		return d.Range.Start.Line > y || (d.Range.Start.Line == y && d.Range.Start.Character > character)
+	}
+	before := func(d LSPDiagnostic) bool {
+		return d.Range.Start.Line < y || (d.Range.Start.Line == y && d.Range.Start.Character < character)
+	}
+	var (
+		target LSPDiagnostic
+		found  bool
+	)
+	if forward {
+		for _, d := range diagnostics {
+			if after(d) {
+				target, found = d, true
+				break
+			}
+		}
+		if !found {
+			target = diagnostics[0]
+		}
+	} else {
+		for i := len(diagnostics) - 1; i >= 0; i-- {
+			if before(diagnostics[i]) {
+				target, found = diagnostics[i], true
+				break
+			}
+		}
+		if !found {
+			target = diagnostics[len(diagnostics)-1]
+		}
+	}
+
+	targetLine := LineIndex(target.Range.Start.Line)
+	redraw, _ := e.GoTo(targetLine, c, status)
+	e.redraw.Store(redraw)
+	targetRunes := e.lines.Line(int(targetLine))
+	e.pos.sx = expandedRuneIndex(targetRunes, runeIndexFromLSP(targetRunes, target.Range.Start.Character), e.indentation.PerTab)
+	e.HorizontalScrollIfNeeded(c)
+	e.redrawCursor.Store(true)
+
+	status.SetMessageAfterRedraw(diagnosticText(target))
+	return true
+}
+
+// syncLSPDiagnostics sends the lines that have changed since the last sync to the language server,
+// so that it publishes fresh diagnostics while editing. The language server is started in the
+// background once the file has been edited, if it is not already running.
+func (e *Editor) syncLSPDiagnostics() {
+	if !ProgrammingLanguage(e.mode) || e.filename == "" || e.filename == "-" {
+		return
+	}
+	if !e.lines.Changed() {
+		return
+	}
+	if _, _, found := lspServerFor(e.mode); !found {
+		return
+	}
+	start := e.changed.Load()
+	if !start && !hasLSPClient(e.mode) {
+		return // wait with starting the language server until the file is edited
+	}
+	e.syncLSPDocumentIfReady(start)
+}
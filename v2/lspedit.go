@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LSPTextEdit is a replacement of a range in a document
+type LSPTextEdit struct {
+	NewText string   `json:"newText"`
+	Range   LSPRange `json:"range"`
+}
+
+// LSPWorkspaceEdit is a set of changes to one or more documents
+type LSPWorkspaceEdit struct {
+	Changes         map[string][]LSPTextEdit `json:"changes"`
+	DocumentChanges []json.RawMessage        `json:"documentChanges"`
+}
+
+// Edits returns the text edits of the workspace edit, per document URI.
+// Resource operations in documentChanges, like creating or deleting files, are skipped.
+func (we *LSPWorkspaceEdit) Edits() map[string][]LSPTextEdit {
+	edits := make(map[string][]LSPTextEdit)
+	for uri, textEdits := range we.Changes {
+		edits[uri] = append(edits[uri], textEdits...)
+	}
+	for _, raw := range we.DocumentChanges {
+		var change struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			Edits []LSPTextEdit `json:"edits"`
+		}
+		if err := json.Unmarshal(raw, &change); err != nil || change.TextDocument.URI == "" {
+			continue
+		}
+		edits[change.TextDocument.URI] = append(edits[change.TextDocument.URI], change.Edits...)
+	}
+	return edits
+}
+
+// uriToPath converts a file:// URI to a local path
+func uriToPath(uri string) string {
+	path := strings.TrimPrefix(uri, "file://")
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		return unescaped
+	}
+	return path
+}
+
+// applyLSPTextEdits applies the given text edits to the given lines and returns the resulting lines.
+// The edits may come in any order, but must not overlap, as required by the LSP specification.
+// The characters in the ranges are counted in UTF-16 code units.
+func applyLSPTextEdits(lines []string, edits []LSPTextEdit) []string {
+	sorted := make([]LSPTextEdit, len(edits))
+	copy(sorted, edits)
+	// apply the edits from the end of the document and backwards, so that the positions stay valid
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range.Start, sorted[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line > b.Line
+		}
+		return a.Character > b.Character
+	})
+	for _, edit := range sorted {
+		start, end := edit.Range.Start, edit.Range.End
+		if end.Line < start.Line || (end.Line == start.Line && end.Character < start.Character) {
+			end = start
+		}
+		for len(lines) <= max(start.Line, end.Line) {
+			lines = append(lines, "")
+		}
+		startRunes := []rune(lines[start.Line])
+		endRunes := []rune(lines[end.Line])
+		startX := runeIndexFromLSP(startRunes, start.Character)
+		endX := runeIndexFromLSP(endRunes, end.Character)
+		prefix := string(startRunes[:startX])
+		suffix := string(endRunes[endX:])
+		replacement := strings.Split(strings.ReplaceAll(edit.NewText, "\r\n", "\n"), "\n")
+		replacement[0] = prefix + replacement[0]
+		replacement[len(replacement)-1] += suffix
+		newLines := make([]string, 0, len(lines)-(end.Line-start.Line)+len(replacement))
+		newLines = append(newLines, lines[:start.Line]...)
+		newLines = append(newLines, replacement...)
+		newLines = append(newLines, lines[end.Line+1:]...)
+		lines = newLines
+	}
+	return lines
+}
+
+// applyLSPTextEditsToBuffer applies the given text edits to the contents of the editor
+func (e *Editor) applyLSPTextEditsToBuffer(edits []LSPTextEdit) {
+	lines := applyLSPTextEdits(strings.Split(e.String(), "\n"), edits)
+	// e.String() ends with a newline, so there is an extra empty line at the end
+	if n := len(lines); n > 1 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	runeLines := make([][]rune, len(lines))
+	for i, line := range lines {
+		runeLines[i] = []rune(line)
+	}
+	before := e.lines
+	e.lines = NewLineBufferFromLines(runeLines)
+	e.moveBreakpoints(before)
+	e.MarkChanged()
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+}
+
+// applyLSPTextEditsToFile applies the given text edits to a file on disk
+func applyLSPTextEditsToFile(path string, edits []LSPTextEdit) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := applyLSPTextEdits(strings.Split(string(data), "\n"), edits)
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), fi.Mode().Perm())
+}
+
+// isCurrentLSPDocument checks if the given URI refers to the file that is being edited,
+// either directly or through a temporary workspace that the language server was given
+func (e *Editor) isCurrentLSPDocument(uri string) bool {
+	absPath, err := filepath.Abs(e.filename)
+	if err != nil {
+		return false
+	}
+	if uriToPath(uri) == absPath {
+		return true
+	}
+	lspDiagnosticsMutex.RLock()
+	defer lspDiagnosticsMutex.RUnlock()
+	return lspDocumentURIs[absPath] == uri
+}
+
+// ApplyLSPWorkspaceEdit applies a workspace edit from the language server. Changes to the current
+// file are made to the editor contents, while other files are changed on disk. One undo snapshot
+// is taken first, which also holds the original contents of the other files, so that the whole
+// edit can be undone at once. Returns the paths of the files that were changed, sorted.
+func (e *Editor) ApplyLSPWorkspaceEdit(undo *Undo, we *LSPWorkspaceEdit) ([]string, error) {
+	var snapshotTaken bool
+	return e.applyLSPWorkspaceEdit(undo, we, &snapshotTaken)
+}
+
+// applyLSPWorkspaceEdit is like ApplyLSPWorkspaceEdit, but only takes an undo snapshot if snapshotTaken
+// is false. Otherwise, the original contents of the other files are added to the latest snapshot, so
+// that several edits can be undone at once.
+func (e *Editor) applyLSPWorkspaceEdit(undo *Undo, we *LSPWorkspaceEdit, snapshotTaken *bool) ([]string, error) {
+	var (
+		changed     []string
+		firstErr    error
+		bufferEdits []LSPTextEdit
+		fileEdits   = make(map[string][]LSPTextEdit)
+		originals   = make(map[string][]byte)
+	)
+	for uri, edits := range we.Edits() {
+		if len(edits) == 0 {
+			continue
+		}
+		if e.isCurrentLSPDocument(uri) {
+			bufferEdits = append(bufferEdits, edits...)
+			continue
+		}
+		path := uriToPath(uri)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		originals[path] = data
+		fileEdits[path] = edits
+	}
+	if len(bufferEdits) == 0 && len(fileEdits) == 0 {
+		return nil, firstErr
+	}
+	if *snapshotTaken {
+		undo.addMissingFilesToLatest(originals)
+	} else {
+		undo.SnapshotWithFiles(e, originals)
+		*snapshotTaken = true
+	}
+	if len(bufferEdits) > 0 {
+		e.applyLSPTextEditsToBuffer(bufferEdits)
+		changed = append(changed, e.filename)
+	}
+	for path, edits := range fileEdits {
+		if err := applyLSPTextEditsToFile(path, edits); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		changed = append(changed, path)
+	}
+	sort.Strings(changed)
+	return changed, firstErr
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// lspFormattingTimeout is for formatting a document or a selection with the language server
+const lspFormattingTimeout = 10 * time.Second
+
+// lspFormattingOptions returns the FormattingOptions for the indentation of the current file
+func (e *Editor) lspFormattingOptions() map[string]any {
+	return map[string]any{
+		"tabSize":                e.indentation.PerTab,
+		"insertSpaces":           e.indentation.Spaces,
+		"trimTrailingWhitespace": true,
+		"insertFinalNewline":     true,
+	}
+}
+
+// requestFormatting sends a textDocument/formatting or textDocument/rangeFormatting request
+// and returns the text edits that format the document
+func (lsp *LSPClient) requestFormatting(method string, params map[string]any, timeout time.Duration) ([]LSPTextEdit, error) {
+	if !lsp.initialized {
+		return nil, errors.New("LSP client not initialized")
+	}
+	id, err := lsp.sendRequest(method, params)
+	if err != nil {
+		return nil, err
+	}
+	response, err := lsp.readResponse(id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	resultData, ok := response["result"]
+	if !ok {
+		if errorData, hasError := response["error"]; hasError {
+			if errorMap, ok := errorData.(map[string]any); ok {
+				if msg, ok := errorMap["message"].(string); ok && msg != "" {
+					return nil, errors.New(msg)
+				}
+			}
+			return nil, fmt.Errorf("LSP error: %v", errorData)
+		}
+		return nil, errors.New("no result in formatting response")
+	}
+	if resultData == nil { // already formatted
+		return nil, nil
+	}
+	resultBytes, err := json.Marshal(resultData)
+	if err != nil {
+		return nil, err
+	}
+	var edits []LSPTextEdit
+	if err := json.Unmarshal(resultBytes, &edits); err != nil {
+		return nil, errors.New("could not parse formatting response")
+	}
+	return edits, nil
+}
+
+// GetFormatting requests the text edits that format the whole document
+func (lsp *LSPClient) GetFormatting(uri string, options map[string]any, timeout time.Duration) ([]LSPTextEdit, error) {
+	params := map[string]any{
+		"textDocument": map[string]any{
+			"uri": uri,
+		},
+		"options": options,
+	}
+	return lsp.requestFormatting("textDocument/formatting", params, timeout)
+}
+
+// GetRangeFormatting requests the text edits that format the given range of the document
+func (lsp *LSPClient) GetRangeFormatting(uri string, r LSPRange, options map[string]any, timeout time.Duration) ([]LSPTextEdit, error) {
+	params := map[string]any{
+		"textDocument": map[string]any{
+			"uri": uri,
+		},
+		"range":   r,
+		"options": options,
+	}
+	return lsp.requestFormatting("textDocument/rangeFormatting", params, timeout)
+}
+
+// lspFormattingAvailable returns true if a language server is configured for this mode and found in the PATH
+func (e *Editor) lspFormattingAvailable() bool {
+	if _, ok := lspConfigs[e.mode]; !ok {
+		return false
+	}
+	_, _, found := lspServerFor(e.mode)
+	return found
+}
+
+// FormatWithLSP formats the current document, or the selection if there is one, with the
+// language server. The undo snapshot should be taken by the caller.
+func (e *Editor) FormatWithLSP(c *vt.Canvas, status *StatusBar) error {
+	lspCommand, _, found := lspServerFor(e.mode)
+	if !found {
+		return fmt.Errorf("%s is missing", lspCommand)
+	}
+
+	status.SetMessage("Waiting for " + lspCommand)
+	status.ShowNoTimeout(c, e)
+	defer status.ClearAll(c, false)
+
+	client, uri, err := e.syncLSPDocument()
+	if err != nil {
+		return fmt.Errorf("%s: %w", lspCommand, err)
+	}
+
+	var edits []LSPTextEdit
+	if e.HasSelection() {
+		edits, err = client.GetRangeFormatting(uri, e.lspSelectionRange(), e.lspFormattingOptions(), lspFormattingTimeout)
+	} else {
+		edits, err = client.GetFormatting(uri, e.lspFormattingOptions(), lspFormattingTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to format code: %s: %w", lspCommand, err)
+	}
+	e.ClearSelection()
+	if len(edits) > 0 {
+		e.applyLSPTextEditsToBuffer(edits)
+		if lastLineIndex := LineIndex(e.Len() - 1); e.DataY() > lastLineIndex {
+			e.GoTo(lastLineIndex, c, status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xyproto/vt"
+	"github.com/xyproto/wordwrap"
+)
+
+var (
+	hoverHeadingRegexp = regexp.MustCompile(`^#{1,6}\s+`)
+	hoverLinkRegexp    = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	hoverEscapeRegexp  = regexp.MustCompile(`\\([[:punct:]])`)
+)
+
+// hoverMarkdown returns the Markdown text from the contents of a hover response,
+// which can be MarkupContent, a MarkedString or a list of MarkedStrings.
+func hoverMarkdown(contents any) string {
+	switch v := contents.(type) {
+	case string:
+		return v
+	case map[string]any:
+		value, _ := v["value"].(string)
+		if language, ok := v["language"].(string); ok {
+			return "```" + language + "\n" + value + "\n```"
+		}
+		return value
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if s := strings.TrimSpace(hoverMarkdown(item)); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
+
+// chopRunes shortens s to at most width runes
+func chopRunes(s string, width int) string {
+	if runes := []rune(s); width > 0 && len(runes) > width {
+		return string(runes[:width])
+	}
+	return s
+}
+
+// hoverLines converts Markdown from a hover response to plain lines of at most width runes.
+// Code blocks are indented but not wrapped, while headings, links, escapes and inline markup
+// are simplified and the remaining text is word wrapped.
+func hoverLines(markdown string, width int) []string {
+	var (
+		lines  []string
+		inCode bool
+	)
+	addBlank := func() {
+		if len(lines) > 0 && lines[len(lines)-1] != "" {
+			lines = append(lines, "")
+		}
+	}
+	for line := range strings.SplitSeq(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n") {
+		line = strings.TrimRightFunc(strings.ReplaceAll(line, "\t", "    "), func(r rune) bool {
+			return r == ' '
+		})
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if !inCode {
+				addBlank()
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			lines = append(lines, chopRunes("  "+line, width))
+			continue
+		}
+		if trimmed == "" || trimmed == "---" || trimmed == "***" || trimmed == "___" {
+			addBlank()
+			continue
+		}
+		line = hoverHeadingRegexp.ReplaceAllString(line, "")
+		line = hoverLinkRegexp.ReplaceAllString(line, "$1")
+		line = strings.ReplaceAll(line, "**", "")
+		line = strings.ReplaceAll(line, "`", "")
+		line = hoverEscapeRegexp.ReplaceAllString(line, "$1")
+		wrapped, err := wordwrap.WordWrap(line, width)
+		if err != nil {
+			wrapped = []string{chopRunes(line, width)}
+		}
+		lines = append(lines, wrapped...)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// ShowLSPHover asks the language server for the documentation of the symbol under
+// the cursor and displays it in a scrollable box. Returns true if something was shown.
+func (e *Editor) ShowLSPHover(tty *vt.TTY, c *vt.Canvas, status *StatusBar) bool {
+	config, ok := lspConfigs[e.mode]
+	if !ok {
+		status.SetErrorMessageAfterRedraw("No language server is configured for " + e.mode.String())
+		return false
+	}
+
+	lspCommand, _, found := lspServerFor(e.mode)
+	if !found {
+		status.SetErrorMessageAfterRedraw(config.Command + " is missing")
+		return false
+	}
+
+	status.SetMessage("Waiting for " + lspCommand)
+	status.ShowNoTimeout(c, e)
+
+	client, uri, err := e.syncLSPDocument()
+	if err != nil {
+		status.ClearAll(c, false)
+		status.SetErrorMessageAfterRedraw(fmt.Sprintf("%s: %v", lspCommand, err))
+		return false
+	}
+
+	line := int(e.DataY())
+	x, err := e.DataX()
+	if err != nil {
+		x = 0
+	}
+
+	markdown, err := client.GetHover(uri, line, lspCharacter(e.lines.Line(line), x), lspHoverTimeout)
+	status.ClearAll(c, false)
+	if err != nil || markdown == "" {
+		status.SetMessageAfterRedraw("No documentation found")
+		return false
+	}
+
+	title := "Documentation"
+	if word := e.CurrentWord(); word != "" {
+		title += ": " + word
+	}
+	e.DrawHover(tty, c, status, title, markdown)
+	return true
+}
+
+// DrawHover shows the given Markdown in a scrollable box, until the user closes it
+func (e *Editor) DrawHover(tty *vt.TTY, c *vt.Canvas, status *StatusBar, title, markdown string) {
+	pageWidth := int(float64(c.Width()) * 0.8)
+	e.ShowPagedText(tty, c, status, title, hoverLines(asciiFallback(markdown), pageWidth-2), "")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xyproto/vt"
+)
+
+// CurrentIdentifier returns the identifier under the cursor, or an empty string.
+// Unlike CurrentWord, "." and "-" are not included, except for "-" in Nix.
+func (e *Editor) CurrentIdentifier() string {
+	runes := e.lines.Line(int(e.DataY()))
+	x, err := e.DataX()
+	if err != nil || x >= len(runes) || !isCompletionIdentRune(runes[x], e.mode) {
+		return ""
+	}
+	start, end := x, x
+	for start > 0 && isCompletionIdentRune(runes[start-1], e.mode) {
+		start--
+	}
+	for end < len(runes) && isCompletionIdentRune(runes[end], e.mode) {
+		end++
+	}
+	return string(runes[start:end])
+}
+
+// displayPath returns the given path relative to dir, if that makes it shorter
+func displayPath(path, dir string) string {
+	if rel, err := filepath.Rel(dir, path); err == nil && len(rel) < len(path) {
+		return rel
+	}
+	return path
+}
+
+// RenameSymbol asks for a new name for the symbol under the cursor, asks the language server
+// for the changes that are needed, lists the files that will be changed and then applies the
+// changes to the editor contents and to the other files on disk. Returns true if renamed.
+func (e *Editor) RenameSymbol(tty *vt.TTY, c *vt.Canvas, status *StatusBar, undo *Undo) bool {
+	config, ok := lspConfigs[e.mode]
+	if !ok {
+		status.SetErrorMessageAfterRedraw("No language server is configured for " + e.mode.String())
+		return false
+	}
+
+	lspCommand, _, found := lspServerFor(e.mode)
+	if !found {
+		status.SetErrorMessageAfterRedraw(config.Command + " is missing")
+		return false
+	}
+
+	oldName := e.CurrentIdentifier()
+	if oldName == "" {
+		status.SetErrorMessageAfterRedraw("No symbol under the cursor")
+		return false
+	}
+
+	newName, ok := e.UserInput(c, tty, status, "Rename "+oldName+" to", oldName, nil, false, oldName)
+	newName = strings.TrimSpace(newName)
+	if !ok || newName == "" || newName == oldName {
+		status.SetMessageAfterRedraw("Rename canceled")
+		return false
+	}
+
+	status.SetMessage("Waiting for " + lspCommand)
+	status.ShowNoTimeout(c, e)
+
+	client, uri, err := e.syncLSPDocument()
+	if err != nil {
+		status.ClearAll(c, false)
+		status.SetErrorMessageAfterRedraw(fmt.Sprintf("%s: %v", lspCommand, err))
+		return false
+	}
+
+	line := int(e.DataY())
+	x, err := e.DataX()
+	if err != nil {
+		x = 0
+	}
+
+	workspaceEdit, err := client.Rename(uri, line, lspCharacter(e.lines.Line(line), x), newName, lspRenameTimeout)
+	status.ClearAll(c, false)
+	if err != nil {
+		status.SetErrorMessageAfterRedraw(fmt.Sprintf("%s: %v", lspCommand, err))
+		return false
+	}
+	edits := workspaceEdit.Edits()
+	if len(edits) == 0 {
+		status.SetMessageAfterRedraw("Nothing to rename")
+		return false
+	}
+
+	// List the files that are about to be changed, and ask for confirmation
+	dir := filepath.Dir(e.filename)
+	if absPath, err := filepath.Abs(e.filename); err == nil {
+		dir = filepath.Dir(absPath)
+	}
+	var (
+		fileLines []string
+		onDisk    bool
+	)
+	for editURI, fileEdits := range edits {
+		changes := "1 change"
+		if len(fileEdits) != 1 {
+			changes = fmt.Sprintf("%d changes", len(fileEdits))
+		}
+		if e.isCurrentLSPDocument(editURI) {
+			fileLines = append(fileLines, fmt.Sprintf("  %s (%s, in this editor)", filepath.Base(e.filename), changes))
+		} else {
+			fileLines = append(fileLines, fmt.Sprintf("  %s (%s, on disk)", displayPath(uriToPath(editURI), dir), changes))
+			onDisk = true
+		}
+	}
+	sort.Strings(fileLines)
+	lines := []string{fmt.Sprintf("Rename %s to %s in these files:", oldName, newName), ""}
+	lines = append(lines, fileLines...)
+	if onDisk {
+		lines = append(lines, "", "Files on disk are saved right away. Undo restores them.")
+	}
+	if key := e.ShowPagedText(tty, c, status, "Rename symbol", lines, "Press return or y to rename, or Esc, q or n to cancel."); key != "c:13" && key != "y" {
+		status.SetMessageAfterRedraw("Rename canceled")
+		return false
+	}
+
+	changed, err := e.ApplyLSPWorkspaceEdit(undo, workspaceEdit)
+	if err != nil {
+		status.SetErrorMessageAfterRedraw(fmt.Sprintf("Renamed %s to %s in %d files, but: %v", oldName, newName, len(changed), err))
+		return len(changed) > 0
+	}
+	if len(changed) == 1 {
+		status.SetMessageAfterRedraw(fmt.Sprintf("Renamed %s to %s in %s", oldName, newName, filepath.Base(changed[0])))
+	} else {
+		status.SetMessageAfterRedraw(fmt.Sprintf("Renamed %s to %s in %d files", oldName, newName, len(changed)))
+	}
+	return true
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// lspSignatureHelpTimeout is how long to wait for signature help in the background, while typing
+const lspSignatureHelpTimeout = 300 * time.Millisecond
+
+// LSPParameterInformation is a parameter of a function signature. The label is either
+// a substring of the signature label, or a [start, end] pair of UTF-16 offsets into it.
+type LSPParameterInformation struct {
+	Label json.RawMessage `json:"label"`
+}
+
+// LSPSignatureInformation is one signature of a function
+type LSPSignatureInformation struct {
+	ActiveParameter *int                      `json:"activeParameter"`
+	Label           string                    `json:"label"`
+	Parameters      []LSPParameterInformation `json:"parameters"`
+}
+
+// LSPSignatureHelp is the response to a textDocument/signatureHelp request
+type LSPSignatureHelp struct {
+	Signatures      []LSPSignatureInformation `json:"signatures"`
+	ActiveSignature int                       `json:"activeSignature"`
+	ActiveParameter int                       `json:"activeParameter"`
+}
+
+// signatureHelpState is the signature that is currently shown above the cursor line
+type signatureHelpState struct {
+	label      string
+	paramStart int // rune index of the active parameter in label, or -1
+	paramEnd   int
+	line       LineIndex // the line the signature is shown for
+}
+
+// GetSignatureHelp requests the signature of the function call at the given position
+func (lsp *LSPClient) GetSignatureHelp(uri string, line, character int, timeout time.Duration) (*LSPSignatureHelp, error) {
+	if !lsp.initialized {
+		return nil, errors.New("LSP client not initialized")
+	}
+	params := map[string]any{
+		"textDocument": map[string]any{
+			"uri": uri,
+		},
+		"position": map[string]any{
+			"line":      line,
+			"character": character,
+		},
+	}
+	id, err := lsp.sendRequest("textDocument/signatureHelp", params)
+	if err != nil {
+		return nil, err
+	}
+	response, err := lsp.readResponse(id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	resultData, ok := response["result"]
+	if !ok {
+		if errorData, hasError := response["error"]; hasError {
+			return nil, fmt.Errorf("LSP error: %v", errorData)
+		}
+		return nil, errors.New("no result in signature help response")
+	}
+	if resultData == nil {
+		return nil, errors.New("no signature found")
+	}
+	resultBytes, err := json.Marshal(resultData)
+	if err != nil {
+		return nil, err
+	}
+	var help LSPSignatureHelp
+	if err := json.Unmarshal(resultBytes, &help); err != nil {
+		return nil, errors.New("could not parse signature help response")
+	}
+	if len(help.Signatures) == 0 {
+		return nil, errors.New("no signature found")
+	}
+	return &help, nil
+}
+
+// utf16OffsetToRuneIndex converts an offset in UTF-16 code units to a rune index in s
+func utf16OffsetToRuneIndex(s string, offset int) int {
+	return runeIndexFromLSP([]rune(s), offset)
+}
+
+// activeSignature returns the label of the active signature, and the rune indices of the
+// active parameter in that label. The indices are -1 if there is no active parameter.
+func (help *LSPSignatureHelp) activeSignature() (string, int, int) {
+	index := help.ActiveSignature
+	if index < 0 || index >= len(help.Signatures) {
+		index = 0
+	}
+	signature := help.Signatures[index]
+	activeParameter := help.ActiveParameter
+	if signature.ActiveParameter != nil {
+		activeParameter = *signature.ActiveParameter
+	}
+	if activeParameter < 0 || activeParameter >= len(signature.Parameters) {
+		return signature.Label, -1, -1
+	}
+	label := signature.Parameters[activeParameter].Label
+	var offsets []int
+	if err := json.Unmarshal(label, &offsets); err == nil && len(offsets) == 2 {
+		return signature.Label, utf16OffsetToRuneIndex(signature.Label, offsets[0]), utf16OffsetToRuneIndex(signature.Label, offsets[1])
+	}
+	var name string
+	if err := json.Unmarshal(label, &name); err != nil || name == "" {
+		return signature.Label, -1, -1
+	}
+	// Look for the parameter after the opening parenthesis, so that it is not found in the function name
+	searchFrom := max(strings.Index(signature.Label, "("), 0)
+	pos := strings.Index(signature.Label[searchFrom:], name)
+	if pos < 0 {
+		return signature.Label, -1, -1
+	}
+	start := len([]rune(signature.Label[:searchFrom+pos]))
+	return signature.Label, start, start + len([]rune(name))
+}
+
+// UpdateSignatureHelp asks the language server for the signature of the function call the cursor
+// is in, if the server is ready. The request is sent in the background, and the signature is shown
+// above the cursor line when the answer arrives, if the cursor is still on that line. Nothing is
+// shown if the cursor is not in a function call.
+func (e *Editor) UpdateSignatureHelp(c *vt.Canvas, status *StatusBar) {
+	e.signatureHelp = nil
+	requestNumber := e.signatureHelpRequests.Add(1)
+	if _, ok := lspConfigs[e.mode]; !ok || e.InBookMode() {
+		return
+	}
+	client, uri := e.syncLSPDocumentIfReady(false)
+	if client == nil {
+		return
+	}
+	line := e.DataY()
+	x, err := e.DataX()
+	if err != nil {
+		x = len(e.lines.Line(int(line)))
+	}
+	character := lspCharacter(e.lines.Line(int(line)), x)
+	go func() {
+		help, err := client.GetSignatureHelp(uri, int(line), character, lspSignatureHelpTimeout)
+		if err != nil {
+			return
+		}
+		label, paramStart, paramEnd := help.activeSignature()
+		e.linesMut.Lock()
+		defer e.linesMut.Unlock()
+		// Only show the answer to the latest request, and only if the cursor is still on the same line
+		if requestNumber != e.signatureHelpRequests.Load() || e.DataY() != line {
+			return
+		}
+		e.signatureHelp = &signatureHelpState{
+			label:      strings.TrimSpace(label),
+			paramStart: paramStart,
+			paramEnd:   paramEnd,
+			line:       line,
+		}
+		e.redraw.Store(true)
+		e.RedrawAtEndOfKeyLoop(c, status, false, true)
+	}()
+}
+
+// DismissSignatureHelp hides the signature help box, if it is shown,
+// and makes sure that it is not shown by a request that has not been answered yet
+func (e *Editor) DismissSignatureHelp() {
+	e.signatureHelpRequests.Add(1)
+	if e.signatureHelp != nil {
+		e.signatureHelp = nil
+		e.redraw.Store(true)
+	}
+}
+
+// DrawSignatureHelp draws the current signature in a small box above the cursor line,
+// with the active parameter highlighted. The box is placed below the line if there is
+// no room above it. The signature is forgotten when the cursor leaves the line.
+func (e *Editor) DrawSignatureHelp(c *vt.Canvas) {
+	help := e.signatureHelp
+	if help == nil {
+		return
+	}
+	if e.DataY() != help.line {
+		e.signatureHelp = nil
+		return
+	}
+
+	canvasWidth := int(c.Width())
+	label := []rune(asciiFallback(help.label))
+	maxWidth := canvasWidth - 4
+	if maxWidth < 10 {
+		return
+	}
+	// Wrap the label by character, since signatures may be long and contain few spaces
+	var rows [][]rune
+	for i := 0; i < len(label); i += maxWidth {
+		rows = append(rows, label[i:min(i+maxWidth, len(label))])
+	}
+	if len(rows) == 0 {
+		return
+	}
+	const maxRows = 3
+	if len(rows) > maxRows {
+		rows = rows[:maxRows]
+	}
+
+	width := 4
+	for _, row := range rows {
+		width = max(width, len(row)+4)
+	}
+	height := len(rows) + 2
+
+	cursorY := int(e.pos.ScreenY()) + int(e.stickyTopBarHeight())
+	y := cursorY - height
+	if y < int(e.stickyTopBarHeight()) {
+		y = cursorY + 1
+	}
+	x := max(min(e.pos.ScreenX()-2, canvasWidth-width), 0)
+
+	bt := e.NewBoxTheme()
+	bt.Foreground = &e.BoxTextColor
+	bt.Background = &e.BoxBackground
+	signatureBox := &Box{X: x, Y: y, W: width, H: height}
+	e.DrawBox(bt, c, signatureBox)
+
+	highlight := e.BoxHighlight.Combine(vt.Bold)
+	for rowIndex, row := range rows {
+		for i, r := range row {
+			color := *bt.Foreground
+			if index := rowIndex*maxWidth + i; index >= help.paramStart && index < help.paramEnd {
+				color = highlight
+			}
+			c.WriteRune(uint(x+2+i), uint(y+1+rowIndex), color, *bt.Background, r)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import "strings"
+
+// LSP TextDocumentSyncKind constants (from the LSP specification)
+const (
+	lspSyncNone        = 0
+	lspSyncFull        = 1
+	lspSyncIncremental = 2
+)
+
+// LSPContentChange is one entry in the contentChanges of a didChange notification.
+// If Range is nil, Text is the full contents of the document.
+type LSPContentChange struct {
+	Range *LSPRange `json:"range,omitempty"`
+	Text  string    `json:"text"`
+}
+
+// textDocumentSyncKind returns how the server wants to be told about document changes,
+// given the capabilities from the initialize response. Defaults to full sync, which also
+// works for servers that do not ask for changes at all.
+func textDocumentSyncKind(capabilities map[string]any) int {
+	switch v := capabilities["textDocumentSync"].(type) {
+	case float64:
+		return int(v)
+	case map[string]any:
+		if change, ok := v["change"].(float64); ok {
+			return int(change)
+		}
+	}
+	return lspSyncFull
+}
+
+// lspOpenDocument is what has been sent to the language server for a document that is open
+type lspOpenDocument struct {
+	lines     *LineBuffer // the lines that were last sent, if changes to them are tracked
+	lineCount int         // the number of lines that were last sent
+	version   int
+}
+
+// linesText returns the lines from index from up to, but not including, index to, each followed by a newline
+func linesText(b *LineBuffer, from, to int) string {
+	var sb strings.Builder
+	for y := from; y < to; y++ {
+		for _, r := range b.Line(y) {
+			sb.WriteRune(r)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// openDocument returns what has been sent for the document with the given URI, or nil if it is not open
+func (lsp *LSPClient) openDocument(uri string) *lspOpenDocument {
+	lsp.mutex.Lock()
+	defer lsp.mutex.Unlock()
+	return lsp.documents[uri]
+}
+
+// setOpenDocument stores what has been sent for the document with the given URI,
+// or forgets the document if doc is nil, so that it is opened again the next time
+func (lsp *LSPClient) setOpenDocument(uri string, doc *lspOpenDocument) {
+	lsp.mutex.Lock()
+	defer lsp.mutex.Unlock()
+	if doc == nil {
+		delete(lsp.documents, uri)
+		return
+	}
+	if lsp.documents == nil {
+		lsp.documents = make(map[string]*lspOpenDocument)
+	}
+	lsp.documents[uri] = doc
+}
+
+// IsOpen returns true if the document with the given URI has been opened with didOpen
+func (lsp *LSPClient) IsOpen(uri string) bool {
+	return lsp.openDocument(uri) != nil
+}
+
+// SyncDocument sends the given lines of a document to the language server. The first time, didOpen
+// is sent. After that, didChange is sent with only the lines that have changed since the last time,
+// if the server supports incremental sync and the buffer keeps track of the changes, or with the
+// full contents if not. Nothing is sent if no lines have changed. Returns true if the document was opened.
+func (lsp *LSPClient) SyncDocument(uri, languageID string, lines *LineBuffer) (bool, error) {
+	doc := lsp.openDocument(uri)
+	if doc == nil {
+		if err := lsp.DidOpen(uri, languageID, linesText(lines, 0, lines.Len())); err != nil {
+			return false, err
+		}
+		lines.ResetChanges()
+		lsp.setOpenDocument(uri, &lspOpenDocument{lines: lines, lineCount: lines.Len(), version: 1})
+		return true, nil
+	}
+	var change LSPContentChange
+	prefix, suffix, tracked := lines.Changes()
+	switch {
+	case !tracked || doc.lines != lines:
+		change.Text = linesText(lines, 0, lines.Len())
+	case prefix+suffix == doc.lineCount && prefix+suffix == lines.Len():
+		return false, nil // nothing has changed
+	case lsp.syncKind == lspSyncIncremental:
+		change.Range = &LSPRange{Start: LSPPosition{Line: prefix}, End: LSPPosition{Line: doc.lineCount - suffix}}
+		change.Text = linesText(lines, prefix, lines.Len()-suffix)
+	default:
+		change.Text = linesText(lines, 0, lines.Len())
+	}
+	if err := lsp.DidChange(uri, []LSPContentChange{change}, doc.version+1); err != nil {
+		lsp.setOpenDocument(uri, nil)
+		return false, err
+	}
+	lines.ResetChanges()
+	lsp.setOpenDocument(uri, &lspOpenDocument{lines: lines, lineCount: lines.Len(), version: doc.version + 1})
+	return false, nil
+}
+
+// SyncDocumentText is like SyncDocument, but sends the given text, which does not have to be the same
+// as the lines in the editor. The next call to SyncDocument will then send the full contents.
+func (lsp *LSPClient) SyncDocumentText(uri, languageID, text string) (bool, error) {
+	doc := lsp.openDocument(uri)
+	if doc == nil {
+		if err := lsp.DidOpen(uri, languageID, text); err != nil {
+			return false, err
+		}
+		lsp.setOpenDocument(uri, &lspOpenDocument{version: 1})
+		return true, nil
+	}
+	if err := lsp.DidChange(uri, []LSPContentChange{{Text: text}}, doc.version+1); err != nil {
+		lsp.setOpenDocument(uri, nil)
+		return false, err
+	}
+	lsp.setOpenDocument(uri, &lspOpenDocument{version: doc.version + 1})
+	return false, nil
+}
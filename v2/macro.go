@@ -1,10 +1,27 @@
 package main
 
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt"
+)
+
 // Macro represents a series of keypresses that can be played back later
 type Macro struct {
+	Name       string // set when the macro is saved
 	KeyPresses []string
 	index      int // current position, when playing back
 	Recording  bool
+	eachLine   bool      // play back the macro once per line, starting at the start of each line
+	lineY      LineIndex // the line of the current pass, when playing back once per line
+	lineCount  int       // the number of lines in the document when the current pass started
 }
 
 // NewMacro creates a new Macro struct
@@ -35,3 +52,307 @@ func (m *Macro) Home() {
 func (m *Macro) Len() int {
 	return len(m.KeyPresses)
 }
+
+// macroKeyNames are the names that are used for keypresses when a macro is written as text
+var macroKeyNames = map[string]string{
+	" ":        "space",
+	"c:9":      "tab",
+	"c:13":     "return",
+	"c:27":     "esc",
+	"c:127":    "backspace",
+	upArrow:    "up",
+	downArrow:  "down",
+	leftArrow:  "left",
+	rightArrow: "right",
+	pgUpKey:    "pgup",
+	pgDnKey:    "pgdn",
+	homeKey:    "home",
+	endKey:     "end",
+}
+
+// macroKeyName returns the name of a keypress, like "return" or "ctrl-a"
+func macroKeyName(key string) string {
+	if name, ok := macroKeyNames[key]; ok {
+		return name
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(key, "c:")); err == nil && strings.HasPrefix(key, "c:") && n >= 1 && n <= 26 {
+		return "ctrl-" + string(rune('a'+n-1))
+	}
+	return key
+}
+
+// String returns the keypresses of the macro as text, like: home "// " down
+// Typed letters are grouped together in quotes, while other keys are written by name.
+func (m *Macro) String() string {
+	var (
+		words []string
+		typed string
+	)
+	for _, key := range m.KeyPresses {
+		if _, named := macroKeyNames[key]; !named && isTypedKey(key) {
+			typed += key
+			continue
+		}
+		if key == " " && len(typed) > 0 {
+			// Let spaces be part of the typed text
+			typed += key
+			continue
+		}
+		if len(typed) > 0 {
+			words = append(words, strconv.Quote(typed))
+			typed = ""
+		}
+		words = append(words, macroKeyName(key))
+	}
+	if len(typed) > 0 {
+		words = append(words, strconv.Quote(typed))
+	}
+	return strings.Join(words, " ")
+}
+
+// isTypedKey returns true if the keypress is a single printable character
+func isTypedKey(key string) bool {
+	r, size := utf8.DecodeRuneInString(key)
+	return size == len(key) && size > 0 && unicode.IsPrint(r)
+}
+
+// parseMacroKeys parses keypresses that are written as text, in the format that Macro.String returns
+func parseMacroKeys(s string) ([]string, error) {
+	keys := make([]string, 0, 16)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("unterminated quote: %s", s)
+			}
+			typed, _ := strconv.Unquote(quoted)
+			for _, r := range typed {
+				keys = append(keys, string(r))
+			}
+			s = s[len(quoted):]
+			continue
+		}
+		word := s
+		if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+			word = s[:i]
+		}
+		s = s[len(word):]
+		key, err := macroKeyFromName(word)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// macroKeyFromName returns the keypress for a name that macroKeyName may return
+func macroKeyFromName(name string) (string, error) {
+	for key, keyName := range macroKeyNames {
+		if name == keyName {
+			return key, nil
+		}
+	}
+	if letter, ok := strings.CutPrefix(name, "ctrl-"); ok && len(letter) == 1 && letter[0] >= 'a' && letter[0] <= 'z' {
+		return "c:" + strconv.Itoa(int(letter[0]-'a'+1)), nil
+	}
+	if n, ok := strings.CutPrefix(name, "c:"); ok {
+		if _, err := strconv.Atoi(n); err == nil {
+			return name, nil
+		}
+	}
+	// Keys like "F3", "backtab", "ctrl↑" or "shift→" are written as they are
+	if isFunctionKey(name) || name == "backtab" {
+		return name, nil
+	}
+	for _, r := range name {
+		if r >= utf8.RuneSelf {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown key: %s", name)
+}
+
+// LoadMacros reads the saved macros from the macro file in the configuration directory.
+// Each line is a name, a colon and the keypresses. Blank lines and lines starting with # are skipped.
+func LoadMacros() ([]*Macro, error) {
+	data, err := os.ReadFile(macrosFilename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var macros []*Macro
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, keysText, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected a name, a colon and the keys", macrosFilename, i+1)
+		}
+		keys, err := parseMacroKeys(keysText)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", macrosFilename, i+1, err)
+		}
+		macros = append(macros, &Macro{Name: strings.TrimSpace(name), KeyPresses: keys})
+	}
+	return macros, nil
+}
+
+// SaveMacros writes the given macros to the macro file in the configuration directory
+func SaveMacros(macros []*Macro) error {
+	var sb strings.Builder
+	sb.WriteString("# Macros for o. Each line is a name, a colon and the keypresses.\n")
+	for _, m := range macros {
+		sb.WriteString(m.Name + ": " + m.String() + "\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(macrosFilename), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(macrosFilename, []byte(sb.String()), 0o644)
+}
+
+// SaveMacro adds the given macro to the saved macros, or replaces the one with the same name.
+// A macro without any keypresses removes the saved macro with that name instead.
+func SaveMacro(m *Macro) error {
+	macros, err := LoadMacros()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(macros, func(saved *Macro) bool { return saved.Name == m.Name })
+	switch {
+	case m.Len() == 0 && i >= 0:
+		macros = slices.Delete(macros, i, i+1)
+	case m.Len() == 0:
+		return nil
+	case i >= 0:
+		macros[i] = m
+	default:
+		macros = append(macros, m)
+	}
+	return SaveMacros(macros)
+}
+
+// PlayMacroOnLines starts playing back the current macro once for each of the given number
+// of lines, starting at line y. The cursor is placed at the start of a line before each pass.
+func (e *Editor) PlayMacroOnLines(c *vt.Canvas, status *StatusBar, undo *Undo, y LineIndex, count int) {
+	if e.macro == nil || e.macro.Len() == 0 || count <= 0 {
+		return
+	}
+	undo.IgnoreSnapshots(false)
+	undo.Snapshot(e)
+	e.ClearSelection()
+	e.macro.Home()
+	e.macro.eachLine = true
+	e.macro.lineY = y
+	e.macro.lineCount = e.Len()
+	e.GoTo(y, c, status)
+	e.Home()
+	e.playBackMacroCount = count
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+}
+
+// macroNextLine moves the cursor to the start of the next line to play back the macro on, after a pass.
+// Lines that the macro added or removed are taken into account. Returns false if there are no more lines.
+func (e *Editor) macroNextLine(c *vt.Canvas, status *StatusBar) bool {
+	m := e.macro
+	m.lineY += 1 + LineIndex(e.Len()-m.lineCount)
+	m.lineCount = e.Len()
+	if m.lineY < 0 || int(m.lineY) >= e.Len() {
+		m.eachLine = false
+		return false
+	}
+	e.GoTo(m.lineY, c, status)
+	e.Home()
+	return true
+}
+
+// pickSavedMacro lets the user select one of the saved macros. Returns nil if there are none, or if cancelled.
+func (e *Editor) pickSavedMacro(tty *vt.TTY, c *vt.Canvas, status *StatusBar, title string) *Macro {
+	macros, err := LoadMacros()
+	if err != nil {
+		status.SetErrorAfterRedraw(err)
+		return nil
+	}
+	if len(macros) == 0 {
+		status.SetMessageAfterRedraw("No saved macros")
+		return nil
+	}
+	items := make([]string, len(macros))
+	names := make([]string, len(macros))
+	for i, m := range macros {
+		items[i] = m.Name + ": " + m.String()
+		names[i] = m.Name
+	}
+	if i := e.FuzzyPickFromList(tty, c, status, title, items, names, "Type to filter, press return to select, or Esc to cancel."); i >= 0 {
+		return macros[i]
+	}
+	return nil
+}
+
+// SaveCurrentMacro asks for a name and saves the current macro with that name
+func (e *Editor) SaveCurrentMacro(tty *vt.TTY, c *vt.Canvas, status *StatusBar) {
+	if e.macro == nil || e.macro.Len() == 0 {
+		status.SetMessageAfterRedraw("No macro to save")
+		return
+	}
+	name, ok := e.UserInput(c, tty, status, "Macro name", e.macro.Name, nil, false, "")
+	if name = strings.TrimSpace(name); !ok || name == "" {
+		return
+	}
+	if strings.Contains(name, ":") {
+		status.SetErrorMessageAfterRedraw("A macro name can not contain a colon")
+		return
+	}
+	e.macro.Name = name
+	if err := SaveMacro(e.macro); err != nil {
+		status.SetErrorAfterRedraw(err)
+		return
+	}
+	status.SetMessageAfterRedraw("Saved macro " + name)
+}
+
+// UseSavedMacro lets the user select a saved macro, which then becomes the current macro,
+// so that it can be played back with ctrl-t
+func (e *Editor) UseSavedMacro(tty *vt.TTY, c *vt.Canvas, status *StatusBar) {
+	m := e.pickSavedMacro(tty, c, status, "Use macro")
+	if m == nil {
+		return
+	}
+	e.macro = m
+	e.playBackMacroCount = 0
+	status.SetMessageAfterRedraw("Press ctrl-t to play back " + m.Name)
+}
+
+// EditSavedMacro lets the user select a saved macro and edit its keypresses as text.
+// The edited macro is saved and becomes the current macro. Removing all keypresses removes the macro.
+func (e *Editor) EditSavedMacro(tty *vt.TTY, c *vt.Canvas, status *StatusBar) {
+	m := e.pickSavedMacro(tty, c, status, "Edit macro")
+	if m == nil {
+		return
+	}
+	text, ok := e.UserInput(c, tty, status, m.Name, m.String(), nil, false, "")
+	if !ok {
+		return
+	}
+	keys, err := parseMacroKeys(text)
+	if err != nil {
+		status.SetErrorAfterRedraw(err)
+		return
+	}
+	m.KeyPresses = keys
+	if err := SaveMacro(m); err != nil {
+		status.SetErrorAfterRedraw(err)
+		return
+	}
+	if m.Len() == 0 {
+		status.SetMessageAfterRedraw("Removed macro " + m.Name)
+		return
+	}
+	e.macro = m
+	e.playBackMacroCount = 0
+	status.SetMessageAfterRedraw("Saved macro " + m.Name)
+}
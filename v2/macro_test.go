@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMacroTextRoundTrip(t *testing.T) {
+	m := &Macro{KeyPresses: []string{homeKey, "/", "/", " ", "\"", "c:5", " ", "c:13", downArrow, "ctrl↑", "é", "F3", "F12", "backtab"}}
+	text := m.String()
+	if want := `home "// \"" ctrl-e space return down ctrl↑ "é" F3 F12 backtab`; text != want {
+		t.Errorf("got %s, want %s", text, want)
+	}
+	keys, err := parseMacroKeys(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(keys, m.KeyPresses) {
+		t.Errorf("got %q, want %q", keys, m.KeyPresses)
+	}
+	for _, bad := range []string{`"unterminated`, "retrun", "F13"} {
+		if _, err := parseMacroKeys(bad); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+}
+
+func TestSaveMacro(t *testing.T) {
+	oldFilename := macrosFilename
+	defer func() { macrosFilename = oldFilename }()
+	macrosFilename = filepath.Join(t.TempDir(), "o", "macros.txt")
+
+	if macros, err := LoadMacros(); err != nil || len(macros) != 0 {
+		t.Fatalf("expected no macros and no error, got %d macros and %v", len(macros), err)
+	}
+	if err := SaveMacro(&Macro{Name: "comment", KeyPresses: []string{homeKey, "/", "/", " "}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveMacro(&Macro{Name: "join", KeyPresses: []string{"c:10"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Replace the first one, then remove the second one
+	if err := SaveMacro(&Macro{Name: "comment", KeyPresses: []string{homeKey, "#", " "}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveMacro(&Macro{Name: "join"}); err != nil {
+		t.Fatal(err)
+	}
+	macros, err := LoadMacros()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(macros) != 1 || macros[0].Name != "comment" || macros[0].String() != `home "# "` {
+		t.Errorf("unexpected macros: %v", macros)
+	}
+}
+
+// TestMacroNextLine checks that playing back a macro once per line goes to the next line,
+// also when the macro adds or removes lines
+func TestMacroNextLine(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("a\nb\nc\nd\n"))
+	e.macro = &Macro{KeyPresses: []string{"x"}}
+	e.PlayMacroOnLines(nil, nil, NewUndo(8, 0), 0, 4)
+	if e.playBackMacroCount != 4 || e.DataY() != 0 {
+		t.Fatalf("got %d passes from line %d", e.playBackMacroCount, e.DataY())
+	}
+	// The first pass adds a line below the current one
+	e.InsertLineBelowAt(0)
+	if !e.macroNextLine(nil, nil) || e.DataY() != 2 {
+		t.Fatalf("expected to go to line 2, got line %d", e.DataY())
+	}
+	// The second pass removes the current line
+	e.DeleteLine(2)
+	if !e.macroNextLine(nil, nil) || e.DataY() != 2 || e.Line(2) != "c" {
+		t.Fatalf("expected to go to line 2 with c, got line %d", e.DataY())
+	}
+	if !e.macroNextLine(nil, nil) || e.Line(e.DataY()) != "d" {
+		t.Fatalf("expected to go to the line with d")
+	}
+	if e.macroNextLine(nil, nil) {
+		t.Errorf("expected no more lines")
+	}
+}
@@ -235,6 +235,13 @@ func main() {
 		}
 	}
 
+	// Merge user-configured language servers from ~/.config/o/lsp.toml with the built-in ones.
+	// An error is shown in the status bar instead of stopping, so that lsp.toml can be opened and fixed.
+	lspConfigError = LoadLSPConfigs()
+
+	// Merge user-configured debug adapters from ~/.config/o/dap.toml with the built-in ones
+	dapConfigError = LoadDAPConfigs()
+
 	noWriteToCache = noCacheFlag || monitorAndReadOnlyFlag
 
 	var (
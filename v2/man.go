@@ -59,8 +59,8 @@ func handleManPageEscape(input string) string {
 // stripManPageEscapes removes nroff overstriking and ANSI codes from every line,
 // so that the buffer matches what is drawn
 func (e *Editor) stripManPageEscapes() {
-	for i, runes := range e.lines {
-		e.lines[i] = []rune(strings.TrimRight(handleManPageEscape(string(runes)), " \t"))
+	for i, runes := range e.lines.All() {
+		e.lines.Set(i, []rune(strings.TrimRight(handleManPageEscape(string(runes)), " \t")))
 	}
 }
 
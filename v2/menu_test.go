@@ -50,3 +50,48 @@ func TestSelectionLettersForChoices(_ *testing.T) {
 		_ = s
 	}
 }
+
+func TestListPicker(t *testing.T) {
+	lp := NewListPicker([]string{"a", "b", "c", "d", "e"}, 2)
+	if visible, selected := lp.Visible(); len(visible) != 2 || visible[0] != "a" || selected != 0 {
+		t.Fatalf("unexpected initial state: %v %d", visible, selected)
+	}
+	lp.Down()
+	lp.Down()
+	if visible, selected := lp.Visible(); visible[0] != "b" || visible[1] != "c" || selected != 1 || lp.Selected() != 2 {
+		t.Errorf("expected to scroll down to b and c, got %v %d", visible, selected)
+	}
+	lp.Up()
+	lp.Up()
+	lp.Up() // wraps around to the last item
+	if visible, _ := lp.Visible(); lp.Selected() != 4 || visible[1] != "e" {
+		t.Errorf("expected the last item to be selected and visible, got %d %v", lp.Selected(), visible)
+	}
+	lp.PageDown() // does not wrap around
+	if lp.Selected() != 4 {
+		t.Errorf("expected page down to stop at the last item, got %d", lp.Selected())
+	}
+	lp.PageUp()
+	if visible, _ := lp.Visible(); lp.Selected() != 2 || visible[0] != "c" {
+		t.Errorf("expected page up to select c, got %d %v", lp.Selected(), visible)
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	keys := []string{"GoToNextFuncOrSection", "gotoLine", "FindReferences", "goToSymbol", "String"}
+	if got := fuzzyFilter("", keys); len(got) != len(keys) || got[0] != 0 || got[4] != 4 {
+		t.Errorf("expected all keys in order for an empty pattern, got %v", got)
+	}
+	if got := fuzzyFilter("gts", keys); len(got) != 2 || got[0] != 3 || got[1] != 0 {
+		t.Errorf("expected goToSymbol before GoToNextFuncOrSection, got %v", got)
+	}
+	if got := fuzzyFilter("fref", keys); len(got) != 1 || got[0] != 2 {
+		t.Errorf("expected only FindReferences to match, got %v", got)
+	}
+	if got := fuzzyFilter("xyz", keys); len(got) != 0 {
+		t.Errorf("expected no matches, got %v", got)
+	}
+	if _, ok := fuzzyScore("str", "String"); !ok {
+		t.Error("expected matching to ignore case")
+	}
+}
@@ -34,7 +34,7 @@ func dataXToScreenX(runes []rune, dataX int, spacesPerTab int) int {
 // GoToNextWord moves the cursor to the start of the next word on the current or next line
 func (e *Editor) GoToNextWord(c *vt.Canvas, status *StatusBar) {
 	y := e.DataY()
-	runes := e.lines[int(y)]
+	runes := e.lines.Line(int(y))
 	x, err := e.DataX()
 	if err != nil || x >= len(runes) {
 		// At end of line: go to first word on the next line
@@ -72,7 +72,7 @@ func (e *Editor) GoToNextWord(c *vt.Canvas, status *StatusBar) {
 // GoToPrevWord moves the cursor to the start of the previous word on the current or previous line
 func (e *Editor) GoToPrevWord(c *vt.Canvas, status *StatusBar) {
 	y := e.DataY()
-	runes := e.lines[int(y)]
+	runes := e.lines.Line(int(y))
 	x, err := e.DataX()
 
 	atLineStart := err != nil || x == 0
@@ -303,8 +303,8 @@ func NewEditor(tty *vt.TTY, c *vt.Canvas, fnord FilenameOrData, lineNumber LineN
 					e.binaryFile = false
 					// Strip nroff/ANSI escape codes and trailing whitespace from each stored line,
 					// so that cursor navigation and rendering both see clean content.
-					for i, runes := range e.lines {
-						e.lines[i] = []rune(strings.TrimRight(handleManPageEscape(string(runes)), " \t"))
+					for i, runes := range e.lines.All() {
+						e.lines.Set(i, []rune(strings.TrimRight(handleManPageEscape(string(runes)), " \t")))
 					}
 				} else {
 					if m, found := mode.DetectFromContents(e.mode, firstLine, e.String); found {
@@ -736,7 +736,7 @@ func NewCustomEditor(indentation mode.TabsSpaces, scrollSpeed int, m mode.Mode,
 	e := &Editor{}
 	e.debugLine.Store(-1)
 	e.SetTheme(theme)
-	e.lines = make(map[int][]rune)
+	e.lines = NewLineBuffer()
 	e.linesMut = &sync.Mutex{}
 	e.hlCache = newHighlightCache()
 	e.indentation = indentation
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt"
+)
+
+// lspDocumentSymbolTimeout is for requesting the symbols of the current document
+const lspDocumentSymbolTimeout = 3 * time.Second
+
+// LSPDocumentSymbol is a symbol in a document, with the symbols it contains as children
+type LSPDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Detail         string              `json:"detail"`
+	Children       []LSPDocumentSymbol `json:"children"`
+	Range          LSPRange            `json:"range"`
+	SelectionRange LSPRange            `json:"selectionRange"`
+	Kind           int                 `json:"kind"`
+}
+
+// LSPSymbolInformation is a symbol in a document, for servers that do not return a hierarchy
+type LSPSymbolInformation struct {
+	Name          string      `json:"name"`
+	ContainerName string      `json:"containerName"`
+	Location      LSPLocation `json:"location"`
+	Kind          int         `json:"kind"`
+}
+
+// OutlineSymbol is a function, type, method or heading in the outline of the current file
+type OutlineSymbol struct {
+	Name  string
+	Kind  string
+	Line  LineIndex
+	Col   ColIndex
+	Depth int // how deeply the symbol is nested in other symbols
+}
+
+// lspSymbolKinds are the names of the LSP SymbolKind constants, starting at 1
+var lspSymbolKinds = []string{"file", "module", "namespace", "package", "class", "method", "property", "field", "constructor", "enum", "interface", "function", "variable", "constant", "string", "number", "boolean", "array", "object", "key", "null", "enum member", "struct", "event", "operator", "type parameter"}
+
+// lspSymbolKindName returns the name of the given LSP SymbolKind, like "function"
+func lspSymbolKindName(kind int) string {
+	if kind < 1 || kind > len(lspSymbolKinds) {
+		return "symbol"
+	}
+	return lspSymbolKinds[kind-1]
+}
+
+// outlineKind returns true if symbols of this kind are listed when nested in other symbols.
+// Top-level symbols are always listed, but fields and local variables are left out.
+func outlineKind(kind string) bool {
+	switch kind {
+	case "class", "constructor", "enum", "function", "interface", "method", "module", "namespace", "struct":
+		return true
+	}
+	return false
+}
+
+// flattenDocumentSymbols returns the given symbols and their children, in order
+func flattenDocumentSymbols(symbols []LSPDocumentSymbol, depth int) []OutlineSymbol {
+	var outline []OutlineSymbol
+	for _, symbol := range symbols {
+		kind := lspSymbolKindName(symbol.Kind)
+		if depth > 0 && !outlineKind(kind) {
+			continue
+		}
+		start := symbol.SelectionRange.Start
+		outline = append(outline, OutlineSymbol{Name: symbol.Name, Kind: kind, Line: LineIndex(start.Line), Col: ColIndex(start.Character), Depth: depth})
+		outline = append(outline, flattenDocumentSymbols(symbol.Children, depth+1)...)
+	}
+	return outline
+}
+
+// parseDocumentSymbols parses the result of a textDocument/documentSymbol request, which
+// is either a list of DocumentSymbol or a list of SymbolInformation
+func parseDocumentSymbols(result []any) ([]OutlineSymbol, error) {
+	if len(result) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	if first, ok := result[0].(map[string]any); ok {
+		if _, hasLocation := first["location"]; hasLocation {
+			var symbols []LSPSymbolInformation
+			if err := json.Unmarshal(data, &symbols); err != nil {
+				return nil, errors.New("could not parse document symbol response")
+			}
+			outline := make([]OutlineSymbol, 0, len(symbols))
+			for _, symbol := range symbols {
+				depth := 0
+				if symbol.ContainerName != "" {
+					depth = 1
+				}
+				kind := lspSymbolKindName(symbol.Kind)
+				if depth > 0 && !outlineKind(kind) {
+					continue
+				}
+				start := symbol.Location.Range.Start
+				outline = append(outline, OutlineSymbol{Name: symbol.Name, Kind: kind, Line: LineIndex(start.Line), Col: ColIndex(start.Character), Depth: depth})
+			}
+			return outline, nil
+		}
+	}
+	var symbols []LSPDocumentSymbol
+	if err := json.Unmarshal(data, &symbols); err != nil {
+		return nil, errors.New("could not parse document symbol response")
+	}
+	return flattenDocumentSymbols(symbols, 0), nil
+}
+
+// GetDocumentSymbols requests the functions, types and other symbols in the given document
+func (lsp *LSPClient) GetDocumentSymbols(uri string, timeout time.Duration) ([]OutlineSymbol, error) {
+	if !lsp.initialized {
+		return nil, errors.New("LSP client not initialized")
+	}
+	params := map[string]any{
+		"textDocument": map[string]any{
+			"uri": uri,
+		},
+	}
+	id, err := lsp.sendRequest("textDocument/documentSymbol", params)
+	if err != nil {
+		return nil, err
+	}
+	response, err := lsp.readResponse(id, timeout)
+	if err != nil {
+		return nil, err
+	}
+	resultData, ok := response["result"]
+	if !ok {
+		if errorData, hasError := response["error"]; hasError {
+			return nil, fmt.Errorf("LSP error: %v", errorData)
+		}
+		return nil, errors.New("no result in document symbol response")
+	}
+	result, _ := resultData.([]any)
+	return parseDocumentSymbols(result)
+}
+
+// headingLevel returns the level and the text of a Markdown heading like "## Usage",
+// or of an AsciiDoc heading like "== Usage". Returns 0 if the line is not a heading.
+func headingLevel(line string, m mode.Mode) (int, string) {
+	marker := '#'
+	if m == mode.ASCIIDoc {
+		marker = '='
+	}
+	level := 0
+	for level < len(line) && rune(line[level]) == marker {
+		level++
+	}
+	if level == 0 || level > 6 || level == len(line) || line[level] != ' ' {
+		return 0, ""
+	}
+	text := strings.TrimSpace(strings.TrimRight(line[level:], string(marker)))
+	if text == "" {
+		return 0, ""
+	}
+	return level, text
+}
+
+// typeModifiers are words that may come before a type definition, like "pub" in "pub struct"
+var typeModifiers = map[string]bool{"abstract": true, "data": true, "export": true, "final": true, "internal": true, "open": true, "partial": true, "private": true, "protected": true, "pub": true, "public": true, "sealed": true, "static": true}
+
+// typeKeywords are words that start a type definition, mapped to the kind of the type
+var typeKeywords = map[string]string{"class": "class", "enum": "enum", "interface": "interface", "object": "class", "record": "struct", "struct": "struct", "trait": "interface", "type": "type", "union": "struct"}
+
+// typeDefinitionName returns the name and the kind of the type that is defined on the given line,
+// like "Editor" and "type" for "type Editor struct {". Returns an empty string if no type is defined.
+func typeDefinitionName(line string) (string, string) {
+	fields := strings.Fields(line)
+	for len(fields) > 0 && typeModifiers[fields[0]] {
+		fields = fields[1:]
+	}
+	if len(fields) < 2 {
+		return "", ""
+	}
+	kind, ok := typeKeywords[fields[0]]
+	if !ok {
+		return "", ""
+	}
+	name := fields[1]
+	for i, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			name = name[:i]
+			break
+		}
+	}
+	if name == "" || strings.HasSuffix(strings.TrimSpace(line), ";") { // forward declarations
+		return "", ""
+	}
+	return name, kind
+}
+
+// heuristicOutline finds the headings, or the functions and types, in the current file without
+// a language server, by using the same heuristics as the function name in the top right corner
+func (e *Editor) heuristicOutline() []OutlineSymbol {
+	var (
+		outline           []OutlineSymbol
+		commentMarker     = e.SingleLineCommentMarker()
+		documentation     = hasMarkdownHeadings(e.mode)
+		inCodeBlock       bool
+		methodIndentation = e.mode == mode.Python || e.mode == mode.Mojo || e.mode == mode.Ruby || e.mode == mode.Crystal
+	)
+	for i := range e.Len() {
+		line := e.Line(LineIndex(i))
+		if documentation {
+			if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+				inCodeBlock = !inCodeBlock
+				continue
+			}
+			if inCodeBlock {
+				continue
+			}
+			if level, text := headingLevel(line, e.mode); level > 0 {
+				outline = append(outline, OutlineSymbol{Name: bookHeadingPlainText(text), Kind: "heading", Line: LineIndex(i), Depth: level - 1})
+			}
+			continue
+		}
+		trimmedLine := strings.TrimSpace(line)
+		if trimmedLine == "" || (commentMarker != "" && strings.HasPrefix(trimmedLine, commentMarker)) {
+			continue
+		}
+		indented := strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+		col := ColIndex(len([]rune(line)) - len([]rune(strings.TrimLeft(line, " \t"))))
+		if name, kind := typeDefinitionName(trimmedLine); name != "" {
+			outline = append(outline, OutlineSymbol{Name: name, Kind: kind, Line: LineIndex(i), Col: col})
+			continue
+		}
+		if name := e.FunctionName(line); name != "" {
+			kind, depth := "function", 0
+			if strings.HasPrefix(trimmedLine, "func (") || (methodIndentation && indented) {
+				kind, depth = "method", 1
+			}
+			outline = append(outline, OutlineSymbol{Name: name, Kind: kind, Line: LineIndex(i), Col: col, Depth: depth})
+		}
+	}
+	return outline
+}
+
+// GoToSymbol lists the functions, types and methods in the current file, or the headings for
+// Markdown and similar formats, and jumps to the one that is selected. The list can be filtered
+// by typing. The language server is used if it is running, if not the file is searched with
+// the same heuristics that are used for ctrl-g up and down. Returns true if the cursor was moved.
+func (e *Editor) GoToSymbol(tty *vt.TTY, c *vt.Canvas, status *StatusBar) bool {
+	var outline []OutlineSymbol
+	if _, ok := lspConfigs[e.mode]; ok && !e.InBookMode() {
+		if client, uri := e.syncLSPDocumentIfReady(true); client != nil {
+			outline, _ = client.GetDocumentSymbols(uri, lspDocumentSymbolTimeout)
+		}
+	}
+	if len(outline) == 0 {
+		outline = e.heuristicOutline()
+	}
+	if len(outline) == 0 {
+		status.SetMessageAfterRedraw("No symbols found")
+		return false
+	}
+
+	items := make([]string, len(outline))
+	names := make([]string, len(outline))
+	for i, symbol := range outline {
+		items[i] = fmt.Sprintf("%s%s (%s) %d", strings.Repeat("  ", symbol.Depth), symbol.Name, symbol.Kind, symbol.Line.LineNumber())
+		names[i] = symbol.Name
+	}
+	title := "Symbols in " + filepath.Base(e.filename)
+	index := e.FuzzyPickFromList(tty, c, status, title, items, names, "Type to filter, press return to jump, or Esc to cancel.")
+	if index < 0 {
+		return false
+	}
+	symbol := outline[index]
+	absPath, err := filepath.Abs(e.filename)
+	if err != nil {
+		absPath = e.filename
+	}
+	return e.jumpToReference(Reference{Filename: absPath, Line: symbol.Line, Col: symbol.Col}, tty, c, status)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/xyproto/vt"
 )
 
@@ -57,3 +59,73 @@ func (stb *ScrollableTextBox) PrevPage() {
 		stb.CurrentPage--
 	}
 }
+
+// ShowPagedText shows the given lines in a box with pages that can be scrolled through,
+// until return, ctrl-q, esc, q, y or n is pressed. The key that closed the box is returned.
+// hint is shown in the status bar, or a default hint if it is empty.
+func (e *Editor) ShowPagedText(tty *vt.TTY, c *vt.Canvas, status *StatusBar, title string, lines []string, hint string) string {
+	// Use 80% of the canvas width and height
+	pageWidth := int(float64(c.Width()) * 0.8)
+	pageHeight := int(float64(c.Height()) * 0.8)
+
+	// Create pages of text
+	var pages []Page
+	for i := 0; i < len(lines); i += pageHeight {
+		end := min(i+pageHeight, len(lines))
+		pages = append(pages, Page{Lines: lines[i:end]})
+	}
+	if len(pages) == 0 {
+		return ""
+	}
+
+	canvasBox := NewCanvasBox(c)
+	centerBox := NewBox()
+	centerBox.FillWithMargins(canvasBox, 5, 2)
+	centerBox.Y--
+	centerBox.W = pageWidth
+	centerBox.H = min(pageHeight, len(lines)) + 6
+	scrollableTextBox := NewScrollableTextBox(pages)
+	scrollableTextBox.FillWithMargins(centerBox, 4, 4)
+	boxTheme := e.NewBoxTheme()
+	boxTheme.Foreground = &e.BoxTextColor
+	boxTheme.Background = &e.BoxBackground
+	surroundingBox := *(scrollableTextBox.Box)
+	surroundingBox.X -= 2
+	surroundingBox.Y -= 2
+	surroundingBox.W += 2
+	surroundingBox.H += 4
+
+	if hint == "" {
+		hint = "Press Esc or q to close."
+	}
+
+	defer func() {
+		status.ClearAll(c, false)
+		e.redraw.Store(true)
+		e.redrawCursor.Store(true)
+	}()
+
+	for {
+		// Draw the current page
+		e.DrawBox(boxTheme, c, &surroundingBox)
+		e.DrawTitle(boxTheme, c, &surroundingBox, title, true)
+		if len(pages) > 1 {
+			status.SetMessage(fmt.Sprintf("Page %d of %d. Press Space for the next page. %s", scrollableTextBox.CurrentPage+1, len(pages), hint))
+		} else {
+			status.SetMessage(hint)
+		}
+		status.Show(c, e)
+		e.DrawScrollableText(boxTheme, c, scrollableTextBox)
+		c.HideCursorAndDraw()
+
+		// Wait for a keypress
+		switch key := tty.ReadKey(); key {
+		case " ", "↓", "j", "c:14": // space, down, j or ctrl-n
+			scrollableTextBox.NextPage()
+		case "↑", "k", "c:16": // up, k or ctrl-p
+			scrollableTextBox.PrevPage()
+		case "c:13", "c:17", "c:27", "q", "y", "n": // return, ctrl-q, esc, q, y or n
+			return key
+		}
+	}
+}
@@ -12,6 +12,9 @@ var (
 
 	locationHistoryFilename = filepath.Join(userCacheDir, "o", "locations.txt")
 	quickHelpToggleFilename = filepath.Join(userCacheDir, "o", "quickhelp.txt")
+	breakpointsFilename     = filepath.Join(userCacheDir, "o", "breakpoints.txt")
+	macrosFilename          = filepath.Join(userConfigDir, "o", "macros.txt")
+	undoHistoryDir          = filepath.Join(userCacheDir, "o", "undo")
 
 	vimLocationHistoryFilename   = env.ExpandUser("~/.viminfo")
 	nvimLocationHistoryFilename  = filepath.Join(env.Dir("XDG_DATA_HOME", "~/.local/share"), "nvim", "shada", "main.shada")
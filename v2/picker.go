@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt"
+)
+
+// ListPicker keeps track of the selected item and the visible part of a list that can be scrolled
+type ListPicker struct {
+	items    []string
+	selected int // index of the selected item
+	offset   int // index of the first visible item
+	height   int // number of visible items
+}
+
+// NewListPicker creates a new ListPicker that shows height items at a time
+func NewListPicker(items []string, height int) *ListPicker {
+	return &ListPicker{
+		items:  items,
+		height: max(height, 1),
+	}
+}
+
+// SetItems replaces the items and selects the first one
+func (lp *ListPicker) SetItems(items []string) {
+	lp.items = items
+	lp.selected = 0
+	lp.offset = 0
+}
+
+// Selected returns the index of the selected item
+func (lp *ListPicker) Selected() int {
+	return lp.selected
+}
+
+// Visible returns the visible items, and the index of the selected item among them
+func (lp *ListPicker) Visible() ([]string, int) {
+	end := min(lp.offset+lp.height, len(lp.items))
+	return lp.items[lp.offset:end], lp.selected - lp.offset
+}
+
+// Select selects the item with the given index, clamped to the list, and scrolls it into view
+func (lp *ListPicker) Select(n int) {
+	lp.selected = max(min(n, len(lp.items)-1), 0)
+	if lp.selected < lp.offset {
+		lp.offset = lp.selected
+	} else if lp.selected >= lp.offset+lp.height {
+		lp.offset = lp.selected - lp.height + 1
+	}
+}
+
+// Up selects the previous item, with wrap-around
+func (lp *ListPicker) Up() {
+	if lp.selected <= 0 {
+		lp.Select(len(lp.items) - 1)
+		return
+	}
+	lp.Select(lp.selected - 1)
+}
+
+// Down selects the next item, with wrap-around
+func (lp *ListPicker) Down() {
+	if lp.selected >= len(lp.items)-1 {
+		lp.Select(0)
+		return
+	}
+	lp.Select(lp.selected + 1)
+}
+
+// PageUp selects the item one page up, without wrapping around
+func (lp *ListPicker) PageUp() {
+	lp.Select(lp.selected - lp.height)
+}
+
+// PageDown selects the item one page down, without wrapping around
+func (lp *ListPicker) PageDown() {
+	lp.Select(lp.selected + lp.height)
+}
+
+// fuzzyScore checks if the letters in pattern appear in s in the same order, ignoring case.
+// Matches at the start of s, at the start of words and right after the previous match score higher.
+// Returns false if s does not match.
+func fuzzyScore(pattern, s string) (int, bool) {
+	var (
+		patternRunes = []rune(strings.ToLower(pattern))
+		runes        = []rune(s)
+		score        int
+		p            int
+		prevMatch    = -2
+	)
+	for i, r := range runes {
+		if p == len(patternRunes) {
+			break
+		}
+		if unicode.ToLower(r) != patternRunes[p] {
+			continue
+		}
+		switch {
+		case i == 0:
+			score += 8
+		case !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]):
+			score += 6 // start of a word, like "b" in "foo_bar"
+		case unicode.IsUpper(r) && unicode.IsLower(runes[i-1]):
+			score += 6 // start of a word, like "B" in "fooBar"
+		}
+		if i == prevMatch+1 {
+			score += 4
+		} else {
+			score--
+		}
+		prevMatch = i
+		p++
+	}
+	if p < len(patternRunes) {
+		return 0, false
+	}
+	return score - len(runes)/8, true // prefer shorter strings
+}
+
+// fuzzyFilter returns the indices of the keys that match the pattern, best matches first.
+// All indices are returned, in order, if the pattern is empty.
+func fuzzyFilter(pattern string, keys []string) []int {
+	indices := make([]int, 0, len(keys))
+	if pattern == "" {
+		for i := range keys {
+			indices = append(indices, i)
+		}
+		return indices
+	}
+	scores := make(map[int]int, len(keys))
+	for i, key := range keys {
+		if score, ok := fuzzyScore(pattern, key); ok {
+			indices = append(indices, i)
+			scores[i] = score
+		}
+	}
+	sort.SliceStable(indices, func(a, b int) bool {
+		return scores[indices[a]] > scores[indices[b]]
+	})
+	return indices
+}
+
+// PickFromList shows the given items in a box where one item can be selected with the arrow keys
+// and return. Returns the index of the selected item, or -1 if esc, q or ctrl-q was pressed.
+func (e *Editor) PickFromList(tty *vt.TTY, c *vt.Canvas, status *StatusBar, title string, items []string, hint string) int {
+	return e.pickFromList(tty, c, status, title, items, nil, hint, false)
+}
+
+// FuzzyPickFromList is like PickFromList, but the items can be filtered by typing. The typed
+// letters are matched against the keys, which can be shorter than the items, like only the
+// name of a symbol. If keys is nil, the items are used. Returns -1 if esc or ctrl-q was pressed.
+func (e *Editor) FuzzyPickFromList(tty *vt.TTY, c *vt.Canvas, status *StatusBar, title string, items, keys []string, hint string) int {
+	if keys == nil {
+		keys = items
+	}
+	return e.pickFromList(tty, c, status, title, items, keys, hint, true)
+}
+
+// pickFromList is the implementation of PickFromList and FuzzyPickFromList
+func (e *Editor) pickFromList(tty *vt.TTY, c *vt.Canvas, status *StatusBar, title string, items, keys []string, hint string, filter bool) int {
+	if len(items) == 0 {
+		return -1
+	}
+
+	// Use 80% of the canvas width and at most 80% of the canvas height
+	listWidth := int(float64(c.Width())*0.8) - 4
+	listHeight := min(int(float64(c.Height())*0.8)-4, len(items))
+
+	canvasBox := NewCanvasBox(c)
+	surroundingBox := NewBox()
+	surroundingBox.FillWithMargins(canvasBox, 5, 2)
+	surroundingBox.W = listWidth + 4
+	surroundingBox.H = listHeight + 4
+	listBox := NewBox()
+	listBox.FillWithMargins(surroundingBox, 2, 2)
+
+	boxTheme := e.NewBoxTheme()
+	picker := NewListPicker(items, listHeight)
+
+	// matches are the indices of the items that match the typed letters, if filtering
+	var (
+		query   string
+		matches = fuzzyFilter("", items)
+	)
+
+	if hint == "" {
+		hint = "Press return to select, or Esc or q to cancel."
+	}
+
+	defer func() {
+		status.ClearAll(c, false)
+		e.redraw.Store(true)
+		e.redrawCursor.Store(true)
+	}()
+
+	for {
+		visible, selected := picker.Visible()
+		lines := make([]string, len(visible))
+		for i, item := range visible {
+			lines[i] = chopRunes(asciiFallback(item), listWidth)
+		}
+		e.DrawBox(boxTheme, c, surroundingBox)
+		if filter && query != "" {
+			e.DrawTitle(boxTheme, c, surroundingBox, title+": "+query, true)
+		} else {
+			e.DrawTitle(boxTheme, c, surroundingBox, title, true)
+		}
+		e.DrawList(boxTheme, c, listBox, lines, selected)
+		switch {
+		case len(matches) == 0:
+			status.SetMessage("No matches. " + hint)
+		case len(matches) > listHeight || len(matches) < len(items):
+			status.SetMessage(fmt.Sprintf("%d of %d. %s", picker.Selected()+1, len(matches), hint))
+		default:
+			status.SetMessage(hint)
+		}
+		status.Show(c, e)
+		c.HideCursorAndDraw()
+
+		// Wait for a keypress
+		key := tty.ReadKey()
+		if filter {
+			// Letters are typed into the filter instead of being used for navigation
+			newQuery := query
+			if key == "c:8" || key == "c:127" { // ctrl-h or backspace
+				if len(newQuery) > 0 {
+					_, size := utf8.DecodeLastRuneInString(newQuery)
+					newQuery = newQuery[:len(newQuery)-size]
+				}
+			} else if r, size := utf8.DecodeRuneInString(key); size == len(key) && unicode.IsPrint(r) {
+				newQuery += key
+			}
+			if newQuery != query {
+				query = newQuery
+				matches = fuzzyFilter(query, keys)
+				filtered := make([]string, len(matches))
+				for i, index := range matches {
+					filtered[i] = items[index]
+				}
+				picker.SetItems(filtered)
+				continue
+			}
+		}
+		switch key {
+		case upArrow, "k", "c:16": // up, k or ctrl-p
+			picker.Up()
+		case downArrow, "j", "c:14": // down, j or ctrl-n
+			picker.Down()
+		case pgUpKey:
+			picker.PageUp()
+		case pgDnKey, " ": // page down or space
+			picker.PageDown()
+		case homeKey, "c:1": // home or ctrl-a
+			picker.Select(0)
+		case endKey, "c:5": // end or ctrl-e
+			picker.Select(len(matches) - 1)
+		case "c:13": // return
+			if len(matches) > 0 {
+				return matches[picker.Selected()]
+			}
+		case "c:17", "c:27", "q": // ctrl-q, esc or q
+			return -1
+		}
+	}
+}
@@ -157,7 +157,7 @@ func (e *Editor) findMatchingCurly(dataY LineIndex, dataX int) (LineIndex, int,
 	case '{':
 		depth := 0
 		for lineIdx := dataY; ; lineIdx++ {
-			runes, ok := e.lines[int(lineIdx)]
+			runes, ok := e.lines.Get(int(lineIdx))
 			if !ok {
 				break
 			}
@@ -180,7 +180,7 @@ func (e *Editor) findMatchingCurly(dataY LineIndex, dataX int) (LineIndex, int,
 	case '}':
 		depth := 0
 		for lineIdx := dataY; lineIdx >= 0; lineIdx-- {
-			runes, ok := e.lines[int(lineIdx)]
+			runes, ok := e.lines.Get(int(lineIdx))
 			if !ok {
 				continue
 			}
@@ -270,6 +270,9 @@ func (e *Editor) InitialRedraw(c *vt.Canvas, status *StatusBar) {
 		e.DrawFunctionDescriptionContinuous(c, false)
 	}
 
+	// Draw the signature of the function that is being called, if any
+	e.DrawSignatureHelp(c)
+
 	c.HideCursorAndDraw() // drawing now
 }
 
@@ -351,6 +354,9 @@ func (e *Editor) RedrawAtEndOfKeyLoop(c *vt.Canvas, status *StatusBar, shouldHig
 			e.DrawFunctionDescriptionContinuous(c, false)
 		}
 
+		// Draw the signature of the function that is being called, if any
+		e.DrawSignatureHelp(c)
+
 		c.HideCursorAndDraw() // drawing now
 		didDraw = true
 		e.redraw.Store(false) // mark as redrawn
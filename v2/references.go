@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt"
+)
+
+// Reference is a place in a file where a symbol is used
+type Reference struct {
+	Filename string // absolute path
+	Text     string // the contents of the line, trimmed
+	Line     LineIndex
+	Col      ColIndex
+}
+
+// wordOccurrences returns the rune indices where word occurs in line as a whole identifier
+func wordOccurrences(line, word []rune, m mode.Mode) []int {
+	var found []int
+	if len(word) == 0 {
+		return found
+	}
+	for x := 0; x+len(word) <= len(line); x++ {
+		if string(line[x:x+len(word)]) != string(word) {
+			continue
+		}
+		if x > 0 && isCompletionIdentRune(line[x-1], m) {
+			continue
+		}
+		if end := x + len(word); end < len(line) && isCompletionIdentRune(line[end], m) {
+			continue
+		}
+		found = append(found, x)
+	}
+	return found
+}
+
+// linesOf returns the lines of the given file. The contents of the editor are used for the current file.
+func (e *Editor) linesOf(absPath string) ([]string, error) {
+	if currentAbs, err := filepath.Abs(e.filename); err == nil && currentAbs == absPath {
+		return strings.Split(strings.TrimSuffix(e.String(), "\n"), "\n"), nil
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(data), "\n"), nil
+}
+
+// textSearchReferences searches for word in the same files as textSearchDefinition does
+func (e *Editor) textSearchReferences(word string) []Reference {
+	var (
+		references []Reference
+		wordRunes  = []rune(word)
+	)
+	for _, filename := range e.sourceFilenames() {
+		absPath, err := filepath.Abs(filename)
+		if err != nil {
+			continue
+		}
+		lines, err := e.linesOf(absPath)
+		if err != nil {
+			continue
+		}
+		for y, line := range lines {
+			for _, x := range wordOccurrences([]rune(line), wordRunes, e.mode) {
+				references = append(references, Reference{Filename: absPath, Text: strings.TrimSpace(line), Line: LineIndex(y), Col: ColIndex(x)})
+			}
+		}
+	}
+	return references
+}
+
+// lspReferences asks the language server for the references to the symbol under the cursor
+func (e *Editor) lspReferences() ([]Reference, error) {
+	client, uri, err := e.syncLSPDocument()
+	if err != nil {
+		return nil, err
+	}
+	line := int(e.DataY())
+	x, err := e.DataX()
+	if err != nil {
+		x = 0
+	}
+	locations, err := client.GetReferences(uri, line, lspCharacter(e.lines.Line(line), x), lspReferencesTimeout)
+	if err != nil {
+		return nil, err
+	}
+	currentAbs, _ := filepath.Abs(e.filename)
+	fileLines := make(map[string][]string)
+	references := make([]Reference, 0, len(locations))
+	for _, location := range locations {
+		absPath := uriToPath(location.URI)
+		if e.isCurrentLSPDocument(location.URI) {
+			absPath = currentAbs
+		}
+		lines, ok := fileLines[absPath]
+		if !ok {
+			lines, _ = e.linesOf(absPath)
+			fileLines[absPath] = lines
+		}
+		var (
+			text string
+			x    = location.Range.Start.Character
+		)
+		if y := location.Range.Start.Line; y >= 0 && y < len(lines) {
+			text = strings.TrimSpace(lines[y])
+			x = runeIndexFromLSP([]rune(lines[y]), x)
+		}
+		references = append(references, Reference{Filename: absPath, Text: text, Line: LineIndex(location.Range.Start.Line), Col: ColIndex(x)})
+	}
+	return references, nil
+}
+
+// FindReferences lists the references to the symbol under the cursor, and jumps to the one that is selected.
+// The language server is used if there is one, if not the source files next to the current file are searched.
+// Returns true if the cursor was moved.
+func (e *Editor) FindReferences(tty *vt.TTY, c *vt.Canvas, status *StatusBar) bool {
+	word := e.CurrentIdentifier()
+	if word == "" {
+		status.SetErrorMessageAfterRedraw("No symbol under the cursor")
+		return false
+	}
+
+	var (
+		references []Reference
+		err        error
+		usedLSP    bool
+	)
+	if _, ok := lspConfigs[e.mode]; ok {
+		if lspCommand, _, found := lspServerFor(e.mode); found {
+			status.SetMessage("Waiting for " + lspCommand)
+			status.ShowNoTimeout(c, e)
+			references, err = e.lspReferences()
+			status.ClearAll(c, false)
+			usedLSP = err == nil
+		}
+	}
+	if !usedLSP {
+		references = e.textSearchReferences(word)
+	}
+	if len(references) == 0 {
+		if err != nil {
+			status.SetErrorMessageAfterRedraw(fmt.Sprintf("No references to %s found: %v", word, err))
+		} else {
+			status.SetMessageAfterRedraw("No references to " + word + " found")
+		}
+		return false
+	}
+
+	dir := filepath.Dir(e.filename)
+	if absPath, err := filepath.Abs(e.filename); err == nil {
+		dir = filepath.Dir(absPath)
+	}
+	items := make([]string, len(references))
+	for i, ref := range references {
+		items[i] = fmt.Sprintf("%s:%d: %s", displayPath(ref.Filename, dir), ref.Line.LineNumber(), ref.Text)
+	}
+	title := fmt.Sprintf("References to %s", word)
+	if !usedLSP {
+		title += " (text search)"
+	}
+	index := e.PickFromList(tty, c, status, title, items, "Press return to jump, or Esc or q to cancel.")
+	if index < 0 {
+		return false
+	}
+	return e.jumpToReference(references[index], tty, c, status)
+}
+
+// jumpToReference jumps to the given reference and pushes a breadcrumb for jumping back
+func (e *Editor) jumpToReference(ref Reference, tty *vt.TTY, c *vt.Canvas, status *StatusBar) bool {
+	oldFilename := e.filename
+	oldLineIndex := e.LineIndex()
+
+	currentAbs, _ := filepath.Abs(e.filename)
+	otherFile := ref.Filename != currentAbs
+	if otherFile {
+		if err := e.Switch(c, tty, status, fileLock, ref.Filename); err != nil {
+			status.SetErrorAfterRedraw(err)
+			return false
+		}
+	}
+	e.redraw.Store(e.GoToLineNumberAndCol(ref.Line.LineNumber(), ref.Col.ColNumber(), c, status, true, true) || otherFile)
+	e.HorizontalScrollIfNeeded(c)
+	e.redrawCursor.Store(true)
+
+	// Push breadcrumb for back navigation
+	var label string
+	if otherFile {
+		label = breadcrumbFileLabel(oldFilename)
+	} else {
+		label = breadcrumbLabel(oldFilename, oldLineIndex)
+	}
+	pushBreadcrumb(label, func() {
+		if e.filename != oldFilename {
+			e.Switch(c, tty, status, fileLock, oldFilename)
+		}
+		redraw, _ := e.GoTo(oldLineIndex, c, status)
+		e.redraw.Store(redraw)
+	})
+
+	return true
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"strings"
+	"unsafe"
 )
 
 // opinionatedStringReplacer is a Replacer that can be used for fixing:
@@ -19,6 +21,19 @@ var opinionatedStringReplacer = strings.NewReplacer(
 	string([]byte{'\r'}), string([]byte{'\n'}),
 )
 
+// opinionatedBytes applies opinionatedStringReplacer to the given data. If there is nothing to replace,
+// which is the common case, the data is returned as it is, so that large files are not copied.
+func opinionatedBytes(data []byte) []byte {
+	if bytes.IndexByte(data, '\r') < 0 && !bytes.Contains(data, []byte{0xc2, 0xa0}) && !bytes.Contains(data, []byte{0xcc, 0x88}) && !bytes.Contains(data, []byte{0xcd, 0xbe}) {
+		return data
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	// The data is only read while it is being replaced, so it can be used as a string without copying it
+	opinionatedStringReplacer.WriteString(&buf, unsafe.String(unsafe.SliceData(data), len(data)))
+	return buf.Bytes()
+}
+
 // pastedTextReplacer normalizes line endings and ambiguous runes in pasted
 // text the same way InsertRune does when typing, so text inserted in bulk (a
 // paste) gets the same treatment as text typed rune by rune. The rune code
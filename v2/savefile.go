@@ -24,14 +24,14 @@ func (e *Editor) binaryBytes() []byte {
 	n := e.Len()
 	total := 0
 	for i := range n {
-		total += len(e.lines[i])
+		total += len(e.lines.Line(i))
 	}
 	if n > 1 {
 		total += n - 1
 	}
 	buf := make([]byte, 0, total)
 	for i := range n {
-		for _, r := range e.lines[i] {
+		for _, r := range e.lines.Line(i) {
 			buf = append(buf, byte(r))
 		}
 		if i < n-1 {
@@ -184,6 +184,11 @@ func (e *Editor) SaveAs(c *vt.Canvas, tty *vt.TTY, filename string) error {
 		// This file should not be considered read-only, since saving went fine
 		e.readOnly = false
 
+		// Save the breakpoints too, since they may have been moved by inserted or deleted lines
+		if len(e.Breakpoints()) > 0 {
+			allBreakpoints().Save(breakpointsFilename) // best effort
+		}
+
 		// TODO: Consider the previous fileMode of the file when doing chmod +x instead of just setting 0755 or 0644
 
 		// "chmod +x" or "chmod -x". This is needed after saving the file, in order to toggle the executable bit.
@@ -51,7 +51,7 @@ const conflictMarker = "<<<<<<< "
 func (e *Editor) FirstConflictMarker() (LineIndex, bool) {
 	prefix := []rune(conflictMarker)
 	for i := range e.Len() {
-		runes, ok := e.lines[i]
+		runes, ok := e.lines.Get(i)
 		if !ok || len(runes) < len(prefix) {
 			continue
 		}
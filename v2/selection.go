@@ -67,7 +67,7 @@ func (s *Selection) Text(e *Editor) string {
 		if y > startY {
 			sb.WriteRune('\n')
 		}
-		runes, ok := e.lines[int(y)]
+		runes, ok := e.lines.Get(int(y))
 		if !ok {
 			continue
 		}
@@ -95,7 +95,7 @@ func (s *Selection) Text(e *Editor) string {
 
 // displayXToDataX converts a display X (tab-expanded column) to a rune index in the given line
 func (e *Editor) displayXToDataX(y LineIndex, displayX int) int {
-	runes, ok := e.lines[int(y)]
+	runes, ok := e.lines.Get(int(y))
 	if !ok {
 		return 0
 	}
@@ -161,21 +161,21 @@ func (e *Editor) DeleteSelection(c *vt.Canvas, status *StatusBar) {
 
 	if startY == endY {
 		// Single-line deletion: remove runes from startDataX to endDataX
-		runes, ok := e.lines[int(startY)]
+		runes, ok := e.lines.Get(int(startY))
 		if ok {
 			newRunes := make([]rune, 0, len(runes))
 			newRunes = append(newRunes, runes[:startDataX]...)
 			if endDataX < len(runes) {
 				newRunes = append(newRunes, runes[endDataX:]...)
 			}
-			e.lines[int(startY)] = newRunes
+			e.lines.Set(int(startY), newRunes)
 		}
 	} else {
 		// Multi-line deletion:
 		// 1. Merge the prefix of startY with the suffix of endY
 		// 2. Delete all lines from startY+1 to endY using DeleteLine (which handles shifting)
-		startRunes := e.lines[int(startY)]
-		endRunes := e.lines[int(endY)]
+		startRunes := e.lines.Line(int(startY))
+		endRunes := e.lines.Line(int(endY))
 
 		var prefix []rune
 		if startDataX <= len(startRunes) {
@@ -189,7 +189,7 @@ func (e *Editor) DeleteSelection(c *vt.Canvas, status *StatusBar) {
 		merged := make([]rune, len(prefix)+len(suffix))
 		copy(merged, prefix)
 		copy(merged[len(prefix):], suffix)
-		e.lines[int(startY)] = merged
+		e.lines.Set(int(startY), merged)
 
 		// Delete lines from endY down to startY+1 (in reverse so indices stay valid)
 		for y := endY; y > startY; y-- {
@@ -203,7 +203,7 @@ func (e *Editor) DeleteSelection(c *vt.Canvas, status *StatusBar) {
 
 	// Clamp the cursor to the (now shorter) line length to prevent the next
 	// Insert from being silently skipped because x > len(line).
-	if runes, ok := e.lines[int(startY)]; ok {
+	if runes, ok := e.lines.Get(int(startY)); ok {
 		if dx := e.pos.sx + e.pos.offsetX; dx > len(runes) {
 			e.pos.SetX(c, len(runes))
 		}
@@ -2,23 +2,40 @@ package main
 
 import (
 	"errors"
+	"os"
 	"sync"
+	"time"
 	"unsafe"
 )
 
-// Undo is a struct that can store several states of the editor and position
+// Undo is a struct that can store several states of the editor and position.
+// Only the lines of the latest state are kept as a whole. For the earlier states, only the
+// lines that differ from the state after them are kept, so that large files use little memory.
 type Undo struct {
 	mut                  *sync.RWMutex
-	redoBuffer           *Undo // if set, cleared when a new snapshot is taken (i.e. a new edit is made)
-	editorCopies         []Editor
-	editorLineCopies     []map[int][]rune
+	redoBuffer           *Undo       // if set, cleared when a new snapshot is taken (i.e. a new edit is made)
+	counterpart          *Undo       // if set, receives the file contents that are overwritten when restoring
+	latestLines          *LineBuffer // the lines of the latest snapshot
+	editorCopies         []Editor    // the editor state of each snapshot, without the lines
+	lineEdits            []lineEdit  // how to get the lines of each snapshot back from the lines of the snapshot after it
 	editorPositionCopies []Position
+	snapshotTimes        []time.Time
+	fileCopies           []map[string][]byte // contents of other files on disk, for edits that span several files
 	index                int
 	count                int
 	maxSize              int
-	maxMemoryUse         uint64 // can be <= 0 to not check for memory use
-	ignoreSnapshots      bool   // used when playing back macros
-	ignoreRedoClear      bool   // used when snapshotting as part of a redo operation
+	maxMemoryUse         uint64    // can be <= 0 to not check for memory use
+	ignoreSnapshots      bool      // used when playing back macros
+	ignoreRedoClear      bool      // used when snapshotting as part of a redo operation
+	groupEdits           bool      // merge consecutive changes to the same line into one snapshot
+	tree                 *UndoTree // if set, every state is also recorded here, so that no branch is lost
+}
+
+// lineEdit replaces n lines, starting at line index y, with the given lines
+type lineEdit struct {
+	lines [][]rune
+	y     int
+	n     int
 }
 
 const (
@@ -26,6 +43,9 @@ const (
 	defaultMaxUndoCount = 512
 	undoGrowthFactor    = 2
 	defaultUndoMemory   = 0 // 32 * 1024 * 1024
+
+	// undoGroupDuration is how close in time changes to the same line must be, to be undone together
+	undoGroupDuration = time.Second
 )
 
 var (
@@ -33,16 +53,43 @@ var (
 	redo = NewUndo(defaultMaxUndoCount, defaultUndoMemory)
 
 	// Circular undo buffer that starts small and grows as needed
-	undo = NewUndo(defaultMaxUndoCount, defaultUndoMemory).WithRedoBuffer(redo)
+	undo = NewUndo(defaultMaxUndoCount, defaultUndoMemory).WithRedoBuffer(redo).WithGrouping().WithTree()
 
 	// Save the contents of one switch.
 	// Used when switching between a .c or .cpp file to the corresponding .h file.
 	switchBuffer = NewUndo(1, defaultUndoMemory)
 
 	// Save a copy of the undo stack when switching between files
-	switchUndoBackup = NewUndo(defaultMaxUndoCount, defaultUndoMemory)
+	switchUndoBackup = NewUndo(defaultMaxUndoCount, defaultUndoMemory).WithGrouping().WithTree()
 )
 
+// diffLines returns the edit that turns the after lines back into the before lines
+func diffLines(before, after *LineBuffer) lineEdit {
+	prefix := before.commonPrefix(after)
+	suffix := before.commonSuffix(after, min(before.Len(), after.Len())-prefix)
+	edit := lineEdit{y: prefix, n: after.Len() - prefix - suffix}
+	for y := prefix; y < before.Len()-suffix; y++ {
+		edit.lines = append(edit.lines, before.Line(y))
+	}
+	return edit
+}
+
+// apply performs the edit on the given lines
+func (le lineEdit) apply(b *LineBuffer) {
+	b.DeleteRange(le.y, le.y+le.n)
+	b.Insert(le.y, le.lines...)
+}
+
+// singleLine returns true if the edit changes just one line, and no lines are added or removed
+func (le lineEdit) singleLine() bool {
+	return le.n == 1 && len(le.lines) == 1
+}
+
+// empty returns true if the edit changes nothing
+func (le lineEdit) empty() bool {
+	return le.n == 0 && len(le.lines) == 0
+}
+
 // NewUndo takes arguments that are only for initializing the undo buffers
 func NewUndo(maxSize int, maxMemoryUse uint64) *Undo {
 	// Start with a small initial size or the max size if it's very small
@@ -51,8 +98,10 @@ func NewUndo(maxSize int, maxMemoryUse uint64) *Undo {
 	return &Undo{
 		mut:                  &sync.RWMutex{},
 		editorCopies:         make([]Editor, initialSize),
-		editorLineCopies:     make([]map[int][]rune, initialSize),
+		lineEdits:            make([]lineEdit, initialSize),
 		editorPositionCopies: make([]Position, initialSize),
+		snapshotTimes:        make([]time.Time, initialSize),
+		fileCopies:           make([]map[string][]byte, initialSize),
 		index:                0,
 		count:                0,
 		maxSize:              maxSize,
@@ -66,12 +115,34 @@ func (u *Undo) IgnoreSnapshots(b bool) {
 	u.ignoreSnapshots = b
 }
 
-// WithRedoBuffer links a redo buffer that will be cleared whenever a new snapshot is taken
+// WithRedoBuffer links a redo buffer that will be cleared whenever a new snapshot is taken.
+// File contents that are overwritten when restoring from one of them are passed on to the other.
 func (u *Undo) WithRedoBuffer(r *Undo) *Undo {
 	u.redoBuffer = r
+	u.counterpart = r
+	r.counterpart = u
+	return u
+}
+
+// WithGrouping makes the undo buffer treat consecutive changes to the same line, like typing
+// a word, as one snapshot, so that they are undone together
+func (u *Undo) WithGrouping() *Undo {
+	u.groupEdits = true
 	return u
 }
 
+// WithTree makes the undo buffer record every state in an undo tree as well, so that the states
+// that are cleared from the redo buffer when making a change after undoing can still be reached
+func (u *Undo) WithTree() *Undo {
+	u.tree = &UndoTree{}
+	return u
+}
+
+// Tree returns the undo tree, or nil if there is none
+func (u *Undo) Tree() *UndoTree {
+	return u.tree
+}
+
 // IgnoreRedoClear is used when snapshotting as part of a redo, to keep the redo buffer intact
 func (u *Undo) IgnoreRedoClear(b bool) {
 	u.ignoreRedoClear = b
@@ -83,21 +154,25 @@ func (u *Undo) Reset() {
 	defer u.mut.Unlock()
 	u.index = 0
 	u.count = 0
-}
-
-func lineMapMemoryFootprint(m map[int][]rune) uint64 {
-	var sum uint64
-	for _, v := range m {
-		sum += uint64(cap(v))
-	}
-	return sum
+	u.latestLines = nil
+	u.tree.Reset()
 }
 
 // MemoryFootprint returns how much memory one Undo struct is using
 func (u *Undo) MemoryFootprint() uint64 {
 	var sum uint64
-	for i := 0; i < len(u.editorLineCopies); i++ {
-		sum += lineMapMemoryFootprint(u.editorLineCopies[i])
+	if u.count > 0 {
+		sum += u.latestLines.MemoryFootprint()
+	}
+	for _, edit := range u.lineEdits {
+		for _, runes := range edit.lines {
+			sum += uint64(cap(runes)) * uint64(unsafe.Sizeof(rune(0)))
+		}
+	}
+	for _, files := range u.fileCopies {
+		for _, data := range files {
+			sum += uint64(cap(data))
+		}
 	}
 	sum += uint64(unsafe.Sizeof(u.index))
 	sum += uint64(unsafe.Sizeof(u.count))
@@ -108,11 +183,51 @@ func (u *Undo) MemoryFootprint() uint64 {
 	sum += uint64(unsafe.Sizeof(u.maxMemoryUse))
 	// Add the actual capacity of the slices
 	sum += uint64(cap(u.editorCopies)) * uint64(unsafe.Sizeof(Editor{}))
-	sum += uint64(cap(u.editorLineCopies)) * uint64(unsafe.Sizeof(map[int][]rune{}))
+	sum += uint64(cap(u.lineEdits)) * uint64(unsafe.Sizeof(lineEdit{}))
 	sum += uint64(cap(u.editorPositionCopies)) * uint64(unsafe.Sizeof(Position{}))
+	sum += uint64(cap(u.snapshotTimes)) * uint64(unsafe.Sizeof(time.Time{}))
+	sum += uint64(cap(u.fileCopies)) * uint64(unsafe.Sizeof(map[string][]byte{}))
 	return sum
 }
 
+// resize moves the most recent snapshots, at most newSize of them, over to new slices of the given size
+func (u *Undo) resize(newSize int) {
+	currentSize := len(u.editorCopies)
+	keepCount := min(u.count, newSize)
+
+	newEditorCopies := make([]Editor, newSize)
+	newLineEdits := make([]lineEdit, newSize)
+	newEditorPositionCopies := make([]Position, newSize)
+	newSnapshotTimes := make([]time.Time, newSize)
+	newFileCopies := make([]map[string][]byte, newSize)
+
+	const withLines = true
+
+	// Copy the most recent entries, oldest first, while handling the circular nature of the buffer
+	for i := range keepCount {
+		srcIndex := u.index - keepCount + i
+		if srcIndex < 0 {
+			srcIndex += currentSize
+		}
+		newEditorCopies[i] = *(u.editorCopies[srcIndex].Copy(withLines))
+		newLineEdits[i] = u.lineEdits[srcIndex]
+		newEditorPositionCopies[i] = u.editorPositionCopies[srcIndex]
+		newSnapshotTimes[i] = u.snapshotTimes[srcIndex]
+		newFileCopies[i] = u.fileCopies[srcIndex]
+	}
+
+	// Replace the slices
+	u.editorCopies = newEditorCopies
+	u.lineEdits = newLineEdits
+	u.editorPositionCopies = newEditorPositionCopies
+	u.snapshotTimes = newSnapshotTimes
+	u.fileCopies = newFileCopies
+
+	// Point to the next free slot
+	u.index = keepCount % newSize
+	u.count = keepCount
+}
+
 // grow expands the circular buffer when more space is needed
 func (u *Undo) grow() {
 	currentSize := len(u.editorCopies)
@@ -123,47 +238,65 @@ func (u *Undo) grow() {
 		return
 	}
 
-	// Create new slices with larger capacity
-	newEditorCopies := make([]Editor, newSize)
-	newEditorLineCopies := make([]map[int][]rune, newSize)
-	newEditorPositionCopies := make([]Position, newSize)
-
-	// Copy existing data to new slices
-	// Handle the circular nature of the buffer
-	if u.count > 0 {
-		// Find the oldest entry in the circular buffer
-		oldestIndex := u.index - u.count
-		if oldestIndex < 0 {
-			oldestIndex += currentSize
-		}
-
-		const withLines = true
+	u.resize(newSize)
+}
 
-		copied := 0
-		for i := 0; i < u.count; i++ {
-			srcIndex := (oldestIndex + i) % currentSize
-			newEditorCopies[copied] = *(u.editorCopies[srcIndex].Copy(withLines))
-			newEditorLineCopies[copied] = u.editorLineCopies[srcIndex]
-			newEditorPositionCopies[copied] = u.editorPositionCopies[srcIndex]
-			copied++
-		}
+// latestIndex returns the index of the most recent snapshot in the circular buffer
+func (u *Undo) latestIndex() int {
+	if u.index == 0 {
+		return len(u.editorCopies) - 1
+	}
+	return u.index - 1
+}
 
-		// Reset index to point to the next free slot
-		u.index = u.count
+// dropLatest removes the most recent snapshot, and rebuilds the lines of the one before it
+func (u *Undo) dropLatest() {
+	u.index = u.latestIndex()
+	u.count--
+	if u.count == 0 {
+		u.latestLines = nil
+		return
 	}
+	latest := u.latestIndex()
+	lines := u.latestLines.Clone()
+	u.lineEdits[latest].apply(lines)
+	u.lineEdits[latest] = lineEdit{}
+	u.latestLines = lines
+}
 
-	// Replace the slices
-	u.editorCopies = newEditorCopies
-	u.editorLineCopies = newEditorLineCopies
-	u.editorPositionCopies = newEditorPositionCopies
+// groupsWithPrevious returns true if the latest snapshot, which is followed by the given edit,
+// should be merged with the snapshot before it. This is the case when both are followed by a
+// change to the same line, with little time in between.
+func (u *Undo) groupsWithPrevious(edit lineEdit) bool {
+	if !u.groupEdits || u.ignoreRedoClear || u.count < 2 {
+		return false
+	}
+	latest := u.latestIndex()
+	previous := latest - 1
+	if previous < 0 {
+		previous = len(u.editorCopies) - 1
+	}
+	previousEdit := u.lineEdits[previous]
+	return edit.singleLine() && previousEdit.singleLine() && edit.y == previousEdit.y &&
+		u.fileCopies[latest] == nil && u.fileCopies[previous] == nil &&
+		u.snapshotTimes[latest].Sub(u.snapshotTimes[previous]) < undoGroupDuration
 }
 
 // Snapshot will store a snapshot, and move to the next position in the circular buffer
 func (u *Undo) Snapshot(e *Editor) {
+	u.SnapshotWithFiles(e, nil)
+}
+
+// SnapshotWithFiles stores a snapshot together with the current contents of other files on disk,
+// which are written back when the snapshot is restored. Used for edits that span several files.
+func (u *Undo) SnapshotWithFiles(e *Editor, files map[string][]byte) {
 	if u.ignoreSnapshots {
 		return
 	}
 
+	// The lines before the next edit are also the lines after the previous one
+	u.tree.Record(e)
+
 	// New edits clear the redo buffer, unless this snapshot is part of a redo operation
 	if !u.ignoreRedoClear && u.redoBuffer != nil {
 		u.redoBuffer.Reset()
@@ -172,6 +305,19 @@ func (u *Undo) Snapshot(e *Editor) {
 	u.mut.Lock()
 	defer u.mut.Unlock()
 
+	// Now that the lines after the latest snapshot are known, store only what changed since then
+	if u.count > 0 {
+		latest := u.latestIndex()
+		edit := diffLines(u.latestLines, e.lines)
+		if u.groupsWithPrevious(edit) {
+			// The change before this one was to the same line, so let the snapshot before it cover both
+			u.index = latest
+			u.count--
+		} else {
+			u.lineEdits[latest] = edit
+		}
+	}
+
 	// Check if we need to grow the buffer
 	if u.count >= len(u.editorCopies) && len(u.editorCopies) < u.maxSize {
 		u.grow()
@@ -180,8 +326,14 @@ func (u *Undo) Snapshot(e *Editor) {
 	const withLines = false
 
 	u.editorCopies[u.index] = *(e.Copy(withLines))
-	u.editorLineCopies[u.index] = e.CopyLines()
+	u.lineEdits[u.index] = lineEdit{}
 	u.editorPositionCopies[u.index] = e.pos
+	u.snapshotTimes[u.index] = time.Now()
+	u.fileCopies[u.index] = files
+	u.latestLines = e.CopyLines()
+	if u.latestLines == nil {
+		u.latestLines = NewLineBuffer()
+	}
 
 	// Go forward 1 step in the circular buffer
 	u.index++
@@ -204,62 +356,111 @@ func (u *Undo) Snapshot(e *Editor) {
 
 // shrinkForMemory reduces the buffer size when memory usage is too high
 func (u *Undo) shrinkForMemory() {
-	newSize := max(len(u.editorCopies)/2, initialUndoSize)
-
-	// Keep only the most recent entries
-	keepCount := min(u.count, newSize)
-
-	newEditorCopies := make([]Editor, newSize)
-	newEditorLineCopies := make([]map[int][]rune, newSize)
-	newEditorPositionCopies := make([]Position, newSize)
-
-	const withLines = true
-
-	// Copy the most recent entries
-	for i := range keepCount {
-		srcIndex := u.index - keepCount + i
-		if srcIndex < 0 {
-			srcIndex += len(u.editorCopies)
-		}
-
-		newEditorCopies[i] = *(u.editorCopies[srcIndex].Copy(withLines))
-		newEditorLineCopies[i] = u.editorLineCopies[srcIndex]
-		newEditorPositionCopies[i] = u.editorPositionCopies[srcIndex]
-	}
-
-	// Update the undo struct
-	u.editorCopies = newEditorCopies
-	u.editorLineCopies = newEditorLineCopies
-	u.editorPositionCopies = newEditorPositionCopies
-	u.index = keepCount % newSize
-	u.count = keepCount
+	u.resize(max(len(u.editorCopies)/2, initialUndoSize))
 }
 
 // Restore will restore a previous snapshot, and move to the previous position in the circular buffer
 func (u *Undo) Restore(e *Editor) error {
+	u.tree.Record(e)
+
 	u.mut.Lock()
 	defer u.mut.Unlock()
 
 	if u.count == 0 {
 		return errors.New("no undo state available")
 	}
+	if u.latestLines == nil {
+		return errors.New("no undo state at this index")
+	}
 
-	// Go back 1 step in the circular buffer
-	u.index--
-	if u.index < 0 {
-		u.index = len(u.editorCopies) - 1
+	// If the latest change is part of a group, restore the snapshot from before the group
+	if u.groupsWithPrevious(diffLines(u.latestLines, e.lines)) {
+		u.dropLatest()
 	}
 
-	// Decrease count since we're moving backwards
-	u.count--
+	// Restore the state from the latest snapshot, then go back 1 step in the circular buffer
+	latest := u.latestIndex()
+	snapshot := &u.editorCopies[latest] // not cleared by dropLatest
+	lines := u.latestLines.Clone()
+	pos := u.editorPositionCopies[latest]
+	files := u.fileCopies[latest]
+	u.fileCopies[latest] = nil
+	u.dropLatest()
+
+	before, key := e.lines, e.breakpointKey()
+	e.RestoreFrom(snapshot, lines, pos)
+	if e.breakpointKey() == key {
+		// Move the breakpoints back along with the lines, unless this is a snapshot of another file
+		e.moveBreakpoints(before)
+	}
+	u.tree.Sync(e)
+	return u.restoreFiles(files)
+}
 
-	// Restore the state from this index
-	if lines := u.editorLineCopies[u.index]; lines != nil {
-		e.RestoreFrom(&u.editorCopies[u.index], lines, u.editorPositionCopies[u.index])
+// restoreFiles writes the given file contents back to disk. The contents that are overwritten
+// are added to the latest snapshot of the counterpart buffer, so that undo and redo both work.
+func (u *Undo) restoreFiles(files map[string][]byte) error {
+	if len(files) == 0 {
 		return nil
 	}
+	var (
+		overwritten = make(map[string][]byte, len(files))
+		errs        []error
+	)
+	for path, data := range files {
+		perm := os.FileMode(0o644)
+		if fi, err := os.Stat(path); err == nil {
+			perm = fi.Mode().Perm()
+		}
+		if current, err := os.ReadFile(path); err == nil {
+			overwritten[path] = current
+		}
+		if err := os.WriteFile(path, data, perm); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if u.counterpart != nil {
+		u.counterpart.addFilesToLatest(overwritten)
+	}
+	return errors.Join(errs...)
+}
+
+// addFilesToLatest adds file contents to the most recent snapshot
+func (u *Undo) addFilesToLatest(files map[string][]byte) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	if u.count == 0 || len(files) == 0 {
+		return
+	}
+	latestIndex := u.index - 1
+	if latestIndex < 0 {
+		latestIndex = len(u.editorCopies) - 1
+	}
+	if u.fileCopies[latestIndex] == nil {
+		u.fileCopies[latestIndex] = make(map[string][]byte, len(files))
+	}
+	for path, data := range files {
+		u.fileCopies[latestIndex][path] = data
+	}
+}
 
-	return errors.New("no undo state at this index")
+// addMissingFilesToLatest adds file contents to the most recent snapshot, for files that it
+// does not already hold the contents of
+func (u *Undo) addMissingFilesToLatest(files map[string][]byte) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	if u.count == 0 || len(files) == 0 {
+		return
+	}
+	latest := u.latestIndex()
+	if u.fileCopies[latest] == nil {
+		u.fileCopies[latest] = make(map[string][]byte, len(files))
+	}
+	for path, data := range files {
+		if _, found := u.fileCopies[latest][path]; !found {
+			u.fileCopies[latest][path] = data
+		}
+	}
 }
 
 // Len will return the current number of stored undo snapshots
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestUndoRestoresEachState makes several kinds of changes, with a snapshot before each one,
+// and checks that restoring goes back through every state in order
+func TestUndoRestoresEachState(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("a\nb\nc\nd\n"))
+	u := NewUndo(64, 0)
+
+	var states []string
+	change := func(f func()) {
+		states = append(states, e.String())
+		u.Snapshot(e)
+		f()
+	}
+	change(func() { e.SetLine(1, "B") })
+	change(func() { e.InsertLineBelowAt(0) })
+	change(func() { e.DeleteLine(3) })
+	change(func() { e.SetLine(0, "A") })
+	change(func() { e.LoadBytes([]byte("x\n")) })
+
+	for i := len(states) - 1; i >= 0; i-- {
+		if err := u.Restore(e); err != nil {
+			t.Fatalf("Restore: %v", err)
+		}
+		if got := e.String(); got != states[i] {
+			t.Errorf("state %d: got %q, want %q", i, got, states[i])
+		}
+	}
+	if err := u.Restore(e); err == nil {
+		t.Errorf("expected an error when there is nothing more to restore")
+	}
+}
+
+// TestUndoGroupsTyping checks that typing on one line is undone in one go, when grouping is enabled
+func TestUndoGroupsTyping(t *testing.T) {
+	for _, grouping := range []bool{false, true} {
+		e := NewSimpleEditor(80)
+		e.LoadBytes([]byte("first\n"))
+		u := NewUndo(64, 0)
+		if grouping {
+			u.WithGrouping()
+		}
+		// Start a new line, then type a word on it
+		u.Snapshot(e)
+		e.InsertLineBelowAt(0)
+		for i := range 3 {
+			u.Snapshot(e)
+			e.SetLine(1, "abc"[:i+1])
+		}
+		if err := u.Restore(e); err != nil {
+			t.Fatalf("Restore: %v", err)
+		}
+		want := "first\nab\n"
+		if grouping {
+			want = "first\n\n"
+		}
+		if got := e.String(); got != want {
+			t.Errorf("grouping %v: got %q, want %q", grouping, got, want)
+		}
+	}
+}
+
+// TestUndoStoresChangedLinesOnly checks that snapshots of a large document only keep what changed
+func TestUndoStoresChangedLinesOnly(t *testing.T) {
+	var sb strings.Builder
+	for i := range 20 * lineChunkSize {
+		fmt.Fprintf(&sb, "line number %d\n", i)
+	}
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte(sb.String()))
+	u := NewUndo(defaultMaxUndoCount, 0)
+	for i := range 100 {
+		u.Snapshot(e)
+		e.SetLine(LineIndex(i*100), "changed")
+	}
+	// The older snapshots each keep one line, while the latest one shares most of its lines with the editor
+	if used, whole := u.MemoryFootprint(), e.lines.MemoryFootprint(); used > 2*whole {
+		t.Errorf("100 snapshots use %d bytes, while the lines use %d bytes", used, whole)
+	}
+	for range 100 {
+		if err := u.Restore(e); err != nil {
+			t.Fatalf("Restore: %v", err)
+		}
+	}
+	if got := e.String(); got != sb.String() {
+		t.Errorf("the document was not restored")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xyproto/mode"
+)
+
+// savedSnapshot is an undo snapshot, as it is stored in the undo history file.
+// Only the lines and the cursor position are stored, not the rest of the editor state.
+type savedSnapshot struct {
+	Lines   [][]rune // the edit that turns the lines of the next snapshot into the lines of this one
+	Y       int
+	N       int
+	SX      int
+	SY      int
+	OffsetX int
+	OffsetY int
+	Time    int64 // when the snapshot was taken, in nanoseconds since the Unix epoch
+}
+
+// savedUndoHistory is the undo and redo history of one file, as it is stored in the cache directory
+type savedUndoHistory struct {
+	Filename string          // the absolute filename
+	Hash     string          // the SHA-256 of the contents that the history leads up to
+	Undo     []savedSnapshot // oldest first. The edit of the latest snapshot turns those contents into its lines.
+	Redo     []savedSnapshot
+}
+
+// undoHistoryPath returns where the undo history of the given absolute filename is stored
+func undoHistoryPath(absFilename string) string {
+	h := fnv.New64a()
+	h.Write([]byte(absFilename))
+	return filepath.Join(undoHistoryDir, strconv.FormatUint(h.Sum64(), 16)+".gob.gz")
+}
+
+// contentHash returns the SHA-256 of the lines, each followed by a newline, as a hex string.
+// Lines that have not been decoded are hashed directly from the data they were loaded from, if that
+// data is valid UTF-8, since decoding and encoding the runes again would then give the same bytes.
+func (b *LineBuffer) contentHash() string {
+	var (
+		h   = sha256.New()
+		buf []byte
+	)
+	for _, ch := range b.chunks {
+		if ch.offsets != nil && !b.binary && ch.len() > 0 {
+			// The lines of the chunk follow each other in the data, and all but the last line of the data end with a newline
+			if data := b.data[ch.offsets[0] : ch.offsets[ch.len()]-1]; utf8.Valid(data) {
+				h.Write(data)
+				h.Write([]byte{'\n'})
+				continue
+			}
+		}
+		for j := range ch.len() {
+			var runes []rune
+			if ch.offsets != nil {
+				runes = b.decode(ch.offsets[j], ch.offsets[j+1])
+			} else {
+				runes = ch.lines[j]
+			}
+			buf = buf[:0]
+			for _, r := range runes {
+				buf = utf8.AppendRune(buf, r)
+			}
+			buf = append(buf, '\n')
+			h.Write(buf)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// export returns the stored snapshots, oldest first. The edit of the latest snapshot turns the
+// given lines into the lines of that snapshot. Files on disk that are part of a snapshot are left out.
+func (u *Undo) export(current *LineBuffer) []savedSnapshot {
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+	snapshots := make([]savedSnapshot, 0, u.count)
+	for i := range u.count {
+		index := u.index - u.count + i
+		if index < 0 {
+			index += len(u.editorCopies)
+		}
+		edit := u.lineEdits[index]
+		if i == u.count-1 {
+			edit = diffLines(u.latestLines, current)
+		}
+		pos := u.editorPositionCopies[index]
+		snapshots = append(snapshots, savedSnapshot{
+			Lines:   edit.lines,
+			Y:       edit.y,
+			N:       edit.n,
+			SX:      pos.sx,
+			SY:      pos.sy,
+			OffsetX: pos.offsetX,
+			OffsetY: pos.offsetY,
+			Time:    u.snapshotTimes[index].UnixNano(),
+		})
+	}
+	return snapshots
+}
+
+// load replaces the stored snapshots with the given ones, oldest first, for the given editor.
+// The edit of the latest snapshot must turn the lines of the editor into the lines of that snapshot.
+func (u *Undo) load(e *Editor, snapshots []savedSnapshot) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	// Keep only the newest snapshots, if there are too many
+	if len(snapshots) > u.maxSize {
+		snapshots = snapshots[len(snapshots)-u.maxSize:]
+	}
+	u.index, u.count, u.latestLines = 0, 0, nil
+	if len(snapshots) > len(u.editorCopies) {
+		u.resize(len(snapshots))
+	}
+	if len(snapshots) == 0 {
+		return
+	}
+
+	const withLines = false
+
+	for i, snapshot := range snapshots {
+		u.editorCopies[i] = *(e.Copy(withLines))
+		u.lineEdits[i] = lineEdit{lines: snapshot.Lines, y: snapshot.Y, n: snapshot.N}
+		pos := e.pos
+		pos.sx, pos.sy, pos.offsetX, pos.offsetY = snapshot.SX, snapshot.SY, snapshot.OffsetX, snapshot.OffsetY
+		u.editorPositionCopies[i] = pos
+		u.snapshotTimes[i] = time.Unix(0, snapshot.Time)
+		u.fileCopies[i] = nil
+	}
+	latest := len(snapshots) - 1
+	lines := e.lines.Clone()
+	u.lineEdits[latest].apply(lines)
+	u.lineEdits[latest] = lineEdit{}
+	u.latestLines = lines
+	u.count = len(snapshots)
+	u.index = u.count % len(u.editorCopies)
+}
+
+// SaveUndoHistory saves the undo and redo history to the cache directory, together with a hash
+// of the current contents, so that the history can be restored when the file is opened again
+func (e *Editor) SaveUndoHistory(absFilename string) error {
+	if noWriteToCache || !filepath.IsAbs(absFilename) || !ShouldKeep(absFilename) || e.mode == mode.ManPage {
+		return nil
+	}
+	path := undoHistoryPath(absFilename)
+	history := savedUndoHistory{
+		Filename: absFilename,
+		Undo:     undo.export(e.lines),
+		Redo:     redo.export(e.lines),
+	}
+	if len(history.Undo) == 0 && len(history.Redo) == 0 {
+		// Remove the history from earlier, since it does not lead up to the current contents
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	history.Hash = e.lines.contentHash()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(history); err != nil {
+		return err
+	}
+	data, err := gZipData(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(undoHistoryDir, 0o755) // best effort
+	return os.WriteFile(path, data, 0o600)
+}
+
+// LoadUndoHistory restores the undo and redo history of the given file from the cache directory,
+// but only if the contents are the same as when the history was saved
+func (e *Editor) LoadUndoHistory(absFilename string) error {
+	data, err := os.ReadFile(undoHistoryPath(absFilename))
+	if err != nil {
+		return err
+	}
+	if data, err = gUnzipData(data); err != nil {
+		return err
+	}
+	var history savedUndoHistory
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&history); err != nil {
+		return err
+	}
+	if history.Filename != absFilename {
+		return errors.New("the undo history is for another file")
+	}
+	if history.Hash != e.lines.contentHash() {
+		return errors.New("the file has been changed since the undo history was saved")
+	}
+	undo.load(e, history.Undo)
+	redo.load(e, history.Redo)
+	return nil
+}
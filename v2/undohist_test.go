@@ -0,0 +1,99 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestUndoHistoryRoundTrip saves the undo history, clears it, and checks that it can be loaded
+// again for the same contents, but not for changed contents
+func TestUndoHistoryRoundTrip(t *testing.T) {
+	oldDir, oldUndo, oldRedo := undoHistoryDir, undo, redo
+	defer func() {
+		undoHistoryDir, undo, redo = oldDir, oldUndo, oldRedo
+	}()
+	undoHistoryDir = t.TempDir()
+	redo = NewUndo(defaultMaxUndoCount, defaultUndoMemory)
+	undo = NewUndo(defaultMaxUndoCount, defaultUndoMemory).WithRedoBuffer(redo)
+	absFilename := filepath.Join(t.TempDir(), "main.go")
+
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("package main\n\nfunc main() {\n}\n"))
+	undo.Snapshot(e)
+	e.SetLine(3, "\tprintln(\"hi\")")
+	e.InsertLineBelowAt(3)
+	e.SetLine(4, "}")
+	undo.Snapshot(e)
+	e.DeleteLine(1)
+	// Undo the last change, so that there is something to redo as well
+	redo.Snapshot(e)
+	if err := undo.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	contents := e.String()
+
+	if err := e.SaveUndoHistory(absFilename); err != nil {
+		t.Fatalf("SaveUndoHistory: %v", err)
+	}
+	undo.Reset()
+	redo.Reset()
+
+	// Loading the history for changed contents must fail
+	changed := NewSimpleEditor(80)
+	changed.LoadBytes([]byte(contents + "// changed\n"))
+	if err := changed.LoadUndoHistory(absFilename); err == nil {
+		t.Errorf("expected the undo history to be discarded for changed contents")
+	}
+	if undo.Len() != 0 {
+		t.Errorf("expected no undo history, got %d snapshots", undo.Len())
+	}
+
+	e2 := NewSimpleEditor(80)
+	e2.LoadBytes([]byte(contents))
+	if err := e2.LoadUndoHistory(absFilename); err != nil {
+		t.Fatalf("LoadUndoHistory: %v", err)
+	}
+	if undo.Len() != 1 || redo.Len() != 1 {
+		t.Fatalf("got %d undo and %d redo snapshots, want 1 and 1", undo.Len(), redo.Len())
+	}
+	if err := redo.Restore(e2); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e2.String(), "package main\nfunc main() {\n\tprintln(\"hi\")\n}\n"; got != want {
+		t.Errorf("after redo: got %q, want %q", got, want)
+	}
+	if err := undo.Restore(e2); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e2.String(), "package main\n\nfunc main() {\n}\n"; got != want {
+		t.Errorf("after undo: got %q, want %q", got, want)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	data := []byte("a\næ\n\nlast")
+	loaded := NewLineBufferFromBytes(data, false)
+	decoded := NewLineBufferFromLines([][]rune{[]rune("a"), []rune("æ"), {}, []rune("last")})
+	if loaded.contentHash() != decoded.contentHash() {
+		t.Error("expected the same hash for undecoded and decoded lines")
+	}
+	// Changing a line decodes the lines of its chunk
+	loaded.Set(1, []rune("b"))
+	decoded.Set(1, []rune("b"))
+	if loaded.contentHash() != decoded.contentHash() {
+		t.Error("expected the same hash after changing a line")
+	}
+	// Invalid UTF-8 is hashed the same way, whether the lines have been decoded or not
+	invalid := []byte("a\xff\nb\nc")
+	invalidLoaded := NewLineBufferFromBytes(invalid, false)
+	invalidDecoded := NewLineBufferFromBytes(invalid, false)
+	invalidDecoded.Set(2, []rune("c"))
+	if invalidLoaded.contentHash() != invalidDecoded.contentHash() {
+		t.Error("expected the same hash for undecoded and decoded lines with invalid UTF-8")
+	}
+	binaryLoaded := NewLineBufferFromBytes([]byte{'a', 0xff, '\n', 'b'}, true)
+	binaryDecoded := NewLineBufferFromLines([][]rune{{'a', 0xff}, {'b'}})
+	if binaryLoaded.contentHash() != binaryDecoded.contentHash() {
+		t.Error("expected the same hash for undecoded and decoded binary lines")
+	}
+}
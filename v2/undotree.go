@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// UndoTree keeps every state of the document in this session, also the ones that the linear undo
+// and redo buffers forget when a change is made after undoing. Each state is a node that only
+// stores how to get to and from the state before it, so that large files use little memory.
+type UndoTree struct {
+	mut          sync.Mutex
+	root         *undoNode
+	current      *undoNode   // the node that matches the lines in the editor
+	currentLines *LineBuffer // the lines of the current node
+	count        int         // the number of nodes, used for numbering them
+}
+
+// undoNode is one state of the document in an UndoTree
+type undoNode struct {
+	parent     *undoNode
+	children   []*undoNode // oldest first
+	toParent   lineEdit    // turns the lines of this node into the lines of the parent
+	fromParent lineEdit    // turns the lines of the parent into the lines of this node
+	time       time.Time   // when the state was recorded
+	pos        Position
+	number     int
+}
+
+// undoTreeSearchLimit is how many nodes are visited when looking for the state that an undo or redo went to
+const undoTreeSearchLimit = 256
+
+// Reset removes all states
+func (t *UndoTree) Reset() {
+	if t == nil {
+		return
+	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.root, t.current, t.currentLines, t.count = nil, nil, nil, 0
+}
+
+// Len returns the number of states in the tree
+func (t *UndoTree) Len() int {
+	if t == nil {
+		return 0
+	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.count
+}
+
+// addChild adds the given lines as a new child of the current node, and makes it the current node
+func (t *UndoTree) addChild(lines *LineBuffer, pos Position, now time.Time) {
+	node := &undoNode{time: now, pos: pos, number: t.count}
+	t.count++
+	if t.current == nil {
+		t.root = node
+	} else {
+		node.parent = t.current
+		node.toParent = diffLines(t.currentLines, lines)
+		node.fromParent = diffLines(lines, t.currentLines)
+		t.current.children = append(t.current.children, node)
+	}
+	t.current = node
+	t.currentLines = lines.Clone()
+}
+
+// groupsWithCurrent returns true if the given edit, which turns the current lines into new ones,
+// continues a change to the same line that the current node was made with, like typing a word
+func (t *UndoTree) groupsWithCurrent(edit lineEdit, now time.Time) bool {
+	n := t.current
+	return n.parent != nil && len(n.children) == 0 && edit.singleLine() && n.fromParent.singleLine() &&
+		edit.y == n.fromParent.y && now.Sub(n.time) < undoGroupDuration
+}
+
+// Record adds the lines of the editor as a new state after the current one, unless they are unchanged.
+// Consecutive changes to the same line are recorded as one state.
+func (t *UndoTree) Record(e *Editor) {
+	if t == nil || e.lines == nil {
+		return
+	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	now := time.Now()
+	if t.current == nil {
+		t.addChild(e.lines, e.pos, now)
+		return
+	}
+	edit := diffLines(e.lines, t.currentLines)
+	if edit.empty() {
+		return
+	}
+	if t.groupsWithCurrent(edit, now) {
+		// Let the current node cover this change too
+		parentLines := t.currentLines.Clone()
+		t.current.toParent.apply(parentLines)
+		t.current.toParent = diffLines(parentLines, e.lines)
+		t.current.fromParent = diffLines(e.lines, parentLines)
+		t.current.time = now
+		t.currentLines = e.lines.Clone()
+		return
+	}
+	t.addChild(e.lines, e.pos, now)
+}
+
+// Sync makes the node that matches the lines of the editor the current one, after an undo or a redo.
+// The nodes close to the current one are searched. If none of them match, a new node is added.
+func (t *UndoTree) Sync(e *Editor) {
+	if t == nil || e.lines == nil {
+		return
+	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.current == nil {
+		t.addChild(e.lines, e.pos, time.Now())
+		return
+	}
+	type visit struct {
+		node  *undoNode
+		lines *LineBuffer
+	}
+	var (
+		queue = []visit{{t.current, t.currentLines}}
+		seen  = map[*undoNode]bool{t.current: true}
+	)
+	for len(queue) > 0 && len(seen) <= undoTreeSearchLimit {
+		v := queue[0]
+		queue = queue[1:]
+		if diffLines(e.lines, v.lines).empty() {
+			t.current = v.node
+			t.currentLines = e.lines.Clone()
+			return
+		}
+		if p := v.node.parent; p != nil && !seen[p] {
+			seen[p] = true
+			lines := v.lines.Clone()
+			v.node.toParent.apply(lines)
+			queue = append(queue, visit{p, lines})
+		}
+		for _, child := range v.node.children {
+			if !seen[child] {
+				seen[child] = true
+				lines := v.lines.Clone()
+				child.fromParent.apply(lines)
+				queue = append(queue, visit{child, lines})
+			}
+		}
+	}
+	t.addChild(e.lines, e.pos, time.Now())
+}
+
+// linesAt returns the lines of the given node, by going from the current node up to the
+// closest common ancestor, and then down to the given node
+func (t *UndoTree) linesAt(node *undoNode) *LineBuffer {
+	ancestors := make(map[*undoNode]bool)
+	for n := t.current; n != nil; n = n.parent {
+		ancestors[n] = true
+	}
+	var down []*undoNode
+	common := node
+	for !ancestors[common] {
+		down = append(down, common)
+		common = common.parent
+	}
+	lines := t.currentLines.Clone()
+	for n := t.current; n != common; n = n.parent {
+		n.toParent.apply(lines)
+	}
+	for i := len(down) - 1; i >= 0; i-- {
+		down[i].fromParent.apply(lines)
+	}
+	return lines
+}
+
+// nodes returns all nodes in the order they are listed in the undo tree browser, together with how
+// far each one is indented. Children continue at the same indentation as their parent, while earlier
+// branches are indented further and listed before the newest one.
+func (t *UndoTree) nodes() ([]*undoNode, []int) {
+	var (
+		nodes  []*undoNode
+		depths []int
+		walk   func(n *undoNode, depth int)
+	)
+	walk = func(n *undoNode, depth int) {
+		for n != nil {
+			nodes = append(nodes, n)
+			depths = append(depths, depth)
+			if len(n.children) == 0 {
+				return
+			}
+			for _, branch := range n.children[:len(n.children)-1] {
+				walk(branch, depth+1)
+			}
+			n = n.children[len(n.children)-1]
+		}
+	}
+	walk(t.root, 0)
+	return nodes, depths
+}
+
+// describe returns a short description of the change that led to this node
+func (n *undoNode) describe() string {
+	if n.parent == nil {
+		return "the first state"
+	}
+	edit := n.fromParent
+	added, removed := len(edit.lines), edit.n
+	switch {
+	case added == removed && added == 1:
+		return fmt.Sprintf("changed line %d", edit.y+1)
+	case added == removed:
+		return fmt.Sprintf("changed lines %d-%d", edit.y+1, edit.y+added)
+	case removed == 0:
+		return fmt.Sprintf("added %d line(s) at line %d", added, edit.y+1)
+	case added == 0:
+		return fmt.Sprintf("removed %d line(s) at line %d", removed, edit.y+1)
+	}
+	return fmt.Sprintf("replaced %d line(s) with %d at line %d", removed, added, edit.y+1)
+}
+
+// undoTreeItems returns one line of text per node, for the undo tree browser
+func undoTreeItems(nodes []*undoNode, depths []int, current *undoNode, now time.Time) []string {
+	items := make([]string, len(nodes))
+	for i, n := range nodes {
+		marker := "  "
+		if n == current {
+			marker = "> "
+		}
+		indent := strings.Repeat("| ", depths[i])
+		items[i] = fmt.Sprintf("%s%s#%d %s (%s ago) %s", marker, indent, n.number, n.time.Format("15:04:05"), durationAgo(now.Sub(n.time)), n.describe())
+	}
+	return items
+}
+
+// durationAgo returns a short description of a duration, like "5s" or "3m"
+func durationAgo(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh", int(d.Hours()))
+}
+
+// undoTreePreview returns the lines of a diff that shows how the current lines would change
+// when jumping to the other lines, with up to the given number of lines
+func undoTreePreview(current, other *LineBuffer, height int) []string {
+	edit := diffLines(other, current)
+	if edit.empty() {
+		return []string{"No changes compared to the current contents."}
+	}
+	preview := []string{fmt.Sprintf("@@ line %d @@", edit.y+1)}
+	for y := edit.y; y < edit.y+edit.n && len(preview) < height; y++ {
+		preview = append(preview, "-"+string(current.Line(y)))
+	}
+	for _, runes := range edit.lines {
+		if len(preview) >= height {
+			break
+		}
+		preview = append(preview, "+"+string(runes))
+	}
+	return preview
+}
+
+// JumpToUndoState replaces the lines of the editor with the lines of the given node in the undo tree.
+// An undo snapshot is taken first, so that the jump itself can be undone.
+func (e *Editor) JumpToUndoState(undo *Undo, node *undoNode) {
+	undo.Snapshot(e)
+	t := undo.Tree()
+	t.mut.Lock()
+	lines := t.linesAt(node)
+	t.current = node
+	t.currentLines = lines.Clone()
+	t.mut.Unlock()
+	before := e.lines
+	e.lines = lines
+	e.moveBreakpoints(before)
+	e.pos = node.pos
+	e.MarkChanged()
+}
+
+// BrowseUndoTree shows every state of the document in this session, including the ones on branches
+// that were left by undoing and then making other changes, together with a diff preview of the selected
+// state. Pressing return replaces the contents with the selected state.
+func (e *Editor) BrowseUndoTree(tty *vt.TTY, c *vt.Canvas, status *StatusBar, undo *Undo) {
+	t := undo.Tree()
+	if t == nil {
+		status.SetMessageAfterRedraw("No undo tree")
+		return
+	}
+	// Make sure that the latest changes are part of the tree
+	t.Record(e)
+	if t.Len() < 2 {
+		status.SetMessageAfterRedraw("Nothing to undo")
+		return
+	}
+
+	t.mut.Lock()
+	nodes, depths := t.nodes()
+	current := t.current
+	items := undoTreeItems(nodes, depths, current, time.Now())
+	t.mut.Unlock()
+
+	// Use 80% of the canvas, with the list to the left and the preview to the right
+	width := int(float64(c.Width())*0.8) - 4
+	height := min(int(float64(c.Height())*0.8)-4, max(len(items), 8))
+	listWidth := width / 2
+
+	canvasBox := NewCanvasBox(c)
+	surroundingBox := NewBox()
+	surroundingBox.FillWithMargins(canvasBox, 5, 2)
+	surroundingBox.W = width + 4
+	surroundingBox.H = height + 4
+	listBox := NewBox()
+	listBox.FillWithMargins(surroundingBox, 2, 2)
+	listBox.W = listWidth
+	previewBox := &Box{listBox.X + listWidth + 2, listBox.Y, width - listWidth - 2, height}
+
+	boxTheme := e.NewBoxTheme()
+	picker := NewListPicker(items, height)
+	for i, n := range nodes {
+		if n == current {
+			picker.Select(i)
+		}
+	}
+
+	const hint = "Press return to go to the selected state, or Esc or q to cancel."
+
+	defer func() {
+		status.ClearAll(c, false)
+		e.redraw.Store(true)
+		e.redrawCursor.Store(true)
+	}()
+
+	for {
+		visible, selected := picker.Visible()
+		lines := make([]string, len(visible))
+		for i, item := range visible {
+			lines[i] = chopRunes(asciiFallback(item), listWidth)
+		}
+		t.mut.Lock()
+		preview := undoTreePreview(t.currentLines, t.linesAt(nodes[picker.Selected()]), height)
+		t.mut.Unlock()
+		for i, line := range preview {
+			preview[i] = chopRunes(asciiFallback(strings.ReplaceAll(line, "\t", "    ")), previewBox.W)
+		}
+		e.DrawBox(boxTheme, c, surroundingBox)
+		e.DrawTitle(boxTheme, c, surroundingBox, "Undo tree", true)
+		e.DrawList(boxTheme, c, listBox, lines, selected)
+		e.DrawList(boxTheme, c, previewBox, preview, -1)
+		status.SetMessage(fmt.Sprintf("%d of %d. %s", picker.Selected()+1, len(items), hint))
+		status.Show(c, e)
+		c.HideCursorAndDraw()
+
+		switch tty.ReadKey() {
+		case upArrow, "k", "c:16": // up, k or ctrl-p
+			picker.Up()
+		case downArrow, "j", "c:14": // down, j or ctrl-n
+			picker.Down()
+		case pgUpKey:
+			picker.PageUp()
+		case pgDnKey, " ": // page down or space
+			picker.PageDown()
+		case homeKey, "c:1": // home or ctrl-a
+			picker.Select(0)
+		case endKey, "c:5": // end or ctrl-e
+			picker.Select(len(items) - 1)
+		case "c:13": // return
+			if node := nodes[picker.Selected()]; node != current {
+				e.JumpToUndoState(undo, node)
+				status.SetMessageAfterRedraw(fmt.Sprintf("Went to state #%d", node.number))
+			}
+			return
+		case "c:17", "c:27", "q": // ctrl-q, esc or q
+			return
+		}
+	}
+}
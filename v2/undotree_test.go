@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+// TestUndoTreeKeepsBranches undoes a change, makes another one, and checks that the state
+// that could no longer be redone can still be reached through the undo tree
+func TestUndoTreeKeepsBranches(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("a\nb\n"))
+	r := NewUndo(64, 0)
+	u := NewUndo(64, 0).WithRedoBuffer(r).WithTree()
+
+	u.Snapshot(e)
+	e.SetLine(0, "first branch")
+	r.Snapshot(e)
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	u.Snapshot(e)
+	e.SetLine(1, "second branch")
+	u.Snapshot(e)
+	if r.Len() != 0 {
+		t.Fatalf("expected the redo buffer to be cleared, got %d snapshots", r.Len())
+	}
+
+	tree := u.Tree()
+	nodes, depths := tree.nodes()
+	if len(nodes) != 3 {
+		t.Fatalf("got %d states, want 3", len(nodes))
+	}
+	if len(nodes[0].children) != 2 {
+		t.Fatalf("expected the first state to have 2 branches, got %d", len(nodes[0].children))
+	}
+	// The older branch is listed first, and indented
+	if depths[1] != 1 || depths[2] != 0 || nodes[2] != tree.current {
+		t.Errorf("unexpected order or indentation: %v", depths)
+	}
+
+	e.JumpToUndoState(u, nodes[1])
+	if got, want := e.String(), "first branch\nb\n"; got != want {
+		t.Errorf("after jumping: got %q, want %q", got, want)
+	}
+	// The jump can be undone
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.String(), "a\nsecond branch\n"; got != want {
+		t.Errorf("after undoing the jump: got %q, want %q", got, want)
+	}
+	if tree.current != nodes[2] {
+		t.Errorf("expected the undo to go back to the second branch in the tree")
+	}
+}
+
+// TestUndoTreeGroupsTyping checks that typing on one line becomes one state
+func TestUndoTreeGroupsTyping(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("\n"))
+	tree := &UndoTree{}
+	for i := range 3 {
+		tree.Record(e)
+		e.SetLine(0, "abc"[:i+1])
+	}
+	tree.Record(e)
+	if tree.Len() != 2 {
+		t.Fatalf("got %d states, want 2", tree.Len())
+	}
+	if got := tree.root.children[0].describe(); got != "changed line 1" {
+		t.Errorf("got %q", got)
+	}
+	if got := tree.linesAt(tree.root); got.Len() != 1 || len(got.Line(0)) != 0 {
+		t.Errorf("expected the first state to be one empty line, got %q", lineBufferStrings(got))
+	}
+}